@@ -0,0 +1,63 @@
+// Command mocktesla runs the mock Tesla auth server and Fleet API for local development.
+// mocktesla 在本地启动模拟的特斯拉鉴权服务与 Fleet API，便于离线开发。
+package main
+
+import (
+	"flag"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"tds_server/internal/mocktesla"
+
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:4443", "listen address")
+	baseURL := flag.String("base-url", "", "public URL of the mock, defaults to http://<addr>")
+	vehicles := flag.Int("vehicles", 2, "number of vehicles to create")
+	asleep := flag.Bool("asleep", false, "start every vehicle asleep")
+	wakeDelay := flag.Duration("wake-delay", 3*time.Second, "time an asleep vehicle takes to come online after wake_up")
+	tokenTTL := flag.Duration("token-ttl", 8*time.Hour, "lifetime of issued access tokens")
+	strict := flag.Bool("strict-auth", false, "reject bearer and refresh tokens the mock did not issue")
+	pairedKey := flag.String("paired-key", "", "PEM public key to pair with every vehicle; when empty signed commands from any key are accepted")
+	flag.Parse()
+
+	if *baseURL == "" {
+		*baseURL = "http://" + *addr
+	}
+	opts := []mocktesla.Option{
+		mocktesla.WithBaseURL(*baseURL),
+		mocktesla.WithWakeDelay(*wakeDelay),
+		mocktesla.WithTokenTTL(*tokenTTL),
+	}
+	if *strict {
+		opts = append(opts, mocktesla.WithStrictAuth())
+	}
+	if *pairedKey != "" {
+		publicKey, err := protocol.LoadPublicKey(*pairedKey)
+		if err != nil {
+			slog.Error("load paired key", "error", err)
+			os.Exit(1)
+		}
+		opts = append(opts, mocktesla.WithPairedKey(publicKey.Bytes()))
+	}
+
+	server := mocktesla.New(opts...)
+	for i := 0; i < *vehicles; i++ {
+		v := mocktesla.Vehicle{}
+		if *asleep {
+			v.State = mocktesla.StateAsleep
+		}
+		added := server.AddVehicle(v)
+		slog.Info("mock vehicle created", "vin", added.VIN, "id", added.ID, "state", added.State)
+	}
+
+	slog.Info("mock tesla listening", "address", *addr, "base_url", *baseURL)
+	if err := http.ListenAndServe(*addr, server.Handler()); err != nil {
+		slog.Error("mock tesla stopped", "error", err)
+		os.Exit(1)
+	}
+}
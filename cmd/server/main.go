@@ -1,44 +1,113 @@
 package main
 
 import (
-	"log"
+	"log/slog"
+	"os"
 	"tds_server/internal/config"
 	"tds_server/internal/data"
+	"tds_server/internal/logging"
 	"tds_server/internal/repository"
 	"tds_server/internal/router"
 	"tds_server/internal/service"
+	"tds_server/internal/upstream"
+	"time"
 )
 
 func main() {
 	cfg, err := config.LoadConfig()
 	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
+		fatal("failed to load config", err)
 	}
+	if err := setupLogging(cfg); err != nil {
+		fatal("invalid log configuration", err)
+	}
+	if err := setupUpstream(cfg); err != nil {
+		fatal("invalid tesla recording configuration", err)
+	}
+
 	// 初始化数据库
 	if err := data.InitDB(cfg); err != nil {
-		log.Fatalf("init db error: %v", err)
+		fatal("init db error", err)
 	}
 
 	// 构造repository
 	tokenRepo := repository.NewTokenRepo()
+	privacyRepo := repository.NewPrivacyRepo()
+	commandJobRepo := repository.NewCommandJobRepo()
+
+	// 上次进程未完成的异步指令已无工作协程处理，启动时标记为失败。
+	if failed, err := commandJobRepo.FailUnfinished(cfg.Commands.Instance, "server restarted before the command finished"); err != nil {
+		fatal("recover command jobs error", err)
+	} else if failed > 0 {
+		slog.Warn("marked interrupted command jobs as failed", "count", failed)
+	}
+	commandJobs := service.NewCommandJobService(commandJobRepo, cfg.Commands.Instance, cfg.Commands.Workers, cfg.Commands.QueueSize, cfg.Commands.JobTimeout)
+	commandAudit := service.NewCommandAuditService(repository.NewCommandAuditRepo())
+	idempotency := service.NewIdempotencyService(repository.NewIdempotencyRepo(), cfg.Commands.IdempotencyWindow, 0)
+	go idempotency.PurgeExpired(time.Hour)
+	commandScenes := service.NewCommandSceneService(repository.NewCommandSceneRepo())
+	vehicleGroups := service.NewVehicleGroupService(repository.NewVehicleGroupRepo())
 
 	partnerSvc, err := service.NewPartnerTokenService(cfg)
 	if err != nil {
-		log.Fatalf("init partner token service error: %v", err)
+		fatal("init partner token service error", err)
 	}
 
-	commandSvc, err := service.NewVehicleCommandService(cfg)
-	if err != nil {
-		log.Fatalf("init vehicle command service error: %v", err)
+	// 关闭签名指令时（如对接 mocktesla），所有指令均走 REST 接口。
+	var commandSvc *service.VehicleCommandService
+	if cfg.TeslaSignedCommands {
+		commandSvc, err = service.NewVehicleCommandService(cfg)
+		if err != nil {
+			fatal("init vehicle command service error", err)
+		}
+	} else {
+		slog.Info("signed vehicle commands disabled, using REST commands only")
 	}
 
-	r := router.NewRouter(cfg, tokenRepo, partnerSvc, commandSvc)
+	vehicleDirectory := service.NewVehicleDirectory(cfg.VehicleDirectoryTTL)
+	energySites := service.NewEnergySiteDirectory(cfg.VehicleDirectoryTTL)
+
+	r := router.NewRouter(cfg, tokenRepo, partnerSvc, commandSvc, vehicleDirectory, privacyRepo, commandJobs, commandAudit, idempotency, commandScenes, vehicleGroups, energySites)
 
 	addr := cfg.Server.Address
 
-	log.Printf("Starting server on %s", addr)
+	slog.Info("starting server", "address", addr)
 
 	if err := r.Run(addr); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+		fatal("failed to start server", err)
 	}
 }
+
+// setupLogging 根据 LOG_LEVEL、LOG_FORMAT 与 LOG_LEVELS 初始化结构化日志。
+func setupLogging(cfg *config.Config) error {
+	level, err := logging.ParseLevel(cfg.Log.Level)
+	if err != nil {
+		return err
+	}
+	levels, err := logging.ParseLevels(cfg.Log.Subsystems)
+	if err != nil {
+		return err
+	}
+	logging.Setup(logging.Options{
+		Level:  level,
+		Levels: levels,
+		Format: cfg.Log.Format,
+	})
+	return nil
+}
+
+// setupUpstream 根据 TESLA_RECORD_* 配置开启上游流量的录制或回放。
+func setupUpstream(cfg *config.Config) error {
+	return upstream.Setup(upstream.Options{
+		Mode:     cfg.Record.Mode,
+		Dir:      cfg.Record.Dir,
+		Users:    cfg.Record.Users,
+		Vehicles: cfg.Record.Vehicles,
+		Secret:   cfg.Record.Secret,
+	})
+}
+
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
@@ -0,0 +1,237 @@
+// Package apierror defines the single error envelope returned by every HTTP handler.
+// apierror 定义所有 HTTP 接口统一返回的错误结构。
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"tds_server/internal/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Stable machine-readable error codes. Clients branch on these instead of matching messages.
+// 稳定的机器可读错误码，客户端应依据错误码而非错误信息进行判断。
+const (
+	CodeInvalidRequest     = "invalid_request"
+	CodeUnauthorized       = "unauthorized"
+	CodeTokenRefreshFailed = "token_refresh_failed"
+	CodeForbidden          = "forbidden"
+	CodeNotFound           = "not_found"
+	CodeVehicleNotFound    = "vehicle_not_found"
+	CodeVehicleAmbiguous   = "vehicle_ambiguous"
+	// CodeVehicleListIncomplete means the vehicle list was cut off before the tag could be resolved.
+	CodeVehicleListIncomplete = "vehicle_list_incomplete"
+	CodeMethodNotAllowed      = "method_not_allowed"
+	CodeConflict              = "conflict"
+	// CodeIdempotencyInProgress means a request with the same Idempotency-Key is still executing.
+	CodeIdempotencyInProgress = "idempotency_in_progress"
+	// CodeIdempotencyKeyReused means the Idempotency-Key was already used for a different request.
+	CodeIdempotencyKeyReused = "idempotency_key_reused"
+	CodeVehicleUnavailable   = "vehicle_unavailable"
+	CodeRateLimited          = "rate_limited"
+	// CodeServiceOverloaded means this server cannot take more work right now, e.g. the command queue
+	// is full; unlike rate_limited it is not tied to the caller's quota.
+	CodeServiceOverloaded     = "service_overloaded"
+	CodeCommandNotImplemented = "command_not_implemented"
+	CodeCommandFailed         = "command_failed"
+	CodeUpstreamError         = "upstream_error"
+	CodeUpstreamUnavailable   = "upstream_unavailable"
+	CodeInternal              = "internal_error"
+)
+
+// Error is the unified error envelope. It is serialized under the top-level "error" key.
+type Error struct {
+	// Status is the HTTP status returned to the client.
+	Status int `json:"-"`
+	// Code is a stable machine-readable error code.
+	Code string `json:"code"`
+	// Message is a human-readable description.
+	Message string `json:"message"`
+	// UpstreamStatus is the HTTP status Tesla returned, when the error came from Tesla.
+	UpstreamStatus int `json:"upstream_status,omitempty"`
+	// TeslaError is the "error" field parsed from Tesla's response body.
+	TeslaError string `json:"tesla_error,omitempty"`
+	// TeslaErrorDescription is the "error_description" field parsed from Tesla's response body.
+	TeslaErrorDescription string `json:"tesla_error_description,omitempty"`
+	// RequestID identifies the request in server logs.
+	RequestID string `json:"request_id,omitempty"`
+	// Retryable reports whether repeating the same request later may succeed.
+	Retryable bool `json:"retryable"`
+	// Details carries structured context such as field-level validation errors.
+	Details any `json:"details,omitempty"`
+
+	cause error
+}
+
+type envelope struct {
+	Error *Error `json:"error"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// New creates an error with the given status, code and message.
+func New(status int, code, message string) *Error {
+	return &Error{
+		Status:    status,
+		Code:      code,
+		Message:   message,
+		Retryable: retryableStatus(status),
+	}
+}
+
+// Wrap creates an error with the given status and code whose message comes from err. Tesla details
+// carried by err (for example a failed token refresh) are preserved and decide retryability.
+func Wrap(status int, code string, err error) *Error {
+	apiErr := New(status, code, http.StatusText(status))
+	if err == nil {
+		return apiErr
+	}
+	apiErr.Message = err.Error()
+	apiErr.cause = err
+
+	var upstream *Error
+	if errors.As(err, &upstream) {
+		apiErr.UpstreamStatus = upstream.UpstreamStatus
+		apiErr.TeslaError = upstream.TeslaError
+		apiErr.TeslaErrorDescription = upstream.TeslaErrorDescription
+		apiErr.Retryable = upstream.Retryable
+	}
+	return apiErr
+}
+
+// From converts any error into an *Error. Existing *Error values are returned as-is; other errors
+// get a code derived from status.
+func From(status int, err error) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	if status < http.StatusBadRequest {
+		status = http.StatusInternalServerError
+	}
+	return Wrap(status, CodeForStatus(status), err)
+}
+
+// FromUpstream builds an error from a Tesla error response, parsing Tesla's error and
+// error_description fields out of the JSON body.
+// FromUpstream 根据特斯拉的错误响应构建错误，并解析其中的 error 与 error_description 字段。
+func FromUpstream(status int, body []byte) *Error {
+	apiErr := New(status, CodeForStatus(status), http.StatusText(status))
+	apiErr.UpstreamStatus = status
+
+	var payload struct {
+		Error            json.RawMessage `json:"error"`
+		ErrorDescription string          `json:"error_description"`
+		Message          string          `json:"message"`
+	}
+	trimmed := strings.TrimSpace(string(body))
+	if err := json.Unmarshal(body, &payload); err == nil {
+		var teslaError string
+		if len(payload.Error) > 0 && json.Unmarshal(payload.Error, &teslaError) != nil {
+			// Some endpoints nest the error object; keep its raw form.
+			teslaError = string(payload.Error)
+		}
+		apiErr.TeslaError = teslaError
+		apiErr.TeslaErrorDescription = payload.ErrorDescription
+		switch {
+		case teslaError != "":
+			apiErr.Message = teslaError
+		case payload.Message != "":
+			apiErr.Message = payload.Message
+		}
+	} else if trimmed != "" {
+		apiErr.Message = trimmed
+	}
+
+	// Tesla reports sleeping or offline vehicles with 408 and sometimes with this message on 5xx.
+	if strings.Contains(strings.ToLower(apiErr.TeslaError), "vehicle unavailable") {
+		apiErr.Code = CodeVehicleUnavailable
+		apiErr.Retryable = true
+	}
+	return apiErr
+}
+
+// WithDetails attaches structured details and returns the error for chaining.
+func (e *Error) WithDetails(details any) *Error {
+	e.Details = details
+	return e
+}
+
+// CodeForStatus returns the default code for an HTTP status.
+func CodeForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return CodeInvalidRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusRequestTimeout:
+		return CodeVehicleUnavailable
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	case http.StatusNotImplemented:
+		return CodeCommandNotImplemented
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return CodeUpstreamUnavailable
+	}
+	if status >= http.StatusInternalServerError {
+		return CodeInternal
+	}
+	return CodeUpstreamError
+}
+
+func retryableStatus(status int) bool {
+	switch status {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests,
+		http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// Respond writes err as the unified envelope. Non-*Error values are converted with From(status, err).
+// Respond 以统一结构输出错误，非 *Error 类型会通过 From(status, err) 转换。
+func Respond(c *gin.Context, status int, err error) {
+	apiErr := From(status, err)
+	write(c, apiErr)
+}
+
+// Write writes err as the unified envelope with err.Status, so the status is stated only once.
+// Write 以 err 自带的状态码输出统一错误结构。
+func Write(c *gin.Context, err *Error) {
+	write(c, err)
+}
+
+// Abort writes err as the unified envelope and stops the handler chain.
+func Abort(c *gin.Context, err *Error) {
+	write(c, err)
+	c.Abort()
+}
+
+func write(c *gin.Context, apiErr *Error) {
+	if apiErr.Status == 0 {
+		apiErr.Status = http.StatusInternalServerError
+	}
+	if apiErr.RequestID == "" {
+		apiErr.RequestID = logging.RequestIDFromContext(c.Request.Context())
+	}
+	c.JSON(apiErr.Status, envelope{Error: apiErr})
+}
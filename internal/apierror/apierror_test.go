@@ -0,0 +1,64 @@
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"tds_server/internal/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestFromUpstreamParsesTeslaError(t *testing.T) {
+	body := []byte(`{"response":null,"error":"vehicle unavailable: vehicle is offline or asleep","error_description":""}`)
+	apiErr := FromUpstream(http.StatusRequestTimeout, body)
+
+	if apiErr.Code != CodeVehicleUnavailable || !apiErr.Retryable {
+		t.Fatalf("unexpected code/retryable: %s %v", apiErr.Code, apiErr.Retryable)
+	}
+	if apiErr.UpstreamStatus != http.StatusRequestTimeout {
+		t.Fatalf("upstream status = %d", apiErr.UpstreamStatus)
+	}
+	if apiErr.TeslaError != "vehicle unavailable: vehicle is offline or asleep" {
+		t.Fatalf("tesla error = %q", apiErr.TeslaError)
+	}
+}
+
+func TestWrapKeepsUpstreamDetails(t *testing.T) {
+	upstream := FromUpstream(http.StatusUnauthorized, []byte(`{"error":"invalid_grant","error_description":"refresh_token is invalid"}`))
+	apiErr := Wrap(http.StatusUnauthorized, CodeTokenRefreshFailed, fmt.Errorf("token refresh failed: %w", upstream))
+
+	if apiErr.Code != CodeTokenRefreshFailed || apiErr.TeslaError != "invalid_grant" || apiErr.TeslaErrorDescription != "refresh_token is invalid" {
+		t.Fatalf("unexpected error: %+v", apiErr)
+	}
+	if apiErr.Retryable {
+		t.Fatal("invalid_grant must not be retryable")
+	}
+}
+
+func TestRespondWritesEnvelope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), "req-1"))
+
+	Respond(c, http.StatusServiceUnavailable, errors.New("boom"))
+
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d", recorder.Code)
+	}
+	var payload struct {
+		Error Error `json:"error"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Error.Code != CodeUpstreamUnavailable || payload.Error.RequestID != "req-1" || !payload.Error.Retryable {
+		t.Fatalf("unexpected envelope: %s", recorder.Body.String())
+	}
+}
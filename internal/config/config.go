@@ -1,8 +1,11 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -19,7 +22,15 @@ type Config struct {
 	TeslaPartnerScope    string
 	TeslaPartnerDomain   string
 	TeslaCommandKeyPath  string
-	DB                   struct {
+	// TeslaSignedCommands enables the vehicle-command SDK; when false every command uses the REST API.
+	TeslaSignedCommands bool
+	// TeslaCommandURL overrides where signed commands are sent, e.g. the local mock; empty uses the
+	// Fleet API host named in the user's token.
+	TeslaCommandURL     string
+	VehicleDirectoryTTL time.Duration
+	// V1CommandSunset, when set, is announced in the Sunset header of the deprecated v1 command route.
+	V1CommandSunset time.Time
+	DB              struct {
 		Host     string
 		Port     string
 		User     string
@@ -35,6 +46,47 @@ type Config struct {
 		Issuer     string
 		Expiration time.Duration
 	}
+	Log struct {
+		// Level is the default level: debug, info, warn or error.
+		Level string
+		// Format is json or text.
+		Format string
+		// Subsystems overrides levels per subsystem, e.g. "db=warn,tesla=debug".
+		Subsystems string
+	}
+	// Commands configures asynchronous command execution.
+	Commands struct {
+		// Workers is the number of commands executed concurrently; QueueSize bounds the waiting ones.
+		Workers   int
+		QueueSize int
+		// JobTimeout bounds one asynchronous command, including waking the vehicle.
+		JobTimeout time.Duration
+		// IdempotencyWindow is how long the response to an Idempotency-Key is replayed.
+		IdempotencyWindow time.Duration
+		// VerifyTimeout bounds the polling of vehicle_data for ?verify=true.
+		VerifyTimeout time.Duration
+		// BatchConcurrency is the number of vehicles a synchronous batch commands at once.
+		BatchConcurrency int
+		// Instance names this server process in the jobs it runs; on startup only the unfinished jobs
+		// of the same instance are failed. It must stay the same across restarts.
+		Instance string
+	}
+	// Audit configures the command audit log; see docs/command_audit.md.
+	Audit struct {
+		// AdminUserIDs may query every user's entries and verify the hash chain.
+		AdminUserIDs []string
+	}
+	// Record captures or replays Tesla traffic; see docs/upstream_recording.md.
+	Record struct {
+		// Mode is off, record or replay.
+		Mode string
+		Dir  string
+		// Users and Vehicles narrow recording to these user IDs and VINs / vehicle ids.
+		Users    []string
+		Vehicles []string
+		// Secret keys the request hashes replay matches on; it is never written to recordings.
+		Secret string
+	}
 }
 
 func LoadConfig() (*Config, error) {
@@ -54,6 +106,13 @@ func LoadConfig() (*Config, error) {
 	if cfg.TeslaCommandKeyPath == "" {
 		cfg.TeslaCommandKeyPath = filepath.Join("public", ".well-known", "appspecific", "private-key.pem")
 	}
+	cfg.TeslaSignedCommands = true
+	if signed := os.Getenv("TESLA_SIGNED_COMMANDS"); signed != "" {
+		if enabled, err := strconv.ParseBool(signed); err == nil {
+			cfg.TeslaSignedCommands = enabled
+		}
+	}
+	cfg.TeslaCommandURL = strings.TrimRight(os.Getenv("TESLA_COMMAND_URL"), "/")
 	cfg.TeslaPartnerTokenURL = os.Getenv("TESLA_PARTNER_TOKEN_URL")
 	if cfg.TeslaPartnerTokenURL == "" {
 		cfg.TeslaPartnerTokenURL = "https://auth.tesla.cn/oauth2/v3/token"
@@ -67,6 +126,47 @@ func LoadConfig() (*Config, error) {
 		cfg.TeslaPartnerDomain = "dwdacbj25q.ap-southeast-1.awsapprunner.com"
 	}
 
+	if ttl := os.Getenv("VEHICLE_DIRECTORY_TTL"); ttl != "" {
+		if dur, err := time.ParseDuration(ttl); err == nil {
+			cfg.VehicleDirectoryTTL = dur
+		}
+	}
+	if cfg.VehicleDirectoryTTL == 0 {
+		cfg.VehicleDirectoryTTL = 10 * time.Minute
+	}
+
+	cfg.Commands.Workers, _ = strconv.Atoi(os.Getenv("COMMAND_WORKERS"))
+	cfg.Commands.QueueSize, _ = strconv.Atoi(os.Getenv("COMMAND_QUEUE_SIZE"))
+	cfg.Commands.BatchConcurrency, _ = strconv.Atoi(os.Getenv("COMMAND_BATCH_CONCURRENCY"))
+	cfg.Commands.Instance = os.Getenv("COMMAND_INSTANCE_ID")
+	if cfg.Commands.Instance == "" {
+		cfg.Commands.Instance, _ = os.Hostname()
+	}
+	if ttl := os.Getenv("COMMAND_JOB_TIMEOUT"); ttl != "" {
+		if dur, err := time.ParseDuration(ttl); err == nil {
+			cfg.Commands.JobTimeout = dur
+		}
+	}
+
+	if timeout := os.Getenv("COMMAND_VERIFY_TIMEOUT"); timeout != "" {
+		if dur, err := time.ParseDuration(timeout); err == nil {
+			cfg.Commands.VerifyTimeout = dur
+		}
+	}
+	if window := os.Getenv("IDEMPOTENCY_WINDOW"); window != "" {
+		if dur, err := time.ParseDuration(window); err == nil {
+			cfg.Commands.IdempotencyWindow = dur
+		}
+	}
+
+	if sunset := os.Getenv("API_V1_COMMAND_SUNSET"); sunset != "" {
+		date, err := time.Parse(time.DateOnly, sunset)
+		if err != nil {
+			return nil, fmt.Errorf("API_V1_COMMAND_SUNSET must be a date such as 2027-04-01: %w", err)
+		}
+		cfg.V1CommandSunset = date
+	}
+
 	if cfg.Server.Address == "" {
 		cfg.Server.Address = ":8080"
 	}
@@ -83,6 +183,24 @@ func LoadConfig() (*Config, error) {
 	if cfg.JWT.Expiration == 0 {
 		cfg.JWT.Expiration = 24 * time.Hour
 	}
+	cfg.Log.Level = os.Getenv("LOG_LEVEL")
+	if cfg.Log.Level == "" {
+		cfg.Log.Level = "info"
+	}
+	cfg.Log.Format = os.Getenv("LOG_FORMAT")
+	if cfg.Log.Format == "" {
+		cfg.Log.Format = "json"
+	}
+	cfg.Log.Subsystems = os.Getenv("LOG_LEVELS")
+	cfg.Audit.AdminUserIDs = splitList(os.Getenv("AUDIT_ADMIN_USER_IDS"))
+	cfg.Record.Mode = os.Getenv("TESLA_RECORD_MODE")
+	cfg.Record.Dir = os.Getenv("TESLA_RECORD_DIR")
+	if cfg.Record.Dir == "" {
+		cfg.Record.Dir = "recordings"
+	}
+	cfg.Record.Users = splitList(os.Getenv("TESLA_RECORD_USERS"))
+	cfg.Record.Vehicles = splitList(os.Getenv("TESLA_RECORD_VEHICLES"))
+	cfg.Record.Secret = os.Getenv("TESLA_RECORD_SECRET")
 	cfg.DB.Host = os.Getenv("DB_HOST")
 	cfg.DB.Port = os.Getenv("DB_PORT")
 	if cfg.DB.Port == "" {
@@ -98,6 +216,17 @@ func LoadConfig() (*Config, error) {
 	return cfg, nil
 }
 
+// splitList parses a comma separated environment value, dropping blanks.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 // loadEnv loads environment variables from a .env file. loadEnv 会从 .env 文件加载环境变量。
 // It checks the current working directory first and then walks up the parent directories. 它会先检查当前工作目录，然后逐级向上查找父级目录。
 func loadEnv() {
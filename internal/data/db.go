@@ -2,18 +2,19 @@ package data
 
 import (
 	"fmt"
-	"log"
 	"tds_server/internal/config"
+	"tds_server/internal/logging"
 	"tds_server/internal/model"
 	"time"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
 )
 
 var DB *gorm.DB
 
+var dbLog = logging.Logger(logging.SubsystemDB)
+
 func InitDB(cfg *config.Config) error {
 	// 构建连接字符串。Build the connection string.
 	dsn := fmt.Sprintf(
@@ -22,7 +23,7 @@ func InitDB(cfg *config.Config) error {
 	)
 	var err error
 	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Info),
+		Logger: newGormLogger(dbLog),
 	})
 	if err != nil {
 		return fmt.Errorf("failed to connect to database: %w", err)
@@ -40,10 +41,10 @@ func InitDB(cfg *config.Config) error {
 	sqlDB.SetConnMaxLifetime(time.Hour)
 
 	// 自动迁移（只创建缺失表/列，不删除）。Auto-migrate creates missing tables or columns without dropping existing ones.
-	err = DB.AutoMigrate(&model.UserToken{})
+	err = DB.AutoMigrate(&model.UserToken{}, &model.PrivacySetting{}, &model.CommandJob{}, &model.CommandJobEvent{}, &model.CommandAudit{}, &model.IdempotencyKey{}, &model.CommandScene{}, &model.VehicleGroup{})
 	if err != nil {
 		return fmt.Errorf("failed to auto migrate: %w", err)
 	}
-	log.Println("Database initialization finished")
+	dbLog.Info("database initialization finished")
 	return nil
 }
@@ -6,7 +6,9 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"tds_server/internal/apierror"
 	"tds_server/internal/config"
+	"tds_server/internal/logging"
 	"tds_server/internal/repository"
 	"tds_server/internal/service"
 	"time"
@@ -18,6 +20,8 @@ import (
 	"github.com/google/uuid"
 )
 
+var authLog = logging.Logger(logging.SubsystemAuth)
+
 func LoginRedirect(cfg *config.Config) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		state := c.Query("state")
@@ -30,30 +34,30 @@ func LoginCallback(cfg *config.Config, tokenRepo *repository.TokenRepo) gin.Hand
 	return func(c *gin.Context) {
 		code := c.Query("code")
 		if code == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "authorization code is required"})
+			apierror.Write(c, apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest, "authorization code is required"))
 			return
 		}
 
 		userID, err := resolveUserID(c.Query("state"))
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			apierror.Respond(c, http.StatusBadRequest, err)
 			return
 		}
 
-		teslaTokenRepo, err := service.ExchangeCode(cfg, code)
+		teslaTokenRepo, err := service.ExchangeCode(c.Request.Context(), cfg, code)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			apierror.Write(c, apierror.Wrap(http.StatusBadGateway, apierror.CodeUpstreamError, err))
 			return
 		}
 
 		if saveErr := tokenRepo.Save(userID, teslaTokenRepo.AccessToken, teslaTokenRepo.RefreshToken, time.Duration(teslaTokenRepo.ExpiresIn)); saveErr != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": saveErr.Error()})
+			apierror.Respond(c, http.StatusInternalServerError, saveErr)
 			return
 		}
 
 		jwtToken, err := buildJWT(cfg, userID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			apierror.Respond(c, http.StatusInternalServerError, err)
 			return
 		}
 
@@ -66,14 +70,14 @@ func LoginCallback(cfg *config.Config, tokenRepo *repository.TokenRepo) gin.Hand
 			},
 			TeslaToken: teslaTokenRepo,
 		}
-		fmt.Printf("JWT Token Response: %+v\n", response)
+		authLog.InfoContext(c.Request.Context(), "login completed", "user_id", userID.String(), "jwt_expires_in", response.JWT.ExpiresIn)
 		if prefersJSON(c) {
 			c.JSON(http.StatusOK, response)
 			return
 		}
 
 		if err := renderLoginCallbackHTML(c, response); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			apierror.Respond(c, http.StatusInternalServerError, err)
 		}
 	}
 }
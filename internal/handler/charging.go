@@ -0,0 +1,275 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"tds_server/internal/config"
+	"tds_server/internal/repository"
+	"tds_server/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// maxChargingPageSize caps pageSize / limit on the charging endpoints.
+	maxChargingPageSize = 50
+	// invoiceIDParam is the route parameter carrying the invoice content id.
+	invoiceIDParam = "invoice_id"
+)
+
+// ChargingHistoryResponse mirrors Tesla GET /api/1/dx/charging/history.
+type ChargingHistoryResponse struct {
+	Data []ChargingHistoryRecord `json:"data"`
+	// TotalResults is the number of records matching the filters across all pages.
+	TotalResults int  `json:"totalResults"`
+	HasMoreData  bool `json:"hasMoreData"`
+	PageNo       int  `json:"pageNo"`
+}
+
+// ChargingHistoryRecord is one paid charging session (Supercharger or other Tesla billed charging).
+type ChargingHistoryRecord struct {
+	SessionID int64  `json:"sessionId"`
+	VIN       string `json:"vin"`
+	// SiteLocationName is blank unless the location policy of the vehicle is exact.
+	SiteLocationName string `json:"siteLocationName"`
+	// ChargeStartDateTime, ChargeStopDateTime and UnlatchDateTime are RFC 3339 timestamps.
+	ChargeStartDateTime string                 `json:"chargeStartDateTime"`
+	ChargeStopDateTime  string                 `json:"chargeStopDateTime"`
+	UnlatchDateTime     string                 `json:"unlatchDateTime"`
+	CountryCode         string                 `json:"countryCode"`
+	Fees                []ChargingFee          `json:"fees"`
+	BillingType         string                 `json:"billingType"`
+	Invoices            []ChargingInvoiceEntry `json:"invoices"`
+	VehicleMakeType     string                 `json:"vehicleMakeType"`
+}
+
+// ChargingFee is a line of a charging session bill.
+type ChargingFee struct {
+	SessionFeeID int64 `json:"sessionFeeId"`
+	// FeeType is CHARGING, PARKING or CONGESTION.
+	FeeType      string  `json:"feeType"`
+	CurrencyCode string  `json:"currencyCode"`
+	PricingType  string  `json:"pricingType"`
+	RateBase     float64 `json:"rateBase"`
+	RateTier1    float64 `json:"rateTier1"`
+	RateTier2    float64 `json:"rateTier2"`
+	RateTier3    float64 `json:"rateTier3"`
+	RateTier4    float64 `json:"rateTier4"`
+	UsageBase    float64 `json:"usageBase"`
+	UsageTier1   float64 `json:"usageTier1"`
+	UsageTier2   float64 `json:"usageTier2"`
+	UsageTier3   float64 `json:"usageTier3"`
+	UsageTier4   float64 `json:"usageTier4"`
+	TotalBase    float64 `json:"totalBase"`
+	TotalTier1   float64 `json:"totalTier1"`
+	TotalTier2   float64 `json:"totalTier2"`
+	TotalTier3   float64 `json:"totalTier3"`
+	TotalTier4   float64 `json:"totalTier4"`
+	TotalDue     float64 `json:"totalDue"`
+	NetDue       float64 `json:"netDue"`
+	// UOM is the billed unit, e.g. kwh or min.
+	UOM    string `json:"uom"`
+	IsPaid bool   `json:"isPaid"`
+	Status string `json:"status"`
+}
+
+// ChargingInvoiceEntry references an invoice downloadable through GetChargingInvoice.
+type ChargingInvoiceEntry struct {
+	FileName string `json:"fileName"`
+	// ContentID is the id used in /api/1/dx/charging/invoice/{invoice_id}.
+	ContentID   string `json:"contentId"`
+	InvoiceType string `json:"invoiceType"`
+}
+
+// ChargingSessionsResponse mirrors Tesla GET /api/1/dx/charging/sessions (business fleet accounts).
+type ChargingSessionsResponse struct {
+	Data          []ChargingSession `json:"data"`
+	StatusCode    int               `json:"status_code"`
+	StatusMessage string            `json:"status_message"`
+}
+
+// ChargingSession is a charging session in OCPI-like form.
+type ChargingSession struct {
+	ID       string `json:"id"`
+	VIN      string `json:"vin"`
+	Model    string `json:"model"`
+	Location struct {
+		Country string `json:"country"`
+		// Name is blank unless the location policy of the vehicle is exact.
+		Name string `json:"name"`
+	} `json:"location"`
+	StartDateTime string `json:"start_date_time"`
+	StopDateTime  string `json:"stop_date_time"`
+	// TotalEnergy is in kWh.
+	TotalEnergy float64 `json:"total_energy"`
+	TotalCost   struct {
+		ExclVAT float64 `json:"excl_vat"`
+		InclVAT float64 `json:"incl_vat"`
+		VAT     float64 `json:"vat"`
+	} `json:"total_cost"`
+	ChargingPeriods []map[string]any `json:"charging_periods,omitempty"`
+	Tariffs         map[string]any   `json:"tariffs,omitempty"`
+}
+
+// GetChargingHistory proxies Tesla GET /api/1/dx/charging/history. Filters: vin (any vehicle tag),
+// startTime/endTime (RFC 3339), pageNo (from 0), pageSize (1-50), sortBy and sortOrder (ASC/DESC).
+// Site names are masked by the location policy of each record's vehicle.
+// GetChargingHistory 查询付费充电记录（超充账单），支持车辆、时间范围与分页过滤。
+func GetChargingHistory(cfg *config.Config, tokenRepo *repository.TokenRepo, vehicles *service.VehicleDirectory, privacyRepo *repository.PrivacyRepo) gin.HandlerFunc {
+	return chargingHistory(newTeslaProxy(cfg, tokenRepo, vehicles), newPrivacyStore(privacyRepo))
+}
+
+func chargingHistory(proxy *teslaProxy, privacy privacyStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query, status, err := buildChargingQuery(c, proxy, historyQuerySpec{
+			start: "startTime", end: "endTime", page: "pageNo", size: "pageSize", extra: []string{"sortBy"},
+		})
+		if err != nil {
+			respondWithError(c, status, err)
+			return
+		}
+		if order := strings.ToUpper(strings.TrimSpace(c.Query("sortOrder"))); order != "" {
+			if order != "ASC" && order != "DESC" {
+				respondWithError(c, http.StatusBadRequest, fmt.Errorf("sortOrder must be ASC or DESC"))
+				return
+			}
+			query.Set("sortOrder", order)
+		}
+
+		var payload ChargingHistoryResponse
+		status, err = proxy.JSON(c, http.MethodGet, apiSegments("dx", "charging", "history"), query, nil, nil, &payload)
+		if err != nil {
+			respondWithError(c, status, err)
+			return
+		}
+		policies := proxy.policyByVIN(c, privacy)
+		for i := range payload.Data {
+			policy, err := policies(payload.Data[i].VIN)
+			if err != nil {
+				respondWithError(c, http.StatusInternalServerError, err)
+				return
+			}
+			payload.Data[i].ApplyLocationPolicy(policy)
+		}
+		respondCacheable(c, status, payload, time.Time{})
+	}
+}
+
+// GetChargingSessions proxies Tesla GET /api/1/dx/charging/sessions, which is only available to
+// business fleet accounts. Filters: vin, date_from/date_to (RFC 3339), offset and limit (1-50).
+func GetChargingSessions(cfg *config.Config, tokenRepo *repository.TokenRepo, vehicles *service.VehicleDirectory, privacyRepo *repository.PrivacyRepo) gin.HandlerFunc {
+	return chargingSessions(newTeslaProxy(cfg, tokenRepo, vehicles), newPrivacyStore(privacyRepo))
+}
+
+func chargingSessions(proxy *teslaProxy, privacy privacyStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query, status, err := buildChargingQuery(c, proxy, historyQuerySpec{
+			start: "date_from", end: "date_to", page: "offset", size: "limit",
+		})
+		if err != nil {
+			respondWithError(c, status, err)
+			return
+		}
+
+		var payload ChargingSessionsResponse
+		status, err = proxy.JSON(c, http.MethodGet, apiSegments("dx", "charging", "sessions"), query, nil, nil, &payload)
+		if err != nil {
+			respondWithError(c, status, err)
+			return
+		}
+		policies := proxy.policyByVIN(c, privacy)
+		for i := range payload.Data {
+			policy, err := policies(payload.Data[i].VIN)
+			if err != nil {
+				respondWithError(c, http.StatusInternalServerError, err)
+				return
+			}
+			payload.Data[i].ApplyLocationPolicy(policy)
+		}
+		respondCacheable(c, status, payload, time.Time{})
+	}
+}
+
+// ApplyLocationPolicy blanks the site name, which names the place the vehicle was charged, unless
+// policy is exact.
+func (r *ChargingHistoryRecord) ApplyLocationPolicy(policy service.LocationPolicy) {
+	if !policy.IsExact() {
+		r.SiteLocationName = ""
+	}
+}
+
+// ApplyLocationPolicy blanks the location name unless policy is exact; the country is kept.
+func (s *ChargingSession) ApplyLocationPolicy(policy service.LocationPolicy) {
+	if !policy.IsExact() {
+		s.Location.Name = ""
+	}
+}
+
+// GetChargingInvoice streams Tesla GET /api/1/dx/charging/invoice/{invoice_id} to the client with the
+// upstream content type (normally application/pdf) instead of decoding it as JSON.
+// GetChargingInvoice 以流的方式转发发票 PDF，不在服务端缓冲或解析。
+func GetChargingInvoice(cfg *config.Config, tokenRepo *repository.TokenRepo, vehicles *service.VehicleDirectory) gin.HandlerFunc {
+	proxy := newTeslaProxy(cfg, tokenRepo, vehicles)
+	return func(c *gin.Context) {
+		invoiceID := strings.TrimSpace(c.Param(invoiceIDParam))
+		if invoiceID == "" || strings.ContainsAny(invoiceID, "/?#") {
+			respondWithError(c, http.StatusBadRequest, fmt.Errorf("%s is invalid", invoiceIDParam))
+			return
+		}
+		path, status, err := proxy.resolvePath(c, apiSegments("dx", "charging", "invoice", ":"+invoiceIDParam))
+		if err != nil {
+			respondWithError(c, status, err)
+			return
+		}
+
+		resp, status, err := proxy.execute(c, http.MethodGet, path, nil, nil, map[string]string{"Accept": "application/pdf"}, true)
+		if err != nil {
+			respondWithError(c, status, err)
+			return
+		}
+		body := resp.RawBody()
+		defer body.Close()
+
+		contentType := resp.Header().Get("Content-Type")
+		if contentType == "" {
+			contentType = "application/pdf"
+		}
+		disposition := resp.Header().Get("Content-Disposition")
+		if disposition == "" {
+			disposition = fmt.Sprintf("attachment; filename=%q", "invoice-"+invoiceID+".pdf")
+		}
+		contentLength := int64(-1)
+		if length, err := strconv.ParseInt(resp.Header().Get("Content-Length"), 10, 64); err == nil {
+			contentLength = length
+		}
+		c.DataFromReader(resp.StatusCode(), contentLength, contentType, body, map[string]string{
+			"Content-Disposition": disposition,
+			"Cache-Control":       "private, max-age=3600",
+		})
+	}
+}
+
+// buildChargingQuery validates the date range and pagination filters through historyQuery, then the
+// vin. The vin may be any vehicle tag and is resolved against the user's vehicles so other owners'
+// history cannot be queried.
+func buildChargingQuery(c *gin.Context, proxy *teslaProxy, spec historyQuerySpec) (url.Values, int, error) {
+	spec.maxSize = maxChargingPageSize
+	query, err := historyQuery(c, spec)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	if tag := strings.TrimSpace(c.Query("vin")); tag != "" {
+		vin, _, status, err := proxy.commandVIN(c, tag)
+		if err != nil {
+			return nil, status, err
+		}
+		query.Set("vin", vin)
+	}
+	return query, http.StatusOK, nil
+}
@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"tds_server/internal/config"
+	"tds_server/internal/middleware"
+	"tds_server/internal/model"
+	"tds_server/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const chargingTestVIN = "5YJ3E1EA7KF123456"
+
+// newChargingTestProxy returns a proxy for a user owning chargingTestVIN (id 1, named "Daily").
+func newChargingTestProxy(apiURL string) (*teslaProxy, uuid.UUID) {
+	userID := uuid.New()
+	directory := service.NewVehicleDirectory(time.Minute)
+	directory.Store(userID, []service.VehicleIdentity{{ID: 1, IDS: "1", VIN: chargingTestVIN, DisplayName: "Daily"}})
+	return newTeslaProxy(&config.Config{TeslaAPIURL: apiURL}, newMemoryTokenStore(userID, "access", "refresh"), directory), userID
+}
+
+func TestBuildChargingQuery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	proxy, userID := newChargingTestProxy("http://tesla.invalid")
+	spec := historyQuerySpec{start: "startTime", end: "endTime", page: "pageNo", size: "pageSize", extra: []string{"sortBy"}}
+	build := func(rawQuery string) (string, int, error) {
+		query, status, err := buildChargingQuery(userContext(userID, "/?"+rawQuery), proxy, spec)
+		if err != nil {
+			return "", status, err
+		}
+		return query.Encode(), status, nil
+	}
+
+	encoded, _, err := build("vin=Daily&startTime=2026-09-01T00:00:00Z&endTime=2026-10-01T00:00:00Z&pageNo=0&pageSize=20&sortBy=chargeStartDateTime&user_id=x")
+	want := "endTime=2026-10-01T00%3A00%3A00Z&pageNo=0&pageSize=20&sortBy=chargeStartDateTime&startTime=2026-09-01T00%3A00%3A00Z&vin=" + chargingTestVIN
+	if err != nil || encoded != want {
+		t.Fatalf("query = %s, %v", encoded, err)
+	}
+
+	for _, rawQuery := range []string{
+		"startTime=2026-09-01",
+		"startTime=2026-10-01T00:00:00Z&endTime=2026-09-01T00:00:00Z",
+		"pageNo=-1",
+		"pageSize=0",
+		"pageSize=51",
+	} {
+		if _, status, err := build(rawQuery); err == nil || status != http.StatusBadRequest {
+			t.Fatalf("%q: status %d, err %v", rawQuery, status, err)
+		}
+	}
+	if _, status, err := build("vin=5YJ3E1EA7KF999999"); err == nil || status != http.StatusNotFound {
+		t.Fatalf("unowned vin: status %d, err %v", status, err)
+	}
+}
+
+func TestChargingHistoryMasksSiteNames(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/1/dx/charging/history" || r.URL.Query().Get("vin") != chargingTestVIN {
+			http.Error(w, `{"error":"unexpected request"}`, http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"data":         []map[string]any{{"sessionId": 7, "vin": chargingTestVIN, "siteLocationName": "Shanghai Jing'an Supercharger", "countryCode": "CN"}},
+			"totalResults": 1,
+		})
+	}))
+	defer upstream.Close()
+
+	for _, tc := range []struct {
+		mode     string
+		wantName bool
+	}{
+		{model.LocationModeExact, true},
+		{model.LocationModeCoarse, false},
+		{model.LocationModeHidden, false},
+	} {
+		proxy, userID := newChargingTestProxy(upstream.URL)
+		handler := chargingHistory(proxy, staticPrivacyStore{setting: &model.PrivacySetting{LocationMode: tc.mode, GeohashPrecision: 5}})
+
+		recorder := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(recorder)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/1/dx/charging/history?vin=1", nil)
+		c.Set(middleware.UserIDContextKey, userID)
+		handler(c)
+
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", tc.mode, recorder.Code, recorder.Body)
+		}
+		body := recorder.Body.String()
+		if got := strings.Contains(body, "Jing'an"); got != tc.wantName {
+			t.Fatalf("%s: site name present = %v: %s", tc.mode, got, body)
+		}
+		if !strings.Contains(body, `"countryCode":"CN"`) {
+			t.Fatalf("%s: other fields must be kept: %s", tc.mode, body)
+		}
+	}
+}
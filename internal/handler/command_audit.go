@@ -0,0 +1,184 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"tds_server/internal/apierror"
+	"tds_server/internal/config"
+	"tds_server/internal/middleware"
+	"tds_server/internal/model"
+	"tds_server/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// CommandAuditPayload is one audit entry as returned to clients.
+type CommandAuditPayload struct {
+	ID        uint   `json:"id"`
+	UserID    string `json:"user_id"`
+	Actor     string `json:"actor"`
+	RequestID string `json:"request_id,omitempty"`
+	VIN       string `json:"vin"`
+	Command   string `json:"command"`
+	// Params is the redacted request body.
+	Params     json.RawMessage `json:"params,omitempty"`
+	Path       string          `json:"path,omitempty"`
+	Outcome    string          `json:"outcome"`
+	HTTPStatus int             `json:"http_status"`
+	ErrorCode  string          `json:"error_code,omitempty"`
+	Reason     string          `json:"reason,omitempty"`
+	LatencyMS  int64           `json:"latency_ms"`
+	CreatedAt  time.Time       `json:"created_at"`
+	PrevHash   string          `json:"prev_hash"`
+	Hash       string          `json:"hash"`
+}
+
+// CommandAuditResponse is a page of audit entries; NextBeforeID requests the following page.
+type CommandAuditResponse struct {
+	Entries      []CommandAuditPayload `json:"entries"`
+	NextBeforeID uint                  `json:"next_before_id,omitempty"`
+}
+
+// ListCommandAudits handles GET /api/audit/commands. Users see their own commands; audit admins may
+// query any user or all of them. Filters: vin, user_id, from, to (RFC 3339), before_id and limit.
+// ListCommandAudits 查询车辆指令审计记录，可按车辆、用户与时间过滤。
+func ListCommandAudits(cfg *config.Config, audit *service.CommandAuditService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := middleware.UserIDFromContext(c)
+		if !ok {
+			apierror.Write(c, apierror.New(http.StatusUnauthorized, apierror.CodeUnauthorized, "user is not authenticated"))
+			return
+		}
+		filter, err := buildCommandAuditFilter(c)
+		if err != nil {
+			apierror.Write(c, apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest, err.Error()))
+			return
+		}
+		if !isAuditAdmin(cfg, userID) {
+			if filter.UserID != uuid.Nil && filter.UserID != userID {
+				apierror.Write(c, apierror.New(http.StatusForbidden, apierror.CodeForbidden, "only audit admins may query other users"))
+				return
+			}
+			filter.UserID = userID
+		}
+
+		entries, err := audit.List(filter)
+		if err != nil {
+			respondWithError(c, http.StatusInternalServerError, err)
+			return
+		}
+		response := CommandAuditResponse{Entries: make([]CommandAuditPayload, 0, len(entries))}
+		for _, entry := range entries {
+			response.Entries = append(response.Entries, newCommandAuditPayload(entry))
+		}
+		if n := len(entries); n > 0 && n == filter.Limit {
+			response.NextBeforeID = entries[n-1].ID
+		}
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// VerifyCommandAudit handles GET /api/audit/commands/verify, recomputing the whole hash chain. Only
+// audit admins may call it. VerifyCommandAudit 校验审计哈希链是否被篡改。
+func VerifyCommandAudit(cfg *config.Config, audit *service.CommandAuditService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := middleware.UserIDFromContext(c)
+		if !ok {
+			apierror.Write(c, apierror.New(http.StatusUnauthorized, apierror.CodeUnauthorized, "user is not authenticated"))
+			return
+		}
+		if !isAuditAdmin(cfg, userID) {
+			apierror.Write(c, apierror.New(http.StatusForbidden, apierror.CodeForbidden, "only audit admins may verify the audit log"))
+			return
+		}
+		result, err := audit.Verify(c.Request.Context())
+		if err != nil {
+			respondWithError(c, http.StatusInternalServerError, err)
+			return
+		}
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+func buildCommandAuditFilter(c *gin.Context) (model.CommandAuditFilter, error) {
+	filter := model.CommandAuditFilter{VIN: strings.TrimSpace(c.Query("vin")), Limit: service.DefaultCommandAuditLimit}
+	if raw := strings.TrimSpace(c.Query("user_id")); raw != "" {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			return filter, fmt.Errorf("user_id must be a UUID")
+		}
+		filter.UserID = id
+	}
+	for key, target := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		raw := strings.TrimSpace(c.Query(key))
+		if raw == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return filter, fmt.Errorf("%s must be an RFC 3339 timestamp", key)
+		}
+		*target = parsed
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && filter.To.Before(filter.From) {
+		return filter, fmt.Errorf("to must not be before from")
+	}
+	if raw := strings.TrimSpace(c.Query("before_id")); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 0)
+		if err != nil || id == 0 {
+			return filter, fmt.Errorf("before_id must be a positive integer")
+		}
+		filter.BeforeID = uint(id)
+	}
+	if raw := strings.TrimSpace(c.Query("limit")); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > service.MaxCommandAuditLimit {
+			return filter, fmt.Errorf("limit must be between 1 and %d", service.MaxCommandAuditLimit)
+		}
+		filter.Limit = limit
+	}
+	return filter, nil
+}
+
+func isAuditAdmin(cfg *config.Config, userID uuid.UUID) bool {
+	return slices.ContainsFunc(cfg.Audit.AdminUserIDs, func(id string) bool {
+		return strings.EqualFold(id, userID.String())
+	})
+}
+
+func newCommandAuditPayload(entry model.CommandAudit) CommandAuditPayload {
+	payload := CommandAuditPayload{
+		ID:         entry.ID,
+		UserID:     entry.UserID.String(),
+		Actor:      entry.Actor,
+		RequestID:  entry.RequestID,
+		VIN:        entry.VIN,
+		Command:    entry.Command,
+		Path:       entry.Path,
+		Outcome:    entry.Outcome,
+		HTTPStatus: entry.HTTPStatus,
+		ErrorCode:  entry.ErrorCode,
+		Reason:     entry.Reason,
+		LatencyMS:  entry.LatencyMS,
+		CreatedAt:  entry.CreatedAt,
+		PrevHash:   entry.PrevHash,
+		Hash:       entry.Hash,
+	}
+	if entry.Params != "" {
+		if json.Valid([]byte(entry.Params)) {
+			payload.Params = json.RawMessage(entry.Params)
+		} else {
+			payload.Params, _ = json.Marshal(entry.Params)
+		}
+	}
+	return payload
+}
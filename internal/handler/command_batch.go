@@ -0,0 +1,313 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"tds_server/internal/apierror"
+	"tds_server/internal/config"
+	"tds_server/internal/middleware"
+	"tds_server/internal/repository"
+	"tds_server/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// commandBatchParam is the route parameter carrying the batch id.
+const commandBatchParam = "batch_id"
+
+// CommandBatchRequest is the body of POST /api/v2/command_batches. Exactly one of Vehicles, Group and
+// All selects the vehicles; Params is the command body as for the v1 command route.
+type CommandBatchRequest struct {
+	// Vehicles lists VINs, ids or display names.
+	Vehicles []string `json:"vehicles,omitempty"`
+	// Group is the id or name of one of the user's vehicle groups.
+	Group string `json:"group,omitempty"`
+	// All selects every vehicle of the account.
+	All     bool            `json:"all,omitempty"`
+	Command string          `json:"command"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// CommandBatchResponse reports a batch per vehicle, in request order, together with a summary.
+// Asynchronous batches carry BatchID and StatusURL. CommandBatchResponse 为批量指令的响应结构。
+type CommandBatchResponse struct {
+	BatchID   string                      `json:"batch_id,omitempty"`
+	StatusURL string                      `json:"status_url,omitempty"`
+	Command   string                      `json:"command"`
+	Summary   service.CommandBatchSummary `json:"summary"`
+	Vehicles  []service.CommandBatchItem  `json:"vehicles"`
+}
+
+// RunCommandBatch handles POST /api/v2/command_batches, sending one command to many vehicles. Vehicles
+// are commanded at most cfg.Commands.BatchConcurrency at a time and the response lists the outcome of
+// each one. With ?async=true every vehicle becomes a command job of the batch and the response is
+// 202; GET /api/v2/command_batches/{batch_id} reports the progress.
+// RunCommandBatch 对多辆车批量执行同一指令，返回逐车结果与汇总，支持异步执行。
+func RunCommandBatch(cfg *config.Config, tokenRepo *repository.TokenRepo, commandSvc *service.VehicleCommandService, vehicles *service.VehicleDirectory, jobs *service.CommandJobService, audit *service.CommandAuditService, groups *service.VehicleGroupService) gin.HandlerFunc {
+	executor := newCommandExecutor(cfg, tokenRepo, commandSvc, vehicles, jobs, audit)
+	return func(c *gin.Context) {
+		var request CommandBatchRequest
+		if apiErr := decodeV2Body(c, &request); apiErr != nil {
+			apierror.Write(c, apiErr)
+			return
+		}
+		var params []byte
+		if trimmed := bytes.TrimSpace(request.Params); len(trimmed) > 0 && !bytes.Equal(trimmed, []byte("null")) {
+			params = trimmed
+		}
+		spec, apiErr := validateVehicleCommand(request.Command, params)
+		if apiErr != nil {
+			executor.rejectBatch(c, request, params, apiErr)
+			return
+		}
+		tags, apiErr := executor.batchVehicles(c, request, groups)
+		if apiErr != nil {
+			apierror.Write(c, apiErr)
+			return
+		}
+		if apiErr := executor.refreshBatchToken(c); apiErr != nil {
+			apierror.Write(c, apiErr)
+			return
+		}
+
+		if wantsAsync(c) {
+			executor.submitBatch(c, tags, spec, params)
+			return
+		}
+
+		items := service.RunCommandBatch(c.Request.Context(), tags, cfg.Commands.BatchConcurrency, func(tag string) service.CommandBatchItem {
+			vc := vehicleContext(c, tag)
+			item := service.CommandBatchItem{Vehicle: tag}
+			vin, _, status, err := executor.proxy.commandVIN(vc, tag)
+			if err != nil {
+				apiErr := apierror.From(status, err)
+				item.Status, item.Reason, item.ErrorCode = service.CommandBatchFailed, apiErr.Message, apiErr.Code
+				return item
+			}
+			item.VIN = vin
+			result, apiErr := executor.run(vc, vin, spec, spec.Name, params)
+			if apiErr != nil {
+				item.Status, item.Reason, item.ErrorCode = service.CommandBatchFailed, apiErr.Message, apiErr.Code
+				return item
+			}
+			outcome := commandOutcome(spec.Name, result.Body)
+			item.Status, item.Reason, item.Verification = service.CommandBatchSucceeded, outcome.Reason, result.Verification
+			if !outcome.Result {
+				item.Status = service.CommandBatchDeclined
+			}
+			if json.Valid(result.Body) {
+				item.Response = result.Body
+			}
+			return item
+		})
+		summary := service.SummarizeCommandBatch(items)
+		commandLog.InfoContext(c.Request.Context(), "vehicle command batch executed", "command", spec.Name,
+			"total", summary.Total, "succeeded", summary.Succeeded, "declined", summary.Declined, "failed", summary.Failed)
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusOK, CommandBatchResponse{Command: spec.Name, Summary: summary, Vehicles: items})
+	}
+}
+
+// GetCommandBatch handles GET /api/v2/command_batches/{batch_id}, reporting the jobs of an
+// asynchronous batch owned by the caller. GetCommandBatch 查询异步批量指令的执行进度。
+func GetCommandBatch(jobs *service.CommandJobService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := middleware.UserIDFromContext(c)
+		if !ok {
+			apierror.Write(c, apierror.New(http.StatusUnauthorized, apierror.CodeUnauthorized, "user is not authenticated"))
+			return
+		}
+		batchID, err := uuid.Parse(c.Param(commandBatchParam))
+		if err != nil {
+			respondWithError(c, http.StatusBadRequest, fmt.Errorf("%s must be a UUID", commandBatchParam))
+			return
+		}
+		if jobs == nil {
+			apierror.Write(c, apierror.New(http.StatusNotFound, apierror.CodeNotFound, "command batch not found"))
+			return
+		}
+		batchJobs, err := jobs.ListBatch(userID, batchID)
+		if err != nil {
+			respondWithError(c, http.StatusInternalServerError, err)
+			return
+		}
+		if len(batchJobs) == 0 {
+			apierror.Write(c, apierror.New(http.StatusNotFound, apierror.CodeNotFound, "command batch not found"))
+			return
+		}
+
+		response := CommandBatchResponse{BatchID: batchID.String(), StatusURL: commandBatchURL(batchID), Command: batchJobs[0].Command}
+		for i := range batchJobs {
+			item := service.CommandBatchJobItem(&batchJobs[i])
+			item.StatusURL = commandJobURL(batchJobs[i].ID)
+			response.Vehicles = append(response.Vehicles, item)
+		}
+		response.Summary = service.SummarizeCommandBatch(response.Vehicles)
+		if response.Summary.Pending > 0 {
+			c.Header("Retry-After", strconv.Itoa(commandJobRetryAfter))
+		}
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// rejectBatch audits a batch whose command failed validation once per listed vehicle, or once without
+// a vehicle when it targets a group or the whole account, and responds with apiErr.
+func (e *commandExecutor) rejectBatch(c *gin.Context, request CommandBatchRequest, params []byte, apiErr *apierror.Error) {
+	targets := []string{""}
+	if len(request.Vehicles) > 0 {
+		targets = request.Vehicles
+	}
+	for _, target := range targets {
+		recordRejected(c, e.audit, strings.TrimSpace(target), request.Command, params, apiErr)
+	}
+	apierror.Write(c, apiErr)
+}
+
+// batchVehicles returns the requested vehicle tags without duplicates, the VINs of the named group,
+// or the VINs of the whole account for all=true.
+func (e *commandExecutor) batchVehicles(c *gin.Context, request CommandBatchRequest, groups *service.VehicleGroupService) ([]string, *apierror.Error) {
+	selectors := 0
+	for _, set := range []bool{len(request.Vehicles) > 0, strings.TrimSpace(request.Group) != "", request.All} {
+		if set {
+			selectors++
+		}
+	}
+	if selectors != 1 {
+		return nil, apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest, "exactly one of vehicles, group and all is required")
+	}
+
+	var tags []string
+	switch {
+	case request.Group != "":
+		userID, ok := middleware.UserIDFromContext(c)
+		if !ok {
+			return nil, apierror.New(http.StatusUnauthorized, apierror.CodeUnauthorized, "user is not authenticated")
+		}
+		if groups == nil {
+			return nil, apierror.New(http.StatusNotFound, apierror.CodeNotFound, service.ErrVehicleGroupNotFound.Error())
+		}
+		group, err := groups.Find(userID, request.Group)
+		if errors.Is(err, service.ErrVehicleGroupNotFound) {
+			return nil, apierror.Wrap(http.StatusNotFound, apierror.CodeNotFound, err)
+		}
+		if err != nil {
+			return nil, apierror.From(http.StatusInternalServerError, err)
+		}
+		tags = append(tags, group.VINs...)
+	case request.All:
+		payload, status, err := fetchAllVehicles(c, e.proxy, allVehiclesPerPage)
+		if err != nil {
+			return nil, apierror.From(status, err)
+		}
+		// A truncated list is far above MaxCommandBatchSize and rejected below.
+		if payload.Pagination.Next == nil {
+			e.proxy.syncVehicleDirectory(c, payload.Response)
+		}
+		for _, vehicle := range payload.Response {
+			tags = append(tags, vehicle.VIN)
+		}
+	default:
+		seen := map[string]bool{}
+		for _, tag := range request.Vehicles {
+			tag = strings.TrimSpace(tag)
+			if tag == "" {
+				return nil, apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest, "vehicles must not contain empty entries")
+			}
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+
+	if len(tags) == 0 {
+		return nil, apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest, "the account has no vehicles")
+	}
+	if len(tags) > service.MaxCommandBatchSize {
+		return nil, apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest,
+			fmt.Sprintf("a batch may command at most %d vehicles, got %d", service.MaxCommandBatchSize, len(tags)))
+	}
+	return tags, nil
+}
+
+// refreshBatchToken renews the user's token once before the vehicles are commanded concurrently, so
+// the workers do not race to spend the same refresh token.
+func (e *commandExecutor) refreshBatchToken(c *gin.Context) *apierror.Error {
+	userID, ok := middleware.UserIDFromContext(c)
+	if !ok {
+		return apierror.New(http.StatusUnauthorized, apierror.CodeUnauthorized, "user is not authenticated")
+	}
+	token, err := e.tokenRepo.GetByUserID(userID)
+	if err != nil {
+		return apierror.From(http.StatusInternalServerError, err)
+	}
+	if token == nil {
+		return apierror.New(http.StatusUnauthorized, apierror.CodeUnauthorized, "user token not found")
+	}
+	if _, err := ensureValidToken(c.Request.Context(), e.cfg, e.tokenRepo, userID, token); err != nil {
+		return apierror.Wrap(http.StatusUnauthorized, apierror.CodeTokenRefreshFailed, fmt.Errorf("token refresh failed: %w", err))
+	}
+	return nil
+}
+
+// submitBatch queues one job per vehicle under a new batch id and answers 202. Vehicles that cannot
+// be queued, e.g. unknown tags, are reported as failed in the response only.
+func (e *commandExecutor) submitBatch(c *gin.Context, tags []string, spec service.CommandSpec, params []byte) {
+	if e.jobs == nil {
+		apierror.Write(c, apierror.New(http.StatusNotImplemented, apierror.CodeCommandNotImplemented, "asynchronous commands are not enabled"))
+		return
+	}
+	batchID := uuid.New()
+	items := make([]service.CommandBatchItem, 0, len(tags))
+	for _, tag := range tags {
+		job, status, err := e.enqueue(vehicleContext(c, tag), tag, spec.Name, &batchID, e.commandTask(tag, spec, spec.Name, params))
+		item := service.CommandBatchItem{Vehicle: tag}
+		if job != nil {
+			item = service.CommandBatchJobItem(job)
+			item.Vehicle, item.StatusURL = tag, commandJobURL(job.ID)
+		}
+		if err != nil {
+			apiErr := apierror.From(status, err)
+			item.Status, item.Reason, item.ErrorCode = service.CommandBatchFailed, apiErr.Message, apiErr.Code
+		}
+		items = append(items, item)
+	}
+
+	commandLog.InfoContext(c.Request.Context(), "vehicle command batch queued", "command", spec.Name, "batch_id", batchID, "vehicles", len(tags))
+	c.Header("Location", commandBatchURL(batchID))
+	c.Header("Retry-After", strconv.Itoa(commandJobRetryAfter))
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusAccepted, CommandBatchResponse{
+		BatchID:   batchID.String(),
+		StatusURL: commandBatchURL(batchID),
+		Command:   spec.Name,
+		Summary:   service.SummarizeCommandBatch(items),
+		Vehicles:  items,
+	})
+}
+
+// vehicleContext returns a copy of c addressing vehicleTag, so the executor can work on several
+// vehicles of one request concurrently.
+func vehicleContext(c *gin.Context, vehicleTag string) *gin.Context {
+	vc := c.Copy()
+	params := gin.Params{{Key: vehicleTagParam, Value: vehicleTag}}
+	for _, param := range vc.Params {
+		if param.Key != vehicleTagParam {
+			params = append(params, param)
+		}
+	}
+	vc.Params = params
+	return vc
+}
+
+func commandBatchURL(id uuid.UUID) string {
+	return "/api/v2/command_batches/" + id.String()
+}
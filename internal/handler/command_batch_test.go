@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tds_server/internal/config"
+	"tds_server/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func TestRunCommandBatchRejectsInvalidRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/command_batches", RunCommandBatch(&config.Config{}, nil, nil, nil, nil, nil, nil))
+
+	tooMany := make([]string, 101)
+	for i := range tooMany {
+		tooMany[i] = `"car ` + strconv.Itoa(i) + `"`
+	}
+	cases := []string{
+		`{"vehicles": ["5YJ3E1EA7KF123456"]}`,
+		`{"vehicles": ["5YJ3E1EA7KF123456"], "command": "no_such_command"}`,
+		`{"vehicles": ["5YJ3E1EA7KF123456"], "command": "set_charge_limit", "params": {"percent": 200}}`,
+		`{"command": "door_lock"}`,
+		`{"vehicles": ["5YJ3E1EA7KF123456"], "all": true, "command": "door_lock"}`,
+		`{"group": "Fleet", "all": true, "command": "door_lock"}`,
+		`{"vehicles": [" "], "command": "door_lock"}`,
+		`{"vehicles": [` + strings.Join(tooMany, ",") + `], "command": "door_lock"}`,
+	}
+	for _, body := range cases {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/command_batches", strings.NewReader(body)))
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "invalid_request") {
+			t.Fatalf("%s: status %d %s", body, w.Code, w.Body)
+		}
+	}
+}
+
+func TestCommandBatchRefreshesRevokedTokenOnce(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var refreshes atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth2/v3/token", func(w http.ResponseWriter, r *http.Request) {
+		refreshes.Add(1)
+		// Tesla rotates refresh tokens: the old one is spent after its first use.
+		if r.FormValue("refresh_token") != "refresh-1" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+		_ = json.NewEncoder(w).Encode(map[string]any{"access_token": "access-2", "refresh_token": "refresh-2", "expires_in": 3600})
+	})
+	mux.HandleFunc("/api/1/vehicles/", func(w http.ResponseWriter, r *http.Request) {
+		// The access token was revoked after the batch started.
+		if r.Header.Get("Authorization") != "Bearer access-2" {
+			http.Error(w, `{"error":"token expired"}`, http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"response": map[string]any{"result": true, "reason": ""}})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	userID := uuid.New()
+	directory := service.NewVehicleDirectory(time.Minute)
+	var tags []string
+	var fleet []service.VehicleIdentity
+	for id := int64(1); id <= 4; id++ {
+		vin := fmt.Sprintf("VIN%014d", id)
+		fleet = append(fleet, service.VehicleIdentity{ID: id, IDS: strconv.FormatInt(id, 10), VIN: vin})
+		tags = append(tags, vin)
+	}
+	directory.Store(userID, fleet)
+	tokens := newMemoryTokenStore(userID, "access-1", "refresh-1")
+	cfg := &config.Config{TeslaAPIURL: server.URL, TeslaTokenURL: server.URL + "/oauth2/v3/token"}
+	executor := newCommandExecutor(cfg, tokens, nil, directory, nil, nil)
+	spec, apiErr := validateVehicleCommand("door_lock", nil)
+	if apiErr != nil {
+		t.Fatal(apiErr)
+	}
+
+	c := userContext(userID, "/api/v2/command_batches")
+	items := service.RunCommandBatch(c.Request.Context(), tags, len(tags), func(tag string) service.CommandBatchItem {
+		if _, apiErr := executor.run(vehicleContext(c, tag), tag, spec, spec.Name, nil); apiErr != nil {
+			return service.CommandBatchItem{Vehicle: tag, Status: service.CommandBatchFailed, Reason: apiErr.Message}
+		}
+		return service.CommandBatchItem{Vehicle: tag, Status: service.CommandBatchSucceeded}
+	})
+
+	if summary := service.SummarizeCommandBatch(items); summary.Succeeded != len(tags) {
+		t.Fatalf("summary = %+v, items = %+v", summary, items)
+	}
+	if got := refreshes.Load(); got != 1 {
+		t.Fatalf("token refreshes = %d, want 1", got)
+	}
+}
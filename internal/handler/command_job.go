@@ -0,0 +1,368 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"tds_server/internal/apierror"
+	"tds_server/internal/middleware"
+	"tds_server/internal/model"
+	"tds_server/internal/repository"
+	"tds_server/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	// asyncQueryParam selects asynchronous execution (?async=true); Prefer: respond-async works too.
+	asyncQueryParam = "async"
+	// commandJobParam is the route parameter carrying the command job id.
+	commandJobParam = "command_id"
+	// commandJobRetryAfter is the polling interval suggested to clients while a job is running.
+	commandJobRetryAfter = 1
+	// wakePollInterval is how often the vehicle state is checked while waking it.
+	wakePollInterval = 3 * time.Second
+	// commandStreamKeepAlive is how often an idle progress stream sends a comment to keep proxies from
+	// closing it.
+	commandStreamKeepAlive = 15 * time.Second
+	// vehicleStateOnline is the state Tesla reports for an awake vehicle.
+	vehicleStateOnline = "online"
+)
+
+// CommandJobPayload describes an asynchronous command as returned to clients.
+type CommandJobPayload struct {
+	ID      string `json:"id"`
+	VIN     string `json:"vin"`
+	Command string `json:"command"`
+	// Status is queued, waking, connecting, sent, succeeded or failed.
+	Status string `json:"status"`
+	// Reason explains a failure, including the vehicle's reason when it declined the command.
+	Reason    string `json:"reason,omitempty"`
+	ErrorCode string `json:"error_code,omitempty"`
+	// ResponseStatus and Response are the HTTP status and body the command would have returned synchronously.
+	ResponseStatus int                      `json:"response_status,omitempty"`
+	Response       json.RawMessage          `json:"response,omitempty"`
+	StatusURL      string                   `json:"status_url"`
+	CreatedAt      time.Time                `json:"created_at"`
+	UpdatedAt      time.Time                `json:"updated_at"`
+	FinishedAt     *time.Time               `json:"finished_at,omitempty"`
+	Events         []CommandJobEventPayload `json:"events,omitempty"`
+}
+
+// CommandJobEventPayload is one status transition of a command job.
+type CommandJobEventPayload struct {
+	Status string    `json:"status"`
+	Reason string    `json:"reason,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+// GetCommandJob handles GET /api/commands/{command_id}, returning the status of an asynchronous
+// command owned by the caller. GetCommandJob 查询异步指令的执行状态。
+func GetCommandJob(jobs *service.CommandJobService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, id, ok := commandJobRequest(c, jobs)
+		if !ok {
+			return
+		}
+		job, ok := loadCommandJob(c, jobs, userID, id)
+		if !ok {
+			return
+		}
+		respondCommandJob(c, http.StatusOK, job)
+	}
+}
+
+// StreamCommandJob handles GET /api/commands/{command_id}/events, streaming the stages of an
+// asynchronous command as Server-Sent Events: the stored history first, then every stage as it
+// happens, and finally a "done" event carrying the job. Jobs running on another instance are followed
+// by polling the database, which only yields the persisted statuses.
+// StreamCommandJob 以 SSE 实时推送异步指令的执行阶段，结束时发送 done 事件。
+func StreamCommandJob(jobs *service.CommandJobService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, id, ok := commandJobRequest(c, jobs)
+		if !ok {
+			return
+		}
+		// Subscribe before reading the history so no stage falls between the two.
+		events, cancel, live := jobs.Subscribe(id)
+		defer cancel()
+		job, ok := loadCommandJob(c, jobs, userID, id)
+		if !ok {
+			return
+		}
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-store")
+		c.Header("X-Accel-Buffering", "no")
+		c.Status(http.StatusOK)
+
+		stream := &commandJobStream{c: c, seen: map[string]bool{}}
+		stream.replay(job)
+		if job.Finished() {
+			stream.done(job)
+			return
+		}
+
+		var poll <-chan time.Time
+		if !live {
+			ticker := time.NewTicker(commandJobRetryAfter * time.Second)
+			defer ticker.Stop()
+			poll = ticker.C
+		}
+		keepAlive := time.NewTicker(commandStreamKeepAlive)
+		defer keepAlive.Stop()
+
+		for {
+			select {
+			case progress, ok := <-events:
+				if ok {
+					stream.progress(progress)
+					continue
+				}
+				// The job finished; send it with its response.
+				job, err := jobs.Get(userID, id)
+				if err != nil {
+					commandLog.ErrorContext(c.Request.Context(), "load finished command job failed", "job_id", id, "error", err)
+					return
+				}
+				stream.done(job)
+				return
+			case <-poll:
+				job, err := jobs.Get(userID, id)
+				if err != nil {
+					commandLog.ErrorContext(c.Request.Context(), "poll command job failed", "job_id", id, "error", err)
+					return
+				}
+				stream.replay(job)
+				if job.Finished() {
+					stream.done(job)
+					return
+				}
+			case <-keepAlive.C:
+				stream.comment("keep-alive")
+			case <-c.Request.Context().Done():
+				return
+			}
+		}
+	}
+}
+
+// commandJobStream writes command progress as Server-Sent Events. Persisted statuses occur once per
+// job, so they are deduplicated between the stored history and the live stream.
+type commandJobStream struct {
+	c        *gin.Context
+	replayed int
+	seen     map[string]bool
+}
+
+// replay sends the stored events that were not sent yet.
+func (s *commandJobStream) replay(job *model.CommandJob) {
+	for _, event := range job.Events[min(s.replayed, len(job.Events)):] {
+		s.progress(service.CommandProgress{Stage: event.Status, Detail: event.Reason, At: event.CreatedAt})
+	}
+	s.replayed = max(s.replayed, len(job.Events))
+}
+
+func (s *commandJobStream) progress(progress service.CommandProgress) {
+	if s.seen[progress.Stage] {
+		return
+	}
+	switch progress.Stage {
+	case service.CommandStageRetrying:
+	case service.CommandStageStep:
+		// Each scene step goes through the stages again.
+		s.seen = map[string]bool{}
+	default:
+		s.seen[progress.Stage] = true
+	}
+	s.c.SSEvent("progress", progress)
+	s.c.Writer.Flush()
+}
+
+func (s *commandJobStream) done(job *model.CommandJob) {
+	// Stored events are already streamed; the final payload only carries the outcome.
+	job.Events = nil
+	s.c.SSEvent("done", newCommandJobPayload(job))
+	s.c.Writer.Flush()
+}
+
+func (s *commandJobStream) comment(text string) {
+	_, _ = io.WriteString(s.c.Writer, ": "+text+"\n\n")
+	s.c.Writer.Flush()
+}
+
+// commandJobRequest reads the caller and the job id, responding with an error when either is missing.
+func commandJobRequest(c *gin.Context, jobs *service.CommandJobService) (userID, id uuid.UUID, ok bool) {
+	userID, ok = middleware.UserIDFromContext(c)
+	if !ok {
+		apierror.Write(c, apierror.New(http.StatusUnauthorized, apierror.CodeUnauthorized, "user is not authenticated"))
+		return userID, id, false
+	}
+	id, err := uuid.Parse(c.Param(commandJobParam))
+	if err != nil {
+		respondWithError(c, http.StatusBadRequest, fmt.Errorf("%s must be a UUID", commandJobParam))
+		return userID, id, false
+	}
+	if jobs == nil {
+		apierror.Write(c, apierror.New(http.StatusNotFound, apierror.CodeNotFound, "command not found"))
+		return userID, id, false
+	}
+	return userID, id, true
+}
+
+// loadCommandJob fetches the caller's job, responding with an error when it cannot.
+func loadCommandJob(c *gin.Context, jobs *service.CommandJobService, userID, id uuid.UUID) (*model.CommandJob, bool) {
+	job, err := jobs.Get(userID, id)
+	if repository.IsNotFound(err) {
+		apierror.Write(c, apierror.New(http.StatusNotFound, apierror.CodeNotFound, "command not found"))
+		return nil, false
+	}
+	if err != nil {
+		respondWithError(c, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	return job, true
+}
+
+// wantsAsync reports whether the client asked for asynchronous execution.
+func wantsAsync(c *gin.Context) bool {
+	if async, err := strconv.ParseBool(c.Query(asyncQueryParam)); err == nil {
+		return async
+	}
+	for _, preference := range strings.Split(c.GetHeader("Prefer"), ",") {
+		if strings.EqualFold(strings.TrimSpace(preference), "respond-async") {
+			return true
+		}
+	}
+	return false
+}
+
+// submit queues task as an asynchronous command and answers 202 with the job. The vehicle is resolved
+// up front so unknown or foreign vehicles still fail immediately. task receives a copy of the request
+// context that stays valid after the response has been sent. submit 将指令放入后台队列并返回 202。
+func (e *commandExecutor) submit(c *gin.Context, vehicleTag, command string, task func(c *gin.Context) (*service.CommandResult, error)) {
+	job, status, err := e.enqueue(c, vehicleTag, command, nil, task)
+	if err != nil {
+		apierror.Respond(c, status, err)
+		return
+	}
+	c.Header("Location", commandJobURL(job.ID))
+	respondCommandJob(c, http.StatusAccepted, job)
+}
+
+// enqueue resolves vehicleTag and queues task as a job of batchID (nil outside batches). When the
+// queue is full the job is stored as failed and returned together with the error.
+func (e *commandExecutor) enqueue(c *gin.Context, vehicleTag, command string, batchID *uuid.UUID, task func(c *gin.Context) (*service.CommandResult, error)) (*model.CommandJob, int, error) {
+	if e.jobs == nil {
+		return nil, http.StatusNotImplemented, apierror.New(http.StatusNotImplemented, apierror.CodeCommandNotImplemented, "asynchronous commands are not enabled")
+	}
+	userID, ok := middleware.UserIDFromContext(c)
+	if !ok {
+		return nil, http.StatusUnauthorized, apierror.New(http.StatusUnauthorized, apierror.CodeUnauthorized, "user is not authenticated")
+	}
+	vin, _, status, err := e.proxy.commandVIN(c, vehicleTag)
+	if err != nil {
+		return nil, status, err
+	}
+
+	detached := c.Copy()
+	job := &model.CommandJob{UserID: userID, VIN: vin, Command: command, BatchID: batchID}
+	err = e.jobs.Submit(context.WithoutCancel(c.Request.Context()), job, func(ctx context.Context) (*service.CommandResult, error) {
+		jc := detached.Copy()
+		jc.Request = detached.Request.WithContext(ctx)
+		if command != "wake_up" {
+			if err := e.wake(jc); err != nil {
+				return nil, err
+			}
+		}
+		return task(jc)
+	})
+	switch {
+	case errors.Is(err, service.ErrCommandQueueFull):
+		return job, http.StatusServiceUnavailable, apierror.New(http.StatusServiceUnavailable, apierror.CodeServiceOverloaded, err.Error())
+	case err != nil:
+		return nil, http.StatusInternalServerError, err
+	}
+
+	commandLog.InfoContext(c.Request.Context(), "vehicle command queued", "command", command, "vin", vin, "job_id", job.ID)
+	return job, http.StatusAccepted, nil
+}
+
+// wake makes sure the vehicle is online before an asynchronous command: when it is asleep or offline
+// it is woken through the Fleet API and its state polled until online or the job times out.
+// wake 在异步指令执行前确保车辆在线，必要时唤醒并轮询状态。
+func (e *commandExecutor) wake(c *gin.Context) error {
+	var vehicle VehicleResponse
+	status, err := e.proxy.JSON(c, http.MethodGet, apiSegments("vehicles", ":vehicle_tag"), nil, nil, nil, &vehicle)
+	if err != nil {
+		return apierror.From(status, err)
+	}
+	if vehicle.Response.State == vehicleStateOnline {
+		return nil
+	}
+
+	ctx := c.Request.Context()
+	service.ReportCommandProgress(ctx, service.CommandStageWaking, "vehicle is "+vehicle.Response.State)
+	status, err = e.proxy.JSON(c, http.MethodPost, apiSegments("vehicles", ":vehicle_tag", "wake_up"), nil, nil, nil, &vehicle)
+	for {
+		if err != nil {
+			return apierror.From(status, err)
+		}
+		if vehicle.Response.State == vehicleStateOnline {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return apierror.Wrap(http.StatusRequestTimeout, apierror.CodeVehicleUnavailable, fmt.Errorf("vehicle did not wake up: %w", ctx.Err()))
+		case <-time.After(wakePollInterval):
+		}
+		status, err = e.proxy.JSON(c, http.MethodGet, apiSegments("vehicles", ":vehicle_tag"), nil, nil, nil, &vehicle)
+	}
+}
+
+func respondCommandJob(c *gin.Context, status int, job *model.CommandJob) {
+	if !job.Finished() {
+		c.Header("Retry-After", strconv.Itoa(commandJobRetryAfter))
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(status, newCommandJobPayload(job))
+}
+
+func newCommandJobPayload(job *model.CommandJob) CommandJobPayload {
+	payload := CommandJobPayload{
+		ID:             job.ID.String(),
+		VIN:            job.VIN,
+		Command:        job.Command,
+		Status:         job.Status,
+		Reason:         job.Reason,
+		ErrorCode:      job.ErrorCode,
+		ResponseStatus: job.ResponseStatus,
+		StatusURL:      commandJobURL(job.ID),
+		CreatedAt:      job.CreatedAt,
+		UpdatedAt:      job.UpdatedAt,
+		FinishedAt:     job.FinishedAt,
+	}
+	if job.Response != "" {
+		if json.Valid([]byte(job.Response)) {
+			payload.Response = json.RawMessage(job.Response)
+		} else {
+			payload.Response, _ = json.Marshal(job.Response)
+		}
+	}
+	for _, event := range job.Events {
+		payload.Events = append(payload.Events, CommandJobEventPayload{Status: event.Status, Reason: event.Reason, At: event.CreatedAt})
+	}
+	return payload
+}
+
+func commandJobURL(id uuid.UUID) string {
+	return "/api/commands/" + id.String()
+}
@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"tds_server/internal/middleware"
+	"tds_server/internal/model"
+	"tds_server/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// eventJobStore keeps command jobs and their events in memory.
+type eventJobStore struct {
+	mu   sync.Mutex
+	jobs map[uuid.UUID]*model.CommandJob
+}
+
+func (s *eventJobStore) Create(job *model.CommandJob) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := *job
+	stored.Events = []model.CommandJobEvent{{JobID: job.ID, Status: job.Status}}
+	s.jobs[job.ID] = &stored
+	return nil
+}
+
+func (s *eventJobStore) Transition(id uuid.UUID, update model.CommandJobUpdate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job := s.jobs[id]
+	job.Status, job.Reason = update.Status, update.Reason
+	job.Events = append(job.Events, model.CommandJobEvent{JobID: id, Status: update.Status, Reason: update.Reason})
+	return nil
+}
+
+func (s *eventJobStore) Get(_, id uuid.UUID) (*model.CommandJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job := *s.jobs[id]
+	job.Events = append([]model.CommandJobEvent(nil), job.Events...)
+	return &job, nil
+}
+
+func (s *eventJobStore) ListBatch(_, batchID uuid.UUID) ([]model.CommandJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var jobs []model.CommandJob
+	for _, job := range s.jobs {
+		if job.BatchID != nil && *job.BatchID == batchID {
+			jobs = append(jobs, *job)
+		}
+	}
+	return jobs, nil
+}
+
+func TestStreamCommandJob(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	jobs := service.NewCommandJobService(&eventJobStore{jobs: map[uuid.UUID]*model.CommandJob{}}, "test", 1, 1, time.Second)
+	start := make(chan struct{})
+	job := &model.CommandJob{Command: "door_lock"}
+	err := jobs.Submit(context.Background(), job, func(ctx context.Context) (*service.CommandResult, error) {
+		<-start
+		service.ReportCommandProgress(ctx, service.CommandStageConnecting, "")
+		service.ReportCommandProgress(ctx, service.CommandStageSession, "")
+		service.ReportCommandProgress(ctx, service.CommandStageSent, "")
+		return &service.CommandResult{Status: http.StatusOK, Body: []byte(`{"response":{"result":true}}`)}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.GET("/commands/:command_id/events", func(c *gin.Context) {
+		c.Set(middleware.UserIDContextKey, uuid.New())
+	}, StreamCommandJob(jobs))
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/commands/" + job.ID.String() + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/event-stream") {
+		t.Fatalf("content type = %q", ct)
+	}
+	// The stored "queued" event has been flushed, so the stream is subscribed; let the job run.
+	close(start)
+
+	var events, stages []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if name, ok := strings.CutPrefix(line, "event:"); ok {
+			events = append(events, name)
+		}
+		if data, ok := strings.CutPrefix(line, "data:"); ok && events[len(events)-1] == "progress" {
+			var progress service.CommandProgress
+			if err := json.Unmarshal([]byte(data), &progress); err != nil {
+				t.Fatal(err)
+			}
+			stages = append(stages, progress.Stage)
+		}
+	}
+	wantStages := []string{service.CommandStageQueued, service.CommandStageConnecting, service.CommandStageSession,
+		service.CommandStageSent, service.CommandStageSucceeded}
+	if !reflect.DeepEqual(stages, wantStages) {
+		t.Fatalf("stages = %v, want %v", stages, wantStages)
+	}
+	if events[len(events)-1] != "done" {
+		t.Fatalf("last event = %q, want done", events[len(events)-1])
+	}
+}
@@ -0,0 +1,280 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"tds_server/internal/apierror"
+	"tds_server/internal/config"
+	"tds_server/internal/middleware"
+	"tds_server/internal/model"
+	"tds_server/internal/repository"
+	"tds_server/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// commandSceneParam is the route parameter carrying the scene id.
+const commandSceneParam = "scene_id"
+
+// CommandSceneRequest is the body of POST /api/v2/scenes and PUT /api/v2/scenes/{scene_id}.
+type CommandSceneRequest struct {
+	Name  string            `json:"name"`
+	Steps []model.SceneStep `json:"steps"`
+	// ContinueOnFailure runs the remaining steps after a failed or declined one.
+	ContinueOnFailure bool `json:"continue_on_failure,omitempty"`
+}
+
+// CommandScenePayload is a stored scene as returned to clients.
+type CommandScenePayload struct {
+	ID                string            `json:"id"`
+	Name              string            `json:"name"`
+	Steps             []model.SceneStep `json:"steps"`
+	ContinueOnFailure bool              `json:"continue_on_failure"`
+	CreatedAt         time.Time         `json:"created_at"`
+	UpdatedAt         time.Time         `json:"updated_at"`
+}
+
+// ListCommandScenes handles GET /api/v2/scenes. ListCommandScenes 返回当前用户的指令场景。
+func ListCommandScenes(scenes *service.CommandSceneService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := middleware.UserIDFromContext(c)
+		if !ok {
+			apierror.Write(c, apierror.New(http.StatusUnauthorized, apierror.CodeUnauthorized, "user is not authenticated"))
+			return
+		}
+		list, err := scenes.List(userID)
+		if err != nil {
+			respondWithError(c, http.StatusInternalServerError, err)
+			return
+		}
+		payloads := make([]CommandScenePayload, 0, len(list))
+		for i := range list {
+			payloads = append(payloads, newCommandScenePayload(&list[i]))
+		}
+		c.JSON(http.StatusOK, gin.H{"scenes": payloads})
+	}
+}
+
+// GetCommandScene handles GET /api/v2/scenes/{scene_id}. GetCommandScene 返回指定场景。
+func GetCommandScene(scenes *service.CommandSceneService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scene, ok := loadCommandScene(c, scenes)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, newCommandScenePayload(scene))
+	}
+}
+
+// CreateCommandScene handles POST /api/v2/scenes. CreateCommandScene 创建指令场景。
+func CreateCommandScene(scenes *service.CommandSceneService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := middleware.UserIDFromContext(c)
+		if !ok {
+			apierror.Write(c, apierror.New(http.StatusUnauthorized, apierror.CodeUnauthorized, "user is not authenticated"))
+			return
+		}
+		saveCommandScene(c, scenes, &model.CommandScene{UserID: userID}, http.StatusCreated)
+	}
+}
+
+// UpdateCommandScene handles PUT /api/v2/scenes/{scene_id}, replacing the scene.
+// UpdateCommandScene 整体替换指令场景。
+func UpdateCommandScene(scenes *service.CommandSceneService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scene, ok := loadCommandScene(c, scenes)
+		if !ok {
+			return
+		}
+		saveCommandScene(c, scenes, scene, http.StatusOK)
+	}
+}
+
+// DeleteCommandScene handles DELETE /api/v2/scenes/{scene_id}. DeleteCommandScene 删除指令场景。
+func DeleteCommandScene(scenes *service.CommandSceneService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, id, ok := commandSceneRequest(c)
+		if !ok {
+			return
+		}
+		if err := scenes.Delete(userID, id); err != nil {
+			if repository.IsNotFound(err) {
+				apierror.Write(c, apierror.New(http.StatusNotFound, apierror.CodeNotFound, "scene not found"))
+				return
+			}
+			respondWithError(c, http.StatusInternalServerError, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// RunCommandScene handles POST /api/v2/vehicles/{vehicle_tag}/scenes/{scene_id}/run, executing the
+// scene's steps in order on the vehicle and reporting each step. The response is 200 even when a step
+// failed; result is false then. With ?async=true the scene runs as one command job whose response is
+// the same report; scenes that may outlast service.MaxSyncSceneDuration must run that way.
+// RunCommandScene 在指定车辆上按顺序执行场景，返回逐步结果。
+func RunCommandScene(cfg *config.Config, tokenRepo *repository.TokenRepo, commandSvc *service.VehicleCommandService, vehicles *service.VehicleDirectory, jobs *service.CommandJobService, audit *service.CommandAuditService, scenes *service.CommandSceneService, privacyRepo *repository.PrivacyRepo) gin.HandlerFunc {
+	executor := newCommandExecutor(cfg, tokenRepo, commandSvc, vehicles, jobs, audit)
+	executor.privacy = newPrivacyStore(privacyRepo)
+	return runCommandScene(executor, cfg, scenes)
+}
+
+func runCommandScene(executor *commandExecutor, cfg *config.Config, scenes *service.CommandSceneService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scene, ok := loadCommandScene(c, scenes)
+		if !ok {
+			return
+		}
+		vehicleTag := c.Param(vehicleTagParam)
+
+		if wantsAsync(c) {
+			jobTimeout := cfg.Commands.JobTimeout
+			if jobTimeout <= 0 {
+				jobTimeout = service.DefaultCommandJobTimeout
+			}
+			ctx := service.WithCommandJobTimeout(c.Request.Context(), service.SceneTimeout(scene.Steps, jobTimeout))
+			c.Request = c.Request.WithContext(ctx)
+			executor.submit(c, vehicleTag, "scene:"+scene.Name, func(jc *gin.Context) (*service.CommandResult, error) {
+				vin, _, status, err := executor.proxy.commandVIN(jc, vehicleTag)
+				if err != nil {
+					return nil, apierror.From(status, err)
+				}
+				result := executor.runScene(jc, vin, scene)
+				response, err := sceneCommandResult(result)
+				if err != nil {
+					return nil, err
+				}
+				if failed := result.FailedStep(); failed != nil {
+					reason := fmt.Sprintf("step %d (%s) %s: %s", failed.Index+1, failed.Command, failed.Status, failed.Reason)
+					return nil, &service.CommandDeclinedError{Reason: reason, Result: response}
+				}
+				return response, nil
+			})
+			return
+		}
+
+		if duration := service.SceneDuration(scene.Steps); duration > service.MaxSyncSceneDuration {
+			executor.reject(c, vehicleTag, "scene:"+scene.Name, nil, apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest,
+				fmt.Sprintf("scene may take up to %s, more than the %s allowed for a synchronous run; use ?async=true", duration, service.MaxSyncSceneDuration)))
+			return
+		}
+		vin, _, status, err := executor.proxy.commandVIN(c, vehicleTag)
+		if err != nil {
+			apierror.Respond(c, status, err)
+			return
+		}
+		result := executor.runScene(c, vin, scene)
+		commandLog.InfoContext(c.Request.Context(), "command scene executed", "scene_id", scene.ID, "vin", vin, "result", result.Result)
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// runScene executes the scene on the vehicle c addresses, whose VIN is vin, through the command
+// pipeline used by the v1 and v2 routes.
+func (e *commandExecutor) runScene(c *gin.Context, vin string, scene *model.CommandScene) service.SceneRunResult {
+	result := service.RunScene(c.Request.Context(), scene, e.vehicleState(c), func(step model.SceneStep) service.SceneStepResult {
+		params := service.SceneStepParams(step)
+		// Steps were validated when the scene was saved, but the catalog may have changed since.
+		spec, apiErr := validateVehicleCommand(step.Command, params)
+		if apiErr == nil {
+			var result *service.CommandResult
+			if result, apiErr = e.run(c, vin, spec, spec.Name, params); apiErr == nil {
+				outcome := commandOutcome(spec.Name, result.Body)
+				stepResult := service.SceneStepResult{Status: service.SceneStepSucceeded, Reason: outcome.Reason, Verification: result.Verification}
+				if !outcome.Result {
+					stepResult.Status = service.SceneStepDeclined
+				}
+				if json.Valid(result.Body) {
+					stepResult.Response = result.Body
+				}
+				return stepResult
+			}
+		}
+		return service.SceneStepResult{Status: service.SceneStepFailed, Reason: apiErr.Message, ErrorCode: apiErr.Code}
+	})
+	result.VIN = vin
+	return result
+}
+
+// sceneCommandResult wraps a scene report as the response of its command job.
+func sceneCommandResult(result service.SceneRunResult) (*service.CommandResult, error) {
+	body, err := json.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("encode scene result: %w", err)
+	}
+	return &service.CommandResult{Status: http.StatusOK, Body: body, ContentType: "application/json"}, nil
+}
+
+func saveCommandScene(c *gin.Context, scenes *service.CommandSceneService, scene *model.CommandScene, status int) {
+	var request CommandSceneRequest
+	if apiErr := decodeV2Body(c, &request); apiErr != nil {
+		apierror.Write(c, apiErr)
+		return
+	}
+	scene.Name, scene.Steps, scene.ContinueOnFailure = request.Name, request.Steps, request.ContinueOnFailure
+
+	fieldErrors, err := scenes.Save(scene)
+	switch {
+	case len(fieldErrors) > 0:
+		apierror.Write(c, apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest, "invalid scene").WithDetails(fieldErrors))
+		return
+	case errors.Is(err, service.ErrSceneNameTaken):
+		apierror.Write(c, apierror.New(http.StatusConflict, apierror.CodeConflict, err.Error()))
+		return
+	case err != nil:
+		respondWithError(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(status, newCommandScenePayload(scene))
+}
+
+// commandSceneRequest reads the caller and the scene id, responding with an error when either is missing.
+func commandSceneRequest(c *gin.Context) (userID, id uuid.UUID, ok bool) {
+	userID, ok = middleware.UserIDFromContext(c)
+	if !ok {
+		apierror.Write(c, apierror.New(http.StatusUnauthorized, apierror.CodeUnauthorized, "user is not authenticated"))
+		return userID, id, false
+	}
+	id, err := uuid.Parse(c.Param(commandSceneParam))
+	if err != nil {
+		respondWithError(c, http.StatusBadRequest, fmt.Errorf("%s must be a UUID", commandSceneParam))
+		return userID, id, false
+	}
+	return userID, id, true
+}
+
+// loadCommandScene fetches the caller's scene, responding with an error when it cannot.
+func loadCommandScene(c *gin.Context, scenes *service.CommandSceneService) (*model.CommandScene, bool) {
+	userID, id, ok := commandSceneRequest(c)
+	if !ok {
+		return nil, false
+	}
+	scene, err := scenes.Get(userID, id)
+	if repository.IsNotFound(err) {
+		apierror.Write(c, apierror.New(http.StatusNotFound, apierror.CodeNotFound, "scene not found"))
+		return nil, false
+	}
+	if err != nil {
+		respondWithError(c, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	return scene, true
+}
+
+func newCommandScenePayload(scene *model.CommandScene) CommandScenePayload {
+	return CommandScenePayload{
+		ID:                scene.ID.String(),
+		Name:              scene.Name,
+		Steps:             scene.Steps,
+		ContinueOnFailure: scene.ContinueOnFailure,
+		CreatedAt:         scene.CreatedAt,
+		UpdatedAt:         scene.UpdatedAt,
+	}
+}
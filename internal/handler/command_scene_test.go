@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tds_server/internal/config"
+	"tds_server/internal/middleware"
+	"tds_server/internal/model"
+	"tds_server/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func TestSceneConditionsSeeMaskedLocation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	const vin = "5YJ3E1EA7KF123456"
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"response": map[string]any{
+			"id": 1, "vin": vin,
+			"drive_state":   map[string]any{"latitude": 31.234567, "longitude": 121.474567, "heading": 90, "speed": 0},
+			"location_data": map[string]any{"latitude": 31.234567, "longitude": 121.474567},
+		}})
+	}))
+	defer upstream.Close()
+
+	userID := uuid.New()
+	directory := service.NewVehicleDirectory(time.Minute)
+	directory.Store(userID, []service.VehicleIdentity{{ID: 1, IDS: "1", VIN: vin}})
+	executor := newCommandExecutor(&config.Config{TeslaAPIURL: upstream.URL}, newMemoryTokenStore(userID, "access", "refresh"), nil, directory, nil, nil)
+	executor.privacy = staticPrivacyStore{setting: &model.PrivacySetting{LocationMode: model.LocationModeHidden}}
+
+	c := userContext(userID, "/api/v2/vehicles/1/scenes/x/run")
+	c.Params = gin.Params{{Key: vehicleTagParam, Value: "1"}}
+	scene := &model.CommandScene{ID: uuid.New(), Name: "leave", Steps: []model.SceneStep{
+		{Command: "door_unlock", Condition: &model.SceneCondition{Field: "drive_state.latitude", Op: service.SceneConditionGt, Value: 0}},
+		{Command: "door_lock", Condition: &model.SceneCondition{Field: "location_data.longitude", Op: service.SceneConditionGt, Value: 0}},
+		{Command: "flash_lights", Condition: &model.SceneCondition{Field: "drive_state.speed", Op: service.SceneConditionEq, Value: 0}},
+	}}
+	result := service.RunScene(c.Request.Context(), scene, executor.vehicleState(c), func(model.SceneStep) service.SceneStepResult {
+		return service.SceneStepResult{Status: service.SceneStepSucceeded}
+	})
+
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(encoded), "31.23") || strings.Contains(string(encoded), "121.47") {
+		t.Fatalf("hidden policy leaked coordinates: %s", encoded)
+	}
+	for i, want := range []string{service.SceneStepSkipped, service.SceneStepSkipped, service.SceneStepSucceeded} {
+		if result.Steps[i].Status != want {
+			t.Fatalf("step %d = %s, want %s: %s", i, result.Steps[i].Status, want, encoded)
+		}
+	}
+}
+
+// memorySceneStore keeps scenes in memory in place of repository.CommandSceneRepo.
+type memorySceneStore struct {
+	scenes []model.CommandScene
+}
+
+func (s *memorySceneStore) List(uuid.UUID) ([]model.CommandScene, error) {
+	return s.scenes, nil
+}
+
+func (s *memorySceneStore) Get(userID, id uuid.UUID) (*model.CommandScene, error) {
+	for _, scene := range s.scenes {
+		if scene.UserID == userID && scene.ID == id {
+			return &scene, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (s *memorySceneStore) Save(scene *model.CommandScene) error {
+	s.scenes = append(s.scenes, *scene)
+	return nil
+}
+
+func (s *memorySceneStore) Delete(uuid.UUID, uuid.UUID) error {
+	return nil
+}
+
+func TestLongScenesMustRunAsync(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var upstreamCalls atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamCalls.Add(1)
+		http.Error(w, `{"error":"unexpected request"}`, http.StatusBadRequest)
+	}))
+	defer upstream.Close()
+
+	proxy, userID := newChargingTestProxy(upstream.URL)
+	store, audit := &memorySceneStore{}, &memoryAuditStore{}
+	scene := model.CommandScene{ID: uuid.New(), UserID: userID, Name: "warm up", Steps: []model.SceneStep{
+		{Command: "auto_conditioning_start"},
+		{Command: "door_unlock", DelaySeconds: 600},
+	}}
+	store.scenes = append(store.scenes, scene)
+	executor := &commandExecutor{proxy: proxy, audit: service.NewCommandAuditService(audit)}
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set(middleware.UserIDContextKey, userID) })
+	r.POST("/api/v2/vehicles/:vehicle_tag/scenes/:scene_id/run", runCommandScene(executor, &config.Config{}, service.NewCommandSceneService(store)))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v2/vehicles/Daily/scenes/"+scene.ID.String()+"/run", nil))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "async=true") {
+		t.Fatalf("status %d %s", w.Code, w.Body)
+	}
+	if upstreamCalls.Load() != 0 {
+		t.Fatalf("a rejected scene reached the vehicle")
+	}
+	if entries, _ := audit.List(model.CommandAuditFilter{}); len(entries) != 1 || entries[0].Outcome != model.CommandAuditRejected {
+		t.Fatalf("audit entries = %+v", entries)
+	}
+}
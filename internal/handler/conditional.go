@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// cacheControlPrivate lets clients keep per-user payloads but forces revalidation on every use.
+	cacheControlPrivate = "private, no-cache"
+	// dataFreshness is how long timestamped data counts as current after the vehicle reported it.
+	dataFreshness = 30 * time.Second
+)
+
+// respondCacheable writes body as JSON with a strong ETag and, when known, a Last-Modified header.
+// It answers 304 Not Modified when the request's If-None-Match (or If-Modified-Since) matches.
+// respondCacheable 会为响应体计算 ETag 并处理条件请求，命中时返回 304。
+func respondCacheable(c *gin.Context, status int, body any, lastModified time.Time) {
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		respondWithError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	if status != http.StatusOK {
+		c.Data(status, "application/json; charset=utf-8", encoded)
+		return
+	}
+
+	etag := computeETag(encoded)
+	header := c.Writer.Header()
+	header.Set("ETag", etag)
+	header.Set("Cache-Control", cacheControl(lastModified, time.Now()))
+	header.Add("Vary", "Authorization")
+	if !lastModified.IsZero() {
+		header.Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if notModified(c.Request, etag, lastModified) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.Data(status, "application/json; charset=utf-8", encoded)
+}
+
+// cacheControl lets clients reuse data reported at lastModified until it is dataFreshness old, so
+// max-age shrinks as the data ages. Untimestamped or stale data must be revalidated on every use.
+// cacheControl 按数据时间戳计算剩余的新鲜期，无时间戳或已过期的数据需每次重新验证。
+func cacheControl(lastModified, now time.Time) string {
+	if lastModified.IsZero() {
+		return cacheControlPrivate
+	}
+	remaining := int((dataFreshness - now.Sub(lastModified)) / time.Second)
+	if remaining <= 0 {
+		return cacheControlPrivate
+	}
+	// Clock skew must not extend the window beyond dataFreshness.
+	remaining = min(remaining, int(dataFreshness/time.Second))
+	return fmt.Sprintf("private, max-age=%d", remaining)
+}
+
+func computeETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// notModified applies RFC 9110 precedence: If-None-Match wins over If-Modified-Since.
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return etagMatches(inm, etag)
+	}
+
+	ims := r.Header.Get("If-Modified-Since")
+	if ims == "" || lastModified.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+	return !lastModified.Truncate(time.Second).After(since)
+}
+
+// etagMatches performs the weak comparison used for If-None-Match.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// unixMillis converts a Tesla millisecond timestamp into a time, returning zero for nil.
+func unixMillis(ms *int64) time.Time {
+	if ms == nil || *ms <= 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(*ms)
+}
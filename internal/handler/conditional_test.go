@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRespondCacheableHonorsConditionalHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	lastModified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	router := gin.New()
+	router.GET("/", func(c *gin.Context) {
+		respondCacheable(c, http.StatusOK, gin.H{"response": "ok"}, lastModified)
+	})
+
+	first := httptest.NewRecorder()
+	router.ServeHTTP(first, httptest.NewRequest(http.MethodGet, "/", nil))
+	if first.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", first.Code)
+	}
+	etag := first.Header().Get("ETag")
+	if etag == "" {
+		t.Fatalf("expected ETag header")
+	}
+	if got := first.Header().Get("Last-Modified"); got != "Wed, 01 May 2024 12:00:00 GMT" {
+		t.Fatalf("unexpected Last-Modified: %s", got)
+	}
+
+	cases := []struct {
+		name   string
+		header string
+		value  string
+		want   int
+	}{
+		{"matching etag", "If-None-Match", etag, http.StatusNotModified},
+		{"weak etag list", "If-None-Match", `"other", W/` + etag, http.StatusNotModified},
+		{"stale etag", "If-None-Match", `"other"`, http.StatusOK},
+		{"not modified since", "If-Modified-Since", "Wed, 01 May 2024 12:00:00 GMT", http.StatusNotModified},
+		{"modified since", "If-Modified-Since", "Wed, 01 May 2024 11:00:00 GMT", http.StatusOK},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(tc.header, tc.value)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != tc.want {
+				t.Fatalf("unexpected status: %d", rec.Code)
+			}
+			if tc.want == http.StatusNotModified && rec.Body.Len() != 0 {
+				t.Fatalf("304 must not carry a body")
+			}
+		})
+	}
+}
+
+func TestCacheControlFollowsDataAge(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name         string
+		lastModified time.Time
+		want         string
+	}{
+		{"no timestamp", time.Time{}, cacheControlPrivate},
+		{"fresh", now.Add(-10 * time.Second), "private, max-age=20"},
+		{"just reported", now, "private, max-age=30"},
+		{"clock skew", now.Add(time.Minute), "private, max-age=30"},
+		{"stale", now.Add(-time.Minute), cacheControlPrivate},
+	}
+	for _, tc := range cases {
+		if got := cacheControl(tc.lastModified, now); got != tc.want {
+			t.Fatalf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
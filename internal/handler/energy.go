@@ -0,0 +1,442 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"tds_server/internal/apierror"
+	"tds_server/internal/config"
+	"tds_server/internal/middleware"
+	"tds_server/internal/repository"
+	"tds_server/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// energySiteParam is the route parameter carrying the numeric energy_site_id.
+const energySiteParam = "energy_site_id"
+
+// ProductListResponse mirrors Tesla GET /api/1/products, which lists vehicles and energy sites together.
+type ProductListResponse struct {
+	Response []Product `json:"response"`
+	Count    int       `json:"count"`
+}
+
+// Product is either a vehicle or an energy site; exactly one of the fields is set. It is encoded as
+// the bare Tesla object so clients see the upstream shape.
+// Product 为车辆或能源站点之一，序列化时保持特斯拉原始结构。
+type Product struct {
+	Vehicle    *VehicleSummary
+	EnergySite *EnergySiteProduct
+}
+
+// EnergySiteProduct is an energy site entry of the product list (Powerwall, solar or both).
+type EnergySiteProduct struct {
+	EnergySiteID int64 `json:"energy_site_id"`
+	// ResourceType is battery or solar.
+	ResourceType string `json:"resource_type"`
+	SiteName     string `json:"site_name"`
+	// ID is the site's string identifier, e.g. STE12345678-12345.
+	ID          string `json:"id"`
+	GatewayID   string `json:"gateway_id,omitempty"`
+	AssetSiteID string `json:"asset_site_id,omitempty"`
+	// EnergyLeft and TotalPackEnergy are in Wh.
+	EnergyLeft        float64 `json:"energy_left"`
+	TotalPackEnergy   float64 `json:"total_pack_energy"`
+	PercentageCharged float64 `json:"percentage_charged"`
+	BatteryType       string  `json:"battery_type,omitempty"`
+	BackupCapable     bool    `json:"backup_capable"`
+	// BatteryPower is in W; positive while discharging.
+	BatteryPower     float64               `json:"battery_power"`
+	StormModeEnabled *bool                 `json:"storm_mode_enabled,omitempty"`
+	Components       *EnergySiteComponents `json:"components,omitempty"`
+	Features         map[string]any        `json:"features,omitempty"`
+}
+
+// EnergySiteComponents describes the hardware installed at a site.
+type EnergySiteComponents struct {
+	Battery              bool   `json:"battery"`
+	BatteryType          string `json:"battery_type,omitempty"`
+	Solar                bool   `json:"solar"`
+	SolarType            string `json:"solar_type,omitempty"`
+	Grid                 bool   `json:"grid"`
+	LoadMeter            bool   `json:"load_meter"`
+	MarketType           string `json:"market_type,omitempty"`
+	WallConnectors       []any  `json:"wall_connectors,omitempty"`
+	Backup               bool   `json:"backup,omitempty"`
+	StormModeCapable     bool   `json:"storm_mode_capable,omitempty"`
+	OffGridVehicleCharge bool   `json:"off_grid_vehicle_charging_reserve_supported,omitempty"`
+}
+
+// UnmarshalJSON tells vehicles and energy sites apart by the energy_site_id field.
+func (p *Product) UnmarshalJSON(data []byte) error {
+	var probe struct {
+		EnergySiteID json.RawMessage `json:"energy_site_id"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return err
+	}
+	if len(probe.EnergySiteID) > 0 && string(probe.EnergySiteID) != "null" {
+		p.EnergySite = &EnergySiteProduct{}
+		return json.Unmarshal(data, p.EnergySite)
+	}
+	p.Vehicle = &VehicleSummary{}
+	return json.Unmarshal(data, p.Vehicle)
+}
+
+// MarshalJSON encodes whichever product is set.
+func (p Product) MarshalJSON() ([]byte, error) {
+	if p.EnergySite != nil {
+		return json.Marshal(p.EnergySite)
+	}
+	return json.Marshal(p.Vehicle)
+}
+
+// EnergySiteInfoResponse mirrors Tesla GET /api/1/energy_sites/{energy_site_id}/site_info.
+type EnergySiteInfoResponse struct {
+	Response EnergySiteInfo `json:"response"`
+}
+
+// EnergySiteInfo holds the configuration of an energy site.
+type EnergySiteInfo struct {
+	ID                   string  `json:"id"`
+	SiteName             string  `json:"site_name"`
+	BackupReservePercent float64 `json:"backup_reserve_percent"`
+	// DefaultRealMode is the operation mode: self_consumption, backup or autonomous.
+	DefaultRealMode      string                `json:"default_real_mode"`
+	InstallationDate     string                `json:"installation_date"`
+	InstallationTimeZone string                `json:"installation_time_zone"`
+	Version              string                `json:"version"`
+	BatteryCount         int                   `json:"battery_count"`
+	NameplatePower       float64               `json:"nameplate_power"`
+	NameplateEnergy      float64               `json:"nameplate_energy"`
+	MaxSiteMeterPowerAC  float64               `json:"max_site_meter_power_ac"`
+	MinSiteMeterPowerAC  float64               `json:"min_site_meter_power_ac"`
+	VPPBackupReserve     *float64              `json:"vpp_backup_reserve_percent,omitempty"`
+	UserSettings         map[string]any        `json:"user_settings,omitempty"`
+	Components           *EnergySiteComponents `json:"components,omitempty"`
+	// TOUSettings holds the time-of-use tariff configuration, passed through as reported.
+	TOUSettings map[string]any `json:"tou_settings,omitempty"`
+}
+
+// EnergyLiveStatusResponse mirrors Tesla GET /api/1/energy_sites/{energy_site_id}/live_status.
+type EnergyLiveStatusResponse struct {
+	Response EnergyLiveStatus `json:"response"`
+}
+
+// EnergyLiveStatus is the current power flow of a site. Power values are in W, energy in Wh.
+type EnergyLiveStatus struct {
+	SolarPower        float64 `json:"solar_power"`
+	EnergyLeft        float64 `json:"energy_left"`
+	TotalPackEnergy   float64 `json:"total_pack_energy"`
+	PercentageCharged float64 `json:"percentage_charged"`
+	BackupCapable     bool    `json:"backup_capable"`
+	// BatteryPower is positive while discharging and negative while charging.
+	BatteryPower float64 `json:"battery_power"`
+	LoadPower    float64 `json:"load_power"`
+	// GridStatus is Active or Inactive (islanded).
+	GridStatus         string  `json:"grid_status"`
+	GridServicesActive bool    `json:"grid_services_active"`
+	GridPower          float64 `json:"grid_power"`
+	GridServicesPower  float64 `json:"grid_services_power"`
+	GeneratorPower     float64 `json:"generator_power"`
+	IslandStatus       string  `json:"island_status"`
+	StormModeActive    bool    `json:"storm_mode_active"`
+	Timestamp          string  `json:"timestamp"`
+	WallConnectors     []any   `json:"wall_connectors,omitempty"`
+}
+
+// EnergyCalendarHistoryResponse mirrors Tesla GET /api/1/energy_sites/{energy_site_id}/calendar_history.
+type EnergyCalendarHistoryResponse struct {
+	Response EnergyCalendarHistory `json:"response"`
+}
+
+// EnergyCalendarHistory holds aggregated history; TimeSeries for kind=energy or power, Events for kind=backup.
+type EnergyCalendarHistory struct {
+	SerialNumber         string             `json:"serial_number,omitempty"`
+	Period               string             `json:"period,omitempty"`
+	InstallationTimeZone string             `json:"installation_time_zone,omitempty"`
+	TimeSeries           []EnergyTimeSeries `json:"time_series,omitempty"`
+	Events               []BackupEvent      `json:"events,omitempty"`
+	TotalEvents          *int               `json:"total_events,omitempty"`
+}
+
+// EnergyTimeSeries is one bucket of energy (Wh) or power (W) history; fields absent for the
+// requested kind are omitted.
+type EnergyTimeSeries struct {
+	Timestamp string `json:"timestamp"`
+
+	SolarEnergyExported                 *float64 `json:"solar_energy_exported,omitempty"`
+	GeneratorEnergyExported             *float64 `json:"generator_energy_exported,omitempty"`
+	GridEnergyImported                  *float64 `json:"grid_energy_imported,omitempty"`
+	GridServicesEnergyImported          *float64 `json:"grid_services_energy_imported,omitempty"`
+	GridServicesEnergyExported          *float64 `json:"grid_services_energy_exported,omitempty"`
+	GridEnergyExportedFromSolar         *float64 `json:"grid_energy_exported_from_solar,omitempty"`
+	GridEnergyExportedFromGenerator     *float64 `json:"grid_energy_exported_from_generator,omitempty"`
+	GridEnergyExportedFromBattery       *float64 `json:"grid_energy_exported_from_battery,omitempty"`
+	BatteryEnergyExported               *float64 `json:"battery_energy_exported,omitempty"`
+	BatteryEnergyImportedFromGrid       *float64 `json:"battery_energy_imported_from_grid,omitempty"`
+	BatteryEnergyImportedFromSolar      *float64 `json:"battery_energy_imported_from_solar,omitempty"`
+	BatteryEnergyImportedFromGenerator  *float64 `json:"battery_energy_imported_from_generator,omitempty"`
+	ConsumerEnergyImportedFromGrid      *float64 `json:"consumer_energy_imported_from_grid,omitempty"`
+	ConsumerEnergyImportedFromSolar     *float64 `json:"consumer_energy_imported_from_solar,omitempty"`
+	ConsumerEnergyImportedFromBattery   *float64 `json:"consumer_energy_imported_from_battery,omitempty"`
+	ConsumerEnergyImportedFromGenerator *float64 `json:"consumer_energy_imported_from_generator,omitempty"`
+
+	SolarPower   *float64 `json:"solar_power,omitempty"`
+	BatteryPower *float64 `json:"battery_power,omitempty"`
+	GridPower    *float64 `json:"grid_power,omitempty"`
+}
+
+// BackupEvent is a grid outage during which the site ran on battery.
+type BackupEvent struct {
+	Timestamp string `json:"timestamp"`
+	// Duration is in milliseconds.
+	Duration int64 `json:"duration"`
+}
+
+// EnergyTelemetryHistoryResponse mirrors Tesla GET /api/1/energy_sites/{energy_site_id}/telemetry_history.
+type EnergyTelemetryHistoryResponse struct {
+	Response struct {
+		ChargeHistory []WallConnectorCharge `json:"charge_history"`
+	} `json:"response"`
+}
+
+// WallConnectorCharge is one charging session on a Wall Connector attached to the site.
+type WallConnectorCharge struct {
+	ChargeStartTime struct {
+		Seconds int64 `json:"seconds"`
+	} `json:"charge_start_time"`
+	ChargeDuration struct {
+		Seconds int64 `json:"seconds"`
+	} `json:"charge_duration"`
+	EnergyAddedWh float64 `json:"energy_added_wh"`
+}
+
+var (
+	calendarHistoryKinds   = map[string]struct{}{"energy": {}, "power": {}, "backup": {}, "soe": {}, "self_consumption": {}, "time_of_use_energy": {}, "savings": {}}
+	calendarHistoryPeriods = map[string]struct{}{"day": {}, "week": {}, "month": {}, "year": {}, "lifetime": {}}
+)
+
+// ListProducts proxies Tesla GET /api/1/products, returning the user's vehicles and energy sites.
+// ListProducts 返回用户名下的车辆与能源产品（Powerwall、太阳能）。
+func ListProducts(cfg *config.Config, tokenRepo *repository.TokenRepo, vehicles *service.VehicleDirectory, sites *service.EnergySiteDirectory) gin.HandlerFunc {
+	proxy := newTeslaProxy(cfg, tokenRepo, vehicles)
+	return func(c *gin.Context) {
+		var payload ProductListResponse
+		status, err := proxy.JSON(c, http.MethodGet, apiSegments("products"), nil, nil, nil, &payload)
+		if err != nil {
+			respondWithError(c, status, err)
+			return
+		}
+		syncEnergySiteDirectory(c, sites, &payload)
+		respondCacheable(c, status, payload, time.Time{})
+	}
+}
+
+// GetEnergySiteInfo proxies Tesla GET /api/1/energy_sites/{energy_site_id}/site_info.
+func GetEnergySiteInfo(cfg *config.Config, tokenRepo *repository.TokenRepo, vehicles *service.VehicleDirectory, sites *service.EnergySiteDirectory) gin.HandlerFunc {
+	return proxyEnergySiteJSON[EnergySiteInfoResponse](cfg, tokenRepo, vehicles, sites, "site_info", nil)
+}
+
+// GetEnergyLiveStatus proxies Tesla GET /api/1/energy_sites/{energy_site_id}/live_status.
+func GetEnergyLiveStatus(cfg *config.Config, tokenRepo *repository.TokenRepo, vehicles *service.VehicleDirectory, sites *service.EnergySiteDirectory) gin.HandlerFunc {
+	return proxyEnergySiteJSON[EnergyLiveStatusResponse](cfg, tokenRepo, vehicles, sites, "live_status", nil)
+}
+
+// GetEnergyCalendarHistory proxies Tesla GET /api/1/energy_sites/{energy_site_id}/calendar_history.
+// kind is required; period, start_date, end_date and time_zone are optional.
+func GetEnergyCalendarHistory(cfg *config.Config, tokenRepo *repository.TokenRepo, vehicles *service.VehicleDirectory, sites *service.EnergySiteDirectory) gin.HandlerFunc {
+	return proxyEnergySiteJSON[EnergyCalendarHistoryResponse](cfg, tokenRepo, vehicles, sites, "calendar_history", buildCalendarHistoryQuery)
+}
+
+// GetEnergyTelemetryHistory proxies Tesla GET /api/1/energy_sites/{energy_site_id}/telemetry_history,
+// which reports Wall Connector charging sessions (kind=charge).
+func GetEnergyTelemetryHistory(cfg *config.Config, tokenRepo *repository.TokenRepo, vehicles *service.VehicleDirectory, sites *service.EnergySiteDirectory) gin.HandlerFunc {
+	return proxyEnergySiteJSON[EnergyTelemetryHistoryResponse](cfg, tokenRepo, vehicles, sites, "telemetry_history", buildTelemetryHistoryQuery)
+}
+
+// proxyEnergySiteJSON builds a handler for GET /api/1/energy_sites/{energy_site_id}/<endpoint>. Sites
+// missing from the user's product list are rejected with 404 before the site endpoint is called.
+func proxyEnergySiteJSON[T any](cfg *config.Config, tokenRepo *repository.TokenRepo, vehicles *service.VehicleDirectory, sites *service.EnergySiteDirectory, endpoint string, buildQuery func(*gin.Context) (url.Values, error)) gin.HandlerFunc {
+	return energySiteJSON[T](newTeslaProxy(cfg, tokenRepo, vehicles), sites, endpoint, buildQuery)
+}
+
+func energySiteJSON[T any](proxy *teslaProxy, sites *service.EnergySiteDirectory, endpoint string, buildQuery func(*gin.Context) (url.Values, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		siteID, err := validateEnergySiteID(c.Param(energySiteParam))
+		if err != nil {
+			respondWithError(c, http.StatusBadRequest, err)
+			return
+		}
+		if status, err := proxy.checkEnergySite(c, sites, siteID); err != nil {
+			respondWithError(c, status, err)
+			return
+		}
+		var query url.Values
+		if buildQuery != nil {
+			var err error
+			if query, err = buildQuery(c); err != nil {
+				respondWithError(c, http.StatusBadRequest, err)
+				return
+			}
+		}
+
+		var payload T
+		status, err := proxy.JSON(c, http.MethodGet, apiSegments("energy_sites", ":"+energySiteParam, endpoint), query, nil, nil, &payload)
+		if err != nil {
+			respondWithError(c, status, err)
+			return
+		}
+		respondCacheable(c, status, payload, time.Time{})
+	}
+}
+
+func validateEnergySiteID(raw string) (int64, error) {
+	id, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("%s must be a positive integer", energySiteParam)
+	}
+	return id, nil
+}
+
+// checkEnergySite confirms the site is in the user's product list, refreshing the cached list from
+// Tesla when needed. Only GET /api/1/products is requested upstream, never the site itself.
+// checkEnergySite 校验站点属于当前用户，不属于时在请求特斯拉站点接口前直接返回 404。
+func (p *teslaProxy) checkEnergySite(c *gin.Context, sites *service.EnergySiteDirectory, siteID int64) (int, error) {
+	if sites == nil {
+		return http.StatusOK, nil
+	}
+	userID, ok := middleware.UserIDFromContext(c)
+	if !ok {
+		return http.StatusUnauthorized, fmt.Errorf("user is not authenticated")
+	}
+
+	listStatus := http.StatusBadGateway
+	lister := func(ctx context.Context) ([]int64, error) {
+		var payload ProductListResponse
+		status, err := p.JSON(c, http.MethodGet, apiSegments("products"), nil, nil, nil, &payload)
+		if err != nil {
+			listStatus = status
+			return nil, err
+		}
+		return energySiteIDs(&payload), nil
+	}
+
+	err := sites.Check(c.Request.Context(), userID, siteID, lister)
+	switch {
+	case err == nil:
+		return http.StatusOK, nil
+	case errors.Is(err, service.ErrEnergySiteNotFound):
+		return http.StatusNotFound, apierror.Wrap(http.StatusNotFound, apierror.CodeNotFound, err)
+	default:
+		return listStatus, err
+	}
+}
+
+// syncEnergySiteDirectory stores the energy sites of a product list fetched by ListProducts so later
+// site requests skip the ownership lookup.
+func syncEnergySiteDirectory(c *gin.Context, sites *service.EnergySiteDirectory, payload *ProductListResponse) {
+	if sites == nil {
+		return
+	}
+	if userID, ok := middleware.UserIDFromContext(c); ok {
+		sites.Store(userID, energySiteIDs(payload))
+	}
+}
+
+func energySiteIDs(payload *ProductListResponse) []int64 {
+	var ids []int64
+	for _, product := range payload.Response {
+		if product.EnergySite != nil {
+			ids = append(ids, product.EnergySite.EnergySiteID)
+		}
+	}
+	return ids
+}
+
+func buildCalendarHistoryQuery(c *gin.Context) (url.Values, error) {
+	kind := strings.TrimSpace(c.Query("kind"))
+	if _, ok := calendarHistoryKinds[kind]; !ok {
+		return nil, fmt.Errorf("kind must be one of energy, power, backup, soe, self_consumption, time_of_use_energy or savings")
+	}
+	if period := strings.TrimSpace(c.Query("period")); period != "" {
+		if _, ok := calendarHistoryPeriods[period]; !ok {
+			return nil, fmt.Errorf("period must be one of day, week, month, year or lifetime")
+		}
+	}
+	return historyQuery(c, historyQuerySpec{start: "start_date", end: "end_date", extra: []string{"kind", "period", "time_zone"}})
+}
+
+func buildTelemetryHistoryQuery(c *gin.Context) (url.Values, error) {
+	query, err := historyQuery(c, historyQuerySpec{start: "start_date", end: "end_date", extra: []string{"time_zone"}})
+	if err != nil {
+		return nil, err
+	}
+	query.Set("kind", "charge")
+	return query, nil
+}
+
+// historyQuerySpec names the parameters of a history endpoint: the date range, the optional paging
+// pair and other keys forwarded as they are. Energy and charging history share it, so both accept
+// the same formats and report the same errors.
+type historyQuerySpec struct {
+	start, end string
+	// page and size name the page (or offset) and page size parameters; empty when not paginated.
+	page, size string
+	// maxSize caps size.
+	maxSize int
+	extra   []string
+}
+
+// historyQuery forwards the keys of spec, checking that the range bounds are RFC 3339 and ordered,
+// the page is a non-negative integer and the size lies between 1 and spec.maxSize.
+func historyQuery(c *gin.Context, spec historyQuerySpec) (url.Values, error) {
+	query := passThroughQuery(c, append([]string{spec.start, spec.end}, spec.extra...)...)
+	if query == nil {
+		query = url.Values{}
+	}
+
+	var bounds [2]time.Time
+	for i, key := range []string{spec.start, spec.end} {
+		raw := query.Get(key)
+		if raw == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be an RFC 3339 timestamp", key)
+		}
+		bounds[i] = parsed
+	}
+	if start, end := bounds[0], bounds[1]; !start.IsZero() && !end.IsZero() && end.Before(start) {
+		return nil, fmt.Errorf("%s must not be before %s", spec.end, spec.start)
+	}
+
+	if spec.page != "" {
+		if raw := strings.TrimSpace(c.Query(spec.page)); raw != "" {
+			page, err := strconv.Atoi(raw)
+			if err != nil || page < 0 {
+				return nil, fmt.Errorf("%s must be a non-negative integer", spec.page)
+			}
+			query.Set(spec.page, strconv.Itoa(page))
+		}
+	}
+	if spec.size != "" {
+		if raw := strings.TrimSpace(c.Query(spec.size)); raw != "" {
+			size, err := strconv.Atoi(raw)
+			if err != nil || size < 1 || size > spec.maxSize {
+				return nil, fmt.Errorf("%s must be between 1 and %d", spec.size, spec.maxSize)
+			}
+			query.Set(spec.size, strconv.Itoa(size))
+		}
+	}
+	return query, nil
+}
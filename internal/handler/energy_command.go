@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"tds_server/internal/apierror"
+	"tds_server/internal/config"
+	"tds_server/internal/model"
+	"tds_server/internal/repository"
+	"tds_server/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// EnergyCommand handles POST /api/energy_sites/{energy_site_id}/command/{command}. Parameters are
+// validated and the site is checked against the user's product list before anything is sent to
+// Tesla, then the command is proxied with the usual token
+// refresh and error mapping and recorded in the audit log. EnergyCommand 校验能源指令参数后转发至特斯拉，并记录审计日志。
+func EnergyCommand(cfg *config.Config, tokenRepo *repository.TokenRepo, vehicles *service.VehicleDirectory, sites *service.EnergySiteDirectory, audit *service.CommandAuditService) gin.HandlerFunc {
+	return energyCommand(newTeslaProxy(cfg, tokenRepo, vehicles), sites, audit)
+}
+
+func energyCommand(proxy *teslaProxy, sites *service.EnergySiteDirectory, audit *service.CommandAuditService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		siteID := c.Param(energySiteParam)
+		id, err := validateEnergySiteID(siteID)
+		if err != nil {
+			apierror.Write(c, apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest, err.Error()))
+			return
+		}
+
+		commandName := strings.Trim(c.Param("command"), "/")
+		target := energySiteAuditTarget(siteID)
+		bodyBytes, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			apiErr := apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest, "failed to read request body")
+			recordRejected(c, audit, target, commandName, nil, apiErr)
+			apierror.Write(c, apiErr)
+			return
+		}
+
+		payload, err := service.ValidateEnergyCommand(commandName, bodyBytes)
+		if err != nil {
+			apiErr := apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest, err.Error())
+			if errors.Is(err, service.ErrUnknownEnergyCommand) {
+				apiErr = apierror.New(http.StatusNotFound, apierror.CodeNotFound,
+					fmt.Sprintf("unknown energy command %q, supported: %s", commandName, strings.Join(service.EnergyCommandNames(), ", ")))
+			}
+			recordRejected(c, audit, target, commandName, bodyBytes, apiErr)
+			apierror.Write(c, apiErr)
+			return
+		}
+		if status, err := proxy.checkEnergySite(c, sites, id); err != nil {
+			apiErr := apierror.From(status, err)
+			recordRejected(c, audit, target, commandName, bodyBytes, apiErr)
+			apierror.Write(c, apiErr)
+			return
+		}
+
+		path, status, err := proxy.resolvePath(c, apiSegments("energy_sites", ":"+energySiteParam, commandName))
+		if err != nil {
+			apiErr := apierror.From(status, err)
+			recordRejected(c, audit, target, commandName, bodyBytes, apiErr)
+			apierror.Write(c, apiErr)
+			return
+		}
+
+		start := time.Now()
+		resp, status, err := proxy.do(c, http.MethodPost, path, nil, payload, map[string]string{"Content-Type": "application/json"})
+		latency := time.Since(start)
+		commandLog.InfoContext(c.Request.Context(), "energy command executed",
+			"command", commandName, "energy_site_id", siteID, "status", status, "duration_ms", latency.Milliseconds(), "error", err)
+
+		entry := newCommandAudit(c, target, commandName, payload)
+		entry.Path, entry.LatencyMS = service.CommandPathREST, latency.Milliseconds()
+		if err != nil {
+			apiErr := apierror.From(status, err)
+			entry.Outcome, entry.HTTPStatus, entry.ErrorCode, entry.Reason = model.CommandAuditFailed, apiErr.Status, apiErr.Code, apiErr.Message
+			audit.Record(c.Request.Context(), entry)
+			apierror.Write(c, apiErr)
+			return
+		}
+		entry.HTTPStatus = resp.StatusCode()
+		if outcome := commandOutcome(commandName, resp.Body()); !outcome.Result {
+			entry.Outcome, entry.Reason = model.CommandAuditDeclined, outcome.Reason
+		}
+		audit.Record(c.Request.Context(), entry)
+
+		contentType := resp.Header().Get("Content-Type")
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		c.Data(resp.StatusCode(), contentType, resp.Body())
+	}
+}
+
+// energySiteAuditTarget is the audit log's vehicle column for commands sent to an energy site.
+func energySiteAuditTarget(siteID string) string {
+	return "energy_site:" + siteID
+}
@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tds_server/internal/middleware"
+	"tds_server/internal/model"
+	"tds_server/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// memoryAuditStore keeps the audit chain in memory in place of repository.CommandAuditRepo.
+type memoryAuditStore struct {
+	mu      sync.Mutex
+	entries []model.CommandAudit
+}
+
+func (s *memoryAuditStore) Append(entry *model.CommandAudit) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n := len(s.entries); n > 0 {
+		entry.PrevHash = s.entries[n-1].Hash
+	}
+	entry.ID = uint(len(s.entries) + 1)
+	entry.Hash = entry.ComputeHash(entry.PrevHash)
+	s.entries = append(s.entries, *entry)
+	return nil
+}
+
+func (s *memoryAuditStore) List(model.CommandAuditFilter) ([]model.CommandAudit, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]model.CommandAudit(nil), s.entries...), nil
+}
+
+func (s *memoryAuditStore) Chain(uint, int) ([]model.CommandAudit, error) {
+	return nil, nil
+}
+
+func TestEnergyCommandsAreAudited(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var sent string
+	var productLists, siteCalls atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/1/products" {
+			productLists.Add(1)
+			_, _ = w.Write([]byte(`{"response":[{"energy_site_id":429124,"resource_type":"battery","id":"STE12345678-12345"}],"count":1}`))
+			return
+		}
+		siteCalls.Add(1)
+		if r.URL.Path == "/api/1/energy_sites/429124/storm_mode" {
+			_, _ = w.Write([]byte(`{"response":{"result":false,"reason":"storm watch active"}}`))
+			return
+		}
+		if r.URL.Path != "/api/1/energy_sites/429124/backup" || r.Header.Get("Authorization") != "Bearer access" {
+			http.Error(w, `{"error":"unexpected request"}`, http.StatusBadRequest)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		sent = string(body)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"response":{"code":201,"message":"Updated"}}`))
+	}))
+	defer upstream.Close()
+
+	proxy, userID := newChargingTestProxy(upstream.URL)
+	store := &memoryAuditStore{}
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set(middleware.UserIDContextKey, userID) })
+	r.POST("/api/energy_sites/:energy_site_id/command/:command", energyCommand(proxy, service.NewEnergySiteDirectory(time.Minute), service.NewCommandAuditService(store)))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/energy_sites/429124/command/backup", strings.NewReader(`{"backup_reserve_percent": 20}`)))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Updated") {
+		t.Fatalf("status %d %s", w.Code, w.Body)
+	}
+	if sent != `{"backup_reserve_percent":20}` {
+		t.Fatalf("upstream body = %s", sent)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/energy_sites/429124/command/backup", strings.NewReader(`{"backup_reserve_percent": 101}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid params: status %d %s", w.Code, w.Body)
+	}
+
+	// A site outside the product list is rejected locally, from the cached list.
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/energy_sites/999999/command/backup", strings.NewReader(`{"backup_reserve_percent": 20}`)))
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "energy site not found") {
+		t.Fatalf("unowned site: status %d %s", w.Code, w.Body)
+	}
+	if siteCalls.Load() != 1 || productLists.Load() != 1 {
+		t.Fatalf("site calls = %d, product lists = %d, want 1 and 1", siteCalls.Load(), productLists.Load())
+	}
+
+	// A 2xx reporting result false is a declined command, not a success.
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/energy_sites/429124/command/storm_mode", strings.NewReader(`{"enabled": false}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("storm_mode: status %d %s", w.Code, w.Body)
+	}
+
+	entries, _ := store.List(model.CommandAuditFilter{})
+	if len(entries) != 4 {
+		t.Fatalf("audit entries = %+v", entries)
+	}
+	if rejected := entries[1]; rejected.VIN != "energy_site:429124" || rejected.Outcome != model.CommandAuditRejected || rejected.HTTPStatus != http.StatusBadRequest {
+		t.Fatalf("rejected entry = %+v", rejected)
+	}
+	if rejected := entries[2]; rejected.VIN != "energy_site:999999" || rejected.Outcome != model.CommandAuditRejected || rejected.HTTPStatus != http.StatusNotFound {
+		t.Fatalf("unowned site entry = %+v", rejected)
+	}
+	if declined := entries[3]; declined.Outcome != model.CommandAuditDeclined || declined.Reason != "storm watch active" {
+		t.Fatalf("declined entry = %+v", declined)
+	}
+	entry := entries[0]
+	if entry.UserID != userID || entry.VIN != "energy_site:429124" || entry.Command != "backup" ||
+		entry.Outcome != model.CommandAuditSucceeded || entry.HTTPStatus != http.StatusOK || entry.Path != service.CommandPathREST {
+		t.Fatalf("audit entry = %+v", entry)
+	}
+}
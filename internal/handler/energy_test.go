@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tds_server/internal/middleware"
+	"tds_server/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestProductListSplitsVehiclesAndEnergySites(t *testing.T) {
+	raw := `{"response":[
+		{"id":100021,"vehicle_id":99999,"vin":"5YJ3E1EA7KF123456","display_name":"Owned","state":"online","id_s":"100021"},
+		{"energy_site_id":429124,"resource_type":"battery","site_name":"Home","id":"STE12345678-12345","energy_left":21276.6,"total_pack_energy":25269,"percentage_charged":84.2,"backup_capable":true,"battery_power":-1500,"components":{"battery":true,"solar":true,"grid":true}}
+	],"count":2}`
+
+	var payload ProductListResponse
+	if err := json.Unmarshal([]byte(raw), &payload); err != nil {
+		t.Fatal(err)
+	}
+	if len(payload.Response) != 2 || payload.Response[0].Vehicle == nil || payload.Response[1].EnergySite == nil {
+		t.Fatalf("products not split: %+v", payload.Response)
+	}
+	site := payload.Response[1].EnergySite
+	if site.EnergySiteID != 429124 || site.ID != "STE12345678-12345" || !site.Components.Solar {
+		t.Fatalf("energy site decoded wrong: %+v", site)
+	}
+
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(encoded), `"vin":"5YJ3E1EA7KF123456"`) || !strings.Contains(string(encoded), `"energy_site_id":429124`) {
+		t.Fatalf("products must keep the upstream shape: %s", encoded)
+	}
+}
+
+func TestCalendarHistoryQueryValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	build := func(rawQuery string) error {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/?"+rawQuery, nil)
+		_, err := buildCalendarHistoryQuery(c)
+		return err
+	}
+
+	if err := build("kind=energy&period=day&start_date=2026-10-01T00:00:00Z&end_date=2026-10-02T00:00:00Z"); err != nil {
+		t.Fatalf("valid query rejected: %v", err)
+	}
+	for _, query := range []string{
+		"period=day",
+		"kind=energy&period=hour",
+		"kind=energy&start_date=yesterday",
+		"kind=energy&start_date=2026-10-02T00:00:00Z&end_date=2026-10-01T00:00:00Z",
+	} {
+		if err := build(query); err == nil {
+			t.Fatalf("%q must be rejected", query)
+		}
+	}
+}
+
+func TestEnergySiteRequestsRejectUnownedSites(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var siteCalls atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siteCalls.Add(1)
+		_, _ = w.Write([]byte(`{"response":{"id":"STE12345678-12345","site_name":"Home"}}`))
+	}))
+	defer upstream.Close()
+
+	proxy, userID := newChargingTestProxy(upstream.URL)
+	sites := service.NewEnergySiteDirectory(time.Minute)
+	sites.Store(userID, []int64{429124})
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set(middleware.UserIDContextKey, userID) })
+	r.GET("/api/1/energy_sites/:energy_site_id/site_info", energySiteJSON[EnergySiteInfoResponse](proxy, sites, "site_info", nil))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/1/energy_sites/429124/site_info", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Home") {
+		t.Fatalf("owned site: status %d %s", w.Code, w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/1/energy_sites/999999/site_info", nil))
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "not_found") {
+		t.Fatalf("unowned site: status %d %s", w.Code, w.Body)
+	}
+	if got := siteCalls.Load(); got != 1 {
+		t.Fatalf("upstream calls = %d, want only the owned site", got)
+	}
+}
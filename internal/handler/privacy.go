@@ -0,0 +1,358 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"tds_server/internal/apierror"
+	"tds_server/internal/config"
+	"tds_server/internal/middleware"
+	"tds_server/internal/model"
+	"tds_server/internal/repository"
+	"tds_server/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// PrivacySettingsRequest is the body of PUT /api/privacy and PUT /api/vehicles/{vehicle_tag}/privacy.
+type PrivacySettingsRequest struct {
+	// LocationMode is exact, coarse or hidden.
+	LocationMode string `json:"location_mode"`
+	// GeohashPrecision sets the cell size used by coarse mode (1-9, default 5).
+	GeohashPrecision *int `json:"geohash_precision,omitempty"`
+	// HomeZone masks coordinates inside the circle regardless of LocationMode.
+	HomeZone *HomeZonePayload `json:"home_zone,omitempty"`
+}
+
+// HomeZonePayload describes the circle masked as "home".
+type HomeZonePayload struct {
+	Latitude     float64 `json:"latitude"`
+	Longitude    float64 `json:"longitude"`
+	RadiusMeters int     `json:"radius_meters"`
+}
+
+// PrivacySettingsPayload is a stored privacy setting as returned to clients.
+type PrivacySettingsPayload struct {
+	// VIN is empty for the user's default setting.
+	VIN              string           `json:"vin,omitempty"`
+	LocationMode     string           `json:"location_mode"`
+	GeohashPrecision int              `json:"geohash_precision"`
+	HomeZone         *HomeZonePayload `json:"home_zone,omitempty"`
+	UpdatedAt        *time.Time       `json:"updated_at,omitempty"`
+}
+
+// PrivacySettingsResponse lists the default setting and the per-vehicle overrides of the user.
+type PrivacySettingsResponse struct {
+	Default  *PrivacySettingsPayload  `json:"default"`
+	Vehicles []PrivacySettingsPayload `json:"vehicles"`
+}
+
+// GetPrivacySettings returns the caller's privacy settings. GetPrivacySettings 返回当前用户的隐私设置。
+func GetPrivacySettings(privacyRepo *repository.PrivacyRepo) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := middleware.UserIDFromContext(c)
+		if !ok {
+			apierror.Write(c, apierror.New(http.StatusUnauthorized, apierror.CodeUnauthorized, "user is not authenticated"))
+			return
+		}
+		settings, err := privacyRepo.ListByUserID(userID)
+		if err != nil {
+			respondWithError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		response := PrivacySettingsResponse{Vehicles: []PrivacySettingsPayload{}}
+		for i := range settings {
+			payload := privacyPayload(&settings[i])
+			if settings[i].VIN == "" {
+				response.Default = &payload
+				continue
+			}
+			response.Vehicles = append(response.Vehicles, payload)
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// PutPrivacySettings stores the caller's default privacy setting. PutPrivacySettings 保存当前用户的默认隐私设置。
+func PutPrivacySettings(privacyRepo *repository.PrivacyRepo) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		savePrivacySetting(c, privacyRepo, "")
+	}
+}
+
+// PutVehiclePrivacySettings stores a privacy override for a single vehicle grant.
+// PutVehiclePrivacySettings 为单个车辆授权保存隐私覆盖设置。
+func PutVehiclePrivacySettings(cfg *config.Config, tokenRepo *repository.TokenRepo, vehicles *service.VehicleDirectory, privacyRepo *repository.PrivacyRepo) gin.HandlerFunc {
+	proxy := newTeslaProxy(cfg, tokenRepo, vehicles)
+	return func(c *gin.Context) {
+		vin, _, status, err := proxy.commandVIN(c, c.Param(vehicleTagParam))
+		if err != nil {
+			respondWithError(c, status, err)
+			return
+		}
+		savePrivacySetting(c, privacyRepo, vin)
+	}
+}
+
+// DeleteVehiclePrivacySettings removes a vehicle override so the user's default applies again.
+// DeleteVehiclePrivacySettings 删除车辆覆盖设置，恢复使用默认设置。
+func DeleteVehiclePrivacySettings(cfg *config.Config, tokenRepo *repository.TokenRepo, vehicles *service.VehicleDirectory, privacyRepo *repository.PrivacyRepo) gin.HandlerFunc {
+	proxy := newTeslaProxy(cfg, tokenRepo, vehicles)
+	return func(c *gin.Context) {
+		vin, _, status, err := proxy.commandVIN(c, c.Param(vehicleTagParam))
+		if err != nil {
+			respondWithError(c, status, err)
+			return
+		}
+		userID, ok := middleware.UserIDFromContext(c)
+		if !ok {
+			apierror.Write(c, apierror.New(http.StatusUnauthorized, apierror.CodeUnauthorized, "user is not authenticated"))
+			return
+		}
+		if err := privacyRepo.Delete(userID, vin); err != nil {
+			if repository.IsNotFound(err) {
+				apierror.Write(c, apierror.New(http.StatusNotFound, apierror.CodeNotFound, "privacy setting not found"))
+				return
+			}
+			respondWithError(c, http.StatusInternalServerError, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func savePrivacySetting(c *gin.Context, privacyRepo *repository.PrivacyRepo, vin string) {
+	userID, ok := middleware.UserIDFromContext(c)
+	if !ok {
+		apierror.Write(c, apierror.New(http.StatusUnauthorized, apierror.CodeUnauthorized, "user is not authenticated"))
+		return
+	}
+
+	var req PrivacySettingsRequest
+	decoder := json.NewDecoder(c.Request.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		apierror.Write(c, apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest, fmt.Sprintf("invalid request body: %v", err)))
+		return
+	}
+
+	setting := &model.PrivacySetting{
+		UserID:           userID,
+		VIN:              vin,
+		LocationMode:     strings.ToLower(strings.TrimSpace(req.LocationMode)),
+		GeohashPrecision: service.DefaultGeohashPrecision,
+	}
+	if req.GeohashPrecision != nil {
+		setting.GeohashPrecision = *req.GeohashPrecision
+	}
+	if zone := req.HomeZone; zone != nil {
+		setting.HomeLatitude = &zone.Latitude
+		setting.HomeLongitude = &zone.Longitude
+		setting.HomeRadiusMeters = zone.RadiusMeters
+	}
+	if err := service.ValidatePrivacySetting(setting); err != nil {
+		apierror.Write(c, apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest, err.Error()))
+		return
+	}
+
+	if err := privacyRepo.Save(setting); err != nil {
+		respondWithError(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, privacyPayload(setting))
+}
+
+func privacyPayload(setting *model.PrivacySetting) PrivacySettingsPayload {
+	payload := PrivacySettingsPayload{
+		VIN:              setting.VIN,
+		LocationMode:     setting.LocationMode,
+		GeohashPrecision: setting.GeohashPrecision,
+	}
+	if setting.HasHomeZone() {
+		payload.HomeZone = &HomeZonePayload{
+			Latitude:     *setting.HomeLatitude,
+			Longitude:    *setting.HomeLongitude,
+			RadiusMeters: setting.HomeRadiusMeters,
+		}
+	}
+	if !setting.UpdatedAt.IsZero() {
+		updatedAt := setting.UpdatedAt
+		payload.UpdatedAt = &updatedAt
+	}
+	return payload
+}
+
+// privacyStore is the part of repository.PrivacyRepo the location policy reads.
+type privacyStore interface {
+	GetEffective(userID uuid.UUID, vin string) (*model.PrivacySetting, error)
+}
+
+// locationMasker is implemented by every response that carries a vehicle position or anything
+// derived from it (distances, place names).
+type locationMasker interface {
+	ApplyLocationPolicy(policy service.LocationPolicy)
+}
+
+// newPrivacyStore keeps a nil repository a nil interface so locationPolicy can tell it is missing.
+func newPrivacyStore(privacyRepo *repository.PrivacyRepo) privacyStore {
+	if privacyRepo == nil {
+		return nil
+	}
+	return privacyRepo
+}
+
+// locationPolicy loads the effective privacy policy of the current user for vin. Every route that
+// returns location data must obtain its policy here. Tesla's hide_private flag always forces
+// coordinates to be hidden; when the payload does not carry it, the flag of the cached grant is used.
+// locationPolicy 读取当前用户对该车辆的隐私策略，所有返回位置数据的接口都必须经由此处；hide_private 为 true 时强制隐藏坐标。
+func (p *teslaProxy) locationPolicy(c *gin.Context, privacy privacyStore, vin string, hidePrivate bool) (service.LocationPolicy, error) {
+	userID, ok := middleware.UserIDFromContext(c)
+	if !ok {
+		return service.NewLocationPolicy(nil, hidePrivate), nil
+	}
+	if !hidePrivate && p.vehicles != nil && vin != "" {
+		if identity, found := p.vehicles.Cached(userID, vin); found {
+			hidePrivate = identity.HidePrivate
+		}
+	}
+	if privacy == nil {
+		return service.NewLocationPolicy(nil, hidePrivate), nil
+	}
+	setting, err := privacy.GetEffective(userID, vin)
+	if err != nil {
+		return service.LocationPolicy{}, err
+	}
+	return service.NewLocationPolicy(setting, hidePrivate), nil
+}
+
+// maskLocation applies the policy of vin to every target.
+func (p *teslaProxy) maskLocation(c *gin.Context, privacy privacyStore, vin string, hidePrivate bool, targets ...locationMasker) error {
+	policy, err := p.locationPolicy(c, privacy, vin, hidePrivate)
+	if err != nil {
+		return err
+	}
+	for _, target := range targets {
+		target.ApplyLocationPolicy(policy)
+	}
+	return nil
+}
+
+// policyByVIN returns a lookup that loads each vehicle's policy once, for responses listing records of
+// several vehicles.
+func (p *teslaProxy) policyByVIN(c *gin.Context, privacy privacyStore) func(vin string) (service.LocationPolicy, error) {
+	policies := map[string]service.LocationPolicy{}
+	return func(vin string) (service.LocationPolicy, error) {
+		if policy, ok := policies[vin]; ok {
+			return policy, nil
+		}
+		policy, err := p.locationPolicy(c, privacy, vin, false)
+		if err != nil {
+			return service.LocationPolicy{}, err
+		}
+		policies[vin] = policy
+		return policy, nil
+	}
+}
+
+// ApplyLocationPolicy masks every coordinate in the payload according to policy. Unknown fields of the
+// location-bearing sections and vehicle_data_combo cannot be checked, so they are dropped unless the
+// policy is exact. It must run before summaries, projections, ETags or any stored copy are derived
+// from the payload.
+// ApplyLocationPolicy 按策略处理所有坐标，必须在生成摘要、投影、ETag 或任何存储副本之前调用。
+func (d *VehicleData) ApplyLocationPolicy(policy service.LocationPolicy) {
+	if d == nil || policy.IsExact() {
+		return
+	}
+
+	if ds := d.DriveState; ds != nil {
+		visible := maskCoordinates(policy, &ds.Latitude, &ds.Longitude, true)
+		maskCoordinates(policy, &ds.NativeLatitude, &ds.NativeLongitude, visible)
+		maskCoordinates(policy, &ds.ActiveRouteLatitude, &ds.ActiveRouteLongitude, true)
+		if policy.HidesLocation() || !visible {
+			ds.Heading = nil
+		}
+		ds.Extra = nil
+	}
+	if loc := d.LocationData; loc != nil {
+		visible := maskCoordinates(policy, &loc.Latitude, &loc.Longitude, true)
+		maskCoordinates(policy, &loc.NativeLatitude, &loc.NativeLongitude, visible)
+		if policy.HidesLocation() || !visible {
+			loc.Heading = nil
+		}
+		loc.Extra = nil
+	}
+	if schedules := d.ChargeScheduleData; schedules != nil {
+		for i := range schedules.ChargeSchedules {
+			maskCoordinates(policy, &schedules.ChargeSchedules[i].Latitude, &schedules.ChargeSchedules[i].Longitude, true)
+			schedules.ChargeSchedules[i].Extra = nil
+		}
+		schedules.Extra = nil
+	}
+	if schedules := d.PreconditioningScheduleData; schedules != nil {
+		for i := range schedules.PreconditionSchedules {
+			maskCoordinates(policy, &schedules.PreconditionSchedules[i].Latitude, &schedules.PreconditionSchedules[i].Longitude, true)
+			schedules.PreconditionSchedules[i].Extra = nil
+		}
+		schedules.Extra = nil
+	}
+	if combo := d.VehicleDataCombo; combo != nil {
+		combo.Extra = nil
+	}
+	if vs := d.VehicleState; vs != nil {
+		// homelink_nearby tells whether the car is parked at home.
+		vs.HomelinkNearby = nil
+		stripCoordinateExtras(vs.Extra)
+	}
+	if cs := d.ChargeState; cs != nil {
+		stripCoordinateExtras(cs.Extra)
+	}
+	if cs := d.ClimateState; cs != nil {
+		stripCoordinateExtras(cs.Extra)
+	}
+	if cs := d.ClosuresState; cs != nil {
+		stripCoordinateExtras(cs.Extra)
+	}
+	if gs := d.GUISettings; gs != nil {
+		stripCoordinateExtras(gs.Extra)
+	}
+	if vc := d.VehicleConfig; vc != nil {
+		stripCoordinateExtras(vc.Extra)
+	}
+}
+
+// maskCoordinates applies policy to a latitude/longitude pair in place. When allowed is false the pair
+// is stripped, which keeps native (GCJ-02) coordinates consistent with the primary pair. It reports
+// whether the pair is still present.
+func maskCoordinates(policy service.LocationPolicy, lat, lon **float64, allowed bool) bool {
+	if *lat == nil || *lon == nil {
+		*lat, *lon = nil, nil
+		return allowed
+	}
+	if !allowed {
+		*lat, *lon = nil, nil
+		return false
+	}
+	maskedLat, maskedLon, ok := policy.Apply(**lat, **lon)
+	if !ok {
+		*lat, *lon = nil, nil
+		return false
+	}
+	*lat, *lon = &maskedLat, &maskedLon
+	return true
+}
+
+// stripCoordinateExtras drops unknown fields of sections without known location data that still look
+// like coordinates, since they cannot be masked.
+func stripCoordinateExtras(extra map[string]json.RawMessage) {
+	for key := range extra {
+		lower := strings.ToLower(key)
+		if strings.Contains(lower, "latitude") || strings.Contains(lower, "longitude") {
+			delete(extra, key)
+		}
+	}
+}
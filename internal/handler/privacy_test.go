@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"tds_server/internal/config"
+	"tds_server/internal/model"
+	"tds_server/internal/service"
+
+	"github.com/google/uuid"
+)
+
+func TestApplyLocationPolicyHidesCoordinates(t *testing.T) {
+	raw := `{
+		"drive_state": {"latitude": 31.3, "longitude": 121.5, "native_latitude": 31.29, "native_longitude": 121.49, "heading": 90, "speed": 10},
+		"location_data": {"latitude": 31.3, "longitude": 121.5, "heading": 90, "route_destination_latitude": 30.1},
+		"charge_schedule_data": {"charge_schedules": [{"id": 1, "latitude": 31.2, "longitude": 121.4}]}
+	}`
+	var data VehicleData
+	if err := json.Unmarshal([]byte(raw), &data); err != nil {
+		t.Fatal(err)
+	}
+
+	data.ApplyLocationPolicy(service.NewLocationPolicy(&model.PrivacySetting{LocationMode: model.LocationModeHidden}, false))
+
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		DriveState   map[string]any `json:"drive_state"`
+		LocationData map[string]any `json:"location_data"`
+	}
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	for section, fields := range map[string]map[string]any{"drive_state": decoded.DriveState, "location_data": decoded.LocationData} {
+		for _, key := range []string{"latitude", "longitude", "native_latitude", "native_longitude", "heading", "route_destination_latitude"} {
+			if _, ok := fields[key]; ok {
+				t.Fatalf("%s.%s must be stripped: %s", section, key, encoded)
+			}
+		}
+	}
+	if data.DriveState.Speed == nil {
+		t.Fatal("non-location fields must be kept")
+	}
+	if data.ChargeScheduleData.ChargeSchedules[0].Latitude != nil {
+		t.Fatal("schedule coordinates must be stripped")
+	}
+}
+
+// staticPrivacyStore returns the same setting for every vehicle.
+type staticPrivacyStore struct {
+	setting *model.PrivacySetting
+}
+
+func (s staticPrivacyStore) GetEffective(uuid.UUID, string) (*model.PrivacySetting, error) {
+	return s.setting, nil
+}
+
+func TestApplyLocationPolicyDropsUnknownFieldsUnlessExact(t *testing.T) {
+	raw := `{
+		"drive_state": {"speed": 10, "active_route_destination": "Office"},
+		"location_data": {"gps_as_of": 1, "plus_code": "8Q336FJ8+"},
+		"vehicle_state": {"homelink_nearby": true, "odometer": 100},
+		"vehicle_data_combo": {"timestamp": 1, "route": {"lat": 31.2}}
+	}`
+	decode := func() VehicleData {
+		var data VehicleData
+		if err := json.Unmarshal([]byte(raw), &data); err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	exact := decode()
+	exact.ApplyLocationPolicy(service.NewLocationPolicy(nil, false))
+	if exact.DriveState.Extra["active_route_destination"] == nil || exact.VehicleDataCombo.Extra["route"] == nil {
+		t.Fatal("exact policy must keep unknown fields")
+	}
+
+	coarse := decode()
+	coarse.ApplyLocationPolicy(service.NewLocationPolicy(&model.PrivacySetting{LocationMode: model.LocationModeCoarse, GeohashPrecision: 5}, false))
+	encoded, err := json.Marshal(coarse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, leak := range []string{"active_route_destination", "plus_code", "homelink_nearby", `"route"`} {
+		if strings.Contains(string(encoded), leak) {
+			t.Fatalf("coarse policy leaked %s: %s", leak, encoded)
+		}
+	}
+	if coarse.DriveState.Speed == nil || coarse.VehicleState.Odometer == nil {
+		t.Fatal("known non-location fields must be kept")
+	}
+}
+
+func TestLocationPolicyHonoursCachedHidePrivate(t *testing.T) {
+	userID := uuid.New()
+	directory := service.NewVehicleDirectory(time.Minute)
+	directory.Store(userID, []service.VehicleIdentity{{ID: 1, IDS: "1", VIN: "VIN1", HidePrivate: true}})
+	proxy := newTeslaProxy(&config.Config{}, nil, directory)
+
+	policy, err := proxy.locationPolicy(userContext(userID, "/"), staticPrivacyStore{}, "VIN1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !policy.HidesLocation() {
+		t.Fatalf("hide_private of the grant must hide the location: %+v", policy)
+	}
+}
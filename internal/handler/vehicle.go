@@ -1,24 +1,46 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
+	"tds_server/internal/apierror"
 	"tds_server/internal/config"
+	"tds_server/internal/logging"
 	"tds_server/internal/middleware"
 	"tds_server/internal/model"
 	"tds_server/internal/repository"
 	"tds_server/internal/service"
+	"tds_server/internal/upstream"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-resty/resty/v2"
 	"github.com/google/uuid"
+	"golang.org/x/sync/singleflight"
 )
 
+var teslaLog = logging.Logger(logging.SubsystemTesla)
+
+// maxErrorBodyBytes bounds how much of a streamed error response is read for the error envelope.
+const maxErrorBodyBytes = 64 << 10
+
+const (
+	// tokenRefreshLead is how long before expiry an access token is renewed proactively.
+	tokenRefreshLead = 5 * time.Minute
+	// tokenRefreshTimeout bounds a token refresh, which outlives the request that started it.
+	tokenRefreshTimeout = 30 * time.Second
+)
+
+// tokenRefreshes collapses concurrent token refreshes per user id.
+var tokenRefreshes singleflight.Group
+
 const teslaUserAgent = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/129.0.0.0 Safari/537.36"
 
 // VehicleListResponse mirrors the Tesla GET /api/1/vehicles payload.
@@ -90,9 +112,24 @@ type PaginationMeta struct {
 }
 
 // ListVehicles proxies Tesla GET /api/1/vehicles and documents the response payload.
-func ListVehicles(cfg *config.Config, tokenRepo *repository.TokenRepo) gin.HandlerFunc {
-	proxy := newTeslaProxy(cfg, tokenRepo)
+// With all=true every page is fetched server-side and merged into a single list.
+func ListVehicles(cfg *config.Config, tokenRepo *repository.TokenRepo, vehicles *service.VehicleDirectory) gin.HandlerFunc {
+	proxy := newTeslaProxy(cfg, tokenRepo, vehicles)
 	return func(c *gin.Context) {
+		if parseBoolQuery(c.Query("all")) {
+			perPage, _ := strconv.Atoi(strings.TrimSpace(c.Query("per_page")))
+			payload, status, err := fetchAllVehicles(c, proxy, perPage)
+			if err != nil {
+				respondWithError(c, status, err)
+				return
+			}
+			if payload.Pagination.Next == nil {
+				proxy.syncVehicleDirectory(c, payload.Response)
+			}
+			respondCacheable(c, status, payload, time.Time{})
+			return
+		}
+
 		query := buildVehicleListQuery(c)
 		var payload VehicleListResponse
 		status, err := proxy.JSON(c, http.MethodGet, apiSegments("vehicles"), query, nil, nil, &payload)
@@ -100,13 +137,16 @@ func ListVehicles(cfg *config.Config, tokenRepo *repository.TokenRepo) gin.Handl
 			respondWithError(c, status, err)
 			return
 		}
-		c.JSON(status, payload)
+		if isCompleteVehicleList(&payload) {
+			proxy.syncVehicleDirectory(c, payload.Response)
+		}
+		respondCacheable(c, status, payload, time.Time{})
 	}
 }
 
 // GetVehicle proxies Tesla GET /api/1/vehicles/{vehicle_tag} returning a single vehicle record.
-func GetVehicle(cfg *config.Config, tokenRepo *repository.TokenRepo) gin.HandlerFunc {
-	proxy := newTeslaProxy(cfg, tokenRepo)
+func GetVehicle(cfg *config.Config, tokenRepo *repository.TokenRepo, vehicles *service.VehicleDirectory) gin.HandlerFunc {
+	proxy := newTeslaProxy(cfg, tokenRepo, vehicles)
 	return func(c *gin.Context) {
 		var payload VehicleResponse
 		status, err := proxy.JSON(c, http.MethodGet, apiSegments("vehicles", ":vehicle_tag"), nil, nil, nil, &payload)
@@ -114,7 +154,7 @@ func GetVehicle(cfg *config.Config, tokenRepo *repository.TokenRepo) gin.Handler
 			respondWithError(c, status, err)
 			return
 		}
-		c.JSON(status, payload)
+		respondCacheable(c, status, payload, time.Time{})
 	}
 }
 
@@ -126,6 +166,8 @@ type VehicleResponse struct {
 // VehicleDataResponse mirrors Tesla GET /api/1/vehicles/{vehicle_tag}/vehicle_data payload.
 type VehicleDataResponse struct {
 	Response VehicleData `json:"response"`
+	// Units describes the units of numeric fields when the units query parameter was used.
+	Units *UnitSet `json:"units,omitempty"`
 }
 
 // VehicleData aggregates summary information alongside detailed vehicle states.
@@ -136,27 +178,27 @@ type VehicleData struct {
 	// UserVehicleBoundAt indicates when the user gained access to this vehicle.
 	UserVehicleBoundAt *string `json:"user_vehicle_bound_at"`
 	// ChargeState contains live charging information (voltage, current, limits).
-	ChargeState map[string]any `json:"charge_state"`
+	ChargeState *ChargeState `json:"charge_state"`
 	// ClimateState contains HVAC status such as temperatures and fan levels.
-	ClimateState map[string]any `json:"climate_state"`
+	ClimateState *ClimateState `json:"climate_state"`
 	// ClosuresState tracks door, window and trunk statuses.
-	ClosuresState map[string]any `json:"closures_state"`
+	ClosuresState *ClosuresState `json:"closures_state"`
 	// DriveState contains vehicle movement, heading and speed information.
-	DriveState map[string]any `json:"drive_state"`
+	DriveState *DriveState `json:"drive_state"`
 	// GUISettings reflects unit preferences for distance, time and temperature.
-	GUISettings map[string]any `json:"gui_settings"`
+	GUISettings *GUISettings `json:"gui_settings"`
 	// LocationData holds precise latitude and longitude coordinates.
-	LocationData map[string]any `json:"location_data"`
+	LocationData *LocationData `json:"location_data"`
 	// ChargeScheduleData reports scheduled charging configuration.
-	ChargeScheduleData map[string]any `json:"charge_schedule_data"`
+	ChargeScheduleData *ChargeScheduleData `json:"charge_schedule_data"`
 	// PreconditioningScheduleData reports scheduled HVAC preconditioning.
-	PreconditioningScheduleData map[string]any `json:"preconditioning_schedule_data"`
+	PreconditioningScheduleData *PreconditioningScheduleData `json:"preconditioning_schedule_data"`
 	// VehicleConfig lists hardware configuration such as trim, wheels and software packages.
-	VehicleConfig map[string]any `json:"vehicle_config"`
+	VehicleConfig *VehicleConfig `json:"vehicle_config"`
 	// VehicleState contains alarms, sentry mode, odometer and window/door sensors.
-	VehicleState map[string]any `json:"vehicle_state"`
+	VehicleState *VehicleState `json:"vehicle_state"`
 	// VehicleDataCombo is populated when requesting aggregated state bundles.
-	VehicleDataCombo map[string]any `json:"vehicle_data_combo"`
+	VehicleDataCombo *VehicleDataCombo `json:"vehicle_data_combo"`
 }
 
 // VehicleDriverListResponse mirrors Tesla GET /api/1/vehicles/{vehicle_tag}/drivers payload.
@@ -179,23 +221,77 @@ type VehicleDriver struct {
 }
 
 // GetVehicleData proxies Tesla GET /api/1/vehicles/{vehicle_tag}/vehicle_data for real-time state.
-func GetVehicleData(cfg *config.Config, tokenRepo *repository.TokenRepo) gin.HandlerFunc {
-	proxy := newTeslaProxy(cfg, tokenRepo)
+func GetVehicleData(cfg *config.Config, tokenRepo *repository.TokenRepo, vehicles *service.VehicleDirectory, privacyRepo *repository.PrivacyRepo) gin.HandlerFunc {
+	proxy := newTeslaProxy(cfg, tokenRepo, vehicles)
+	privacy := newPrivacyStore(privacyRepo)
 	return func(c *gin.Context) {
-		query := buildVehicleDataQuery(c)
+		units, err := parseUnitsQuery(c.Query("units"))
+		if err != nil {
+			respondWithError(c, http.StatusBadRequest, err)
+			return
+		}
+		view, err := parseViewQuery(c.Query("view"))
+		if err != nil {
+			respondWithError(c, http.StatusBadRequest, err)
+			return
+		}
+		fields, err := parseFieldsQuery(c.Query("fields"))
+		if err != nil {
+			respondWithError(c, http.StatusBadRequest, err)
+			return
+		}
+
+		// Narrow the upstream request to the sections the view or projection actually reads.
+		// 根据视图或字段投影收窄上游请求的模块，减少特斯拉返回的数据量。
+		var defaultEndpoints []string
+		switch {
+		case view == vehicleDataViewSummary:
+			defaultEndpoints = summaryEndpoints
+		case len(fields) > 0:
+			defaultEndpoints = endpointsForFields(fields)
+		}
+
+		query := buildVehicleDataQuery(c, units, defaultEndpoints)
 		var payload VehicleDataResponse
 		status, err := proxy.JSON(c, http.MethodGet, apiSegments("vehicles", ":vehicle_tag", "vehicle_data"), query, nil, nil, &payload)
 		if err != nil {
 			respondWithError(c, status, err)
 			return
 		}
-		c.JSON(status, payload)
+		if units != "" {
+			normalized := payload.Response.NormalizeUnits(units)
+			payload.Units = &normalized
+		}
+
+		// Privacy masking runs before any derived view so summaries, projections and ETags never see
+		// raw coordinates. 隐私处理需先于摘要、投影与 ETag 计算执行。
+		if err := proxy.maskLocation(c, privacy, payload.Response.VIN, payload.Response.GranularAccess.HidePrivate, &payload.Response); err != nil {
+			respondWithError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		var body any = payload
+		if view == vehicleDataViewSummary {
+			body = VehicleDataSummaryResponse{Response: payload.Response.Summary(), Units: payload.Units}
+		}
+		if len(fields) > 0 {
+			envelope, err := projectFields(body, prefixFields("response", fields))
+			if err != nil {
+				respondWithError(c, http.StatusInternalServerError, err)
+				return
+			}
+			if payload.Units != nil {
+				envelope["units"] = payload.Units
+			}
+			body = envelope
+		}
+		respondCacheable(c, status, body, unixMillis(payload.Response.latestTimestamp()))
 	}
 }
 
 // GetVehicleDrivers proxies Tesla GET /api/1/vehicles/{vehicle_tag}/drivers to list authorized drivers.
-func GetVehicleDrivers(cfg *config.Config, tokenRepo *repository.TokenRepo) gin.HandlerFunc {
-	proxy := newTeslaProxy(cfg, tokenRepo)
+func GetVehicleDrivers(cfg *config.Config, tokenRepo *repository.TokenRepo, vehicles *service.VehicleDirectory) gin.HandlerFunc {
+	proxy := newTeslaProxy(cfg, tokenRepo, vehicles)
 	return func(c *gin.Context) {
 		var payload VehicleDriverListResponse
 		status, err := proxy.JSON(c, http.MethodGet, apiSegments("vehicles", ":vehicle_tag", "drivers"), nil, nil, nil, &payload)
@@ -203,13 +299,13 @@ func GetVehicleDrivers(cfg *config.Config, tokenRepo *repository.TokenRepo) gin.
 			respondWithError(c, status, err)
 			return
 		}
-		c.JSON(status, payload)
+		respondCacheable(c, status, payload, time.Time{})
 	}
 }
 
 // WakeVehicle proxies Tesla POST /api/1/vehicles/{vehicle_tag}/wake_up.
-func WakeVehicle(cfg *config.Config, tokenRepo *repository.TokenRepo) gin.HandlerFunc {
-	proxy := newTeslaProxy(cfg, tokenRepo)
+func WakeVehicle(cfg *config.Config, tokenRepo *repository.TokenRepo, vehicles *service.VehicleDirectory) gin.HandlerFunc {
+	proxy := newTeslaProxy(cfg, tokenRepo, vehicles)
 	return func(c *gin.Context) {
 		var payload map[string]any
 		status, err := proxy.JSON(c, http.MethodPost, apiSegments("vehicles", ":vehicle_tag", "wake_up"), nil, nil, nil, &payload)
@@ -221,15 +317,23 @@ func WakeVehicle(cfg *config.Config, tokenRepo *repository.TokenRepo) gin.Handle
 	}
 }
 
+// tokenStore persists the users' Tesla tokens; repository.TokenRepo implements it.
+type tokenStore interface {
+	GetByUserID(userID uuid.UUID) (*model.UserToken, error)
+	Save(userID uuid.UUID, accessToken string, refreshToken string, expiresIn time.Duration) error
+}
+
 type teslaProxy struct {
 	cfg       *config.Config
-	tokenRepo *repository.TokenRepo
+	tokenRepo tokenStore
+	vehicles  *service.VehicleDirectory
 }
 
-func newTeslaProxy(cfg *config.Config, tokenRepo *repository.TokenRepo) *teslaProxy {
+func newTeslaProxy(cfg *config.Config, tokenRepo tokenStore, vehicles *service.VehicleDirectory) *teslaProxy {
 	return &teslaProxy{
 		cfg:       cfg,
 		tokenRepo: tokenRepo,
+		vehicles:  vehicles,
 	}
 }
 
@@ -243,9 +347,9 @@ func (p *teslaProxy) JSON(
 	headers map[string]string,
 	dest any,
 ) (int, error) {
-	path, err := resolveTeslaPath(c, pathSegments...)
+	path, status, err := p.resolvePath(c, pathSegments)
 	if err != nil {
-		return http.StatusBadRequest, err
+		return status, err
 	}
 
 	resp, status, err := p.do(c, method, path, query, body, headers)
@@ -267,6 +371,21 @@ func (p *teslaProxy) do(
 	query url.Values,
 	body []byte,
 	headers map[string]string,
+) (*resty.Response, int, error) {
+	return p.execute(c, method, path, query, body, headers, false)
+}
+
+// execute performs the upstream request with token refresh. With stream set the body is left unread
+// so large downloads can be copied straight to the client; the caller must close resp.RawBody().
+// Error responses are always read and closed here. execute 在 stream 模式下不缓冲响应体，由调用方负责关闭。
+func (p *teslaProxy) execute(
+	c *gin.Context,
+	method string,
+	path string,
+	query url.Values,
+	body []byte,
+	headers map[string]string,
+	stream bool,
 ) (*resty.Response, int, error) {
 	userID, ok := middleware.UserIDFromContext(c)
 	if !ok {
@@ -281,14 +400,14 @@ func (p *teslaProxy) do(
 		return nil, http.StatusUnauthorized, fmt.Errorf("user token not found")
 	}
 
-	token, err = ensureValidToken(p.cfg, p.tokenRepo, userID, token)
+	token, err = ensureValidToken(c.Request.Context(), p.cfg, p.tokenRepo, userID, token)
 	if err != nil {
-		return nil, http.StatusUnauthorized, fmt.Errorf("token refresh failed: %w", err)
+		return nil, http.StatusUnauthorized, apierror.Wrap(http.StatusUnauthorized, apierror.CodeTokenRefreshFailed, fmt.Errorf("token refresh failed: %w", err))
 	}
 
 	sanitizedQuery := sanitizeQuery(query)
 
-	client := resty.New()
+	client := upstream.NewClient()
 	client.SetContentLength(true)
 	client.SetHeader("User-Agent", teslaUserAgent)
 
@@ -320,7 +439,7 @@ func (p *teslaProxy) do(
 	requestURL := buildTeslaURL(p.cfg.TeslaAPIURL, path)
 
 	makeRequest := func(accessToken string) (*resty.Response, error) {
-		req := client.R()
+		req := newUpstreamRequest(c, client)
 		req.SetHeader("Authorization", "Bearer "+accessToken)
 		for k, v := range headerValues {
 			req.SetHeader(k, v)
@@ -331,38 +450,74 @@ func (p *teslaProxy) do(
 		if len(body) > 0 {
 			req.SetBody(body)
 		}
+		req.SetDoNotParseResponse(stream)
 		return req.Execute(strings.ToUpper(method), requestURL)
 	}
 
+	start := time.Now()
 	resp, err := makeRequest(token.AccessToken)
 	if err != nil {
-		return nil, http.StatusInternalServerError, err
+		teslaLog.WarnContext(c.Request.Context(), "tesla request failed", "method", method, "path", path, "error", err)
+		return nil, http.StatusBadGateway, apierror.Wrap(http.StatusBadGateway, apierror.CodeUpstreamUnavailable, err)
 	}
 
 	if resp.StatusCode() == http.StatusUnauthorized {
-		token, err = refreshUserToken(p.cfg, p.tokenRepo, userID, token)
+		discardRawBody(resp, stream)
+		token, err = refreshUserToken(c.Request.Context(), p.cfg, p.tokenRepo, userID, token)
 		if err != nil {
-			return nil, http.StatusUnauthorized, fmt.Errorf("token refresh failed: %w", err)
+			return nil, http.StatusUnauthorized, apierror.Wrap(http.StatusUnauthorized, apierror.CodeTokenRefreshFailed, fmt.Errorf("token refresh failed: %w", err))
 		}
 
 		resp, err = makeRequest(token.AccessToken)
 		if err != nil {
-			return nil, http.StatusInternalServerError, err
+			return nil, http.StatusBadGateway, apierror.Wrap(http.StatusBadGateway, apierror.CodeUpstreamUnavailable, err)
 		}
 		if resp.StatusCode() == http.StatusUnauthorized {
-			return nil, http.StatusUnauthorized, fmt.Errorf("unauthorized after token refresh")
+			apiErr := apierror.FromUpstream(resp.StatusCode(), responseBody(resp, stream))
+			apiErr.Message = "unauthorized after token refresh"
+			return nil, http.StatusUnauthorized, apiErr
 		}
 	}
 
+	teslaLog.DebugContext(c.Request.Context(), "tesla request completed",
+		"method", method, "path", path, "status", resp.StatusCode(), "duration_ms", time.Since(start).Milliseconds())
+
 	if resp.StatusCode() >= http.StatusBadRequest {
-		return nil, resp.StatusCode(), fmt.Errorf(resp.String())
+		return nil, resp.StatusCode(), apierror.FromUpstream(resp.StatusCode(), responseBody(resp, stream))
 	}
 
 	return resp, resp.StatusCode(), nil
 }
 
+// responseBody returns the body of resp, reading and closing the raw body of streamed responses.
+func responseBody(resp *resty.Response, stream bool) []byte {
+	if !stream {
+		return resp.Body()
+	}
+	defer resp.RawBody().Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.RawBody(), maxErrorBodyBytes))
+	return body
+}
+
+func discardRawBody(resp *resty.Response, stream bool) {
+	if stream {
+		resp.RawBody().Close()
+	}
+}
+
+// newUpstreamRequest binds the upstream request to the client request's context and forwards its
+// request ID. newUpstreamRequest 会绑定请求上下文并向特斯拉透传请求 ID。
+func newUpstreamRequest(c *gin.Context, client *resty.Client) *resty.Request {
+	req := client.R().SetContext(c.Request.Context())
+	if id := logging.RequestIDFromContext(c.Request.Context()); id != "" {
+		req.SetHeader(logging.RequestIDHeader, id)
+	}
+	return req
+}
+
+// respondWithError writes err using the unified error envelope. respondWithError 使用统一错误结构输出错误。
 func respondWithError(c *gin.Context, status int, err error) {
-	c.JSON(status, gin.H{"error": err.Error()})
+	apierror.Respond(c, status, err)
 }
 
 func buildVehicleListQuery(c *gin.Context) url.Values {
@@ -379,9 +534,22 @@ func buildVehicleListQuery(c *gin.Context) url.Values {
 	return query
 }
 
-func buildVehicleDataQuery(c *gin.Context) url.Values {
+func buildVehicleDataQuery(c *gin.Context, units string, defaultEndpoints []string) url.Values {
 	query := url.Values{}
-	if endpoints := strings.TrimSpace(c.Query("endpoints")); endpoints != "" {
+	endpoints := strings.TrimSpace(c.Query("endpoints"))
+	if endpoints == "" && len(defaultEndpoints) > 0 {
+		endpoints = strings.Join(defaultEndpoints, ";")
+	}
+	if endpoints != "" {
+		// units=gui needs the display preferences even when the caller filtered them out.
+		// units=gui 依赖 gui_settings，即使调用方未请求也需要补充。
+		if units == unitsGUI && !containsEndpoint(endpoints, "gui_settings") {
+			separator := ","
+			if strings.Contains(endpoints, ";") {
+				separator = ";"
+			}
+			endpoints += separator + "gui_settings"
+		}
 		query.Set("endpoints", endpoints)
 	}
 	if len(query) == 0 {
@@ -390,17 +558,37 @@ func buildVehicleDataQuery(c *gin.Context) url.Values {
 	return query
 }
 
+func prefixFields(prefix string, fields []string) []string {
+	prefixed := make([]string, 0, len(fields))
+	for _, field := range fields {
+		prefixed = append(prefixed, prefix+"."+field)
+	}
+	return prefixed
+}
+
+func containsEndpoint(endpoints, name string) bool {
+	for _, item := range strings.FieldsFunc(endpoints, func(r rune) bool { return r == ',' || r == ';' }) {
+		if strings.TrimSpace(item) == name {
+			return true
+		}
+	}
+	return false
+}
+
 func apiSegments(segments ...string) []string {
 	base := []string{"api", "1"}
 	return append(base, segments...)
 }
 
-func resolveTeslaPath(c *gin.Context, segments ...string) (string, error) {
+func resolveTeslaPath(c *gin.Context, overrides map[string]string, segments ...string) (string, error) {
 	resolved := make([]string, 0, len(segments))
 	for _, segment := range segments {
 		if strings.HasPrefix(segment, ":") {
 			key := strings.TrimPrefix(segment, ":")
-			value := c.Param(key)
+			value := overrides[key]
+			if value == "" {
+				value = c.Param(key)
+			}
 			if value == "" {
 				return "", fmt.Errorf("%s is required", key)
 			}
@@ -443,33 +631,60 @@ func sanitizeQuery(values url.Values) url.Values {
 
 // ensureValidToken proactively renews tokens that are about to expire (default 5 minutes window).
 // ensureValidToken 会在 token 剩余不足 5 分钟时主动刷新，避免后续请求命中 401。
-func ensureValidToken(cfg *config.Config, tokenRepo *repository.TokenRepo, userID uuid.UUID, token *model.UserToken) (*model.UserToken, error) {
-	if !token.IsExpired(5 * time.Minute) {
+func ensureValidToken(ctx context.Context, cfg *config.Config, tokenRepo tokenStore, userID uuid.UUID, token *model.UserToken) (*model.UserToken, error) {
+	if !token.IsExpired(tokenRefreshLead) {
 		return token, nil
 	}
-	return refreshUserToken(cfg, tokenRepo, userID, token)
+	return refreshUserToken(ctx, cfg, tokenRepo, userID, token)
 }
 
-func refreshUserToken(cfg *config.Config, tokenRepo *repository.TokenRepo, userID uuid.UUID, token *model.UserToken) (*model.UserToken, error) {
-	// Caller-side 401 guard relies on this function to be idempotent.
-	// 调用方的 401 回退依赖此函数幂等刷新，因此这里无需额外判断。
-	refreshed, err := service.RefreshToken(cfg, token.RefreshToken)
-	if err != nil {
-		return nil, err
-	}
+// refreshUserToken renews the user's tokens after stale was rejected or is about to expire. Tesla
+// rotates the refresh token on every use, so a second refresh with the same token fails and logs the
+// user out: concurrent refreshes of one user share a single call, and a token another request
+// renewed in the meantime is reused instead of refreshed again.
+// refreshUserToken 对同一用户的并发刷新只调用一次特斯拉，并复用其他请求已刷新的 token。
+func refreshUserToken(ctx context.Context, cfg *config.Config, tokenRepo tokenStore, userID uuid.UUID, stale *model.UserToken) (*model.UserToken, error) {
+	value, err, _ := tokenRefreshes.Do(userID.String(), func() (any, error) {
+		current, err := tokenRepo.GetByUserID(userID)
+		if err != nil {
+			return nil, err
+		}
+		if current == nil {
+			return nil, fmt.Errorf("user token not found")
+		}
+		if current.AccessToken != stale.AccessToken && !current.IsExpired(tokenRefreshLead) {
+			return current, nil
+		}
 
-	newRefresh := refreshed.RefreshToken
-	if newRefresh == "" {
-		newRefresh = token.RefreshToken
-	}
+		// Tesla spends the old refresh token as soon as it answers, so the refresh and the save must
+		// finish even when the client that triggered them has gone: a rotated token that is never
+		// stored logs the user out.
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), tokenRefreshTimeout)
+		defer cancel()
+		refreshed, err := service.RefreshToken(ctx, cfg, current.RefreshToken)
+		if err != nil {
+			return nil, err
+		}
+
+		newRefresh := refreshed.RefreshToken
+		if newRefresh == "" {
+			newRefresh = current.RefreshToken
+		}
+
+		expiresIn := time.Duration(refreshed.ExpiresIn)
+		if err := tokenRepo.Save(userID, refreshed.AccessToken, newRefresh, expiresIn); err != nil {
+			return nil, err
+		}
 
-	expiresIn := time.Duration(refreshed.ExpiresIn)
-	if err := tokenRepo.Save(userID, refreshed.AccessToken, newRefresh, expiresIn); err != nil {
+		current.AccessToken = refreshed.AccessToken
+		current.RefreshToken = newRefresh
+		current.ExpiresAt = time.Now().Add(expiresIn * time.Second)
+		return current, nil
+	})
+	if err != nil {
 		return nil, err
 	}
-
-	token.AccessToken = refreshed.AccessToken
-	token.RefreshToken = newRefresh
-	token.ExpiresAt = time.Now().Add(expiresIn * time.Second)
-	return token, nil
+	// Every caller of the flight gets its own copy.
+	token := *value.(*model.UserToken)
+	return &token, nil
 }
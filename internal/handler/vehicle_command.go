@@ -1,157 +1,428 @@
 package handler
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
+	"tds_server/internal/apierror"
 	"tds_server/internal/config"
+	"tds_server/internal/logging"
 	"tds_server/internal/middleware"
+	"tds_server/internal/model"
 	"tds_server/internal/repository"
 	"tds_server/internal/service"
+	"tds_server/internal/upstream"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-resty/resty/v2"
 )
 
+var commandLog = logging.Logger(logging.SubsystemCommand)
+
+// verifyQueryParam asks to confirm a command's effect in vehicle_data (?verify=true).
+const verifyQueryParam = "verify"
+
 // VehicleCommand handles Tesla vehicle command requests via POST. VehicleCommand 统一处理 Tesla 车辆指令调用，所有指令均通过 POST 方式触发。
-func VehicleCommand(cfg *config.Config, tokenRepo *repository.TokenRepo, commandSvc *service.VehicleCommandService) gin.HandlerFunc {
+func VehicleCommand(cfg *config.Config, tokenRepo *repository.TokenRepo, commandSvc *service.VehicleCommandService, vehicles *service.VehicleDirectory, jobs *service.CommandJobService, audit *service.CommandAuditService) gin.HandlerFunc {
+	executor := newCommandExecutor(cfg, tokenRepo, commandSvc, vehicles, jobs, audit)
 	return func(c *gin.Context) {
 		if c.Request.Method != http.MethodPost {
-			c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "method not allowed"})
-			return
-		}
-
-		commandPath := strings.Trim(c.Param("command_path"), "/")
-		if commandPath == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "command_path is required"})
+			apierror.Write(c, apierror.New(http.StatusMethodNotAllowed, apierror.CodeMethodNotAllowed, "method not allowed"))
 			return
 		}
 
 		vehicleTag := c.Param("vehicle_tag")
 		if vehicleTag == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "vehicle_tag is required"})
+			apierror.Write(c, apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest, "vehicle_tag is required"))
 			return
 		}
 
-		userID, ok := middleware.UserIDFromContext(c)
-		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "user is not authenticated"})
+		commandPath := strings.Trim(c.Param("command_path"), "/")
+		bodyBytes, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			executor.reject(c, vehicleTag, commandPath, nil, apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest, "failed to read request body"))
+			return
+		}
+		if commandPath == "" {
+			executor.reject(c, vehicleTag, commandPath, bodyBytes, apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest, "command_path is required"))
 			return
 		}
 
-		token, err := tokenRepo.GetByUserID(userID)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		// Validate against the command catalog before touching the vehicle so clients get field-level
+		// errors instead of a generic rejection from the SDK. 先按指令目录校验参数，返回逐字段错误。
+		commandName := strings.Split(commandPath, "/")[0]
+		spec, apiErr := validateVehicleCommand(commandName, bodyBytes)
+		if apiErr != nil {
+			executor.reject(c, vehicleTag, commandPath, bodyBytes, apiErr)
 			return
 		}
 
-		token, err = ensureValidToken(cfg, tokenRepo, userID, token)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "token refresh failed: " + err.Error()})
+		if wantsAsync(c) {
+			executor.submit(c, vehicleTag, spec.Name, executor.commandTask(vehicleTag, spec, commandPath, bodyBytes))
 			return
 		}
 
-		bodyBytes, err := io.ReadAll(c.Request.Body)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read request body"})
+		result, apiErr := executor.run(c, vehicleTag, spec, commandPath, bodyBytes)
+		if apiErr != nil {
+			apierror.Write(c, apiErr)
 			return
 		}
+		c.Data(result.Status, result.ContentType, result.Body)
+	}
+}
 
-		var commandResult *service.CommandResult
-		if commandSvc != nil {
-			commandName := strings.Split(commandPath, "/")[0]
-			commandResult, err = commandSvc.Execute(c.Request.Context(), vehicleTag, commandName, bodyBytes, token.AccessToken)
-			switch {
-			case err == nil && commandResult != nil:
-				c.Data(commandResult.Status, commandResult.ContentType, commandResult.Body)
-				return
-			case errors.Is(err, service.ErrVehicleCommandUseREST):
-				// fall back to REST handling below. 在下方回退到 REST 处理。
-			case err != nil:
-				var cmdErr *service.CommandError
-				if errors.As(err, &cmdErr) {
-					if len(cmdErr.Body) > 0 {
-						c.Data(cmdErr.Status, "application/json", cmdErr.Body)
-					} else {
-						c.JSON(cmdErr.Status, gin.H{"error": cmdErr.Error()})
-					}
-					return
-				}
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return
-			}
+// commandExecutor runs a validated vehicle command for the authenticated user: it resolves the
+// vehicle, refreshes the token, tries the SDK and falls back to the REST endpoint when needed.
+// commandExecutor 负责解析车辆、刷新令牌并通过 SDK 或 REST 执行指令，供 v1 与 v2 接口共用。
+type commandExecutor struct {
+	cfg        *config.Config
+	tokenRepo  tokenStore
+	commandSvc *service.VehicleCommandService
+	proxy      *teslaProxy
+	// jobs runs asynchronous commands; nil disables async mode.
+	jobs *service.CommandJobService
+	// audit records every attempt; nil disables auditing.
+	audit *service.CommandAuditService
+	// privacy supplies the location policy applied to vehicle state read for scene conditions; when
+	// nil only hide_private is honoured.
+	privacy privacyStore
+}
+
+func newCommandExecutor(cfg *config.Config, tokenRepo tokenStore, commandSvc *service.VehicleCommandService, vehicles *service.VehicleDirectory, jobs *service.CommandJobService, audit *service.CommandAuditService) *commandExecutor {
+	return &commandExecutor{cfg: cfg, tokenRepo: tokenRepo, commandSvc: commandSvc, proxy: newTeslaProxy(cfg, tokenRepo, vehicles), jobs: jobs, audit: audit}
+}
+
+// run executes commandPath (the command name, optionally followed by REST sub-paths) against
+// vehicleTag and records the attempt in the audit log. The returned error carries the status to
+// respond with.
+func (e *commandExecutor) run(c *gin.Context, vehicleTag string, spec service.CommandSpec, commandPath string, bodyBytes []byte) (*service.CommandResult, *apierror.Error) {
+	attempt := &commandAttempt{vin: vehicleTag}
+	start := time.Now()
+	result, apiErr := e.execute(c, vehicleTag, spec, commandPath, bodyBytes, attempt)
+	e.record(c, spec, commandPath, bodyBytes, attempt, time.Since(start), result, apiErr)
+	if apiErr == nil && wantsVerify(c) && commandOutcome(spec.Name, result.Body).Result {
+		e.verify(c, spec.Name, bodyBytes, result)
+	}
+	return result, apiErr
+}
+
+// commandTask runs a single command as the task of an asynchronous job; a command the vehicle
+// declines fails the job with service.CommandDeclinedError.
+func (e *commandExecutor) commandTask(vehicleTag string, spec service.CommandSpec, commandPath string, bodyBytes []byte) func(c *gin.Context) (*service.CommandResult, error) {
+	return func(c *gin.Context) (*service.CommandResult, error) {
+		result, apiErr := e.run(c, vehicleTag, spec, commandPath, bodyBytes)
+		if apiErr != nil {
+			return nil, apiErr
 		}
+		if outcome := commandOutcome(spec.Name, result.Body); !outcome.Result {
+			return nil, &service.CommandDeclinedError{Reason: outcome.Reason, Result: result}
+		}
+		return result, nil
+	}
+}
 
-		requestURL := buildVehicleCommandURL(cfg.TeslaAPIURL, vehicleTag, commandPath)
+// record writes the attempt to the audit log.
+func (e *commandExecutor) record(c *gin.Context, spec service.CommandSpec, commandPath string, bodyBytes []byte, attempt *commandAttempt, latency time.Duration, result *service.CommandResult, apiErr *apierror.Error) {
+	if e.audit == nil {
+		return
+	}
 
-		query := c.Request.URL.Query()
-		query.Del("user_id")
+	entry := newCommandAudit(c, attempt.vin, commandPath, bodyBytes)
+	entry.Path, entry.LatencyMS = attempt.path, latency.Milliseconds()
+	switch {
+	case apiErr != nil:
+		entry.Outcome, entry.HTTPStatus, entry.ErrorCode, entry.Reason = model.CommandAuditFailed, apiErr.Status, apiErr.Code, apiErr.Message
+	default:
+		entry.HTTPStatus = result.Status
+		if outcome := commandOutcome(spec.Name, result.Body); !outcome.Result {
+			entry.Outcome, entry.Reason = model.CommandAuditDeclined, outcome.Reason
+		}
+	}
+	e.audit.Record(c.Request.Context(), entry)
+}
 
-		makeRequest := func(accessToken string) (*resty.Response, error) {
-			client := resty.New()
-			client.SetContentLength(true)
-			client.SetHeader("User-Agent", teslaUserAgent)
+// reject records a request that failed validation, and so reached neither Tesla nor the vehicle, in
+// the audit log and responds with apiErr.
+func (e *commandExecutor) reject(c *gin.Context, vehicleTag, command string, bodyBytes []byte, apiErr *apierror.Error) {
+	recordRejected(c, e.audit, vehicleTag, command, bodyBytes, apiErr)
+	apierror.Write(c, apiErr)
+}
 
-			req := client.R()
-			req.SetHeader("Authorization", "Bearer "+accessToken)
+// recordRejected writes a request rejected with apiErr before anything was sent to the audit log.
+func recordRejected(c *gin.Context, audit *service.CommandAuditService, target, command string, bodyBytes []byte, apiErr *apierror.Error) {
+	entry := newCommandAudit(c, target, command, bodyBytes)
+	entry.Outcome, entry.HTTPStatus, entry.ErrorCode, entry.Reason = model.CommandAuditRejected, apiErr.Status, apiErr.Code, apiErr.Message
+	audit.Record(c.Request.Context(), entry)
+}
 
-			if accept := c.GetHeader("Accept"); accept != "" {
-				req.SetHeader("Accept", accept)
-			}
-			if contentType := c.GetHeader("Content-Type"); contentType != "" {
-				req.SetHeader("Content-Type", contentType)
-			} else if len(bodyBytes) > 0 {
-				req.SetHeader("Content-Type", "application/json")
-			}
-			if len(bodyBytes) > 0 {
-				req.SetBody(bodyBytes)
-			}
-			if len(query) > 0 {
-				req.SetQueryString(query.Encode())
-			}
-			return req.Post(requestURL)
+// newCommandAudit returns a succeeded audit entry of the caller for command sent to target, a VIN
+// or an energy site (see energySiteAuditTarget).
+func newCommandAudit(c *gin.Context, target, command string, params []byte) *model.CommandAudit {
+	userID, _ := middleware.UserIDFromContext(c)
+	return &model.CommandAudit{
+		UserID:    userID,
+		Actor:     middleware.ActorFromContext(c),
+		RequestID: logging.RequestIDFromContext(c.Request.Context()),
+		VIN:       target,
+		Command:   command,
+		Params:    string(params),
+		Outcome:   model.CommandAuditSucceeded,
+	}
+}
+
+// verify polls vehicle_data until the command's expected effect shows up and adds the outcome to
+// result, both as Verification and as a "verification" member of the JSON body.
+// verify 轮询 vehicle_data 确认指令效果，并把校验结果写入响应。
+func (e *commandExecutor) verify(c *gin.Context, command string, bodyBytes []byte, result *service.CommandResult) {
+	params := map[string]any{}
+	if len(bytes.TrimSpace(bodyBytes)) > 0 {
+		_ = json.Unmarshal(bodyBytes, &params)
+	}
+	timeout := e.cfg.Commands.VerifyTimeout
+	if timeout <= 0 {
+		timeout = service.DefaultCommandVerifyTimeout
+	}
+	verification := service.VerifyCommandState(c.Request.Context(), service.CommandStateChecks(command, params), e.vehicleState(c), timeout, service.DefaultCommandVerifyInterval)
+	commandLog.InfoContext(c.Request.Context(), "vehicle command verified",
+		"command", command, "status", verification.Status, "attempts", verification.Attempts, "duration_ms", verification.ElapsedMS)
+
+	result.Verification = &verification
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(result.Body, &body); err != nil {
+		return
+	}
+	if encoded, err := json.Marshal(verification); err == nil {
+		body["verification"] = encoded
+		if merged, err := json.Marshal(body); err == nil {
+			result.Body = merged
 		}
+	}
+}
 
-		resp, err := makeRequest(token.AccessToken)
+// vehicleState reads vehicle_data sections of the vehicle c addresses. The caller's location policy is
+// applied first, so scene conditions and the values they report never see more than vehicle_data
+// would return.
+func (e *commandExecutor) vehicleState(c *gin.Context) service.VehicleStateFetcher {
+	return func(_ context.Context, sections []string) (map[string]any, error) {
+		var payload VehicleDataResponse
+		query := url.Values{"endpoints": {strings.Join(sections, ";")}}
+		status, err := e.proxy.JSON(c, http.MethodGet, apiSegments("vehicles", ":vehicle_tag", "vehicle_data"), query, nil, nil, &payload)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
+			return nil, apierror.From(status, err)
+		}
+		data := &payload.Response
+		if err := e.proxy.maskLocation(c, e.privacy, data.VIN, data.GranularAccess.HidePrivate, data); err != nil {
+			return nil, apierror.Wrap(http.StatusInternalServerError, apierror.CodeInternal, err)
 		}
 
-		if resp.StatusCode() == http.StatusUnauthorized {
-			token, err = refreshUserToken(cfg, tokenRepo, userID, token)
-			if err != nil {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "token refresh failed: " + err.Error()})
-				return
-			}
+		encoded, err := json.Marshal(data)
+		if err != nil {
+			return nil, apierror.Wrap(http.StatusInternalServerError, apierror.CodeInternal, err)
+		}
+		var state map[string]any
+		if err := json.Unmarshal(encoded, &state); err != nil {
+			return nil, apierror.Wrap(http.StatusInternalServerError, apierror.CodeInternal, err)
+		}
+		return state, nil
+	}
+}
+
+// wantsVerify reports whether the client asked to confirm the command's effect (?verify=true).
+func wantsVerify(c *gin.Context) bool {
+	verify, _ := strconv.ParseBool(c.Query(verifyQueryParam))
+	return verify
+}
+
+// commandAttempt collects what execute learned about a command for the audit log.
+type commandAttempt struct {
+	// vin is the resolved VIN, or the vehicle tag until it is resolved.
+	vin string
+	// path is sdk or rest once the command has been sent.
+	path string
+}
+
+func (e *commandExecutor) execute(c *gin.Context, vehicleTag string, spec service.CommandSpec, commandPath string, bodyBytes []byte, attempt *commandAttempt) (*service.CommandResult, *apierror.Error) {
+	userID, ok := middleware.UserIDFromContext(c)
+	if !ok {
+		return nil, apierror.New(http.StatusUnauthorized, apierror.CodeUnauthorized, "user is not authenticated")
+	}
 
-			resp, err = makeRequest(token.AccessToken)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return
+	// The SDK needs a VIN while the REST fallback accepts Tesla's id; accept either plus display names.
+	// SDK 需要 VIN，REST 回退使用 id，这里统一解析 VIN、id、id_s 或展示名称。
+	vin, restTag, status, err := e.proxy.commandVIN(c, vehicleTag)
+	if err != nil {
+		return nil, apierror.From(status, err)
+	}
+	attempt.vin = vin
+
+	token, err := e.tokenRepo.GetByUserID(userID)
+	if err != nil {
+		return nil, apierror.From(http.StatusInternalServerError, err)
+	}
+	if token == nil {
+		return nil, apierror.New(http.StatusUnauthorized, apierror.CodeUnauthorized, "user token not found")
+	}
+
+	token, err = ensureValidToken(c.Request.Context(), e.cfg, e.tokenRepo, userID, token)
+	if err != nil {
+		return nil, apierror.Wrap(http.StatusUnauthorized, apierror.CodeTokenRefreshFailed, fmt.Errorf("token refresh failed: %w", err))
+	}
+
+	if e.commandSvc != nil && spec.Path == service.CommandPathSDK {
+		start := time.Now()
+		attempt.path = service.CommandPathSDK
+		commandResult, err := e.commandSvc.Execute(c.Request.Context(), vin, spec.Name, bodyBytes, token.AccessToken)
+		var rejected *service.CommandError
+		if errors.As(err, &rejected) && rejected.Unauthorized() {
+			// The token was revoked or rotated meanwhile, e.g. by another vehicle of a batch; refreshUserToken
+			// collapses the refreshes of concurrent workers into one.
+			if token, err = refreshUserToken(c.Request.Context(), e.cfg, e.tokenRepo, userID, token); err != nil {
+				return nil, apierror.Wrap(http.StatusUnauthorized, apierror.CodeTokenRefreshFailed, fmt.Errorf("token refresh failed: %w", err))
 			}
-			if resp.StatusCode() == http.StatusUnauthorized {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized after token refresh"})
-				return
+			service.ReportCommandProgress(c.Request.Context(), service.CommandStageRetrying, "access token refreshed")
+			commandResult, err = e.commandSvc.Execute(c.Request.Context(), vin, spec.Name, bodyBytes, token.AccessToken)
+		}
+		commandLog.InfoContext(c.Request.Context(), "vehicle command executed",
+			"command", spec.Name, "vin", vin, "duration_ms", time.Since(start).Milliseconds(), "error", err)
+		switch {
+		case err == nil && commandResult != nil:
+			return commandResult, nil
+		case errors.Is(err, service.ErrVehicleCommandUseREST):
+			// fall back to REST handling below. 在下方回退到 REST 处理。
+			service.ReportCommandProgress(c.Request.Context(), service.CommandStageRESTFallback, "vehicle does not accept signed commands")
+		case err != nil:
+			var cmdErr *service.CommandError
+			if errors.As(err, &cmdErr) {
+				return nil, commandAPIError(cmdErr)
 			}
+			return nil, apierror.Wrap(http.StatusInternalServerError, apierror.CodeCommandFailed, err)
 		}
+	}
 
-		if resp.StatusCode() >= http.StatusBadRequest {
-			c.JSON(resp.StatusCode(), gin.H{"error": resp.String()})
-			return
+	requestURL := buildVehicleCommandURL(e.cfg.TeslaAPIURL, restTag, commandPath)
+
+	query := c.Request.URL.Query()
+	query.Del("user_id")
+	query.Del(asyncQueryParam)
+	query.Del(verifyQueryParam)
+
+	makeRequest := func(accessToken string) (*resty.Response, error) {
+		client := upstream.NewClient()
+		client.SetContentLength(true)
+		client.SetHeader("User-Agent", teslaUserAgent)
+
+		req := newUpstreamRequest(c, client)
+		req.SetHeader("Authorization", "Bearer "+accessToken)
+
+		if accept := c.GetHeader("Accept"); accept != "" {
+			req.SetHeader("Accept", accept)
+		}
+		if contentType := c.GetHeader("Content-Type"); contentType != "" {
+			req.SetHeader("Content-Type", contentType)
+		} else if len(bodyBytes) > 0 {
+			req.SetHeader("Content-Type", "application/json")
+		}
+		if len(bodyBytes) > 0 {
+			req.SetBody(bodyBytes)
+		}
+		if len(query) > 0 {
+			req.SetQueryString(query.Encode())
 		}
+		return req.Post(requestURL)
+	}
+
+	attempt.path = service.CommandPathREST
+	service.ReportCommandProgress(c.Request.Context(), service.CommandStageSent, "")
+	resp, err := makeRequest(token.AccessToken)
+	if err != nil {
+		return nil, apierror.Wrap(http.StatusBadGateway, apierror.CodeUpstreamUnavailable, err)
+	}
 
-		contentType := resp.Header().Get("Content-Type")
-		if contentType == "" {
-			contentType = "application/json"
+	if resp.StatusCode() == http.StatusUnauthorized {
+		token, err = refreshUserToken(c.Request.Context(), e.cfg, e.tokenRepo, userID, token)
+		if err != nil {
+			return nil, apierror.Wrap(http.StatusUnauthorized, apierror.CodeTokenRefreshFailed, fmt.Errorf("token refresh failed: %w", err))
+		}
+
+		service.ReportCommandProgress(c.Request.Context(), service.CommandStageRetrying, "access token refreshed")
+		resp, err = makeRequest(token.AccessToken)
+		if err != nil {
+			return nil, apierror.Wrap(http.StatusBadGateway, apierror.CodeUpstreamUnavailable, err)
 		}
+		if resp.StatusCode() == http.StatusUnauthorized {
+			apiErr := apierror.FromUpstream(resp.StatusCode(), resp.Body())
+			apiErr.Message = "unauthorized after token refresh"
+			return nil, apiErr
+		}
+	}
 
-		c.Data(resp.StatusCode(), contentType, resp.Body())
+	if resp.StatusCode() >= http.StatusBadRequest {
+		return nil, apierror.FromUpstream(resp.StatusCode(), resp.Body())
+	}
+
+	contentType := resp.Header().Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	return &service.CommandResult{Status: resp.StatusCode(), Body: resp.Body(), ContentType: contentType}, nil
+}
+
+// validateVehicleCommand checks a command against the catalog and returns its spec, or the error to
+// send: unknown commands and invalid parameters are 400s, commands the SDK cannot run are 501s.
+func validateVehicleCommand(name string, body []byte) (service.CommandSpec, *apierror.Error) {
+	spec, ok := service.LookupCommand(name)
+	if !ok {
+		return spec, apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest,
+			fmt.Sprintf("unknown command %q, see GET /api/vehicles/commands", name))
+	}
+	if spec.Path == service.CommandPathUnsupported {
+		return spec, apierror.New(http.StatusNotImplemented, apierror.CodeCommandNotImplemented,
+			fmt.Sprintf("command %q is not supported", name))
+	}
+
+	fieldErrors, err := service.ValidateCommandParams(name, body)
+	if err != nil {
+		return spec, apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest, err.Error())
+	}
+	if len(fieldErrors) > 0 {
+		return spec, apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest,
+			fmt.Sprintf("invalid parameters for %s", name)).WithDetails(fieldErrors)
+	}
+	return spec, nil
+}
+
+// ListVehicleCommands serves the command catalog so clients can build their forms from it.
+// ListVehicleCommands 返回指令目录（名称、分类、参数、执行路径与危险等级）。
+func ListVehicleCommands() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		respondCacheable(c, http.StatusOK, gin.H{"commands": service.CommandCatalog()}, time.Time{})
+	}
+}
+
+// commandAPIError converts a command service failure into the unified envelope, parsing Tesla's
+// error body when the SDK surfaced one. commandAPIError 将指令服务的错误转换为统一错误结构。
+func commandAPIError(cmdErr *service.CommandError) *apierror.Error {
+	var apiErr *apierror.Error
+	if len(cmdErr.Body) > 0 {
+		apiErr = apierror.FromUpstream(cmdErr.Status, cmdErr.Body)
+	} else {
+		code := apierror.CodeForStatus(cmdErr.Status)
+		if cmdErr.Status == http.StatusInternalServerError {
+			code = apierror.CodeCommandFailed
+		}
+		apiErr = apierror.Wrap(cmdErr.Status, code, cmdErr)
 	}
+	apiErr.Retryable = apiErr.Retryable || cmdErr.Temporary()
+	return apiErr
 }
 
 func buildVehicleCommandURL(baseURL, vehicleTag, commandPath string) string {
@@ -0,0 +1,415 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"tds_server/internal/apierror"
+	"tds_server/internal/config"
+	"tds_server/internal/repository"
+	"tds_server/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// V2CommandResponse is the body returned by every /api/v2 vehicle command endpoint. Result is false
+// when the vehicle declined a command (for example "already_set"); Commands lists what was sent.
+// V2CommandResponse 为 v2 指令接口的统一响应结构。
+type V2CommandResponse struct {
+	Result   bool            `json:"result"`
+	Reason   string          `json:"reason,omitempty"`
+	Commands []V2CommandStep `json:"commands"`
+}
+
+// V2CommandStep is the outcome of one Tesla command executed for a v2 request.
+type V2CommandStep struct {
+	Command string `json:"command"`
+	Result  bool   `json:"result"`
+	Reason  string `json:"reason,omitempty"`
+	// ErrorCode is set on the step that failed, e.g. because the vehicle was unreachable.
+	ErrorCode string `json:"error_code,omitempty"`
+	// Verification is present with ?verify=true once the vehicle accepted the command.
+	Verification *service.CommandVerification `json:"verification,omitempty"`
+}
+
+// ChargeLimitRequest is the body of PUT /api/v2/vehicles/{vehicle_tag}/charge/limit.
+type ChargeLimitRequest struct {
+	Percent *int `json:"percent"`
+}
+
+// ChargingAmpsRequest is the body of PUT /api/v2/vehicles/{vehicle_tag}/charge/amps.
+type ChargingAmpsRequest struct {
+	Amps *int `json:"amps"`
+}
+
+// ClimateRequest is the body of PUT /api/v2/vehicles/{vehicle_tag}/climate. Temperatures are in
+// Celsius; omitted fields are left unchanged.
+type ClimateRequest struct {
+	On            *bool    `json:"on,omitempty"`
+	DriverTemp    *float64 `json:"driver_temp,omitempty"`
+	PassengerTemp *float64 `json:"passenger_temp,omitempty"`
+}
+
+// SeatHeaterRequest is the body of PUT /api/v2/vehicles/{vehicle_tag}/climate/seats/{seat}/heater.
+type SeatHeaterRequest struct {
+	// Level is 0 (off) to 3 (high).
+	Level *int `json:"level"`
+}
+
+// ToggleRequest is the body of endpoints that switch a feature on or off.
+type ToggleRequest struct {
+	Enabled *bool `json:"enabled"`
+}
+
+// ValetModeRequest is the body of PUT /api/v2/vehicles/{vehicle_tag}/valet_mode.
+type ValetModeRequest struct {
+	Enabled *bool `json:"enabled"`
+	// PIN is the optional 4 digit valet PIN.
+	PIN string `json:"pin,omitempty"`
+}
+
+// VolumeRequest is the body of PUT /api/v2/vehicles/{vehicle_tag}/media/volume.
+type VolumeRequest struct {
+	Volume *float64 `json:"volume"`
+}
+
+// VehicleNameRequest is the body of PUT /api/v2/vehicles/{vehicle_tag}/name.
+type VehicleNameRequest struct {
+	Name *string `json:"name"`
+}
+
+// v2SeatPositions maps the seat names of the v2 API to the SDK's seat_position index.
+var v2SeatPositions = map[string]int{
+	"front_left":      0,
+	"front_right":     1,
+	"rear_left":       2,
+	"rear_left_back":  3,
+	"rear_center":     4,
+	"rear_right":      5,
+	"rear_right_back": 6,
+	"third_row_left":  7,
+	"third_row_right": 8,
+}
+
+// v2Step is one Tesla command of a v2 request. fields renames Tesla parameters to the request
+// fields they came from so validation errors point at what the client sent.
+type v2Step struct {
+	command string
+	params  map[string]any
+	fields  map[string]string
+}
+
+// v2Plan turns a decoded v2 request into the Tesla commands to run, in order.
+type v2Plan[T any] func(c *gin.Context, req *T) ([]v2Step, *apierror.Error)
+
+// SetChargeLimitV2 handles PUT /api/v2/vehicles/{vehicle_tag}/charge/limit.
+func SetChargeLimitV2(cfg *config.Config, tokenRepo *repository.TokenRepo, commandSvc *service.VehicleCommandService, vehicles *service.VehicleDirectory, jobs *service.CommandJobService, audit *service.CommandAuditService) gin.HandlerFunc {
+	return v2Command(newCommandExecutor(cfg, tokenRepo, commandSvc, vehicles, jobs, audit), func(_ *gin.Context, req *ChargeLimitRequest) ([]v2Step, *apierror.Error) {
+		return []v2Step{{command: "set_charge_limit", params: optionalParams("percent", req.Percent)}}, nil
+	})
+}
+
+// SetChargingAmpsV2 handles PUT /api/v2/vehicles/{vehicle_tag}/charge/amps.
+func SetChargingAmpsV2(cfg *config.Config, tokenRepo *repository.TokenRepo, commandSvc *service.VehicleCommandService, vehicles *service.VehicleDirectory, jobs *service.CommandJobService, audit *service.CommandAuditService) gin.HandlerFunc {
+	return v2Command(newCommandExecutor(cfg, tokenRepo, commandSvc, vehicles, jobs, audit), func(_ *gin.Context, req *ChargingAmpsRequest) ([]v2Step, *apierror.Error) {
+		return []v2Step{{
+			command: "set_charging_amps",
+			params:  optionalParams("charging_amps", req.Amps),
+			fields:  map[string]string{"charging_amps": "amps"},
+		}}, nil
+	})
+}
+
+// UpdateClimateV2 handles PUT /api/v2/vehicles/{vehicle_tag}/climate. Temperatures are set first so
+// climate control starts at the requested temperature. UpdateClimateV2 先设置温度，再开关空调。
+func UpdateClimateV2(cfg *config.Config, tokenRepo *repository.TokenRepo, commandSvc *service.VehicleCommandService, vehicles *service.VehicleDirectory, jobs *service.CommandJobService, audit *service.CommandAuditService) gin.HandlerFunc {
+	return v2Command(newCommandExecutor(cfg, tokenRepo, commandSvc, vehicles, jobs, audit), func(_ *gin.Context, req *ClimateRequest) ([]v2Step, *apierror.Error) {
+		var steps []v2Step
+		if req.DriverTemp != nil || req.PassengerTemp != nil {
+			params := optionalParams("driver_temp", req.DriverTemp)
+			for key, value := range optionalParams("passenger_temp", req.PassengerTemp) {
+				params[key] = value
+			}
+			steps = append(steps, v2Step{command: "set_temps", params: params})
+		}
+		if req.On != nil {
+			command := "auto_conditioning_stop"
+			if *req.On {
+				command = "auto_conditioning_start"
+			}
+			steps = append(steps, v2Step{command: command})
+		}
+		if len(steps) == 0 {
+			return nil, apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest, "on, driver_temp or passenger_temp is required")
+		}
+		return steps, nil
+	})
+}
+
+// SetSeatHeaterV2 handles PUT /api/v2/vehicles/{vehicle_tag}/climate/seats/{seat}/heater, where seat is
+// front_left, front_right, rear_left, rear_left_back, rear_center, rear_right, rear_right_back,
+// third_row_left or third_row_right.
+func SetSeatHeaterV2(cfg *config.Config, tokenRepo *repository.TokenRepo, commandSvc *service.VehicleCommandService, vehicles *service.VehicleDirectory, jobs *service.CommandJobService, audit *service.CommandAuditService) gin.HandlerFunc {
+	return v2Command(newCommandExecutor(cfg, tokenRepo, commandSvc, vehicles, jobs, audit), func(c *gin.Context, req *SeatHeaterRequest) ([]v2Step, *apierror.Error) {
+		position, ok := v2SeatPositions[c.Param("seat")]
+		if !ok {
+			return nil, apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest, fmt.Sprintf("unknown seat %q", c.Param("seat")))
+		}
+		params := optionalParams("level", req.Level)
+		params["seat_position"] = position
+		return []v2Step{{command: "remote_seat_heater_request", params: params}}, nil
+	})
+}
+
+// SetSteeringWheelHeaterV2 handles PUT /api/v2/vehicles/{vehicle_tag}/climate/steering_wheel_heater.
+func SetSteeringWheelHeaterV2(cfg *config.Config, tokenRepo *repository.TokenRepo, commandSvc *service.VehicleCommandService, vehicles *service.VehicleDirectory, jobs *service.CommandJobService, audit *service.CommandAuditService) gin.HandlerFunc {
+	return v2Toggle(newCommandExecutor(cfg, tokenRepo, commandSvc, vehicles, jobs, audit), "remote_steering_wheel_heater_request")
+}
+
+// SetSentryModeV2 handles PUT /api/v2/vehicles/{vehicle_tag}/sentry_mode.
+func SetSentryModeV2(cfg *config.Config, tokenRepo *repository.TokenRepo, commandSvc *service.VehicleCommandService, vehicles *service.VehicleDirectory, jobs *service.CommandJobService, audit *service.CommandAuditService) gin.HandlerFunc {
+	return v2Toggle(newCommandExecutor(cfg, tokenRepo, commandSvc, vehicles, jobs, audit), "set_sentry_mode")
+}
+
+// SetValetModeV2 handles PUT /api/v2/vehicles/{vehicle_tag}/valet_mode.
+func SetValetModeV2(cfg *config.Config, tokenRepo *repository.TokenRepo, commandSvc *service.VehicleCommandService, vehicles *service.VehicleDirectory, jobs *service.CommandJobService, audit *service.CommandAuditService) gin.HandlerFunc {
+	return v2Command(newCommandExecutor(cfg, tokenRepo, commandSvc, vehicles, jobs, audit), func(_ *gin.Context, req *ValetModeRequest) ([]v2Step, *apierror.Error) {
+		params := optionalParams("on", req.Enabled)
+		if req.PIN != "" {
+			params["password"] = req.PIN
+		}
+		return []v2Step{{command: "set_valet_mode", params: params, fields: map[string]string{"on": "enabled", "password": "pin"}}}, nil
+	})
+}
+
+// SetVolumeV2 handles PUT /api/v2/vehicles/{vehicle_tag}/media/volume.
+func SetVolumeV2(cfg *config.Config, tokenRepo *repository.TokenRepo, commandSvc *service.VehicleCommandService, vehicles *service.VehicleDirectory, jobs *service.CommandJobService, audit *service.CommandAuditService) gin.HandlerFunc {
+	return v2Command(newCommandExecutor(cfg, tokenRepo, commandSvc, vehicles, jobs, audit), func(_ *gin.Context, req *VolumeRequest) ([]v2Step, *apierror.Error) {
+		return []v2Step{{command: "adjust_volume", params: optionalParams("volume", req.Volume)}}, nil
+	})
+}
+
+// RenameVehicleV2 handles PUT /api/v2/vehicles/{vehicle_tag}/name.
+func RenameVehicleV2(cfg *config.Config, tokenRepo *repository.TokenRepo, commandSvc *service.VehicleCommandService, vehicles *service.VehicleDirectory, jobs *service.CommandJobService, audit *service.CommandAuditService) gin.HandlerFunc {
+	return v2Command(newCommandExecutor(cfg, tokenRepo, commandSvc, vehicles, jobs, audit), func(_ *gin.Context, req *VehicleNameRequest) ([]v2Step, *apierror.Error) {
+		return []v2Step{{
+			command: "set_vehicle_name",
+			params:  optionalParams("vehicle_name", req.Name),
+			fields:  map[string]string{"vehicle_name": "name"},
+		}}, nil
+	})
+}
+
+// ActuateTrunkV2 handles POST /api/v2/vehicles/{vehicle_tag}/trunks/{which}/actuate (front or rear).
+func ActuateTrunkV2(cfg *config.Config, tokenRepo *repository.TokenRepo, commandSvc *service.VehicleCommandService, vehicles *service.VehicleDirectory, jobs *service.CommandJobService, audit *service.CommandAuditService) gin.HandlerFunc {
+	return v2Command(newCommandExecutor(cfg, tokenRepo, commandSvc, vehicles, jobs, audit), func(c *gin.Context, _ *struct{}) ([]v2Step, *apierror.Error) {
+		return []v2Step{{
+			command: "actuate_trunk",
+			params:  map[string]any{"which_trunk": c.Param("which")},
+			fields:  map[string]string{"which_trunk": "which"},
+		}}, nil
+	})
+}
+
+// V2Action handles body-less v2 endpoints such as POST /api/v2/vehicles/{vehicle_tag}/doors/lock,
+// which always send command with the fixed params.
+// V2Action 用于无请求体的 v2 动作接口，固定映射到一个特斯拉指令。
+func V2Action(cfg *config.Config, tokenRepo *repository.TokenRepo, commandSvc *service.VehicleCommandService, vehicles *service.VehicleDirectory, jobs *service.CommandJobService, audit *service.CommandAuditService, command string, params map[string]any) gin.HandlerFunc {
+	return v2Command(newCommandExecutor(cfg, tokenRepo, commandSvc, vehicles, jobs, audit), func(_ *gin.Context, _ *struct{}) ([]v2Step, *apierror.Error) {
+		return []v2Step{{command: command, params: params}}, nil
+	})
+}
+
+func v2Toggle(executor *commandExecutor, command string) gin.HandlerFunc {
+	return v2Command(executor, func(_ *gin.Context, req *ToggleRequest) ([]v2Step, *apierror.Error) {
+		return []v2Step{{command: command, params: optionalParams("on", req.Enabled), fields: map[string]string{"on": "enabled"}}}, nil
+	})
+}
+
+// v2Command decodes the typed body, validates every planned command against the catalog before
+// running any of them, then executes them in order, or in the background when async is requested.
+// v2Command 解析强类型请求体，先整体校验再依次执行，遇到车辆拒绝的指令即停止。
+func v2Command[T any](executor *commandExecutor, plan v2Plan[T]) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Requests rejected before the Tesla commands are known are audited under their route.
+		route := c.Request.Method + " " + c.FullPath()
+		rawBody, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			executor.reject(c, c.Param("vehicle_tag"), route, nil, apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest, "failed to read request body"))
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(rawBody))
+
+		var req T
+		if apiErr := decodeV2Body(c, &req); apiErr != nil {
+			executor.reject(c, c.Param("vehicle_tag"), route, rawBody, apiErr)
+			return
+		}
+		steps, apiErr := plan(c, &req)
+		if apiErr != nil {
+			executor.reject(c, c.Param("vehicle_tag"), route, rawBody, apiErr)
+			return
+		}
+
+		specs := make([]service.CommandSpec, len(steps))
+		bodies := make([][]byte, len(steps))
+		for i, step := range steps {
+			params := step.params
+			if params == nil {
+				params = map[string]any{}
+			}
+			body, err := json.Marshal(params)
+			if err != nil {
+				apierror.Respond(c, http.StatusInternalServerError, err)
+				return
+			}
+			spec, apiErr := validateVehicleCommand(step.command, body)
+			if apiErr != nil {
+				renameFieldErrors(apiErr, step.fields)
+				executor.reject(c, c.Param("vehicle_tag"), step.command, body, apiErr)
+				return
+			}
+			specs[i], bodies[i] = spec, body
+		}
+
+		if wantsAsync(c) {
+			names := make([]string, len(steps))
+			for i, step := range steps {
+				names[i] = step.command
+			}
+			executor.submit(c, c.Param("vehicle_tag"), strings.Join(names, ","), func(jc *gin.Context) (*service.CommandResult, error) {
+				response, apiErr := runV2Steps(jc, executor, steps, specs, bodies)
+				if apiErr != nil {
+					return nil, apiErr
+				}
+				body, err := json.Marshal(response)
+				if err != nil {
+					return nil, err
+				}
+				result := &service.CommandResult{Status: http.StatusOK, Body: body, ContentType: "application/json"}
+				if !response.Result {
+					return nil, &service.CommandDeclinedError{Reason: response.Reason, Result: result}
+				}
+				return result, nil
+			})
+			return
+		}
+
+		response, apiErr := runV2Steps(c, executor, steps, specs, bodies)
+		if apiErr != nil {
+			apierror.Write(c, apiErr)
+			return
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// runV2Steps executes validated steps in order and stops at the first one the vehicle declines. When a
+// step of a multi-step request fails, the error's details list the outcome of every step run so far,
+// the failed one last, since the earlier ones already took effect.
+func runV2Steps(c *gin.Context, executor *commandExecutor, steps []v2Step, specs []service.CommandSpec, bodies [][]byte) (V2CommandResponse, *apierror.Error) {
+	response := V2CommandResponse{Result: true, Commands: make([]V2CommandStep, 0, len(steps))}
+	for i, step := range steps {
+		result, apiErr := executor.run(c, c.Param("vehicle_tag"), specs[i], step.command, bodies[i])
+		if apiErr != nil {
+			if len(steps) > 1 {
+				response.Result, response.Reason = false, apiErr.Message
+				response.Commands = append(response.Commands, V2CommandStep{Command: step.command, Reason: apiErr.Message, ErrorCode: apiErr.Code})
+				apiErr.WithDetails(response)
+			}
+			return response, apiErr
+		}
+		outcome := commandOutcome(step.command, result.Body)
+		outcome.Verification = result.Verification
+		response.Commands = append(response.Commands, outcome)
+		if !outcome.Result {
+			response.Result = false
+			response.Reason = outcome.Reason
+			break
+		}
+	}
+	return response, nil
+}
+
+// decodeV2Body decodes the request body strictly into dest; an empty body decodes as {}.
+func decodeV2Body(c *gin.Context, dest any) *apierror.Error {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest, "failed to read request body")
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		body = []byte("{}")
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(dest); err != nil {
+		apiErr := apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest, fmt.Sprintf("invalid request body: %v", err))
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && typeErr.Field != "" {
+			apiErr.WithDetails([]service.FieldError{{Field: typeErr.Field, Message: "must be a " + jsonTypeName(typeErr.Type.Kind())}})
+		}
+		return apiErr
+	}
+	return nil
+}
+
+// jsonTypeName names a Go kind the way the command catalog names parameter types.
+func jsonTypeName(kind reflect.Kind) string {
+	switch kind {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.String:
+		return "string"
+	default:
+		return "number"
+	}
+}
+
+// renameFieldErrors rewrites catalog field names in apiErr's details to the v2 request fields.
+func renameFieldErrors(apiErr *apierror.Error, fields map[string]string) {
+	fieldErrors, ok := apiErr.Details.([]service.FieldError)
+	if !ok || len(fields) == 0 {
+		return
+	}
+	for i, fieldErr := range fieldErrors {
+		if name, ok := fields[fieldErr.Field]; ok {
+			fieldErrors[i].Field = name
+		}
+	}
+}
+
+// commandOutcome reads result and reason from a Tesla command response. Responses without a result
+// field, such as wake_up, count as successful.
+func commandOutcome(command string, body []byte) V2CommandStep {
+	outcome := V2CommandStep{Command: command, Result: true}
+	var payload struct {
+		Response struct {
+			Result *bool  `json:"result"`
+			Reason string `json:"reason"`
+		} `json:"response"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return outcome
+	}
+	if payload.Response.Result != nil {
+		outcome.Result = *payload.Response.Result
+	}
+	outcome.Reason = payload.Response.Reason
+	return outcome
+}
+
+// optionalParams returns {key: *value} when value is set and an empty map otherwise, leaving the
+// required check to the catalog.
+func optionalParams[T any](key string, value *T) map[string]any {
+	params := map[string]any{}
+	if value != nil {
+		params[key] = *value
+	}
+	return params
+}
@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"tds_server/internal/apierror"
+	"tds_server/internal/config"
+	"tds_server/internal/middleware"
+	"tds_server/internal/model"
+	"tds_server/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestV2CommandRejectsInvalidBodies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := &memoryAuditStore{}
+	audit := service.NewCommandAuditService(store)
+	r := gin.New()
+	r.PUT("/vehicles/:vehicle_tag/charge/amps", SetChargingAmpsV2(&config.Config{}, nil, nil, nil, nil, audit))
+	r.PUT("/vehicles/:vehicle_tag/climate", UpdateClimateV2(&config.Config{}, nil, nil, nil, nil, audit))
+
+	cases := []struct {
+		path, body string
+		field      string
+	}{
+		{"/vehicles/car/charge/amps", `{"amps": 200}`, "amps"},
+		{"/vehicles/car/charge/amps", ``, "amps"},
+		{"/vehicles/car/charge/amps", `{"amps": "16"}`, "amps"},
+		{"/vehicles/car/charge/amps", `{"charging_amps": 16}`, ""},
+		{"/vehicles/car/climate", `{}`, ""},
+		{"/vehicles/car/climate", `{"on": true, "driver_temp": 40}`, "driver_temp"},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPut, tc.path, strings.NewReader(tc.body)))
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("%s %s: status %d %s", tc.path, tc.body, w.Code, w.Body)
+		}
+		var payload struct {
+			Error struct {
+				Code    string `json:"code"`
+				Details []struct {
+					Field string `json:"field"`
+				} `json:"details"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &payload); err != nil || payload.Error.Code != "invalid_request" {
+			t.Fatalf("%s %s: unexpected body %s", tc.path, tc.body, w.Body)
+		}
+		if tc.field != "" && (len(payload.Error.Details) != 1 || payload.Error.Details[0].Field != tc.field) {
+			t.Fatalf("%s %s: details %+v, want field %s", tc.path, tc.body, payload.Error.Details, tc.field)
+		}
+	}
+
+	entries, _ := store.List(model.CommandAuditFilter{})
+	if len(entries) != len(cases) {
+		t.Fatalf("audit entries = %d, want one per rejected request", len(entries))
+	}
+	for _, entry := range entries {
+		if entry.VIN != "car" || entry.Outcome != model.CommandAuditRejected || entry.HTTPStatus != http.StatusBadRequest || entry.Path != "" {
+			t.Fatalf("audit entry = %+v", entry)
+		}
+	}
+	if entries[0].Command != "set_charging_amps" || entries[3].Command != "PUT /vehicles/:vehicle_tag/charge/amps" {
+		t.Fatalf("audited commands = %q, %q", entries[0].Command, entries[3].Command)
+	}
+}
+
+func TestV2CommandReportsStepsBeforeFailure(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/command/set_temps") {
+			_ = json.NewEncoder(w).Encode(map[string]any{"response": map[string]any{"result": true, "reason": ""}})
+			return
+		}
+		http.Error(w, `{"error":"upstream internal error"}`, http.StatusServiceUnavailable)
+	}))
+	defer upstream.Close()
+
+	proxy, userID := newChargingTestProxy(upstream.URL)
+	executor := &commandExecutor{cfg: proxy.cfg, tokenRepo: proxy.tokenRepo, proxy: proxy}
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set(middleware.UserIDContextKey, userID) })
+	r.PUT("/vehicles/:vehicle_tag/climate", v2Command(executor, func(_ *gin.Context, _ *struct{}) ([]v2Step, *apierror.Error) {
+		return []v2Step{{command: "set_temps", params: map[string]any{"driver_temp": 21.5}}, {command: "auto_conditioning_start"}}, nil
+	}))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/vehicles/Daily/climate", nil))
+	var payload struct {
+		Error struct {
+			Details V2CommandResponse `json:"details"`
+		} `json:"error"`
+	}
+	if w.Code != http.StatusServiceUnavailable || json.Unmarshal(w.Body.Bytes(), &payload) != nil {
+		t.Fatalf("status %d %s", w.Code, w.Body)
+	}
+	steps := payload.Error.Details.Commands
+	if payload.Error.Details.Result || len(steps) != 2 || !steps[0].Result || steps[0].Command != "set_temps" ||
+		steps[1].Result || steps[1].Command != "auto_conditioning_start" || steps[1].ErrorCode == "" {
+		t.Fatalf("details = %+v", payload.Error.Details)
+	}
+}
+
+func TestCommandOutcome(t *testing.T) {
+	cases := map[string]V2CommandStep{
+		`{"response":{"result":true,"reason":""}}`:             {Command: "door_lock", Result: true},
+		`{"response":{"result":false,"reason":"already_set"}}`: {Command: "door_lock", Result: false, Reason: "already_set"},
+		`{"response":{"id":1,"state":"online"}}`:               {Command: "door_lock", Result: true},
+	}
+	for body, want := range cases {
+		if got := commandOutcome("door_lock", []byte(body)); got != want {
+			t.Fatalf("%s: got %+v, want %+v", body, got, want)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	vehicleDataViewFull    = "full"
+	vehicleDataViewSummary = "summary"
+
+	maxProjectedFields = 64
+)
+
+// vehicleDataEndpoints lists the vehicle_data sections Tesla accepts in the endpoints query.
+var vehicleDataEndpoints = map[string]struct{}{
+	"charge_state":                  {},
+	"climate_state":                 {},
+	"closures_state":                {},
+	"drive_state":                   {},
+	"gui_settings":                  {},
+	"location_data":                 {},
+	"charge_schedule_data":          {},
+	"preconditioning_schedule_data": {},
+	"vehicle_config":                {},
+	"vehicle_state":                 {},
+	"vehicle_data_combo":            {},
+}
+
+// summaryEndpoints are the sections needed to build a VehicleDataSummary.
+var summaryEndpoints = []string{"charge_state", "climate_state", "drive_state", "location_data", "vehicle_state"}
+
+// VehicleDataSummaryResponse wraps the compact vehicle_data view.
+type VehicleDataSummaryResponse struct {
+	Response VehicleDataSummary `json:"response"`
+	// Units describes the units of numeric fields when the units query parameter was used.
+	Units *UnitSet `json:"units,omitempty"`
+}
+
+// VehicleDataSummary carries the handful of values most app screens need.
+// VehicleDataSummary 汇总了客户端大部分页面所需的少量常用字段。
+type VehicleDataSummary struct {
+	// ID is the Tesla Fleet unique identifier for the vehicle.
+	ID int64 `json:"id"`
+	// VIN is the standard Vehicle Identification Number.
+	VIN string `json:"vin"`
+	// DisplayName is the user-defined label for the vehicle.
+	DisplayName string `json:"display_name"`
+	// State reflects the latest connectivity status (e.g. online, asleep).
+	State string `json:"state"`
+	// BatteryLevel is the state of charge in percent.
+	BatteryLevel *int `json:"battery_level,omitempty"`
+	// BatteryRange is the estimated rated range.
+	BatteryRange *float64 `json:"battery_range,omitempty"`
+	// ChargingState is Tesla's charging status such as Charging or Disconnected.
+	ChargingState *string `json:"charging_state,omitempty"`
+	// ChargeLimitSOC is the configured charge limit in percent.
+	ChargeLimitSOC *int `json:"charge_limit_soc,omitempty"`
+	// TimeToFullCharge is the remaining charge time in hours.
+	TimeToFullCharge *float64 `json:"time_to_full_charge,omitempty"`
+	// InsideTemp is the cabin temperature.
+	InsideTemp *float64 `json:"inside_temp,omitempty"`
+	// OutsideTemp is the ambient temperature.
+	OutsideTemp *float64 `json:"outside_temp,omitempty"`
+	// IsClimateOn reports whether HVAC is running.
+	IsClimateOn *bool `json:"is_climate_on,omitempty"`
+	// Locked reports whether the doors are locked.
+	Locked *bool `json:"locked,omitempty"`
+	// SentryMode reports whether sentry mode is active.
+	SentryMode *bool `json:"sentry_mode,omitempty"`
+	// Odometer is the total distance driven.
+	Odometer *float64 `json:"odometer,omitempty"`
+	// ShiftState is the gear selector position (P/D/R/N).
+	ShiftState *string `json:"shift_state,omitempty"`
+	// Speed is the current vehicle speed.
+	Speed *float64 `json:"speed,omitempty"`
+	// Latitude is the vehicle latitude from location_data, falling back to drive_state.
+	Latitude *float64 `json:"latitude,omitempty"`
+	// Longitude is the vehicle longitude from location_data, falling back to drive_state.
+	Longitude *float64 `json:"longitude,omitempty"`
+	// Heading is the compass heading in degrees.
+	Heading *int `json:"heading,omitempty"`
+	// CarVersion is the installed firmware version.
+	CarVersion *string `json:"car_version,omitempty"`
+	// Timestamp is the most recent section timestamp in milliseconds.
+	Timestamp *int64 `json:"timestamp,omitempty"`
+}
+
+// Summary builds the compact view of the vehicle data.
+func (d *VehicleData) Summary() VehicleDataSummary {
+	summary := VehicleDataSummary{
+		ID:          d.ID,
+		VIN:         d.VIN,
+		DisplayName: d.DisplayName,
+		State:       d.State,
+	}
+
+	if cs := d.ChargeState; cs != nil {
+		summary.BatteryLevel = cs.BatteryLevel
+		summary.BatteryRange = cs.BatteryRange
+		summary.ChargingState = cs.ChargingState
+		summary.ChargeLimitSOC = cs.ChargeLimitSOC
+		summary.TimeToFullCharge = cs.TimeToFullCharge
+	}
+	if cl := d.ClimateState; cl != nil {
+		summary.InsideTemp = cl.InsideTemp
+		summary.OutsideTemp = cl.OutsideTemp
+		summary.IsClimateOn = cl.IsClimateOn
+	}
+	if ds := d.DriveState; ds != nil {
+		summary.ShiftState = ds.ShiftState
+		summary.Speed = ds.Speed
+		summary.Latitude = ds.Latitude
+		summary.Longitude = ds.Longitude
+		summary.Heading = ds.Heading
+	}
+	if loc := d.LocationData; loc != nil && loc.Latitude != nil && loc.Longitude != nil {
+		summary.Latitude = loc.Latitude
+		summary.Longitude = loc.Longitude
+		if loc.Heading != nil {
+			summary.Heading = loc.Heading
+		}
+	}
+	if vs := d.VehicleState; vs != nil {
+		summary.Locked = vs.Locked
+		summary.SentryMode = vs.SentryMode
+		summary.Odometer = vs.Odometer
+		summary.CarVersion = vs.CarVersion
+	}
+	summary.Timestamp = d.latestTimestamp()
+	return summary
+}
+
+// latestTimestamp returns the newest section timestamp (milliseconds), or nil when none is present.
+func (d *VehicleData) latestTimestamp() *int64 {
+	var latest *int64
+	consider := func(ts *int64) {
+		if ts != nil && (latest == nil || *ts > *latest) {
+			latest = ts
+		}
+	}
+	if d.ChargeState != nil {
+		consider(d.ChargeState.Timestamp)
+	}
+	if d.ClimateState != nil {
+		consider(d.ClimateState.Timestamp)
+	}
+	if d.ClosuresState != nil {
+		consider(d.ClosuresState.Timestamp)
+	}
+	if d.DriveState != nil {
+		consider(d.DriveState.Timestamp)
+	}
+	if d.GUISettings != nil {
+		consider(d.GUISettings.Timestamp)
+	}
+	if d.LocationData != nil {
+		consider(d.LocationData.Timestamp)
+	}
+	if d.VehicleConfig != nil {
+		consider(d.VehicleConfig.Timestamp)
+	}
+	if d.VehicleState != nil {
+		consider(d.VehicleState.Timestamp)
+	}
+	return latest
+}
+
+// parseViewQuery validates the view query parameter. An empty value means the full payload.
+func parseViewQuery(value string) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	switch value {
+	case "", vehicleDataViewFull:
+		return vehicleDataViewFull, nil
+	case vehicleDataViewSummary:
+		return vehicleDataViewSummary, nil
+	default:
+		return "", fmt.Errorf("view must be %s or %s", vehicleDataViewFull, vehicleDataViewSummary)
+	}
+}
+
+// parseFieldsQuery splits the comma separated fields query into dotted paths.
+// parseFieldsQuery 将逗号分隔的 fields 参数解析为点号路径列表。
+func parseFieldsQuery(value string) ([]string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+
+	var paths []string
+	for _, raw := range strings.Split(value, ",") {
+		path := strings.TrimSpace(raw)
+		if path == "" {
+			continue
+		}
+		for _, segment := range strings.Split(path, ".") {
+			if segment == "" {
+				return nil, fmt.Errorf("invalid field path: %q", path)
+			}
+		}
+		paths = append(paths, path)
+	}
+	if len(paths) > maxProjectedFields {
+		return nil, fmt.Errorf("at most %d fields can be requested", maxProjectedFields)
+	}
+	return paths, nil
+}
+
+// endpointsForFields derives the vehicle_data endpoints referenced by the projected paths so Tesla
+// only returns the sections the caller asked for. Top-level summary fields are always returned.
+func endpointsForFields(paths []string) []string {
+	seen := map[string]struct{}{}
+	var endpoints []string
+	for _, path := range paths {
+		section, _, _ := strings.Cut(path, ".")
+		if _, ok := vehicleDataEndpoints[section]; !ok {
+			continue
+		}
+		if _, dup := seen[section]; dup {
+			continue
+		}
+		seen[section] = struct{}{}
+		endpoints = append(endpoints, section)
+	}
+	return endpoints
+}
+
+// fieldTree is a prefix tree of projected paths; a nil subtree selects the whole value.
+type fieldTree map[string]fieldTree
+
+func buildFieldTree(paths []string) fieldTree {
+	root := fieldTree{}
+	for _, path := range paths {
+		node := root
+		segments := strings.Split(path, ".")
+		for i, segment := range segments {
+			child, exists := node[segment]
+			if exists && child == nil {
+				break
+			}
+			if i == len(segments)-1 {
+				node[segment] = nil
+				break
+			}
+			if !exists {
+				child = fieldTree{}
+				node[segment] = child
+			}
+			node = child
+		}
+	}
+	return root
+}
+
+// projectFields encodes value and keeps only the requested dotted paths. Paths that do not exist
+// are skipped silently; paths crossing arrays apply to every element.
+func projectFields(value any, paths []string) (map[string]any, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	var generic map[string]any
+	if err := decoder.Decode(&generic); err != nil {
+		return nil, err
+	}
+
+	projected, _ := projectValue(generic, buildFieldTree(paths)).(map[string]any)
+	if projected == nil {
+		projected = map[string]any{}
+	}
+	return projected, nil
+}
+
+func projectValue(value any, tree fieldTree) any {
+	switch typed := value.(type) {
+	case map[string]any:
+		out := map[string]any{}
+		for key, subtree := range tree {
+			child, ok := typed[key]
+			if !ok {
+				continue
+			}
+			if subtree == nil {
+				out[key] = child
+				continue
+			}
+			if projected := projectValue(child, subtree); projected != nil {
+				out[key] = projected
+			}
+		}
+		return out
+	case []any:
+		out := make([]any, 0, len(typed))
+		for _, item := range typed {
+			if projected := projectValue(item, tree); projected != nil {
+				out = append(out, projected)
+			}
+		}
+		return out
+	default:
+		return nil
+	}
+}
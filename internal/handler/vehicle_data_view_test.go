@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestProjectFields(t *testing.T) {
+	var payload VehicleDataResponse
+	if err := json.Unmarshal([]byte(sampleVehicleData), &payload); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	fields, err := parseFieldsQuery("vin, charge_state.battery_level,drive_state,vehicle_state.media_info.audio_volume,missing.path")
+	if err != nil {
+		t.Fatalf("parse fields: %v", err)
+	}
+
+	projected, err := projectFields(payload, prefixFields("response", fields))
+	if err != nil {
+		t.Fatalf("project: %v", err)
+	}
+
+	encoded, _ := json.Marshal(projected)
+	want := `{"response":{"charge_state":{"battery_level":42},"drive_state":{"shift_state":null,"speed":60},"vehicle_state":{"media_info":{"audio_volume":2.5}},"vin":"TEST000000VIN01"}}`
+	if string(encoded) != want {
+		t.Fatalf("unexpected projection:\n got %s\nwant %s", encoded, want)
+	}
+
+	if got := endpointsForFields(fields); !reflect.DeepEqual(got, []string{"charge_state", "drive_state", "vehicle_state"}) {
+		t.Fatalf("unexpected endpoints: %v", got)
+	}
+}
+
+func TestParseFieldsQueryRejectsEmptySegments(t *testing.T) {
+	if _, err := parseFieldsQuery("charge_state..battery_level"); err == nil {
+		t.Fatalf("expected empty segment to be rejected")
+	}
+}
+
+func TestSummaryPrefersLocationData(t *testing.T) {
+	lat, lon := 1.5, 2.5
+	driveLat := 9.0
+	data := VehicleData{
+		DriveState:   &DriveState{Latitude: &driveLat, Longitude: &driveLat},
+		LocationData: &LocationData{Latitude: &lat, Longitude: &lon},
+	}
+	summary := data.Summary()
+	if *summary.Latitude != lat || *summary.Longitude != lon {
+		t.Fatalf("expected location_data coordinates, got %v,%v", *summary.Latitude, *summary.Longitude)
+	}
+}
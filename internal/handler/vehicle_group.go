@@ -0,0 +1,214 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"tds_server/internal/apierror"
+	"tds_server/internal/config"
+	"tds_server/internal/middleware"
+	"tds_server/internal/model"
+	"tds_server/internal/repository"
+	"tds_server/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// vehicleGroupParam is the route parameter carrying the vehicle group id.
+const vehicleGroupParam = "group_id"
+
+// VehicleGroupRequest is the body of POST /api/v2/vehicle_groups and PUT /api/v2/vehicle_groups/{group_id}.
+type VehicleGroupRequest struct {
+	Name string `json:"name"`
+	// Vehicles lists VINs, ids or display names; they are stored as VINs.
+	Vehicles []string `json:"vehicles"`
+}
+
+// VehicleGroupPayload is a stored vehicle group as returned to clients.
+type VehicleGroupPayload struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	VINs      []string  `json:"vins"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ListVehicleGroups handles GET /api/v2/vehicle_groups. ListVehicleGroups 返回当前用户的车辆分组。
+func ListVehicleGroups(groups *service.VehicleGroupService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := middleware.UserIDFromContext(c)
+		if !ok {
+			apierror.Write(c, apierror.New(http.StatusUnauthorized, apierror.CodeUnauthorized, "user is not authenticated"))
+			return
+		}
+		list, err := groups.List(userID)
+		if err != nil {
+			respondWithError(c, http.StatusInternalServerError, err)
+			return
+		}
+		payloads := make([]VehicleGroupPayload, 0, len(list))
+		for i := range list {
+			payloads = append(payloads, newVehicleGroupPayload(&list[i]))
+		}
+		c.JSON(http.StatusOK, gin.H{"vehicle_groups": payloads})
+	}
+}
+
+// GetVehicleGroup handles GET /api/v2/vehicle_groups/{group_id}. GetVehicleGroup 返回指定车辆分组。
+func GetVehicleGroup(groups *service.VehicleGroupService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		group, ok := loadVehicleGroup(c, groups)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, newVehicleGroupPayload(group))
+	}
+}
+
+// CreateVehicleGroup handles POST /api/v2/vehicle_groups. Every vehicle must belong to the caller.
+// CreateVehicleGroup 创建车辆分组，分组中的车辆必须属于当前用户。
+func CreateVehicleGroup(cfg *config.Config, tokenRepo *repository.TokenRepo, vehicles *service.VehicleDirectory, groups *service.VehicleGroupService) gin.HandlerFunc {
+	proxy := newTeslaProxy(cfg, tokenRepo, vehicles)
+	return func(c *gin.Context) {
+		userID, ok := middleware.UserIDFromContext(c)
+		if !ok {
+			apierror.Write(c, apierror.New(http.StatusUnauthorized, apierror.CodeUnauthorized, "user is not authenticated"))
+			return
+		}
+		saveVehicleGroup(c, proxy, groups, &model.VehicleGroup{UserID: userID}, http.StatusCreated)
+	}
+}
+
+// UpdateVehicleGroup handles PUT /api/v2/vehicle_groups/{group_id}, replacing the group.
+// UpdateVehicleGroup 整体替换车辆分组。
+func UpdateVehicleGroup(cfg *config.Config, tokenRepo *repository.TokenRepo, vehicles *service.VehicleDirectory, groups *service.VehicleGroupService) gin.HandlerFunc {
+	proxy := newTeslaProxy(cfg, tokenRepo, vehicles)
+	return func(c *gin.Context) {
+		group, ok := loadVehicleGroup(c, groups)
+		if !ok {
+			return
+		}
+		saveVehicleGroup(c, proxy, groups, group, http.StatusOK)
+	}
+}
+
+// DeleteVehicleGroup handles DELETE /api/v2/vehicle_groups/{group_id}. DeleteVehicleGroup 删除车辆分组。
+func DeleteVehicleGroup(groups *service.VehicleGroupService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, id, ok := vehicleGroupRequest(c)
+		if !ok {
+			return
+		}
+		if err := groups.Delete(userID, id); err != nil {
+			if repository.IsNotFound(err) {
+				apierror.Write(c, apierror.New(http.StatusNotFound, apierror.CodeNotFound, "vehicle group not found"))
+				return
+			}
+			respondWithError(c, http.StatusInternalServerError, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func newVehicleGroupPayload(group *model.VehicleGroup) VehicleGroupPayload {
+	return VehicleGroupPayload{
+		ID:        group.ID.String(),
+		Name:      group.Name,
+		VINs:      group.VINs,
+		CreatedAt: group.CreatedAt,
+		UpdatedAt: group.UpdatedAt,
+	}
+}
+
+// saveVehicleGroup resolves the requested vehicles to VINs of the caller and stores the group.
+// Vehicles the caller does not own are reported as field errors.
+func saveVehicleGroup(c *gin.Context, proxy *teslaProxy, groups *service.VehicleGroupService, group *model.VehicleGroup, status int) {
+	var request VehicleGroupRequest
+	if apiErr := decodeV2Body(c, &request); apiErr != nil {
+		apierror.Write(c, apiErr)
+		return
+	}
+
+	var fieldErrors []service.FieldError
+	vins := make([]string, 0, len(request.Vehicles))
+	seen := map[string]bool{}
+	for i, tag := range request.Vehicles {
+		field := fmt.Sprintf("vehicles[%d]", i)
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			fieldErrors = append(fieldErrors, service.FieldError{Field: field, Message: "must not be empty"})
+			continue
+		}
+		vin, _, resolveStatus, err := proxy.commandVIN(c, tag)
+		if err != nil {
+			apiErr := apierror.From(resolveStatus, err)
+			if resolveStatus >= http.StatusInternalServerError || resolveStatus == http.StatusUnauthorized {
+				apierror.Write(c, apiErr)
+				return
+			}
+			fieldErrors = append(fieldErrors, service.FieldError{Field: field, Message: apiErr.Message})
+			continue
+		}
+		if !seen[vin] {
+			seen[vin] = true
+			vins = append(vins, vin)
+		}
+	}
+	if len(fieldErrors) > 0 {
+		apierror.Write(c, apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest, "invalid vehicle group").WithDetails(fieldErrors))
+		return
+	}
+
+	group.Name, group.VINs = request.Name, vins
+	fieldErrors, err := groups.Save(group)
+	switch {
+	case len(fieldErrors) > 0:
+		apierror.Write(c, apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest, "invalid vehicle group").WithDetails(fieldErrors))
+		return
+	case errors.Is(err, service.ErrVehicleGroupNameTaken):
+		apierror.Write(c, apierror.New(http.StatusConflict, apierror.CodeConflict, err.Error()))
+		return
+	case err != nil:
+		respondWithError(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(status, newVehicleGroupPayload(group))
+}
+
+// vehicleGroupRequest reads the caller and the group id, responding with an error when either is missing.
+func vehicleGroupRequest(c *gin.Context) (userID, id uuid.UUID, ok bool) {
+	userID, ok = middleware.UserIDFromContext(c)
+	if !ok {
+		apierror.Write(c, apierror.New(http.StatusUnauthorized, apierror.CodeUnauthorized, "user is not authenticated"))
+		return userID, id, false
+	}
+	id, err := uuid.Parse(c.Param(vehicleGroupParam))
+	if err != nil {
+		respondWithError(c, http.StatusBadRequest, fmt.Errorf("%s must be a UUID", vehicleGroupParam))
+		return userID, id, false
+	}
+	return userID, id, true
+}
+
+// loadVehicleGroup fetches the caller's group, responding with an error when it cannot.
+func loadVehicleGroup(c *gin.Context, groups *service.VehicleGroupService) (*model.VehicleGroup, bool) {
+	userID, id, ok := vehicleGroupRequest(c)
+	if !ok {
+		return nil, false
+	}
+	group, err := groups.Get(userID, id)
+	if repository.IsNotFound(err) {
+		apierror.Write(c, apierror.New(http.StatusNotFound, apierror.CodeNotFound, "vehicle group not found"))
+		return nil, false
+	}
+	if err != nil {
+		respondWithError(c, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	return group, true
+}
@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"tds_server/internal/middleware"
+	"tds_server/internal/model"
+	"tds_server/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// memoryVehicleGroupStore keeps vehicle groups in memory in place of repository.VehicleGroupRepo.
+type memoryVehicleGroupStore struct {
+	mu     sync.Mutex
+	groups []model.VehicleGroup
+}
+
+func (s *memoryVehicleGroupStore) List(userID uuid.UUID) ([]model.VehicleGroup, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []model.VehicleGroup
+	for _, group := range s.groups {
+		if group.UserID == userID {
+			list = append(list, group)
+		}
+	}
+	return list, nil
+}
+
+func (s *memoryVehicleGroupStore) Get(userID, id uuid.UUID) (*model.VehicleGroup, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, group := range s.groups {
+		if group.UserID == userID && group.ID == id {
+			return &group, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (s *memoryVehicleGroupStore) Save(group *model.VehicleGroup) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if group.ID == uuid.Nil {
+		group.ID = uuid.New()
+	}
+	for i := range s.groups {
+		if s.groups[i].ID == group.ID {
+			s.groups[i] = *group
+			return nil
+		}
+	}
+	s.groups = append(s.groups, *group)
+	return nil
+}
+
+func (s *memoryVehicleGroupStore) Delete(userID, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, group := range s.groups {
+		if group.UserID == userID && group.ID == id {
+			s.groups = append(s.groups[:i], s.groups[i+1:]...)
+			return nil
+		}
+	}
+	return gorm.ErrRecordNotFound
+}
+
+func TestVehicleGroupsTargetCommandBatches(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	proxy, userID := newChargingTestProxy("http://tesla.invalid")
+	groups := service.NewVehicleGroupService(&memoryVehicleGroupStore{})
+	save := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/v2/vehicle_groups", strings.NewReader(body))
+		c.Set(middleware.UserIDContextKey, userID)
+		saveVehicleGroup(c, proxy, groups, &model.VehicleGroup{UserID: userID}, http.StatusCreated)
+		return w
+	}
+
+	// Vehicles outside the account are rejected per entry.
+	if w := save(`{"name": "Fleet", "vehicles": ["Daily", "5YJ3E1EA7KF999999"]}`); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "vehicles[1]") {
+		t.Fatalf("unowned vehicle: status %d %s", w.Code, w.Body)
+	}
+
+	w := save(`{"name": "Fleet", "vehicles": ["Daily", "1", "` + chargingTestVIN + `"]}`)
+	var created VehicleGroupPayload
+	if w.Code != http.StatusCreated || json.Unmarshal(w.Body.Bytes(), &created) != nil {
+		t.Fatalf("create: status %d %s", w.Code, w.Body)
+	}
+	if len(created.VINs) != 1 || created.VINs[0] != chargingTestVIN {
+		t.Fatalf("vins = %v, want the tags resolved to one VIN", created.VINs)
+	}
+
+	executor := &commandExecutor{proxy: proxy}
+	for _, ref := range []string{"fleet", created.ID} {
+		tags, apiErr := executor.batchVehicles(userContext(userID, "/api/v2/command_batches"), CommandBatchRequest{Group: ref}, groups)
+		if apiErr != nil || len(tags) != 1 || tags[0] != chargingTestVIN {
+			t.Fatalf("group %q: tags %v, err %v", ref, tags, apiErr)
+		}
+	}
+	if _, apiErr := executor.batchVehicles(userContext(uuid.New(), "/api/v2/command_batches"), CommandBatchRequest{Group: "Fleet"}, groups); apiErr == nil || apiErr.Status != http.StatusNotFound {
+		t.Fatalf("another user's group: err %v", apiErr)
+	}
+}
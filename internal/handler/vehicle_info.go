@@ -0,0 +1,400 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"tds_server/internal/config"
+	"tds_server/internal/repository"
+	"tds_server/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxFleetStatusVINs bounds a single fleet_status request; Tesla rejects larger batches.
+const maxFleetStatusVINs = 100
+
+// NearbyChargingSitesResponse mirrors Tesla GET /api/1/vehicles/{vehicle_tag}/nearby_charging_sites.
+type NearbyChargingSitesResponse struct {
+	Response NearbyChargingSites `json:"response"`
+}
+
+// NearbyChargingSites lists Superchargers and destination chargers around the vehicle.
+type NearbyChargingSites struct {
+	// CongestionSyncTimeUTCSecs is when Supercharger availability was last refreshed.
+	CongestionSyncTimeUTCSecs int64 `json:"congestion_sync_time_utc_secs"`
+	// DestinationCharging lists destination (hotel, mall) chargers.
+	DestinationCharging []ChargingSite `json:"destination_charging"`
+	// Superchargers lists Supercharger sites with live stall availability.
+	Superchargers []ChargingSite `json:"superchargers"`
+	// Timestamp is the vehicle time of the query in milliseconds.
+	Timestamp int64 `json:"timestamp"`
+}
+
+// ChargingSite is a single charging location.
+type ChargingSite struct {
+	Location ChargingSiteLocation `json:"location"`
+	Name     string               `json:"name"`
+	// Type is supercharger or destination.
+	Type string `json:"type"`
+	// DistanceMiles is the distance from the vehicle; omitted when the location policy is not exact.
+	// Location is then masked as well.
+	DistanceMiles *float64 `json:"distance_miles,omitempty"`
+	Amenities     string   `json:"amenities,omitempty"`
+	// AvailableStalls and TotalStalls are only reported for Superchargers.
+	AvailableStalls *int  `json:"available_stalls,omitempty"`
+	TotalStalls     *int  `json:"total_stalls,omitempty"`
+	SiteClosed      *bool `json:"site_closed,omitempty"`
+	// BillingInfo describes pricing for Superchargers, when available.
+	BillingInfo string `json:"billing_info,omitempty"`
+}
+
+// ChargingSiteLocation is the public position of a charging site.
+type ChargingSiteLocation struct {
+	Lat  float64 `json:"lat"`
+	Long float64 `json:"long"`
+}
+
+// ServiceDataResponse mirrors Tesla GET /api/1/vehicles/{vehicle_tag}/service_data.
+type ServiceDataResponse struct {
+	Response ServiceData `json:"response"`
+}
+
+// ServiceData reports whether the vehicle is at a service center.
+type ServiceData struct {
+	// ServiceStatus is in_service or not_in_service.
+	ServiceStatus string `json:"service_status"`
+	// ServiceETC is the estimated completion time (RFC 3339) when in service.
+	ServiceETC         *string `json:"service_etc,omitempty"`
+	ServiceVisitNumber *string `json:"service_visit_number,omitempty"`
+	StatusID           *int    `json:"status_id,omitempty"`
+}
+
+// RecentAlertsResponse mirrors Tesla GET /api/1/vehicles/{vehicle_tag}/recent_alerts.
+type RecentAlertsResponse struct {
+	Response struct {
+		RecentAlerts []VehicleAlert `json:"recent_alerts"`
+	} `json:"response"`
+}
+
+// VehicleAlert is an alert raised by the vehicle.
+type VehicleAlert struct {
+	Name string `json:"name"`
+	// Time is when the alert was raised (RFC 3339).
+	Time string `json:"time"`
+	// Audience lists who the alert is meant for, e.g. customer or service-fix.
+	Audience []string `json:"audience"`
+	UserText string   `json:"user_text"`
+}
+
+// ReleaseNotesResponse mirrors Tesla GET /api/1/vehicles/{vehicle_tag}/release_notes.
+type ReleaseNotesResponse struct {
+	Response struct {
+		ReleaseNotes []ReleaseNote `json:"release_notes"`
+	} `json:"response"`
+}
+
+// ReleaseNote is one entry of the firmware release notes.
+type ReleaseNote struct {
+	Title           string `json:"title"`
+	Subtitle        string `json:"subtitle"`
+	Description     string `json:"description"`
+	CustomerVersion string `json:"customer_version"`
+	Icon            string `json:"icon"`
+	ImageURL        string `json:"image_url"`
+	LightImageURL   string `json:"light_image_url"`
+}
+
+// MobileEnabledResponse mirrors Tesla GET /api/1/vehicles/{vehicle_tag}/mobile_enabled.
+type MobileEnabledResponse struct {
+	Response MobileEnabled `json:"response"`
+}
+
+// MobileEnabled reports whether mobile access is enabled in the vehicle settings.
+type MobileEnabled struct {
+	Result bool   `json:"result"`
+	Reason string `json:"reason"`
+}
+
+// VehicleSpecsResponse mirrors Tesla GET /api/1/vehicles/{vehicle_tag}/specs. The spec sheet differs
+// per model and market, so its contents are passed through untouched.
+type VehicleSpecsResponse struct {
+	Response map[string]any `json:"response"`
+}
+
+// VehicleOptionsResponse mirrors Tesla GET /api/1/dx/vehicles/options.
+type VehicleOptionsResponse struct {
+	Codes []VehicleOptionCode `json:"codes"`
+}
+
+// VehicleOptionCode is a factory option fitted to the vehicle.
+type VehicleOptionCode struct {
+	Code        string `json:"code"`
+	DisplayName string `json:"displayName"`
+	IsActive    bool   `json:"isActive"`
+	ColorCode   string `json:"colorCode,omitempty"`
+}
+
+// WarrantyDetailsResponse mirrors Tesla GET /api/1/dx/warranty/details.
+type WarrantyDetailsResponse struct {
+	ActiveWarranty   []Warranty `json:"activeWarranty"`
+	UpcomingWarranty []Warranty `json:"upcomingWarranty"`
+	ExpiredWarranty  []Warranty `json:"expiredWarranty"`
+}
+
+// Warranty is one warranty coverage entry.
+type Warranty struct {
+	WarrantyType        string  `json:"warrantyType"`
+	WarrantyDisplayName string  `json:"warrantyDisplayName"`
+	ExpirationDate      string  `json:"expirationDate"`
+	ExpirationOdometer  float64 `json:"expirationOdometer"`
+	// OdometerUnit is MI or KM.
+	OdometerUnit       string  `json:"odometerUnit"`
+	WarrantyExpiredOn  *string `json:"warrantyExpiredOn"`
+	CoverageAgeInYears float64 `json:"coverageAgeInYears"`
+}
+
+// FleetStatusRequest is the body of POST /api/1/vehicles/fleet_status.
+type FleetStatusRequest struct {
+	// VINs lists the vehicles to query; any vehicle tag accepted elsewhere is allowed.
+	VINs []string `json:"vins"`
+}
+
+// FleetStatusResponse mirrors Tesla POST /api/1/vehicles/fleet_status.
+type FleetStatusResponse struct {
+	Response FleetStatus `json:"response"`
+}
+
+// FleetStatus reports virtual key pairing and protocol requirements per vehicle.
+type FleetStatus struct {
+	// KeyPairedVINs have our virtual key installed.
+	KeyPairedVINs []string `json:"key_paired_vins"`
+	// UnpairedVINs still need the virtual key pairing flow.
+	UnpairedVINs []string `json:"unpaired_vins"`
+	// VehicleInfo holds firmware details keyed by VIN.
+	VehicleInfo map[string]FleetVehicleInfo `json:"vehicle_info"`
+}
+
+// FleetVehicleInfo describes firmware capabilities of one vehicle.
+type FleetVehicleInfo struct {
+	FirmwareVersion string `json:"firmware_version"`
+	// VehicleCommandProtocolRequired is true when REST commands are rejected and signed commands are needed.
+	VehicleCommandProtocolRequired bool   `json:"vehicle_command_protocol_required"`
+	DiscountedDeviceData           bool   `json:"discounted_device_data"`
+	FleetTelemetryVersion          string `json:"fleet_telemetry_version"`
+	TotalNumberOfKeys              int    `json:"total_number_of_keys"`
+}
+
+// GetNearbyChargingSites proxies Tesla GET /api/1/vehicles/{vehicle_tag}/nearby_charging_sites.
+// The sites and their distances reveal where the vehicle is, so they are masked by the location
+// policy. 充电站列表与距离可反推车辆位置，按位置隐私策略处理。
+func GetNearbyChargingSites(cfg *config.Config, tokenRepo *repository.TokenRepo, vehicles *service.VehicleDirectory, privacyRepo *repository.PrivacyRepo) gin.HandlerFunc {
+	proxy := newTeslaProxy(cfg, tokenRepo, vehicles)
+	privacy := newPrivacyStore(privacyRepo)
+	return func(c *gin.Context) {
+		vin, _, status, err := proxy.commandVIN(c, c.Param(vehicleTagParam))
+		if err != nil {
+			respondWithError(c, status, err)
+			return
+		}
+
+		query := passThroughQuery(c, "count", "radius", "detail")
+		var payload NearbyChargingSitesResponse
+		status, err = proxy.JSON(c, http.MethodGet, apiSegments("vehicles", ":vehicle_tag", "nearby_charging_sites"), query, nil, nil, &payload)
+		if err != nil {
+			respondWithError(c, status, err)
+			return
+		}
+		if err := proxy.maskLocation(c, privacy, vin, false, &payload.Response); err != nil {
+			respondWithError(c, http.StatusInternalServerError, err)
+			return
+		}
+		respondCacheable(c, status, payload, time.Time{})
+	}
+}
+
+// ApplyLocationPolicy masks what the site list reveals about the vehicle position unless policy is
+// exact. Distances are always dropped; under hidden no sites are returned, since the nearest sites
+// alone locate the car; otherwise site coordinates are masked like vehicle coordinates and sites
+// inside the home zone are removed.
+func (s *NearbyChargingSites) ApplyLocationPolicy(policy service.LocationPolicy) {
+	if policy.IsExact() {
+		return
+	}
+	if policy.HidesLocation() {
+		s.DestinationCharging = []ChargingSite{}
+		s.Superchargers = []ChargingSite{}
+		return
+	}
+	s.DestinationCharging = maskChargingSites(policy, s.DestinationCharging)
+	s.Superchargers = maskChargingSites(policy, s.Superchargers)
+}
+
+func maskChargingSites(policy service.LocationPolicy, sites []ChargingSite) []ChargingSite {
+	masked := make([]ChargingSite, 0, len(sites))
+	for _, site := range sites {
+		lat, lon, ok := policy.Apply(site.Location.Lat, site.Location.Long)
+		if !ok {
+			continue
+		}
+		site.Location = ChargingSiteLocation{Lat: lat, Long: lon}
+		site.DistanceMiles = nil
+		masked = append(masked, site)
+	}
+	return masked
+}
+
+// GetServiceData proxies Tesla GET /api/1/vehicles/{vehicle_tag}/service_data.
+func GetServiceData(cfg *config.Config, tokenRepo *repository.TokenRepo, vehicles *service.VehicleDirectory) gin.HandlerFunc {
+	return proxyVehicleJSON[ServiceDataResponse](cfg, tokenRepo, vehicles, "service_data")
+}
+
+// GetRecentAlerts proxies Tesla GET /api/1/vehicles/{vehicle_tag}/recent_alerts.
+func GetRecentAlerts(cfg *config.Config, tokenRepo *repository.TokenRepo, vehicles *service.VehicleDirectory) gin.HandlerFunc {
+	return proxyVehicleJSON[RecentAlertsResponse](cfg, tokenRepo, vehicles, "recent_alerts")
+}
+
+// GetReleaseNotes proxies Tesla GET /api/1/vehicles/{vehicle_tag}/release_notes. Pass staged=true for
+// the notes of a downloaded but not yet installed update, and language to pick a locale.
+func GetReleaseNotes(cfg *config.Config, tokenRepo *repository.TokenRepo, vehicles *service.VehicleDirectory) gin.HandlerFunc {
+	return proxyVehicleJSON[ReleaseNotesResponse](cfg, tokenRepo, vehicles, "release_notes", "staged", "language")
+}
+
+// GetMobileEnabled proxies Tesla GET /api/1/vehicles/{vehicle_tag}/mobile_enabled.
+func GetMobileEnabled(cfg *config.Config, tokenRepo *repository.TokenRepo, vehicles *service.VehicleDirectory) gin.HandlerFunc {
+	return proxyVehicleJSON[MobileEnabledResponse](cfg, tokenRepo, vehicles, "mobile_enabled")
+}
+
+// GetVehicleSpecs proxies Tesla GET /api/1/vehicles/{vehicle_tag}/specs.
+func GetVehicleSpecs(cfg *config.Config, tokenRepo *repository.TokenRepo, vehicles *service.VehicleDirectory) gin.HandlerFunc {
+	return proxyVehicleJSON[VehicleSpecsResponse](cfg, tokenRepo, vehicles, "specs")
+}
+
+// GetVehicleOptions proxies Tesla GET /api/1/dx/vehicles/options for the vehicle's VIN.
+func GetVehicleOptions(cfg *config.Config, tokenRepo *repository.TokenRepo, vehicles *service.VehicleDirectory) gin.HandlerFunc {
+	return proxyVINQueryJSON[VehicleOptionsResponse](cfg, tokenRepo, vehicles, "dx", "vehicles", "options")
+}
+
+// GetWarrantyDetails proxies Tesla GET /api/1/dx/warranty/details for the vehicle's VIN.
+func GetWarrantyDetails(cfg *config.Config, tokenRepo *repository.TokenRepo, vehicles *service.VehicleDirectory) gin.HandlerFunc {
+	return proxyVINQueryJSON[WarrantyDetailsResponse](cfg, tokenRepo, vehicles, "dx", "warranty", "details")
+}
+
+// GetFleetStatus proxies Tesla POST /api/1/vehicles/fleet_status. Every entry is resolved against the
+// user's vehicles first, so tags other than VINs work and foreign vehicles are rejected.
+// GetFleetStatus 查询车辆的虚拟钥匙配对与指令协议要求，请求中的车辆需属于当前用户。
+func GetFleetStatus(cfg *config.Config, tokenRepo *repository.TokenRepo, vehicles *service.VehicleDirectory) gin.HandlerFunc {
+	proxy := newTeslaProxy(cfg, tokenRepo, vehicles)
+	return func(c *gin.Context) {
+		var request FleetStatusRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			respondWithError(c, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+			return
+		}
+		tags, err := normalizeFleetStatusVINs(request.VINs)
+		if err != nil {
+			respondWithError(c, http.StatusBadRequest, err)
+			return
+		}
+
+		vins := make([]string, 0, len(tags))
+		for _, tag := range tags {
+			vin, _, status, err := proxy.commandVIN(c, tag)
+			if err != nil {
+				respondWithError(c, status, err)
+				return
+			}
+			vins = append(vins, vin)
+		}
+
+		body, err := json.Marshal(FleetStatusRequest{VINs: vins})
+		if err != nil {
+			respondWithError(c, http.StatusInternalServerError, err)
+			return
+		}
+		var payload FleetStatusResponse
+		status, err := proxy.JSON(c, http.MethodPost, apiSegments("vehicles", "fleet_status"), nil, body, map[string]string{"Content-Type": "application/json"}, &payload)
+		if err != nil {
+			respondWithError(c, status, err)
+			return
+		}
+		c.JSON(status, payload)
+	}
+}
+
+func normalizeFleetStatusVINs(tags []string) ([]string, error) {
+	seen := make(map[string]struct{}, len(tags))
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+		if _, ok := seen[tag]; ok {
+			continue
+		}
+		seen[tag] = struct{}{}
+		normalized = append(normalized, tag)
+	}
+	switch {
+	case len(normalized) == 0:
+		return nil, errors.New("vins must not be empty")
+	case len(normalized) > maxFleetStatusVINs:
+		return nil, fmt.Errorf("at most %d vins are allowed", maxFleetStatusVINs)
+	}
+	return normalized, nil
+}
+
+// proxyVehicleJSON builds a handler for a read-only GET /api/1/vehicles/{vehicle_tag}/<endpoint>,
+// forwarding only the listed query parameters.
+func proxyVehicleJSON[T any](cfg *config.Config, tokenRepo *repository.TokenRepo, vehicles *service.VehicleDirectory, endpoint string, queryKeys ...string) gin.HandlerFunc {
+	proxy := newTeslaProxy(cfg, tokenRepo, vehicles)
+	return func(c *gin.Context) {
+		var payload T
+		status, err := proxy.JSON(c, http.MethodGet, apiSegments("vehicles", ":vehicle_tag", endpoint), passThroughQuery(c, queryKeys...), nil, nil, &payload)
+		if err != nil {
+			respondWithError(c, status, err)
+			return
+		}
+		respondCacheable(c, status, payload, time.Time{})
+	}
+}
+
+// proxyVINQueryJSON builds a handler for Tesla endpoints that take the VIN as a query parameter
+// instead of a path segment; the route still accepts any vehicle tag.
+func proxyVINQueryJSON[T any](cfg *config.Config, tokenRepo *repository.TokenRepo, vehicles *service.VehicleDirectory, segments ...string) gin.HandlerFunc {
+	proxy := newTeslaProxy(cfg, tokenRepo, vehicles)
+	return func(c *gin.Context) {
+		vin, _, status, err := proxy.commandVIN(c, c.Param(vehicleTagParam))
+		if err != nil {
+			respondWithError(c, status, err)
+			return
+		}
+		var payload T
+		status, err = proxy.JSON(c, http.MethodGet, apiSegments(segments...), url.Values{"vin": {vin}}, nil, nil, &payload)
+		if err != nil {
+			respondWithError(c, status, err)
+			return
+		}
+		respondCacheable(c, status, payload, time.Time{})
+	}
+}
+
+// passThroughQuery copies the allowed query parameters from the client request.
+func passThroughQuery(c *gin.Context, keys ...string) url.Values {
+	query := url.Values{}
+	for _, key := range keys {
+		if value := strings.TrimSpace(c.Query(key)); value != "" {
+			query.Set(key, value)
+		}
+	}
+	if len(query) == 0 {
+		return nil
+	}
+	return query
+}
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+
+	"tds_server/internal/model"
+	"tds_server/internal/service"
+)
+
+func TestNearbyChargingSitesFollowLocationPolicy(t *testing.T) {
+	raw := `{"superchargers":[{"location":{"lat":31.2,"long":121.4},"name":"Shanghai","type":"supercharger","distance_miles":1.5,"available_stalls":3,"total_stalls":8,"site_closed":false}],
+		"destination_charging":[{"location":{"lat":31.1,"long":121.3},"name":"Hotel","type":"destination","distance_miles":2.1}]}`
+	decode := func() NearbyChargingSites {
+		var sites NearbyChargingSites
+		if err := json.Unmarshal([]byte(raw), &sites); err != nil {
+			t.Fatal(err)
+		}
+		return sites
+	}
+
+	exact := decode()
+	exact.ApplyLocationPolicy(service.NewLocationPolicy(nil, false))
+	if exact.Superchargers[0].DistanceMiles == nil || *exact.Superchargers[0].AvailableStalls != 3 {
+		t.Fatalf("exact policy must keep the payload: %+v", exact.Superchargers[0])
+	}
+
+	hidden := decode()
+	hidden.ApplyLocationPolicy(service.NewLocationPolicy(&model.PrivacySetting{LocationMode: model.LocationModeHidden}, false))
+	encoded, _ := json.Marshal(hidden)
+	if len(hidden.Superchargers) != 0 || len(hidden.DestinationCharging) != 0 || strings.Contains(string(encoded), "31.") {
+		t.Fatalf("hidden policy must return no sites: %s", encoded)
+	}
+	if !strings.Contains(string(encoded), `"superchargers":[]`) {
+		t.Fatalf("hidden policy must keep the lists as empty arrays: %s", encoded)
+	}
+
+	coarse := decode()
+	coarse.ApplyLocationPolicy(service.NewLocationPolicy(&model.PrivacySetting{LocationMode: model.LocationModeCoarse, GeohashPrecision: 4}, false))
+	site := coarse.Superchargers[0]
+	if site.DistanceMiles != nil || site.Location.Lat == 31.2 || site.Location.Long == 121.4 {
+		t.Fatalf("coarse policy must drop distances and coarsen coordinates: %+v", site)
+	}
+	if *site.AvailableStalls != 3 {
+		t.Fatalf("coarse policy must keep availability: %+v", site)
+	}
+
+	homeLat, homeLon := 31.1, 121.3
+	home := decode()
+	home.ApplyLocationPolicy(service.NewLocationPolicy(&model.PrivacySetting{
+		LocationMode: model.LocationModeExact, HomeLatitude: &homeLat, HomeLongitude: &homeLon, HomeRadiusMeters: 500,
+	}, false))
+	if len(home.DestinationCharging) != 0 || len(home.Superchargers) != 1 {
+		t.Fatalf("sites inside the home zone must be dropped: %+v", home)
+	}
+}
+
+func TestNormalizeFleetStatusVINs(t *testing.T) {
+	vins, err := normalizeFleetStatusVINs([]string{" 5YJ3E1EA7KF123456", "", "5YJ3E1EA7KF123456", "1492931365271386"})
+	if err != nil || len(vins) != 2 || vins[0] != "5YJ3E1EA7KF123456" {
+		t.Fatalf("normalize = %v, %v", vins, err)
+	}
+	if _, err := normalizeFleetStatusVINs([]string{" "}); err == nil {
+		t.Fatal("empty vins must be rejected")
+	}
+	tooMany := make([]string, 0, maxFleetStatusVINs+1)
+	for i := 0; i <= maxFleetStatusVINs; i++ {
+		tooMany = append(tooMany, strconv.Itoa(i))
+	}
+	if _, err := normalizeFleetStatusVINs(tooMany); err == nil {
+		t.Fatal("oversized batches must be rejected")
+	}
+}
@@ -0,0 +1,177 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// allVehiclesPerPage is the page size used when walking every page; Tesla caps per_page at 100.
+	allVehiclesPerPage = 100
+	// maxVehicleListPages bounds the number of upstream calls a single all=true request may make.
+	maxVehicleListPages = 20
+	// vehicleListConcurrency limits the number of pages fetched in parallel.
+	vehicleListConcurrency = 4
+)
+
+// fetchAllVehicles walks every page of Tesla GET /api/1/vehicles and merges them into one list.
+// The first page is fetched alone to learn the page count; the remaining pages are fetched
+// concurrently, and refreshUserToken collapses the token refreshes their 401s trigger into one. When
+// the fleet exceeds maxVehicleListPages the result is truncated and Pagination.Next points at the
+// first page that was not fetched.
+// fetchAllVehicles 会在服务端遍历所有分页并合并结果，超过页数上限时截断并通过 Pagination.Next 标明续取位置。
+func fetchAllVehicles(c *gin.Context, proxy *teslaProxy, perPage int) (*VehicleListResponse, int, error) {
+	if perPage <= 0 || perPage > allVehiclesPerPage {
+		perPage = allVehiclesPerPage
+	}
+
+	first, status, err := fetchVehiclePage(c, proxy, 1, perPage)
+	if err != nil {
+		return nil, status, err
+	}
+
+	totalPages := first.Pagination.Pages
+	pages := []*VehicleListResponse{first}
+	switch {
+	case totalPages > 1:
+		lastPage := min(totalPages, maxVehicleListPages)
+		rest, status, err := fetchVehiclePages(c, proxy, 2, lastPage, perPage)
+		if err != nil {
+			return nil, status, err
+		}
+		pages = append(pages, rest...)
+	case totalPages == 0 && first.Pagination.Next != nil:
+		// Tesla did not report a page count; follow the next cursor sequentially instead.
+		for page := 2; page <= maxVehicleListPages; page++ {
+			current, status, err := fetchVehiclePage(c, proxy, page, perPage)
+			if err != nil {
+				return nil, status, err
+			}
+			pages = append(pages, current)
+			if current.Pagination.Next == nil || len(current.Response) == 0 {
+				break
+			}
+		}
+		totalPages = len(pages)
+		if last := pages[len(pages)-1]; last.Pagination.Next != nil {
+			totalPages++
+		}
+	}
+	if totalPages < 1 {
+		totalPages = 1
+	}
+
+	merged := mergeVehiclePages(pages)
+	fetched := len(pages)
+	merged.Pagination = PaginationMeta{
+		Current: fetched,
+		PerPage: perPage,
+		Count:   len(merged.Response),
+		Pages:   totalPages,
+	}
+	if fetched < totalPages {
+		next := strconv.Itoa(fetched + 1)
+		merged.Pagination.Next = &next
+	}
+	return merged, http.StatusOK, nil
+}
+
+// fetchVehiclePages retrieves pages [from, to] with bounded concurrency, preserving page order.
+func fetchVehiclePages(c *gin.Context, proxy *teslaProxy, from, to, perPage int) ([]*VehicleListResponse, int, error) {
+	if to < from {
+		return nil, http.StatusOK, nil
+	}
+
+	results := make([]*VehicleListResponse, to-from+1)
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		firstErr  error
+		errStatus int
+	)
+	sem := make(chan struct{}, vehicleListConcurrency)
+
+	for page := from; page <= to; page++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(page int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			mu.Lock()
+			failed := firstErr != nil
+			mu.Unlock()
+			if failed {
+				return
+			}
+
+			payload, status, err := fetchVehiclePage(c, proxy, page, perPage)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("fetch vehicles page %d: %w", page, err)
+					errStatus = status
+				}
+				return
+			}
+			results[page-from] = payload
+		}(page)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, errStatus, firstErr
+	}
+	return results, http.StatusOK, nil
+}
+
+func fetchVehiclePage(c *gin.Context, proxy *teslaProxy, page, perPage int) (*VehicleListResponse, int, error) {
+	query := url.Values{}
+	query.Set("page", strconv.Itoa(page))
+	query.Set("per_page", strconv.Itoa(perPage))
+
+	var payload VehicleListResponse
+	status, err := proxy.JSON(c, http.MethodGet, apiSegments("vehicles"), query, nil, nil, &payload)
+	if err != nil {
+		return nil, status, err
+	}
+	return &payload, status, nil
+}
+
+// mergeVehiclePages concatenates pages and drops duplicates that appear when the fleet changes
+// between page requests.
+func mergeVehiclePages(pages []*VehicleListResponse) *VehicleListResponse {
+	merged := &VehicleListResponse{Response: []VehicleSummary{}}
+	seen := map[int64]struct{}{}
+	for _, page := range pages {
+		if page == nil {
+			continue
+		}
+		for _, vehicle := range page.Response {
+			if _, dup := seen[vehicle.ID]; dup {
+				continue
+			}
+			seen[vehicle.ID] = struct{}{}
+			merged.Response = append(merged.Response, vehicle)
+		}
+	}
+	merged.Count = len(merged.Response)
+	return merged
+}
+
+// parseBoolQuery interprets common truthy spellings of a query flag.
+func parseBoolQuery(value string) bool {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "1", "true", "yes", "on":
+		return true
+	default:
+		return false
+	}
+}
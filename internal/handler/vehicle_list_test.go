@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tds_server/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func TestFetchAllVehiclesRefreshesTokenOnce(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var refreshes atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth2/v3/token", func(w http.ResponseWriter, r *http.Request) {
+		refreshes.Add(1)
+		// Tesla rotates refresh tokens: the old one is spent after its first use.
+		if r.FormValue("refresh_token") != "refresh-1" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+		_ = json.NewEncoder(w).Encode(map[string]any{"access_token": "access-2", "refresh_token": "refresh-2", "expires_in": 3600})
+	})
+	mux.HandleFunc("/api/1/vehicles", func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		// The first page is served before the access token is revoked; pages 2 and 3 see a 401.
+		if page > 1 && r.Header.Get("Authorization") != "Bearer access-2" {
+			http.Error(w, `{"error":"token expired"}`, http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"response":   []map[string]any{{"id": page, "vin": fmt.Sprintf("VIN%d", page)}},
+			"pagination": map[string]any{"current": page, "pages": 3},
+		})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	userID := uuid.New()
+	tokens := newMemoryTokenStore(userID, "access-1", "refresh-1")
+	cfg := &config.Config{TeslaAPIURL: server.URL, TeslaTokenURL: server.URL + "/oauth2/v3/token"}
+	proxy := newTeslaProxy(cfg, tokens, nil)
+
+	payload, status, err := fetchAllVehicles(userContext(userID, "/api/1/vehicles?all=true"), proxy, 1)
+	if err != nil {
+		t.Fatalf("fetch: %d %v", status, err)
+	}
+	if len(payload.Response) != 3 {
+		t.Fatalf("vehicles = %d, want 3", len(payload.Response))
+	}
+	if got := refreshes.Load(); got != 1 {
+		t.Fatalf("token refreshes = %d, want 1", got)
+	}
+	if token, _ := tokens.GetByUserID(userID); token.RefreshToken != "refresh-2" {
+		t.Fatalf("stored refresh token = %q", token.RefreshToken)
+	}
+}
@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"tds_server/internal/apierror"
+	"tds_server/internal/middleware"
+	"tds_server/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// vehicleTagParam is the route parameter that carries a VIN, numeric id, id_s or display name.
+const vehicleTagParam = "vehicle_tag"
+
+// resolvePath expands the path segments, translating :vehicle_tag into the identifier REST
+// endpoints expect. resolvePath 会展开路径参数，并把 :vehicle_tag 转换为 REST 接口所需的标识。
+func (p *teslaProxy) resolvePath(c *gin.Context, segments []string) (string, int, error) {
+	overrides := map[string]string{}
+	for _, segment := range segments {
+		if segment != ":"+vehicleTagParam {
+			continue
+		}
+		tag, status, err := p.restVehicleTag(c)
+		if err != nil {
+			return "", status, err
+		}
+		overrides[vehicleTagParam] = tag
+	}
+
+	path, err := resolveTeslaPath(c, overrides, segments...)
+	if err != nil {
+		return "", http.StatusBadRequest, err
+	}
+	return path, http.StatusOK, nil
+}
+
+// restVehicleTag returns the id_s of the requested vehicle for REST paths. Tags that do not belong
+// to the user are rejected with 404 before any vehicle-specific upstream call is made.
+// restVehicleTag 返回 REST 路径使用的 id_s，不属于当前用户的车辆会在请求特斯拉前直接返回 404。
+func (p *teslaProxy) restVehicleTag(c *gin.Context) (string, int, error) {
+	raw := c.Param(vehicleTagParam)
+	if raw == "" {
+		return "", http.StatusBadRequest, fmt.Errorf("%s is required", vehicleTagParam)
+	}
+	if p.vehicles == nil {
+		return raw, http.StatusOK, nil
+	}
+
+	identity, status, err := p.resolveVehicle(c, raw)
+	if err != nil {
+		return "", status, err
+	}
+	return restTagFor(identity), http.StatusOK, nil
+}
+
+// commandVIN returns the VIN required by the vehicle-command SDK together with the REST tag used for
+// the fallback path, rejecting vehicles the user is not authorized for.
+// commandVIN 返回 SDK 所需的 VIN 以及 REST 回退所用的标识，并拒绝未授权的车辆。
+func (p *teslaProxy) commandVIN(c *gin.Context, raw string) (vin string, restTag string, status int, err error) {
+	if p.vehicles == nil {
+		return raw, raw, http.StatusOK, nil
+	}
+
+	identity, status, err := p.resolveVehicle(c, raw)
+	if err != nil {
+		return "", "", status, err
+	}
+	return identity.VIN, restTagFor(identity), http.StatusOK, nil
+}
+
+// resolveVehicle looks up the tag in the per-user authorized vehicle set, refreshing it from Tesla
+// when needed. Only the account-level vehicle list is requested upstream, never the vehicle itself.
+func (p *teslaProxy) resolveVehicle(c *gin.Context, tag string) (*service.VehicleIdentity, int, error) {
+	if p.vehicles == nil {
+		return nil, http.StatusNotFound, apierror.Wrap(http.StatusNotFound, apierror.CodeVehicleNotFound, service.ErrVehicleNotFound)
+	}
+
+	userID, ok := middleware.UserIDFromContext(c)
+	if !ok {
+		return nil, http.StatusUnauthorized, fmt.Errorf("user is not authenticated")
+	}
+
+	listStatus := http.StatusBadGateway
+	lister := func(ctx context.Context) ([]service.VehicleIdentity, error) {
+		payload, status, err := fetchAllVehicles(c, p, allVehiclesPerPage)
+		if err != nil {
+			listStatus = status
+			return nil, err
+		}
+		if payload.Pagination.Next != nil {
+			return vehicleIdentities(payload.Response), fmt.Errorf("%w: only the first %d vehicles are checked",
+				service.ErrVehicleListIncomplete, len(payload.Response))
+		}
+		return vehicleIdentities(payload.Response), nil
+	}
+
+	identity, err := p.vehicles.Resolve(c.Request.Context(), userID, tag, lister)
+	switch {
+	case err == nil:
+		return identity, http.StatusOK, nil
+	case errors.Is(err, service.ErrVehicleNotFound):
+		return nil, http.StatusNotFound, apierror.Wrap(http.StatusNotFound, apierror.CodeVehicleNotFound, err)
+	case errors.Is(err, service.ErrVehicleAmbiguous):
+		return nil, http.StatusConflict, apierror.Wrap(http.StatusConflict, apierror.CodeVehicleAmbiguous, err)
+	case errors.Is(err, service.ErrVehicleListIncomplete):
+		return nil, http.StatusUnprocessableEntity, apierror.Wrap(http.StatusUnprocessableEntity, apierror.CodeVehicleListIncomplete, err)
+	default:
+		return nil, listStatus, err
+	}
+}
+
+// syncVehicleDirectory stores a complete vehicle list fetched by ListVehicles so later tag lookups
+// skip the upstream call. Callers must not pass partial pages, which would hide other vehicles.
+func (p *teslaProxy) syncVehicleDirectory(c *gin.Context, vehicles []VehicleSummary) {
+	if p.vehicles == nil {
+		return
+	}
+	userID, ok := middleware.UserIDFromContext(c)
+	if !ok {
+		return
+	}
+	p.vehicles.Store(userID, vehicleIdentities(vehicles))
+}
+
+// isCompleteVehicleList reports whether a single ListVehicles page holds the whole fleet.
+func isCompleteVehicleList(payload *VehicleListResponse) bool {
+	pagination := payload.Pagination
+	return pagination.Next == nil && pagination.Previous == nil && pagination.Pages <= 1 && pagination.Current <= 1
+}
+
+func vehicleIdentities(vehicles []VehicleSummary) []service.VehicleIdentity {
+	identities := make([]service.VehicleIdentity, 0, len(vehicles))
+	for _, vehicle := range vehicles {
+		identities = append(identities, service.VehicleIdentity{
+			ID:          vehicle.ID,
+			IDS:         vehicle.IDS,
+			VIN:         vehicle.VIN,
+			DisplayName: vehicle.DisplayName,
+			HidePrivate: vehicle.GranularAccess.HidePrivate,
+		})
+	}
+	return identities
+}
+
+func restTagFor(identity *service.VehicleIdentity) string {
+	if identity.IDS != "" {
+		return identity.IDS
+	}
+	if identity.ID != 0 {
+		return strconv.FormatInt(identity.ID, 10)
+	}
+	return identity.VIN
+}
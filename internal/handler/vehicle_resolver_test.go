@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"tds_server/internal/apierror"
+	"tds_server/internal/config"
+	"tds_server/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// countingUpstream is a fake Fleet API serving a vehicle list of the given size and recording every path.
+type countingUpstream struct {
+	mu    sync.Mutex
+	paths []string
+}
+
+func (u *countingUpstream) handler(vehicles int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u.mu.Lock()
+		u.paths = append(u.paths, r.URL.Path)
+		u.mu.Unlock()
+		if r.URL.Path != "/api/1/vehicles" {
+			_ = json.NewEncoder(w).Encode(map[string]any{"response": map[string]any{}})
+			return
+		}
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+		var list []map[string]any
+		for id := (page-1)*perPage + 1; id <= min(page*perPage, vehicles); id++ {
+			list = append(list, map[string]any{"id": id, "id_s": strconv.Itoa(id), "vin": fmt.Sprintf("VIN%014d", id)})
+		}
+		pages := (vehicles + perPage - 1) / perPage
+		_ = json.NewEncoder(w).Encode(map[string]any{"response": list, "pagination": map[string]any{"current": page, "pages": pages}})
+	})
+}
+
+func (u *countingUpstream) requests() []string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return append([]string(nil), u.paths...)
+}
+
+func TestUnownedVehicleIsRejectedWithoutUpstreamCall(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	upstream := &countingUpstream{}
+	server := httptest.NewServer(upstream.handler(1))
+	defer server.Close()
+
+	userID := uuid.New()
+	directory := service.NewVehicleDirectory(time.Minute)
+	directory.Store(userID, []service.VehicleIdentity{{ID: 1, IDS: "1", VIN: fmt.Sprintf("VIN%014d", 1)}})
+	proxy := newTeslaProxy(&config.Config{TeslaAPIURL: server.URL}, newMemoryTokenStore(userID, "access", "refresh"), directory)
+
+	c := userContext(userID, "/api/1/vehicles/5YJ3E1EA7KF999999/vehicle_data")
+	c.Params = gin.Params{{Key: vehicleTagParam, Value: "5YJ3E1EA7KF999999"}}
+	var payload map[string]any
+	status, err := proxy.JSON(c, http.MethodGet, apiSegments("vehicles", ":vehicle_tag", "vehicle_data"), nil, nil, nil, &payload)
+	if status != http.StatusNotFound || apierror.From(status, err).Code != apierror.CodeVehicleNotFound {
+		t.Fatalf("got %d %v, want 404 vehicle_not_found", status, err)
+	}
+	if got := upstream.requests(); len(got) != 0 {
+		t.Fatalf("upstream requests = %v, want none", got)
+	}
+}
+
+func TestVehicleBeyondListLimitIsNotReportedAsNotFound(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	upstream := &countingUpstream{}
+	server := httptest.NewServer(upstream.handler(allVehiclesPerPage*maxVehicleListPages + 1))
+	defer server.Close()
+
+	userID := uuid.New()
+	proxy := newTeslaProxy(&config.Config{TeslaAPIURL: server.URL}, newMemoryTokenStore(userID, "access", "refresh"),
+		service.NewVehicleDirectory(time.Minute))
+
+	tag := fmt.Sprintf("VIN%014d", allVehiclesPerPage*maxVehicleListPages+1)
+	_, status, err := proxy.resolveVehicle(userContext(userID, "/"), tag)
+	if status != http.StatusUnprocessableEntity || !errors.Is(err, service.ErrVehicleListIncomplete) {
+		t.Fatalf("got %d %v, want 422 vehicle_list_incomplete", status, err)
+	}
+	for _, path := range upstream.requests() {
+		if path != "/api/1/vehicles" {
+			t.Fatalf("unexpected vehicle-specific upstream request %s", path)
+		}
+	}
+
+	if identity, _, err := proxy.resolveVehicle(userContext(userID, "/"), "7"); err != nil || identity.ID != 7 {
+		t.Fatalf("vehicle in the fetched part: %v, %v", identity, err)
+	}
+}
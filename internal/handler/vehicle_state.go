@@ -0,0 +1,668 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// ChargeState mirrors the charge_state section of vehicle_data.
+// ChargeState 对应 vehicle_data 中的 charge_state 模块，未建模字段保存在 Extra 中。
+type ChargeState struct {
+	BatteryHeaterOn             *bool                      `json:"battery_heater_on,omitempty"`
+	BatteryLevel                *int                       `json:"battery_level,omitempty"`
+	BatteryRange                *float64                   `json:"battery_range,omitempty"`
+	ChargeAmps                  *int                       `json:"charge_amps,omitempty"`
+	ChargeCurrentRequest        *int                       `json:"charge_current_request,omitempty"`
+	ChargeCurrentRequestMax     *int                       `json:"charge_current_request_max,omitempty"`
+	ChargeEnableRequest         *bool                      `json:"charge_enable_request,omitempty"`
+	ChargeEnergyAdded           *float64                   `json:"charge_energy_added,omitempty"`
+	ChargeLimitSOC              *int                       `json:"charge_limit_soc,omitempty"`
+	ChargeLimitSOCMax           *int                       `json:"charge_limit_soc_max,omitempty"`
+	ChargeLimitSOCMin           *int                       `json:"charge_limit_soc_min,omitempty"`
+	ChargeLimitSOCStd           *int                       `json:"charge_limit_soc_std,omitempty"`
+	ChargeMilesAddedIdeal       *float64                   `json:"charge_miles_added_ideal,omitempty"`
+	ChargeMilesAddedRated       *float64                   `json:"charge_miles_added_rated,omitempty"`
+	ChargePortColdWeatherMode   *bool                      `json:"charge_port_cold_weather_mode,omitempty"`
+	ChargePortColor             *string                    `json:"charge_port_color,omitempty"`
+	ChargePortDoorOpen          *bool                      `json:"charge_port_door_open,omitempty"`
+	ChargePortLatch             *string                    `json:"charge_port_latch,omitempty"`
+	ChargeRate                  *float64                   `json:"charge_rate,omitempty"`
+	ChargerActualCurrent        *int                       `json:"charger_actual_current,omitempty"`
+	ChargerPhases               *int                       `json:"charger_phases,omitempty"`
+	ChargerPilotCurrent         *int                       `json:"charger_pilot_current,omitempty"`
+	ChargerPower                *int                       `json:"charger_power,omitempty"`
+	ChargerVoltage              *int                       `json:"charger_voltage,omitempty"`
+	ChargingState               *string                    `json:"charging_state,omitempty"`
+	ConnChargeCable             *string                    `json:"conn_charge_cable,omitempty"`
+	EstBatteryRange             *float64                   `json:"est_battery_range,omitempty"`
+	FastChargerBrand            *string                    `json:"fast_charger_brand,omitempty"`
+	FastChargerPresent          *bool                      `json:"fast_charger_present,omitempty"`
+	FastChargerType             *string                    `json:"fast_charger_type,omitempty"`
+	IdealBatteryRange           *float64                   `json:"ideal_battery_range,omitempty"`
+	ManagedChargingActive       *bool                      `json:"managed_charging_active,omitempty"`
+	ManagedChargingStartTime    *int64                     `json:"managed_charging_start_time,omitempty"`
+	ManagedChargingUserCanceled *bool                      `json:"managed_charging_user_canceled,omitempty"`
+	MaxRangeChargeCounter       *int                       `json:"max_range_charge_counter,omitempty"`
+	MinutesToFullCharge         *int                       `json:"minutes_to_full_charge,omitempty"`
+	NotEnoughPowerToHeat        *bool                      `json:"not_enough_power_to_heat,omitempty"`
+	OffPeakChargingEnabled      *bool                      `json:"off_peak_charging_enabled,omitempty"`
+	OffPeakChargingTimes        *string                    `json:"off_peak_charging_times,omitempty"`
+	OffPeakHoursEndTime         *int                       `json:"off_peak_hours_end_time,omitempty"`
+	PreconditioningEnabled      *bool                      `json:"preconditioning_enabled,omitempty"`
+	PreconditioningTimes        *string                    `json:"preconditioning_times,omitempty"`
+	ScheduledChargingMode       *string                    `json:"scheduled_charging_mode,omitempty"`
+	ScheduledChargingPending    *bool                      `json:"scheduled_charging_pending,omitempty"`
+	ScheduledChargingStartTime  *int64                     `json:"scheduled_charging_start_time,omitempty"`
+	ScheduledDepartureTime      *int64                     `json:"scheduled_departure_time,omitempty"`
+	ScheduledDepartureTimeMin   *int                       `json:"scheduled_departure_time_minutes,omitempty"`
+	SuperchargerSessionTripPlan *bool                      `json:"supercharger_session_trip_planner,omitempty"`
+	TimeToFullCharge            *float64                   `json:"time_to_full_charge,omitempty"`
+	Timestamp                   *int64                     `json:"timestamp,omitempty"`
+	TripCharging                *bool                      `json:"trip_charging,omitempty"`
+	UsableBatteryLevel          *int                       `json:"usable_battery_level,omitempty"`
+	UserChargeEnableRequest     *bool                      `json:"user_charge_enable_request,omitempty"`
+	Extra                       map[string]json.RawMessage `json:"-"`
+}
+
+// ClimateState mirrors the climate_state section of vehicle_data; temperatures are reported in Celsius.
+type ClimateState struct {
+	AllowCabinOverheatProtection        *bool                      `json:"allow_cabin_overheat_protection,omitempty"`
+	AutoSeatClimateLeft                 *bool                      `json:"auto_seat_climate_left,omitempty"`
+	AutoSeatClimateRight                *bool                      `json:"auto_seat_climate_right,omitempty"`
+	AutoSteeringWheelHeat               *bool                      `json:"auto_steering_wheel_heat,omitempty"`
+	BatteryHeater                       *bool                      `json:"battery_heater,omitempty"`
+	BatteryHeaterNoPower                *bool                      `json:"battery_heater_no_power,omitempty"`
+	BioweaponMode                       *bool                      `json:"bioweapon_mode,omitempty"`
+	CabinOverheatProtection             *string                    `json:"cabin_overheat_protection,omitempty"`
+	CabinOverheatProtectionActivelyCool *bool                      `json:"cabin_overheat_protection_actively_cooling,omitempty"`
+	ClimateKeeperMode                   *string                    `json:"climate_keeper_mode,omitempty"`
+	CopActivationTemperature            *string                    `json:"cop_activation_temperature,omitempty"`
+	DefrostMode                         *int                       `json:"defrost_mode,omitempty"`
+	DriverTempSetting                   *float64                   `json:"driver_temp_setting,omitempty"`
+	FanStatus                           *int                       `json:"fan_status,omitempty"`
+	HVACAutoRequest                     *string                    `json:"hvac_auto_request,omitempty"`
+	InsideTemp                          *float64                   `json:"inside_temp,omitempty"`
+	IsAutoConditioningOn                *bool                      `json:"is_auto_conditioning_on,omitempty"`
+	IsClimateOn                         *bool                      `json:"is_climate_on,omitempty"`
+	IsFrontDefrosterOn                  *bool                      `json:"is_front_defroster_on,omitempty"`
+	IsPreconditioning                   *bool                      `json:"is_preconditioning,omitempty"`
+	IsRearDefrosterOn                   *bool                      `json:"is_rear_defroster_on,omitempty"`
+	LeftTempDirection                   *int                       `json:"left_temp_direction,omitempty"`
+	MaxAvailTemp                        *float64                   `json:"max_avail_temp,omitempty"`
+	MinAvailTemp                        *float64                   `json:"min_avail_temp,omitempty"`
+	OutsideTemp                         *float64                   `json:"outside_temp,omitempty"`
+	PassengerTempSetting                *float64                   `json:"passenger_temp_setting,omitempty"`
+	RemoteHeaterControlEnabled          *bool                      `json:"remote_heater_control_enabled,omitempty"`
+	RightTempDirection                  *int                       `json:"right_temp_direction,omitempty"`
+	SeatHeaterLeft                      *int                       `json:"seat_heater_left,omitempty"`
+	SeatHeaterRearCenter                *int                       `json:"seat_heater_rear_center,omitempty"`
+	SeatHeaterRearLeft                  *int                       `json:"seat_heater_rear_left,omitempty"`
+	SeatHeaterRearRight                 *int                       `json:"seat_heater_rear_right,omitempty"`
+	SeatHeaterRight                     *int                       `json:"seat_heater_right,omitempty"`
+	SideMirrorHeaters                   *bool                      `json:"side_mirror_heaters,omitempty"`
+	SteeringWheelHeatLevel              *int                       `json:"steering_wheel_heat_level,omitempty"`
+	SteeringWheelHeater                 *bool                      `json:"steering_wheel_heater,omitempty"`
+	SupportsFanOnlyCabinOverheatProtect *bool                      `json:"supports_fan_only_cabin_overheat_protection,omitempty"`
+	Timestamp                           *int64                     `json:"timestamp,omitempty"`
+	WiperBladeHeater                    *bool                      `json:"wiper_blade_heater,omitempty"`
+	Extra                               map[string]json.RawMessage `json:"-"`
+}
+
+// ClosuresState mirrors the closures_state section of vehicle_data (doors, windows and trunks).
+type ClosuresState struct {
+	DF                 *int                       `json:"df,omitempty"`
+	DR                 *int                       `json:"dr,omitempty"`
+	PF                 *int                       `json:"pf,omitempty"`
+	PR                 *int                       `json:"pr,omitempty"`
+	FT                 *int                       `json:"ft,omitempty"`
+	RT                 *int                       `json:"rt,omitempty"`
+	FDWindow           *int                       `json:"fd_window,omitempty"`
+	FPWindow           *int                       `json:"fp_window,omitempty"`
+	RDWindow           *int                       `json:"rd_window,omitempty"`
+	RPWindow           *int                       `json:"rp_window,omitempty"`
+	Locked             *bool                      `json:"locked,omitempty"`
+	SunRoofPercentOpen *int                       `json:"sun_roof_percent_open,omitempty"`
+	SunRoofState       *string                    `json:"sun_roof_state,omitempty"`
+	Timestamp          *int64                     `json:"timestamp,omitempty"`
+	Extra              map[string]json.RawMessage `json:"-"`
+}
+
+// DriveState mirrors the drive_state section of vehicle_data; speed is reported in mph.
+type DriveState struct {
+	ActiveRouteLatitude            *float64                   `json:"active_route_latitude,omitempty"`
+	ActiveRouteLongitude           *float64                   `json:"active_route_longitude,omitempty"`
+	ActiveRouteTrafficMinutesDelay *int                       `json:"active_route_traffic_minutes_delay,omitempty"`
+	GPSAsOf                        *int64                     `json:"gps_as_of,omitempty"`
+	Heading                        *int                       `json:"heading,omitempty"`
+	Latitude                       *float64                   `json:"latitude,omitempty"`
+	Longitude                      *float64                   `json:"longitude,omitempty"`
+	NativeLatitude                 *float64                   `json:"native_latitude,omitempty"`
+	NativeLocationSupported        *int                       `json:"native_location_supported,omitempty"`
+	NativeLongitude                *float64                   `json:"native_longitude,omitempty"`
+	NativeType                     *string                    `json:"native_type,omitempty"`
+	Power                          *int                       `json:"power,omitempty"`
+	ShiftState                     *string                    `json:"shift_state,omitempty"`
+	Speed                          *float64                   `json:"speed,omitempty"`
+	Timestamp                      *int64                     `json:"timestamp,omitempty"`
+	Extra                          map[string]json.RawMessage `json:"-"`
+}
+
+// GUISettings mirrors the gui_settings section of vehicle_data.
+type GUISettings struct {
+	GUI24HourTime        *bool                      `json:"gui_24_hour_time,omitempty"`
+	GUIChargeRateUnits   *string                    `json:"gui_charge_rate_units,omitempty"`
+	GUIDistanceUnits     *string                    `json:"gui_distance_units,omitempty"`
+	GUIRangeDisplay      *string                    `json:"gui_range_display,omitempty"`
+	GUITemperatureUnits  *string                    `json:"gui_temperature_units,omitempty"`
+	GUITirePressureUnits *string                    `json:"gui_tirepressure_units,omitempty"`
+	ShowRangeUnits       *bool                      `json:"show_range_units,omitempty"`
+	Timestamp            *int64                     `json:"timestamp,omitempty"`
+	Extra                map[string]json.RawMessage `json:"-"`
+}
+
+// LocationData mirrors the location_data section of vehicle_data.
+type LocationData struct {
+	Latitude        *float64                   `json:"latitude,omitempty"`
+	Longitude       *float64                   `json:"longitude,omitempty"`
+	Heading         *int                       `json:"heading,omitempty"`
+	GPSAsOf         *int64                     `json:"gps_as_of,omitempty"`
+	NativeLatitude  *float64                   `json:"native_latitude,omitempty"`
+	NativeLongitude *float64                   `json:"native_longitude,omitempty"`
+	NativeType      *string                    `json:"native_type,omitempty"`
+	Timestamp       *int64                     `json:"timestamp,omitempty"`
+	Extra           map[string]json.RawMessage `json:"-"`
+}
+
+// ChargeSchedule is a single entry of charge_schedule_data.charge_schedules.
+type ChargeSchedule struct {
+	ID           *int64                     `json:"id,omitempty"`
+	Name         *string                    `json:"name,omitempty"`
+	DaysOfWeek   *int                       `json:"days_of_week,omitempty"`
+	StartEnabled *bool                      `json:"start_enabled,omitempty"`
+	StartTime    *int                       `json:"start_time,omitempty"`
+	EndEnabled   *bool                      `json:"end_enabled,omitempty"`
+	EndTime      *int                       `json:"end_time,omitempty"`
+	OneTime      *bool                      `json:"one_time,omitempty"`
+	Enabled      *bool                      `json:"enabled,omitempty"`
+	Latitude     *float64                   `json:"latitude,omitempty"`
+	Longitude    *float64                   `json:"longitude,omitempty"`
+	Extra        map[string]json.RawMessage `json:"-"`
+}
+
+// ChargeScheduleData mirrors the charge_schedule_data section of vehicle_data.
+type ChargeScheduleData struct {
+	ChargeSchedules []ChargeSchedule           `json:"charge_schedules,omitempty"`
+	Timestamp       *int64                     `json:"timestamp,omitempty"`
+	Extra           map[string]json.RawMessage `json:"-"`
+}
+
+// PreconditionSchedule is a single entry of preconditioning_schedule_data.precondition_schedules.
+type PreconditionSchedule struct {
+	ID               *int64                     `json:"id,omitempty"`
+	Name             *string                    `json:"name,omitempty"`
+	DaysOfWeek       *int                       `json:"days_of_week,omitempty"`
+	PreconditionTime *int                       `json:"precondition_time,omitempty"`
+	OneTime          *bool                      `json:"one_time,omitempty"`
+	Enabled          *bool                      `json:"enabled,omitempty"`
+	Latitude         *float64                   `json:"latitude,omitempty"`
+	Longitude        *float64                   `json:"longitude,omitempty"`
+	Extra            map[string]json.RawMessage `json:"-"`
+}
+
+// PreconditioningScheduleData mirrors the preconditioning_schedule_data section of vehicle_data.
+type PreconditioningScheduleData struct {
+	PreconditionSchedules []PreconditionSchedule     `json:"precondition_schedules,omitempty"`
+	Timestamp             *int64                     `json:"timestamp,omitempty"`
+	Extra                 map[string]json.RawMessage `json:"-"`
+}
+
+// VehicleConfig mirrors the vehicle_config section of vehicle_data.
+type VehicleConfig struct {
+	AuxParkLamps               *string                    `json:"aux_park_lamps,omitempty"`
+	BadgeVersion               *int                       `json:"badge_version,omitempty"`
+	CanAcceptNavigationRequest *bool                      `json:"can_accept_navigation_requests,omitempty"`
+	CanActuateTrunks           *bool                      `json:"can_actuate_trunks,omitempty"`
+	CarSpecialType             *string                    `json:"car_special_type,omitempty"`
+	CarType                    *string                    `json:"car_type,omitempty"`
+	ChargePortType             *string                    `json:"charge_port_type,omitempty"`
+	CopUserSetTempSupported    *bool                      `json:"cop_user_set_temp_supported,omitempty"`
+	DashcamClipSaveSupported   *bool                      `json:"dashcam_clip_save_supported,omitempty"`
+	DefaultChargeToMax         *bool                      `json:"default_charge_to_max,omitempty"`
+	DriverAssist               *string                    `json:"driver_assist,omitempty"`
+	ECERestrictions            *bool                      `json:"ece_restrictions,omitempty"`
+	EfficiencyPackage          *string                    `json:"efficiency_package,omitempty"`
+	EUVehicle                  *bool                      `json:"eu_vehicle,omitempty"`
+	ExteriorColor              *string                    `json:"exterior_color,omitempty"`
+	ExteriorTrim               *string                    `json:"exterior_trim,omitempty"`
+	ExteriorTrimOverride       *string                    `json:"exterior_trim_override,omitempty"`
+	HasAirSuspension           *bool                      `json:"has_air_suspension,omitempty"`
+	HasLudicrousMode           *bool                      `json:"has_ludicrous_mode,omitempty"`
+	HasSeatCooling             *bool                      `json:"has_seat_cooling,omitempty"`
+	HeadlampType               *string                    `json:"headlamp_type,omitempty"`
+	InteriorTrimType           *string                    `json:"interior_trim_type,omitempty"`
+	KeyVersion                 *int                       `json:"key_version,omitempty"`
+	MotorizedChargePort        *bool                      `json:"motorized_charge_port,omitempty"`
+	PaintColorOverride         *string                    `json:"paint_color_override,omitempty"`
+	PerformancePackage         *string                    `json:"performance_package,omitempty"`
+	PLG                        *bool                      `json:"plg,omitempty"`
+	PWS                        *bool                      `json:"pws,omitempty"`
+	RearDriveUnit              *string                    `json:"rear_drive_unit,omitempty"`
+	RearSeatHeaters            *int                       `json:"rear_seat_heaters,omitempty"`
+	RearSeatType               *int                       `json:"rear_seat_type,omitempty"`
+	RHD                        *bool                      `json:"rhd,omitempty"`
+	RoofColor                  *string                    `json:"roof_color,omitempty"`
+	SeatType                   *int                       `json:"seat_type,omitempty"`
+	SpoilerType                *string                    `json:"spoiler_type,omitempty"`
+	SunRoofInstalled           *int                       `json:"sun_roof_installed,omitempty"`
+	SupportsQRPairing          *bool                      `json:"supports_qr_pairing,omitempty"`
+	ThirdRowSeats              *string                    `json:"third_row_seats,omitempty"`
+	Timestamp                  *int64                     `json:"timestamp,omitempty"`
+	TrimBadging                *string                    `json:"trim_badging,omitempty"`
+	UseRangeBadging            *bool                      `json:"use_range_badging,omitempty"`
+	UTCOffset                  *int                       `json:"utc_offset,omitempty"`
+	WebcamSelfieSupported      *bool                      `json:"webcam_selfie_supported,omitempty"`
+	WebcamSupported            *bool                      `json:"webcam_supported,omitempty"`
+	WheelType                  *string                    `json:"wheel_type,omitempty"`
+	Extra                      map[string]json.RawMessage `json:"-"`
+}
+
+// MediaInfo mirrors vehicle_state.media_info.
+type MediaInfo struct {
+	A2DPSourceName       *string                    `json:"a2dp_source_name,omitempty"`
+	AudioVolume          *float64                   `json:"audio_volume,omitempty"`
+	AudioVolumeIncrement *float64                   `json:"audio_volume_increment,omitempty"`
+	AudioVolumeMax       *float64                   `json:"audio_volume_max,omitempty"`
+	MediaPlaybackStatus  *string                    `json:"media_playback_status,omitempty"`
+	NowPlayingAlbum      *string                    `json:"now_playing_album,omitempty"`
+	NowPlayingArtist     *string                    `json:"now_playing_artist,omitempty"`
+	NowPlayingDuration   *int                       `json:"now_playing_duration,omitempty"`
+	NowPlayingElapsed    *int                       `json:"now_playing_elapsed,omitempty"`
+	NowPlayingSource     *string                    `json:"now_playing_source,omitempty"`
+	NowPlayingStation    *string                    `json:"now_playing_station,omitempty"`
+	NowPlayingTitle      *string                    `json:"now_playing_title,omitempty"`
+	Extra                map[string]json.RawMessage `json:"-"`
+}
+
+// MediaState mirrors vehicle_state.media_state.
+type MediaState struct {
+	RemoteControlEnabled *bool                      `json:"remote_control_enabled,omitempty"`
+	Extra                map[string]json.RawMessage `json:"-"`
+}
+
+// SoftwareUpdate mirrors vehicle_state.software_update.
+type SoftwareUpdate struct {
+	DownloadPerc        *int                       `json:"download_perc,omitempty"`
+	ExpectedDurationSec *int                       `json:"expected_duration_sec,omitempty"`
+	InstallPerc         *int                       `json:"install_perc,omitempty"`
+	Status              *string                    `json:"status,omitempty"`
+	Version             *string                    `json:"version,omitempty"`
+	Extra               map[string]json.RawMessage `json:"-"`
+}
+
+// SpeedLimitMode mirrors vehicle_state.speed_limit_mode; limits are in mph unless units are normalized.
+type SpeedLimitMode struct {
+	Active          *bool                      `json:"active,omitempty"`
+	CurrentLimitMPH *float64                   `json:"current_limit_mph,omitempty"`
+	MaxLimitMPH     *float64                   `json:"max_limit_mph,omitempty"`
+	MinLimitMPH     *float64                   `json:"min_limit_mph,omitempty"`
+	PinCodeSet      *bool                      `json:"pin_code_set,omitempty"`
+	Extra           map[string]json.RawMessage `json:"-"`
+}
+
+// VehicleState mirrors the vehicle_state section of vehicle_data; odometer is in miles and tire pressures in bar.
+type VehicleState struct {
+	APIVersion                 *int                       `json:"api_version,omitempty"`
+	AutoparkStateV3            *string                    `json:"autopark_state_v3,omitempty"`
+	AutoparkStyle              *string                    `json:"autopark_style,omitempty"`
+	CalendarSupported          *bool                      `json:"calendar_supported,omitempty"`
+	CarVersion                 *string                    `json:"car_version,omitempty"`
+	CenterDisplayState         *int                       `json:"center_display_state,omitempty"`
+	DashcamClipSaveAvailable   *bool                      `json:"dashcam_clip_save_available,omitempty"`
+	DashcamState               *string                    `json:"dashcam_state,omitempty"`
+	DF                         *int                       `json:"df,omitempty"`
+	DR                         *int                       `json:"dr,omitempty"`
+	FDWindow                   *int                       `json:"fd_window,omitempty"`
+	FeatureBitmask             *string                    `json:"feature_bitmask,omitempty"`
+	FPWindow                   *int                       `json:"fp_window,omitempty"`
+	FT                         *int                       `json:"ft,omitempty"`
+	HomelinkDeviceCount        *int                       `json:"homelink_device_count,omitempty"`
+	HomelinkNearby             *bool                      `json:"homelink_nearby,omitempty"`
+	IsUserPresent              *bool                      `json:"is_user_present,omitempty"`
+	LastAutoparkError          *string                    `json:"last_autopark_error,omitempty"`
+	Locked                     *bool                      `json:"locked,omitempty"`
+	MediaInfo                  *MediaInfo                 `json:"media_info,omitempty"`
+	MediaState                 *MediaState                `json:"media_state,omitempty"`
+	NotificationsSupported     *bool                      `json:"notifications_supported,omitempty"`
+	Odometer                   *float64                   `json:"odometer,omitempty"`
+	ParsedCalendarSupported    *bool                      `json:"parsed_calendar_supported,omitempty"`
+	PF                         *int                       `json:"pf,omitempty"`
+	PR                         *int                       `json:"pr,omitempty"`
+	RDWindow                   *int                       `json:"rd_window,omitempty"`
+	RemoteStart                *bool                      `json:"remote_start,omitempty"`
+	RemoteStartEnabled         *bool                      `json:"remote_start_enabled,omitempty"`
+	RemoteStartSupported       *bool                      `json:"remote_start_supported,omitempty"`
+	RPWindow                   *int                       `json:"rp_window,omitempty"`
+	RT                         *int                       `json:"rt,omitempty"`
+	SantaMode                  *int                       `json:"santa_mode,omitempty"`
+	SentryMode                 *bool                      `json:"sentry_mode,omitempty"`
+	SentryModeAvailable        *bool                      `json:"sentry_mode_available,omitempty"`
+	ServiceMode                *bool                      `json:"service_mode,omitempty"`
+	ServiceModePlus            *bool                      `json:"service_mode_plus,omitempty"`
+	SmartSummonAvailable       *bool                      `json:"smart_summon_available,omitempty"`
+	SoftwareUpdate             *SoftwareUpdate            `json:"software_update,omitempty"`
+	SpeedLimitMode             *SpeedLimitMode            `json:"speed_limit_mode,omitempty"`
+	SummonStandbyModeEnabled   *bool                      `json:"summon_standby_mode_enabled,omitempty"`
+	Timestamp                  *int64                     `json:"timestamp,omitempty"`
+	TPMSHardWarningFL          *bool                      `json:"tpms_hard_warning_fl,omitempty"`
+	TPMSHardWarningFR          *bool                      `json:"tpms_hard_warning_fr,omitempty"`
+	TPMSHardWarningRL          *bool                      `json:"tpms_hard_warning_rl,omitempty"`
+	TPMSHardWarningRR          *bool                      `json:"tpms_hard_warning_rr,omitempty"`
+	TPMSLastSeenPressureTimeFL *int64                     `json:"tpms_last_seen_pressure_time_fl,omitempty"`
+	TPMSLastSeenPressureTimeFR *int64                     `json:"tpms_last_seen_pressure_time_fr,omitempty"`
+	TPMSLastSeenPressureTimeRL *int64                     `json:"tpms_last_seen_pressure_time_rl,omitempty"`
+	TPMSLastSeenPressureTimeRR *int64                     `json:"tpms_last_seen_pressure_time_rr,omitempty"`
+	TPMSPressureFL             *float64                   `json:"tpms_pressure_fl,omitempty"`
+	TPMSPressureFR             *float64                   `json:"tpms_pressure_fr,omitempty"`
+	TPMSPressureRL             *float64                   `json:"tpms_pressure_rl,omitempty"`
+	TPMSPressureRR             *float64                   `json:"tpms_pressure_rr,omitempty"`
+	TPMSRcpFrontValue          *float64                   `json:"tpms_rcp_front_value,omitempty"`
+	TPMSRcpRearValue           *float64                   `json:"tpms_rcp_rear_value,omitempty"`
+	TPMSSoftWarningFL          *bool                      `json:"tpms_soft_warning_fl,omitempty"`
+	TPMSSoftWarningFR          *bool                      `json:"tpms_soft_warning_fr,omitempty"`
+	TPMSSoftWarningRL          *bool                      `json:"tpms_soft_warning_rl,omitempty"`
+	TPMSSoftWarningRR          *bool                      `json:"tpms_soft_warning_rr,omitempty"`
+	ValetMode                  *bool                      `json:"valet_mode,omitempty"`
+	ValetPinNeeded             *bool                      `json:"valet_pin_needed,omitempty"`
+	VehicleName                *string                    `json:"vehicle_name,omitempty"`
+	VehicleSelfTestProgress    *int                       `json:"vehicle_self_test_progress,omitempty"`
+	VehicleSelfTestRequested   *bool                      `json:"vehicle_self_test_requested,omitempty"`
+	WebcamAvailable            *bool                      `json:"webcam_available,omitempty"`
+	Extra                      map[string]json.RawMessage `json:"-"`
+}
+
+// VehicleDataCombo mirrors the vehicle_data_combo section; Tesla does not document its layout, so
+// everything except the timestamp is kept in Extra.
+type VehicleDataCombo struct {
+	Timestamp *int64                     `json:"timestamp,omitempty"`
+	Extra     map[string]json.RawMessage `json:"-"`
+}
+
+func (s *ChargeState) UnmarshalJSON(data []byte) error {
+	type alias ChargeState
+	return decodeWithExtra(data, (*alias)(s), &s.Extra)
+}
+
+func (s ChargeState) MarshalJSON() ([]byte, error) {
+	type alias ChargeState
+	return encodeWithExtra(alias(s), s.Extra)
+}
+
+func (s *ClimateState) UnmarshalJSON(data []byte) error {
+	type alias ClimateState
+	return decodeWithExtra(data, (*alias)(s), &s.Extra)
+}
+
+func (s ClimateState) MarshalJSON() ([]byte, error) {
+	type alias ClimateState
+	return encodeWithExtra(alias(s), s.Extra)
+}
+
+func (s *ClosuresState) UnmarshalJSON(data []byte) error {
+	type alias ClosuresState
+	return decodeWithExtra(data, (*alias)(s), &s.Extra)
+}
+
+func (s ClosuresState) MarshalJSON() ([]byte, error) {
+	type alias ClosuresState
+	return encodeWithExtra(alias(s), s.Extra)
+}
+
+func (s *DriveState) UnmarshalJSON(data []byte) error {
+	type alias DriveState
+	return decodeWithExtra(data, (*alias)(s), &s.Extra)
+}
+
+func (s DriveState) MarshalJSON() ([]byte, error) {
+	type alias DriveState
+	return encodeWithExtra(alias(s), s.Extra)
+}
+
+func (s *GUISettings) UnmarshalJSON(data []byte) error {
+	type alias GUISettings
+	return decodeWithExtra(data, (*alias)(s), &s.Extra)
+}
+
+func (s GUISettings) MarshalJSON() ([]byte, error) {
+	type alias GUISettings
+	return encodeWithExtra(alias(s), s.Extra)
+}
+
+func (s *LocationData) UnmarshalJSON(data []byte) error {
+	type alias LocationData
+	return decodeWithExtra(data, (*alias)(s), &s.Extra)
+}
+
+func (s LocationData) MarshalJSON() ([]byte, error) {
+	type alias LocationData
+	return encodeWithExtra(alias(s), s.Extra)
+}
+
+func (s *ChargeSchedule) UnmarshalJSON(data []byte) error {
+	type alias ChargeSchedule
+	return decodeWithExtra(data, (*alias)(s), &s.Extra)
+}
+
+func (s ChargeSchedule) MarshalJSON() ([]byte, error) {
+	type alias ChargeSchedule
+	return encodeWithExtra(alias(s), s.Extra)
+}
+
+func (s *ChargeScheduleData) UnmarshalJSON(data []byte) error {
+	type alias ChargeScheduleData
+	return decodeWithExtra(data, (*alias)(s), &s.Extra)
+}
+
+func (s ChargeScheduleData) MarshalJSON() ([]byte, error) {
+	type alias ChargeScheduleData
+	return encodeWithExtra(alias(s), s.Extra)
+}
+
+func (s *PreconditionSchedule) UnmarshalJSON(data []byte) error {
+	type alias PreconditionSchedule
+	return decodeWithExtra(data, (*alias)(s), &s.Extra)
+}
+
+func (s PreconditionSchedule) MarshalJSON() ([]byte, error) {
+	type alias PreconditionSchedule
+	return encodeWithExtra(alias(s), s.Extra)
+}
+
+func (s *PreconditioningScheduleData) UnmarshalJSON(data []byte) error {
+	type alias PreconditioningScheduleData
+	return decodeWithExtra(data, (*alias)(s), &s.Extra)
+}
+
+func (s PreconditioningScheduleData) MarshalJSON() ([]byte, error) {
+	type alias PreconditioningScheduleData
+	return encodeWithExtra(alias(s), s.Extra)
+}
+
+func (s *VehicleConfig) UnmarshalJSON(data []byte) error {
+	type alias VehicleConfig
+	return decodeWithExtra(data, (*alias)(s), &s.Extra)
+}
+
+func (s VehicleConfig) MarshalJSON() ([]byte, error) {
+	type alias VehicleConfig
+	return encodeWithExtra(alias(s), s.Extra)
+}
+
+func (s *MediaInfo) UnmarshalJSON(data []byte) error {
+	type alias MediaInfo
+	return decodeWithExtra(data, (*alias)(s), &s.Extra)
+}
+
+func (s MediaInfo) MarshalJSON() ([]byte, error) {
+	type alias MediaInfo
+	return encodeWithExtra(alias(s), s.Extra)
+}
+
+func (s *MediaState) UnmarshalJSON(data []byte) error {
+	type alias MediaState
+	return decodeWithExtra(data, (*alias)(s), &s.Extra)
+}
+
+func (s MediaState) MarshalJSON() ([]byte, error) {
+	type alias MediaState
+	return encodeWithExtra(alias(s), s.Extra)
+}
+
+func (s *SoftwareUpdate) UnmarshalJSON(data []byte) error {
+	type alias SoftwareUpdate
+	return decodeWithExtra(data, (*alias)(s), &s.Extra)
+}
+
+func (s SoftwareUpdate) MarshalJSON() ([]byte, error) {
+	type alias SoftwareUpdate
+	return encodeWithExtra(alias(s), s.Extra)
+}
+
+func (s *SpeedLimitMode) UnmarshalJSON(data []byte) error {
+	type alias SpeedLimitMode
+	return decodeWithExtra(data, (*alias)(s), &s.Extra)
+}
+
+func (s SpeedLimitMode) MarshalJSON() ([]byte, error) {
+	type alias SpeedLimitMode
+	return encodeWithExtra(alias(s), s.Extra)
+}
+
+func (s *VehicleState) UnmarshalJSON(data []byte) error {
+	type alias VehicleState
+	return decodeWithExtra(data, (*alias)(s), &s.Extra)
+}
+
+func (s VehicleState) MarshalJSON() ([]byte, error) {
+	type alias VehicleState
+	return encodeWithExtra(alias(s), s.Extra)
+}
+
+func (s *VehicleDataCombo) UnmarshalJSON(data []byte) error {
+	type alias VehicleDataCombo
+	return decodeWithExtra(data, (*alias)(s), &s.Extra)
+}
+
+func (s VehicleDataCombo) MarshalJSON() ([]byte, error) {
+	type alias VehicleDataCombo
+	return encodeWithExtra(alias(s), s.Extra)
+}
+
+// knownFieldCache memoizes the JSON keys declared by each typed section.
+var knownFieldCache sync.Map
+
+// decodeWithExtra decodes data into dest and collects keys dest does not declare into extra,
+// so fields Tesla adds later still reach clients unchanged. Declared keys are kept in extra as well
+// when dest cannot reproduce them: null and empty values, which the typed fields omit, and values
+// whose type does not match the field, e.g. a fractional number for an integer field. A type drift
+// on Tesla's side therefore passes the raw value through instead of failing the request.
+// decodeWithExtra 会把未建模的字段、null/空值以及类型与模型不符的字段原样保存在 extra 中，
+// 确保特斯拉新增或变更的字段能透传给客户端，而不会导致请求失败。
+func decodeWithExtra(data []byte, dest any, extra *map[string]json.RawMessage) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	known := knownJSONFields(reflect.TypeOf(dest).Elem())
+	typed := map[string]json.RawMessage{}
+	for key, value := range raw {
+		if _, ok := known[key]; ok && !isEmptyJSON(value) {
+			typed[key] = value
+			delete(raw, key)
+		}
+	}
+
+	if err := json.Unmarshal(data, dest); err != nil {
+		// Try the declared keys one by one so a mismatched value only affects its own field, then
+		// decode the keys that fit afresh; the failed pass may have left zero values behind.
+		target := reflect.ValueOf(dest).Elem()
+		for key, value := range typed {
+			field, err := json.Marshal(map[string]json.RawMessage{key: value})
+			if err != nil {
+				return err
+			}
+			if err := json.Unmarshal(field, reflect.New(target.Type()).Interface()); err != nil {
+				raw[key] = value
+				delete(typed, key)
+			}
+		}
+		fitting, err := json.Marshal(typed)
+		if err != nil {
+			return err
+		}
+		target.Set(reflect.Zero(target.Type()))
+		if err := json.Unmarshal(fitting, dest); err != nil {
+			return err
+		}
+	}
+
+	if len(raw) == 0 {
+		*extra = nil
+		return nil
+	}
+	*extra = raw
+	return nil
+}
+
+// isEmptyJSON reports whether value is null or an empty array or object.
+func isEmptyJSON(value json.RawMessage) bool {
+	switch string(bytes.TrimSpace(value)) {
+	case "null", "[]", "{}":
+		return true
+	}
+	return false
+}
+
+// encodeWithExtra encodes value and merges the preserved extra keys back into the object.
+func encodeWithExtra(value any, extra map[string]json.RawMessage) ([]byte, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(extra) == 0 {
+		return encoded, nil
+	}
+
+	merged := map[string]json.RawMessage{}
+	if err := json.Unmarshal(encoded, &merged); err != nil {
+		return nil, err
+	}
+	for key, val := range extra {
+		if _, exists := merged[key]; !exists {
+			merged[key] = val
+		}
+	}
+	return json.Marshal(merged)
+}
+
+func knownJSONFields(t reflect.Type) map[string]struct{} {
+	if cached, ok := knownFieldCache.Load(t); ok {
+		return cached.(map[string]struct{})
+	}
+
+	fields := map[string]struct{}{}
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag.Get("json")
+		name, _, _ := strings.Cut(tag, ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		fields[name] = struct{}{}
+	}
+
+	knownFieldCache.Store(t, fields)
+	return fields
+}
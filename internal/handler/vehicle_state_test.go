@@ -0,0 +1,174 @@
+package handler
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const sampleVehicleData = `{
+	"response": {
+		"id": 100021,
+		"vin": "TEST000000VIN01",
+		"charge_state": {"battery_level": 42, "battery_range": 100, "charge_rate": 10, "brand_new_field": {"a": 1}},
+		"climate_state": {"inside_temp": 20, "outside_temp": -5.5},
+		"drive_state": {"speed": 60, "shift_state": null},
+		"gui_settings": {"gui_distance_units": "km/hr", "gui_temperature_units": "C", "gui_tirepressure_units": "Psi"},
+		"vehicle_state": {"odometer": 1000, "tpms_pressure_fl": 2.9, "media_info": {"audio_volume": 2.5, "new_media_key": "x"}}
+	}
+}`
+
+func TestVehicleDataPreservesUnknownFields(t *testing.T) {
+	var payload VehicleDataResponse
+	if err := json.Unmarshal([]byte(sampleVehicleData), &payload); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	if got := *payload.Response.ChargeState.BatteryLevel; got != 42 {
+		t.Fatalf("unexpected battery_level: %d", got)
+	}
+
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+
+	var roundTrip struct {
+		Response struct {
+			ChargeState  map[string]any `json:"charge_state"`
+			VehicleState struct {
+				MediaInfo map[string]any `json:"media_info"`
+			} `json:"vehicle_state"`
+		} `json:"response"`
+	}
+	if err := json.Unmarshal(encoded, &roundTrip); err != nil {
+		t.Fatalf("decode round trip: %v", err)
+	}
+	if _, ok := roundTrip.Response.ChargeState["brand_new_field"]; !ok {
+		t.Fatalf("unknown charge_state field was dropped: %s", encoded)
+	}
+	if roundTrip.Response.VehicleState.MediaInfo["new_media_key"] != "x" {
+		t.Fatalf("unknown nested field was dropped: %s", encoded)
+	}
+}
+
+func TestNormalizeUnits(t *testing.T) {
+	cases := []struct {
+		system       string
+		wantUnits    UnitSet
+		wantRange    float64
+		wantSpeed    float64
+		wantOutside  float64
+		wantPressure float64
+	}{
+		{unitsMetric, UnitSet{"km", "km/h", "C", "bar"}, 160.93, 96.56, -5.5, 2.9},
+		{unitsImperial, UnitSet{"mi", "mph", "F", "psi"}, 100, 60, 22.1, 42.1},
+		{unitsGUI, UnitSet{"km", "km/h", "C", "psi"}, 160.93, 96.56, -5.5, 42.1},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.system, func(t *testing.T) {
+			var payload VehicleDataResponse
+			if err := json.Unmarshal([]byte(sampleVehicleData), &payload); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+
+			data := payload.Response
+			units := data.NormalizeUnits(tc.system)
+			if units != tc.wantUnits {
+				t.Fatalf("unexpected units: %+v", units)
+			}
+			if got := *data.ChargeState.BatteryRange; got != tc.wantRange {
+				t.Fatalf("unexpected battery_range: %v", got)
+			}
+			if got := *data.DriveState.Speed; got != tc.wantSpeed {
+				t.Fatalf("unexpected speed: %v", got)
+			}
+			if got := *data.ClimateState.OutsideTemp; got != tc.wantOutside {
+				t.Fatalf("unexpected outside_temp: %v", got)
+			}
+			if got := *data.VehicleState.TPMSPressureFL; got != tc.wantPressure {
+				t.Fatalf("unexpected tpms_pressure_fl: %v", got)
+			}
+		})
+	}
+}
+
+func TestNormalizeUnitsConvertsSpeedLimitsAndDriftedValues(t *testing.T) {
+	const body = `{"response": {
+		"charge_state": {"battery_range": "100", "charge_rate": true},
+		"vehicle_state": {"odometer": 1000, "speed_limit_mode": {"active": true, "current_limit_mph": 50, "max_limit_mph": "90", "min_limit_mph": 50}}
+	}}`
+	var payload VehicleDataResponse
+	if err := json.Unmarshal([]byte(body), &payload); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	data := payload.Response
+	data.NormalizeUnits(unitsMetric)
+
+	limits := data.VehicleState.SpeedLimitMode
+	if *limits.CurrentLimitMPH != 80.47 || *limits.MinLimitMPH != 80.47 {
+		t.Fatalf("speed limits not converted: %v %v", *limits.CurrentLimitMPH, *limits.MinLimitMPH)
+	}
+	if got := string(limits.Extra["max_limit_mph"]); got != `"144.84"` {
+		t.Fatalf("max_limit_mph kept in Extra = %s, want the converted numeric string", got)
+	}
+	if got := string(data.ChargeState.Extra["battery_range"]); got != `"160.93"` {
+		t.Fatalf("battery_range kept in Extra = %s", got)
+	}
+	if got := string(data.ChargeState.Extra["charge_rate"]); got != "true" {
+		t.Fatalf("non-numeric charge_rate must be left alone, got %s", got)
+	}
+}
+
+func TestParseUnitsQuery(t *testing.T) {
+	if _, err := parseUnitsQuery("furlongs"); err == nil {
+		t.Fatalf("expected invalid units to be rejected")
+	}
+	if got, err := parseUnitsQuery(" Metric "); err != nil || got != unitsMetric {
+		t.Fatalf("unexpected result: %q %v", got, err)
+	}
+}
+
+func TestVehicleDataKeepsFieldPresenceAndToleratesTypeDrift(t *testing.T) {
+	const body = `{"response": {
+		"charge_state": {"charge_amps": 16.5, "battery_level": 0, "charge_port_door_open": false, "charge_port_latch": null, "timestamp": 1700000000000},
+		"charge_schedule_data": {"charge_schedules": []}
+	}}`
+	var payload VehicleDataResponse
+	if err := json.Unmarshal([]byte(body), &payload); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if payload.Response.ChargeState.Timestamp == nil || *payload.Response.ChargeState.Timestamp != 1700000000000 {
+		t.Fatalf("fields next to a mismatched one were not decoded: %+v", payload.Response.ChargeState)
+	}
+
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	var roundTrip struct {
+		Response map[string]json.RawMessage `json:"response"`
+	}
+	if err := json.Unmarshal(encoded, &roundTrip); err != nil {
+		t.Fatalf("decode round trip: %v", err)
+	}
+	var chargeState, schedules map[string]json.RawMessage
+	_ = json.Unmarshal(roundTrip.Response["charge_state"], &chargeState)
+	_ = json.Unmarshal(roundTrip.Response["charge_schedule_data"], &schedules)
+
+	want := map[string]string{"charge_amps": "16.5", "battery_level": "0", "charge_port_door_open": "false", "charge_port_latch": "null"}
+	for key, value := range want {
+		if got := string(chargeState[key]); got != value {
+			t.Fatalf("charge_state.%s = %q, want %q in %s", key, got, value, encoded)
+		}
+	}
+	if _, ok := chargeState["battery_range"]; ok {
+		t.Fatalf("absent field was added: %s", encoded)
+	}
+	if got := string(schedules["charge_schedules"]); got != "[]" {
+		t.Fatalf("charge_schedules = %q, want []", got)
+	}
+	if got := string(roundTrip.Response["drive_state"]); got != "null" {
+		t.Fatalf("missing section = %q, want null", got)
+	}
+}
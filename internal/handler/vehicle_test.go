@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"tds_server/internal/config"
+	"tds_server/internal/middleware"
+	"tds_server/internal/model"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// memoryTokenStore keeps tokens in memory in place of repository.TokenRepo.
+type memoryTokenStore struct {
+	mu     sync.Mutex
+	tokens map[uuid.UUID]model.UserToken
+}
+
+func newMemoryTokenStore(userID uuid.UUID, accessToken, refreshToken string) *memoryTokenStore {
+	return &memoryTokenStore{tokens: map[uuid.UUID]model.UserToken{userID: {
+		UserID: userID, AccessToken: accessToken, RefreshToken: refreshToken, ExpiresAt: time.Now().Add(time.Hour),
+	}}}
+}
+
+func (s *memoryTokenStore) GetByUserID(userID uuid.UUID) (*model.UserToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token, ok := s.tokens[userID]
+	if !ok {
+		return nil, fmt.Errorf("record not found")
+	}
+	return &token, nil
+}
+
+func (s *memoryTokenStore) Save(userID uuid.UUID, accessToken string, refreshToken string, expiresIn time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[userID] = model.UserToken{UserID: userID, AccessToken: accessToken, RefreshToken: refreshToken,
+		ExpiresAt: time.Now().Add(expiresIn * time.Second)}
+	return nil
+}
+
+// userContext returns a test context of a request authenticated as userID.
+func userContext(userID uuid.UUID, target string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, target, nil)
+	c.Set(middleware.UserIDContextKey, userID)
+	return c
+}
+
+func TestRefreshUserTokenSurvivesClientDisconnect(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The client goes away while Tesla is rotating the token.
+		cancel()
+		time.Sleep(20 * time.Millisecond)
+		_ = json.NewEncoder(w).Encode(map[string]any{"access_token": "access-2", "refresh_token": "refresh-2", "expires_in": 3600})
+	}))
+	defer server.Close()
+
+	userID := uuid.New()
+	tokens := newMemoryTokenStore(userID, "access-1", "refresh-1")
+	stale, _ := tokens.GetByUserID(userID)
+	cfg := &config.Config{TeslaTokenURL: server.URL}
+	if _, err := refreshUserToken(ctx, cfg, tokens, userID, stale); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if token, _ := tokens.GetByUserID(userID); token.RefreshToken != "refresh-2" {
+		t.Fatalf("stored refresh token = %q, want the rotated one", token.RefreshToken)
+	}
+}
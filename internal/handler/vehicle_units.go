@@ -0,0 +1,178 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Tesla always reports vehicle_data in miles, mph, Celsius and bar regardless of gui_settings.
+// 特斯拉 vehicle_data 始终以英里、英里/小时、摄氏度和巴为单位返回，与 gui_settings 无关。
+const (
+	unitsMetric   = "metric"
+	unitsImperial = "imperial"
+	unitsGUI      = "gui"
+
+	kilometersPerMile = 1.609344
+	psiPerBar         = 14.5037738
+	kPaPerBar         = 100.0
+)
+
+// UnitSet describes the units used by the numeric fields of a normalized vehicle_data payload.
+type UnitSet struct {
+	// Distance is either "mi" or "km".
+	Distance string `json:"distance"`
+	// Speed is either "mph" or "km/h".
+	Speed string `json:"speed"`
+	// Temperature is either "C" or "F".
+	Temperature string `json:"temperature"`
+	// Pressure is one of "bar", "psi" or "kPa".
+	Pressure string `json:"pressure"`
+}
+
+var teslaNativeUnits = UnitSet{Distance: "mi", Speed: "mph", Temperature: "C", Pressure: "bar"}
+
+// parseUnitsQuery validates the units query parameter. An empty value keeps Tesla's native units.
+func parseUnitsQuery(value string) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	switch value {
+	case "", unitsMetric, unitsImperial, unitsGUI:
+		return value, nil
+	default:
+		return "", fmt.Errorf("units must be one of %s, %s or %s", unitsMetric, unitsImperial, unitsGUI)
+	}
+}
+
+// targetUnits resolves the requested unit system into concrete units. The gui system follows the
+// vehicle display preferences and falls back to Tesla's native units for any missing setting.
+func targetUnits(system string, gui *GUISettings) UnitSet {
+	switch system {
+	case unitsMetric:
+		return UnitSet{Distance: "km", Speed: "km/h", Temperature: "C", Pressure: "bar"}
+	case unitsImperial:
+		return UnitSet{Distance: "mi", Speed: "mph", Temperature: "F", Pressure: "psi"}
+	case unitsGUI:
+		units := teslaNativeUnits
+		if gui == nil {
+			return units
+		}
+		if gui.GUIDistanceUnits != nil && strings.HasPrefix(strings.ToLower(*gui.GUIDistanceUnits), "km") {
+			units.Distance, units.Speed = "km", "km/h"
+		}
+		if gui.GUITemperatureUnits != nil && strings.EqualFold(*gui.GUITemperatureUnits, "F") {
+			units.Temperature = "F"
+		}
+		if gui.GUITirePressureUnits != nil {
+			switch strings.ToLower(*gui.GUITirePressureUnits) {
+			case "psi":
+				units.Pressure = "psi"
+			case "kpa":
+				units.Pressure = "kPa"
+			}
+		}
+		return units
+	default:
+		return teslaNativeUnits
+	}
+}
+
+// NormalizeUnits converts distances, speeds, temperatures and pressures in place and returns the
+// resulting unit set. Values kept in Extra because Tesla sent them with an unexpected type are
+// converted too when they hold a number. NormalizeUnits 会原地换算距离、速度、温度与胎压，并返回换算后的单位。
+func (d *VehicleData) NormalizeUnits(system string) UnitSet {
+	units := targetUnits(system, d.GUISettings)
+
+	convertDistance := func(v *float64) {
+		if v != nil && units.Distance == "km" {
+			*v = roundTo(*v*kilometersPerMile, 2)
+		}
+	}
+	convertSpeed := func(v *float64) {
+		if v != nil && units.Speed == "km/h" {
+			*v = roundTo(*v*kilometersPerMile, 2)
+		}
+	}
+	convertTemperature := func(v *float64) {
+		if v != nil && units.Temperature == "F" {
+			*v = roundTo(*v*9/5+32, 1)
+		}
+	}
+	convertPressure := func(v *float64) {
+		if v == nil {
+			return
+		}
+		switch units.Pressure {
+		case "psi":
+			*v = roundTo(*v*psiPerBar, 1)
+		case "kPa":
+			*v = roundTo(*v*kPaPerBar, 1)
+		}
+	}
+
+	if cs := d.ChargeState; cs != nil {
+		for _, v := range []*float64{cs.BatteryRange, cs.EstBatteryRange, cs.IdealBatteryRange, cs.ChargeMilesAddedIdeal, cs.ChargeMilesAddedRated} {
+			convertDistance(v)
+		}
+		convertSpeed(cs.ChargeRate)
+		convertExtra(cs.Extra, convertDistance, "battery_range", "est_battery_range", "ideal_battery_range", "charge_miles_added_ideal", "charge_miles_added_rated")
+		convertExtra(cs.Extra, convertSpeed, "charge_rate")
+	}
+	if cl := d.ClimateState; cl != nil {
+		for _, v := range []*float64{cl.InsideTemp, cl.OutsideTemp, cl.DriverTempSetting, cl.PassengerTempSetting, cl.MaxAvailTemp, cl.MinAvailTemp} {
+			convertTemperature(v)
+		}
+		convertExtra(cl.Extra, convertTemperature, "inside_temp", "outside_temp", "driver_temp_setting", "passenger_temp_setting", "max_avail_temp", "min_avail_temp")
+	}
+	if ds := d.DriveState; ds != nil {
+		convertSpeed(ds.Speed)
+		convertExtra(ds.Extra, convertSpeed, "speed")
+	}
+	if vs := d.VehicleState; vs != nil {
+		convertDistance(vs.Odometer)
+		convertExtra(vs.Extra, convertDistance, "odometer")
+		for _, v := range []*float64{vs.TPMSPressureFL, vs.TPMSPressureFR, vs.TPMSPressureRL, vs.TPMSPressureRR, vs.TPMSRcpFrontValue, vs.TPMSRcpRearValue} {
+			convertPressure(v)
+		}
+		convertExtra(vs.Extra, convertPressure, "tpms_pressure_fl", "tpms_pressure_fr", "tpms_pressure_rl", "tpms_pressure_rr", "tpms_rcp_front_value", "tpms_rcp_rear_value")
+		// The speed limits keep Tesla's *_mph names but follow the requested speed unit.
+		if sl := vs.SpeedLimitMode; sl != nil {
+			for _, v := range []*float64{sl.CurrentLimitMPH, sl.MaxLimitMPH, sl.MinLimitMPH} {
+				convertSpeed(v)
+			}
+			convertExtra(sl.Extra, convertSpeed, "current_limit_mph", "max_limit_mph", "min_limit_mph")
+		}
+	}
+	return units
+}
+
+// convertExtra applies convert to the listed keys of extra that hold a number, either bare or as a
+// numeric string, and writes the result back in the same form. Other values are left untouched.
+func convertExtra(extra map[string]json.RawMessage, convert func(*float64), keys ...string) {
+	for _, key := range keys {
+		raw, ok := extra[key]
+		if !ok {
+			continue
+		}
+		text, quoted := string(raw), false
+		if err := json.Unmarshal(raw, &text); err == nil {
+			quoted = true
+		}
+		value, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+		if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+			continue
+		}
+		convert(&value)
+		encoded := strconv.FormatFloat(value, 'f', -1, 64)
+		if quoted {
+			encoded = strconv.Quote(encoded)
+		}
+		extra[key] = json.RawMessage(encoded)
+	}
+}
+
+func roundTo(value float64, places int) float64 {
+	scale := math.Pow(10, float64(places))
+	return math.Round(value*scale) / scale
+}
@@ -0,0 +1,218 @@
+// Package logging configures structured slog output with per-subsystem levels, request IDs and
+// redaction of tokens, VINs and coordinates.
+// logging 负责基于 slog 的结构化日志，支持按子系统设置级别、请求 ID 以及令牌/VIN/坐标脱敏。
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// Subsystems that can be tuned independently through LOG_LEVELS.
+const (
+	SubsystemApp     = "app"
+	SubsystemHTTP    = "http"
+	SubsystemAuth    = "auth"
+	SubsystemTesla   = "tesla"
+	SubsystemCommand = "command"
+	SubsystemDB      = "db"
+)
+
+// RequestIDHeader carries the request identifier between clients, this server and Tesla.
+const RequestIDHeader = "X-Request-ID"
+
+// Options controls Setup.
+type Options struct {
+	// Level is the default minimum level for subsystems without an explicit entry.
+	Level slog.Level
+	// Levels overrides the minimum level per subsystem.
+	Levels map[string]slog.Level
+	// Format is "json" (default) or "text".
+	Format string
+	// Output defaults to stdout.
+	Output io.Writer
+}
+
+type state struct {
+	base   slog.Handler
+	level  slog.Level
+	levels map[string]slog.Level
+}
+
+var current atomic.Pointer[state]
+
+// defaultLevels keeps SQL statements out of the logs unless the db subsystem is lowered explicitly.
+var defaultLevels = map[string]slog.Level{
+	SubsystemDB: slog.LevelWarn,
+}
+
+func init() {
+	Setup(Options{Level: slog.LevelInfo})
+}
+
+// Setup installs the global handler. Loggers returned by Logger before Setup pick up the new
+// configuration automatically. Setup 会替换全局日志配置，已创建的子系统 Logger 会自动生效。
+func Setup(opts Options) {
+	out := opts.Output
+	if out == nil {
+		out = os.Stdout
+	}
+	handlerOpts := &slog.HandlerOptions{
+		// Level filtering happens per subsystem, so the base handler accepts everything.
+		Level:       slog.Level(-8),
+		ReplaceAttr: redactAttr,
+	}
+
+	var base slog.Handler
+	if strings.EqualFold(opts.Format, "text") {
+		base = slog.NewTextHandler(out, handlerOpts)
+	} else {
+		base = slog.NewJSONHandler(out, handlerOpts)
+	}
+
+	levels := make(map[string]slog.Level, len(defaultLevels)+len(opts.Levels))
+	for name, level := range defaultLevels {
+		levels[name] = level
+	}
+	for name, level := range opts.Levels {
+		levels[strings.ToLower(name)] = level
+	}
+
+	current.Store(&state{
+		base:   &contextHandler{next: base},
+		level:  opts.Level,
+		levels: levels,
+	})
+	slog.SetDefault(Logger(SubsystemApp))
+}
+
+// Logger returns a logger tagged with the subsystem and filtered by its configured level.
+// Logger 返回带有子系统标记、并按该子系统级别过滤的日志器。
+func Logger(subsystem string) *slog.Logger {
+	return slog.New(&subsystemHandler{subsystem: strings.ToLower(subsystem)})
+}
+
+// ParseLevel accepts debug, info, warn/warning and error (case-insensitive).
+func ParseLevel(value string) (slog.Level, error) {
+	var level slog.Level
+	value = strings.TrimSpace(value)
+	if strings.EqualFold(value, "warning") {
+		value = "warn"
+	}
+	if err := level.UnmarshalText([]byte(value)); err != nil {
+		return slog.LevelInfo, fmt.Errorf("invalid log level %q", value)
+	}
+	return level, nil
+}
+
+// ParseLevels parses a comma-separated list such as "db=warn,tesla=debug".
+// ParseLevels 解析形如 "db=warn,tesla=debug" 的子系统级别配置。
+func ParseLevels(spec string) (map[string]slog.Level, error) {
+	levels := map[string]slog.Level{}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(item, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid log level entry %q, expected subsystem=level", item)
+		}
+		level, err := ParseLevel(value)
+		if err != nil {
+			return nil, err
+		}
+		levels[strings.ToLower(strings.TrimSpace(name))] = level
+	}
+	return levels, nil
+}
+
+func (s *state) levelFor(subsystem string) slog.Level {
+	if level, ok := s.levels[subsystem]; ok {
+		return level
+	}
+	return s.level
+}
+
+// subsystemHandler resolves the global state on every call so that package-level loggers created
+// before Setup still honour the final configuration.
+type subsystemHandler struct {
+	subsystem string
+	wrap      []func(slog.Handler) slog.Handler
+}
+
+func (h *subsystemHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= current.Load().levelFor(h.subsystem)
+}
+
+func (h *subsystemHandler) Handle(ctx context.Context, r slog.Record) error {
+	next := current.Load().base.WithAttrs([]slog.Attr{slog.String("subsystem", h.subsystem)})
+	for _, wrap := range h.wrap {
+		next = wrap(next)
+	}
+	return next.Handle(ctx, r)
+}
+
+func (h *subsystemHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(next slog.Handler) slog.Handler { return next.WithAttrs(attrs) })
+}
+
+func (h *subsystemHandler) WithGroup(name string) slog.Handler {
+	return h.with(func(next slog.Handler) slog.Handler { return next.WithGroup(name) })
+}
+
+func (h *subsystemHandler) with(wrap func(slog.Handler) slog.Handler) slog.Handler {
+	wraps := make([]func(slog.Handler) slog.Handler, 0, len(h.wrap)+1)
+	wraps = append(wraps, h.wrap...)
+	return &subsystemHandler{subsystem: h.subsystem, wrap: append(wraps, wrap)}
+}
+
+// contextHandler adds the request ID carried by ctx and redacts the message text.
+type contextHandler struct {
+	next slog.Handler
+}
+
+func (h *contextHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	record := slog.NewRecord(r.Time, r.Level, RedactString(r.Message), r.PC)
+	r.Attrs(func(attr slog.Attr) bool {
+		record.AddAttrs(attr)
+		return true
+	})
+	if id := RequestIDFromContext(ctx); id != "" {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	return h.next.Handle(ctx, record)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{next: h.next.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{next: h.next.WithGroup(name)}
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context carrying the request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID stored by WithRequestID, or "".
+func RequestIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
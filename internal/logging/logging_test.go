@@ -0,0 +1,46 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestRedactionAndSubsystemLevels(t *testing.T) {
+	var buf bytes.Buffer
+	Setup(Options{Level: slog.LevelInfo, Levels: map[string]slog.Level{"tesla": slog.LevelDebug}, Output: &buf})
+	defer Setup(Options{Level: slog.LevelInfo})
+
+	ctx := WithRequestID(context.Background(), "req-42")
+	Logger(SubsystemTesla).DebugContext(ctx, "GET /api/1/vehicles/5YJ3E1EA7KF123456/vehicle_data",
+		"access_token", "secret", "vin", "5YJ3E1EA7KF123456", "latitude", 31.23,
+		"detail", "Authorization: Bearer abc.def")
+	Logger(SubsystemDB).InfoContext(ctx, "select * from user_tokens")
+
+	out := buf.String()
+	for _, leaked := range []string{"secret", "5YJ3E1EA7KF123456", "31.23", "abc.def", "user_tokens"} {
+		if strings.Contains(out, leaked) {
+			t.Fatalf("log output leaked %q: %s", leaked, out)
+		}
+	}
+	for _, want := range []string{`"request_id":"req-42"`, `"subsystem":"tesla"`, "5YJ**********3456"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("log output missing %q: %s", want, out)
+		}
+	}
+}
+
+func TestParseLevels(t *testing.T) {
+	levels, err := ParseLevels("db=debug, tesla=warning")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if levels["db"] != slog.LevelDebug || levels["tesla"] != slog.LevelWarn {
+		t.Fatalf("unexpected levels: %v", levels)
+	}
+	if _, err := ParseLevels("db"); err == nil {
+		t.Fatal("expected error for entry without level")
+	}
+}
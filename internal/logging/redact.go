@@ -0,0 +1,152 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// sensitiveKeys are attribute keys whose values are never written to the logs.
+var sensitiveKeys = map[string]struct{}{
+	"access_token":  {},
+	"refresh_token": {},
+	"id_token":      {},
+	"token":         {},
+	"jwt":           {},
+	"authorization": {},
+	"client_secret": {},
+	"password":      {},
+	"pin":           {},
+}
+
+// coordinateKeys are attribute keys holding vehicle positions.
+var coordinateKeys = map[string]struct{}{
+	"latitude":               {},
+	"longitude":              {},
+	"lat":                    {},
+	"lon":                    {},
+	"lng":                    {},
+	"native_latitude":        {},
+	"native_longitude":       {},
+	"corrected_latitude":     {},
+	"corrected_longitude":    {},
+	"active_route_latitude":  {},
+	"active_route_longitude": {},
+}
+
+var (
+	bearerPattern     = regexp.MustCompile(`(?i)bearer\s+[A-Za-z0-9\-._~+/]+=*`)
+	jwtPattern        = regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+	tokenParamPattern = regexp.MustCompile(`(?i)((?:access_token|refresh_token|id_token|client_secret|code)=)[^&\s"]+`)
+	tokenJSONPattern  = regexp.MustCompile(`(?i)("(?:access_token|refresh_token|id_token|client_secret)"\s*:\s*")[^"]*`)
+	vinPattern        = regexp.MustCompile(`\b[A-HJ-NPR-Z0-9]{17}\b`)
+)
+
+// RedactString masks bearer tokens, JWTs, token parameters and VINs inside free text.
+// RedactString 会对文本中的令牌、JWT 与 VIN 进行脱敏。
+func RedactString(value string) string {
+	if value == "" {
+		return value
+	}
+	value = bearerPattern.ReplaceAllString(value, "Bearer "+redacted)
+	value = jwtPattern.ReplaceAllString(value, redacted)
+	value = tokenParamPattern.ReplaceAllString(value, "${1}"+redacted)
+	value = tokenJSONPattern.ReplaceAllString(value, "${1}"+redacted)
+	return vinPattern.ReplaceAllStringFunc(value, func(match string) string {
+		// 17-digit numbers are Tesla ids, not VINs; a VIN always contains letters.
+		if strings.IndexFunc(match, func(r rune) bool { return r >= 'A' && r <= 'Z' }) < 0 {
+			return match
+		}
+		return MaskVIN(match)
+	})
+}
+
+// MaskVIN keeps the manufacturer prefix and the last four characters, e.g. LRW**********1234.
+func MaskVIN(vin string) string {
+	if len(vin) <= 7 {
+		return strings.Repeat("*", len(vin))
+	}
+	return vin[:3] + strings.Repeat("*", len(vin)-7) + vin[len(vin)-4:]
+}
+
+func redactAttr(_ []string, attr slog.Attr) slog.Attr {
+	key := strings.ToLower(attr.Key)
+	if _, ok := sensitiveKeys[key]; ok {
+		return slog.String(attr.Key, redacted)
+	}
+	if _, ok := coordinateKeys[key]; ok {
+		return slog.String(attr.Key, redacted)
+	}
+	if key == "vin" {
+		return slog.String(attr.Key, MaskVIN(attr.Value.String()))
+	}
+
+	switch attr.Value.Kind() {
+	case slog.KindString:
+		return slog.String(attr.Key, RedactString(attr.Value.String()))
+	case slog.KindAny:
+		if err, ok := attr.Value.Any().(error); ok {
+			return slog.String(attr.Key, RedactString(err.Error()))
+		}
+	}
+	return attr
+}
+
+// RedactJSON applies the log redaction rules to a JSON document: sensitive fields are replaced,
+// coordinates are nulled and VINs or tokens inside strings are masked. Input that is not JSON is
+// redacted as free text. RedactJSON 按日志脱敏规则处理 JSON 文本。
+func RedactJSON(body []byte) []byte {
+	if len(body) == 0 {
+		return body
+	}
+	// UseNumber keeps 16+ digit vehicle ids intact.
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var doc any
+	if err := decoder.Decode(&doc); err != nil {
+		return []byte(RedactString(string(body)))
+	}
+	redacted, err := json.Marshal(redactValue(doc))
+	if err != nil {
+		return []byte(RedactString(string(body)))
+	}
+	return redacted
+}
+
+func redactValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			lower := strings.ToLower(key)
+			if _, ok := sensitiveKeys[lower]; ok {
+				v[key] = redacted
+				continue
+			}
+			if _, ok := coordinateKeys[lower]; ok {
+				v[key] = nil
+				continue
+			}
+			if lower == "vin" {
+				if s, ok := item.(string); ok {
+					v[key] = MaskVIN(s)
+					continue
+				}
+			}
+			v[key] = redactValue(item)
+		}
+		return v
+	case []any:
+		for i, item := range v {
+			v[i] = redactValue(item)
+		}
+		return v
+	case string:
+		return RedactString(v)
+	default:
+		return v
+	}
+}
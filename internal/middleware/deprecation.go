@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Deprecated 为已弃用的路由添加 Deprecation（RFC 9745）、Sunset（RFC 8594）与指向替代接口的 Link 响应头，
+// 路由本身照常处理请求。sunset 为零值时不输出 Sunset；successor 返回当前请求的替代路由，为空时不输出 Link，
+// 其中的 :param 会替换为当前请求的路由参数。
+func Deprecated(since, sunset time.Time, successor func(c *gin.Context) string) gin.HandlerFunc {
+	deprecation := fmt.Sprintf("@%d", since.Unix())
+	return func(c *gin.Context) {
+		c.Header("Deprecation", deprecation)
+		if !sunset.IsZero() {
+			c.Header("Sunset", sunset.UTC().Format(http.TimeFormat))
+		}
+		if target := successor(c); target != "" {
+			for _, param := range c.Params {
+				target = strings.ReplaceAll(target, ":"+param.Key, url.PathEscape(param.Value))
+			}
+			c.Header("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", target))
+		}
+		c.Next()
+	}
+}
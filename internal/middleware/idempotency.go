@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"tds_server/internal/apierror"
+	"tds_server/internal/model"
+	"tds_server/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// IdempotencyKeyHeader carries the client-chosen key of a retryable request.
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader is set to true on responses replayed from an earlier request.
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+)
+
+// Idempotency 为携带 Idempotency-Key 请求头的指令请求提供幂等保证：首次请求正常执行并保存响应，
+// 窗口期内的重复请求直接返回保存的响应（带 Idempotent-Replayed: true），首次请求仍在执行时重复请求返回 409，
+// 同一个键用于不同请求（方法、路径、查询或请求体不同）时返回 422。键按用户隔离，须位于 JWTAuth 之后。
+// 401、408、429、5xx 以及标记为 retryable 的错误响应不会保存，客户端可用同一个键重试并重新执行。
+func Idempotency(idempotency *service.IdempotencyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		userID, ok := UserIDFromContext(c)
+		if key == "" || idempotency == nil || !ok {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			apierror.Abort(c, apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest,
+				"Idempotency-Key must be at most "+strconv.Itoa(maxIdempotencyKeyLength)+" characters"))
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			apierror.Abort(c, apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest, "failed to read request body"))
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		fingerprint := service.RequestFingerprint(c.Request.Method, c.Request.URL.RequestURI(), body)
+		stored, err := idempotency.Begin(userID, key, fingerprint)
+		switch {
+		case errors.Is(err, service.ErrIdempotencyInProgress):
+			apiErr := apierror.New(http.StatusConflict, apierror.CodeIdempotencyInProgress, err.Error())
+			apiErr.Retryable = true
+			c.Header("Retry-After", "1")
+			apierror.Abort(c, apiErr)
+			return
+		case errors.Is(err, service.ErrIdempotencyKeyReused):
+			apierror.Abort(c, apierror.New(http.StatusUnprocessableEntity, apierror.CodeIdempotencyKeyReused, err.Error()))
+			return
+		case err != nil:
+			apierror.Abort(c, apierror.Wrap(http.StatusInternalServerError, apierror.CodeInternal, err))
+			return
+		case stored != nil:
+			if stored.Location != "" {
+				c.Header("Location", stored.Location)
+			}
+			c.Header(IdempotentReplayedHeader, "true")
+			c.Data(stored.ResponseStatus, stored.ContentType, stored.Response)
+			c.Abort()
+			return
+		}
+
+		writer := &capturingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		completed := false
+		defer func() {
+			// Reached without completing when the handler panicked or stored nothing.
+			if !completed {
+				if err := idempotency.Release(userID, key); err != nil {
+					httpLog.ErrorContext(c.Request.Context(), "release idempotency key failed", "error", err)
+				}
+			}
+		}()
+
+		c.Next()
+
+		status := writer.Status()
+		if !writer.Written() || retryableResponse(status, writer.body.Bytes()) {
+			return
+		}
+		err = idempotency.Complete(userID, key, model.IdempotencyKey{
+			ResponseStatus: status,
+			ContentType:    writer.Header().Get("Content-Type"),
+			Location:       writer.Header().Get("Location"),
+			Response:       writer.body.Bytes(),
+		})
+		if err != nil {
+			httpLog.ErrorContext(c.Request.Context(), "store idempotent response failed", "error", err)
+			return
+		}
+		completed = true
+	}
+}
+
+// retryableResponse reports whether the response is an error the client may retry, so that a retry
+// with the same key executes again instead of replaying the failure.
+func retryableResponse(status int, body []byte) bool {
+	if status == http.StatusUnauthorized || status == http.StatusRequestTimeout ||
+		status == http.StatusTooManyRequests || status >= http.StatusInternalServerError {
+		return true
+	}
+	if status < http.StatusBadRequest {
+		return false
+	}
+	var payload struct {
+		Error *apierror.Error `json:"error"`
+	}
+	return json.Unmarshal(body, &payload) == nil && payload.Error != nil && payload.Error.Retryable
+}
+
+// capturingWriter keeps a copy of the response body.
+type capturingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *capturingWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *capturingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
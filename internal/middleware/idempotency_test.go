@@ -0,0 +1,141 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"tds_server/internal/apierror"
+	"tds_server/internal/model"
+	"tds_server/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// memoryIdempotencyStore keeps idempotency keys in memory.
+type memoryIdempotencyStore struct {
+	mu   sync.Mutex
+	keys map[string]*model.IdempotencyKey
+}
+
+func (s *memoryIdempotencyStore) Acquire(record *model.IdempotencyKey) (*model.IdempotencyKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok := s.keys[record.Key]; ok && existing.ExpiresAt.After(time.Now()) {
+		copied := *existing
+		return &copied, nil
+	}
+	s.keys[record.Key] = record
+	return nil, nil
+}
+
+func (s *memoryIdempotencyStore) Complete(_ uuid.UUID, key string, response model.IdempotencyKey, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record := s.keys[key]
+	record.Status, record.ExpiresAt = model.IdempotencyCompleted, expiresAt
+	record.ResponseStatus, record.ContentType, record.Location, record.Response =
+		response.ResponseStatus, response.ContentType, response.Location, response.Response
+	return nil
+}
+
+func (s *memoryIdempotencyStore) Release(_ uuid.UUID, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, key)
+	return nil
+}
+
+func (s *memoryIdempotencyStore) DeleteExpired() (int64, error) { return 0, nil }
+
+func TestIdempotency(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	idempotency := service.NewIdempotencyService(&memoryIdempotencyStore{keys: map[string]*model.IdempotencyKey{}}, time.Hour, time.Minute)
+	executions := 0
+	started, release := make(chan struct{}), make(chan struct{})
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set(UserIDContextKey, uuid.Nil) }, Idempotency(idempotency))
+	router.POST("/unlock", func(c *gin.Context) {
+		executions++
+		c.JSON(http.StatusOK, gin.H{"response": gin.H{"result": true, "execution": executions}})
+	})
+	router.POST("/slow", func(c *gin.Context) {
+		close(started)
+		<-release
+		c.Status(http.StatusOK)
+	})
+	router.POST("/unauthorized", func(c *gin.Context) {
+		executions++
+		c.Status(http.StatusUnauthorized)
+	})
+	router.POST("/flaky", func(c *gin.Context) {
+		executions++
+		if executions == 1 {
+			apierror.Write(c, apierror.New(http.StatusServiceUnavailable, apierror.CodeUpstreamUnavailable, "upstream unavailable"))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"response": gin.H{"result": true}})
+	})
+	router.POST("/busy", func(c *gin.Context) {
+		executions++
+		apiErr := apierror.New(http.StatusConflict, apierror.CodeConflict, "vehicle is busy")
+		apiErr.Retryable = true
+		apierror.Write(c, apiErr)
+	})
+	send := func(path, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set(IdempotencyKeyHeader, key)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := send("/unlock", "a", `{}`)
+	repeat := send("/unlock", "a", `{}`)
+	if executions != 1 || repeat.Code != http.StatusOK || repeat.Body.String() != first.Body.String() ||
+		repeat.Header().Get(IdempotentReplayedHeader) != "true" {
+		t.Fatalf("repeat: executions=%d status=%d body=%s", executions, repeat.Code, repeat.Body)
+	}
+	if rec := send("/unlock", "a", `{"other":true}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("reused key: status %d", rec.Code)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		send("/slow", "b", "")
+	}()
+	<-started
+	if rec := send("/slow", "b", ""); rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), "idempotency_in_progress") {
+		t.Fatalf("concurrent duplicate: status %d body %s", rec.Code, rec.Body)
+	}
+	close(release)
+	<-done
+
+	executions = 0
+	send("/unauthorized", "c", "")
+	if send("/unauthorized", "c", ""); executions != 2 {
+		t.Fatalf("401 responses must not be stored, executions=%d", executions)
+	}
+
+	executions = 0
+	if rec := send("/flaky", "d", ""); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("first attempt: status %d", rec.Code)
+	}
+	if rec := send("/flaky", "d", ""); rec.Code != http.StatusOK || executions != 2 || rec.Header().Get(IdempotentReplayedHeader) != "" {
+		t.Fatalf("retry after 503 must execute again: status %d, executions=%d", rec.Code, executions)
+	}
+	if rec := send("/flaky", "d", ""); rec.Code != http.StatusOK || executions != 2 {
+		t.Fatalf("success must be replayed: status %d, executions=%d", rec.Code, executions)
+	}
+
+	executions = 0
+	send("/busy", "e", "")
+	if send("/busy", "e", ""); executions != 2 {
+		t.Fatalf("retryable errors must not be stored, executions=%d", executions)
+	}
+}
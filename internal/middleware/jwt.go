@@ -4,29 +4,44 @@ import (
 	"errors"
 	"net/http"
 	"strings"
+	"tds_server/internal/apierror"
 	"tds_server/internal/config"
+	"tds_server/internal/upstream"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
-const UserIDContextKey = "userID"
+const (
+	UserIDContextKey = "userID"
+	// ActorContextKey holds the acting identity of a delegated token, see ActorFromContext.
+	ActorContextKey = "actor"
+)
+
+// tokenClaims are the claims of an API JWT. Act is the RFC 8693 actor claim: a token issued to a
+// fleet operator acting on behalf of the subject names the operator there.
+type tokenClaims struct {
+	jwt.RegisteredClaims
+	Act *struct {
+		Subject string `json:"sub"`
+	} `json:"act,omitempty"`
+}
 
 // JWTAuth 校验 Authorization 头中的 Bearer JWT，并将用户 UUID 注入 Gin 上下文。
 func JWTAuth(cfg *config.Config) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tokenString, err := extractBearerToken(c.GetHeader("Authorization"))
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			apierror.Abort(c, apierror.New(http.StatusUnauthorized, apierror.CodeUnauthorized, err.Error()))
 			return
 		}
 		if cfg.JWT.Secret == "" {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "jwt secret is not configured"})
+			apierror.Abort(c, apierror.New(http.StatusInternalServerError, apierror.CodeInternal, "jwt secret is not configured"))
 			return
 		}
 
-		claims := &jwt.RegisteredClaims{}
+		claims := &tokenClaims{}
 		token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
 			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
 				return nil, errors.New("unexpected signing method")
@@ -34,17 +49,21 @@ func JWTAuth(cfg *config.Config) gin.HandlerFunc {
 			return []byte(cfg.JWT.Secret), nil
 		})
 		if err != nil || !token.Valid {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+			apierror.Abort(c, apierror.New(http.StatusUnauthorized, apierror.CodeUnauthorized, "invalid token"))
 			return
 		}
 
 		userID, err := uuid.Parse(claims.Subject)
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "token subject must be a UUID"})
+			apierror.Abort(c, apierror.New(http.StatusUnauthorized, apierror.CodeUnauthorized, "token subject must be a UUID"))
 			return
 		}
 
 		c.Set(UserIDContextKey, userID)
+		if claims.Act != nil && claims.Act.Subject != "" {
+			c.Set(ActorContextKey, claims.Act.Subject)
+		}
+		c.Request = c.Request.WithContext(upstream.WithUserID(c.Request.Context(), userID.String()))
 		c.Next()
 	}
 }
@@ -59,6 +78,17 @@ func UserIDFromContext(c *gin.Context) (uuid.UUID, bool) {
 	return uuid.Nil, false
 }
 
+// ActorFromContext 返回实际发起请求的身份：委托令牌中 act 声明的 sub，否则为用户 UUID。
+func ActorFromContext(c *gin.Context) string {
+	if actor := c.GetString(ActorContextKey); actor != "" {
+		return actor
+	}
+	if userID, ok := UserIDFromContext(c); ok {
+		return userID.String()
+	}
+	return ""
+}
+
 func extractBearerToken(header string) (string, error) {
 	if header == "" {
 		return "", errors.New("authorization header is required")
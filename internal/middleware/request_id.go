@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"tds_server/internal/apierror"
+	"tds_server/internal/logging"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	RequestIDContextKey = "requestID"
+	maxRequestIDLength  = 128
+)
+
+var httpLog = logging.Logger(logging.SubsystemHTTP)
+
+// RequestID 复用客户端传入的 X-Request-ID（格式合法时），否则生成新的 ID，并写入请求上下文与响应头。
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(logging.RequestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+		c.Set(RequestIDContextKey, id)
+		c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), id))
+		c.Header(logging.RequestIDHeader, id)
+		c.Next()
+	}
+}
+
+// AccessLog 记录每个请求的方法、路由、状态码与耗时；路径使用路由模板，避免记录 VIN。
+func AccessLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = c.Request.URL.Path
+		}
+		status := c.Writer.Status()
+		level := logLevelForStatus(status)
+		httpLog.Log(c.Request.Context(), level, "request completed",
+			"method", c.Request.Method,
+			"route", route,
+			"status", status,
+			"duration_ms", time.Since(start).Milliseconds(),
+			"bytes", c.Writer.Size(),
+		)
+	}
+}
+
+// Recovery 捕获 panic，记录日志并返回统一错误结构。
+func Recovery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				httpLog.ErrorContext(c.Request.Context(), "panic recovered", "panic", recovered, "route", c.FullPath())
+				apierror.Abort(c, apierror.New(http.StatusInternalServerError, apierror.CodeInternal, "internal server error"))
+			}
+		}()
+		c.Next()
+	}
+}
+
+func logLevelForStatus(status int) slog.Level {
+	switch {
+	case status >= http.StatusInternalServerError:
+		return slog.LevelError
+	case status >= http.StatusBadRequest:
+		return slog.LevelWarn
+	default:
+		return slog.LevelInfo
+	}
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
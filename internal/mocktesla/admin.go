@@ -0,0 +1,76 @@
+package mocktesla
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// adminPrefix hosts the scripting API. It is never affected by injected faults.
+const adminPrefix = "/_mock/"
+
+// adminRoutes exposes the scripting API used by cmd/mocktesla:
+//
+//	GET    /_mock/vehicles         list vehicles with their full state
+//	POST   /_mock/vehicles         add a vehicle (Vehicle JSON, zero fields get defaults)
+//	PATCH  /_mock/vehicles/{vin}   merge the JSON body into the vehicle state, e.g. {"state":"asleep"}
+//	GET    /_mock/faults           list injected faults
+//	POST   /_mock/faults           inject a Fault
+//	DELETE /_mock/faults           clear all faults
+//	GET    /_mock/commands         list received commands
+func (s *Server) adminRoutes() {
+	s.mux.HandleFunc("GET /_mock/vehicles", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, s.Vehicles())
+	})
+	s.mux.HandleFunc("POST /_mock/vehicles", func(w http.ResponseWriter, r *http.Request) {
+		var v Vehicle
+		if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+			writeTeslaError(w, http.StatusBadRequest, "invalid JSON body", err.Error())
+			return
+		}
+		writeJSON(w, http.StatusCreated, s.AddVehicle(v))
+	})
+	s.mux.HandleFunc("PATCH /_mock/vehicles/{vin}", func(w http.ResponseWriter, r *http.Request) {
+		var decodeErr error
+		err := s.UpdateVehicle(r.PathValue("vin"), func(v *Vehicle) {
+			patched := *v
+			if decodeErr = json.NewDecoder(r.Body).Decode(&patched); decodeErr == nil {
+				patched.ID, patched.VIN = v.ID, v.VIN
+				*v = patched
+			}
+		})
+		switch {
+		case err != nil:
+			writeTeslaError(w, http.StatusNotFound, err.Error(), "")
+		case decodeErr != nil:
+			writeTeslaError(w, http.StatusBadRequest, "invalid JSON body", decodeErr.Error())
+		default:
+			v, _ := s.Vehicle(r.PathValue("vin"))
+			writeJSON(w, http.StatusOK, v)
+		}
+	})
+	s.mux.HandleFunc("GET /_mock/faults", func(w http.ResponseWriter, _ *http.Request) {
+		s.mu.Lock()
+		faults := make([]Fault, 0, len(s.faults))
+		for _, f := range s.faults {
+			faults = append(faults, *f)
+		}
+		s.mu.Unlock()
+		writeJSON(w, http.StatusOK, faults)
+	})
+	s.mux.HandleFunc("POST /_mock/faults", func(w http.ResponseWriter, r *http.Request) {
+		var f Fault
+		if err := json.NewDecoder(r.Body).Decode(&f); err != nil || f.Status < 400 {
+			writeTeslaError(w, http.StatusBadRequest, "fault requires a status >= 400", "")
+			return
+		}
+		s.InjectFault(f)
+		writeJSON(w, http.StatusCreated, f)
+	})
+	s.mux.HandleFunc("DELETE /_mock/faults", func(w http.ResponseWriter, _ *http.Request) {
+		s.ClearFaults()
+		w.WriteHeader(http.StatusNoContent)
+	})
+	s.mux.HandleFunc("GET /_mock/commands", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, s.Commands())
+	})
+}
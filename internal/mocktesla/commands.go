@@ -0,0 +1,145 @@
+package mocktesla
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// commandFunc applies a command to the vehicle, returning a reason when the command is rejected.
+type commandFunc func(v *Vehicle, params map[string]any) (reason string)
+
+// restCommands lists the REST commands the mock understands. Unknown commands answer 404.
+var restCommands = map[string]commandFunc{
+	"door_lock":   func(v *Vehicle, _ map[string]any) string { v.Locked = true; return "" },
+	"door_unlock": func(v *Vehicle, _ map[string]any) string { v.Locked = false; return "" },
+	"auto_conditioning_start": func(v *Vehicle, _ map[string]any) string {
+		v.IsClimateOn = true
+		return ""
+	},
+	"auto_conditioning_stop": func(v *Vehicle, _ map[string]any) string {
+		v.IsClimateOn = false
+		return ""
+	},
+	"set_temps": func(v *Vehicle, params map[string]any) string {
+		driver, ok := numberParam(params, "driver_temp")
+		if !ok {
+			return "missing driver_temp"
+		}
+		passenger, ok := numberParam(params, "passenger_temp")
+		if !ok {
+			passenger = driver
+		}
+		v.DriverTempSetting, v.PassengerTempSetting = driver, passenger
+		return ""
+	},
+	"set_charge_limit": func(v *Vehicle, params map[string]any) string {
+		percent, ok := numberParam(params, "percent")
+		if !ok || percent < 50 || percent > 100 {
+			return "invalid charge limit"
+		}
+		v.ChargeLimitSOC = int(percent)
+		return ""
+	},
+	"set_charging_amps": func(v *Vehicle, params map[string]any) string {
+		amps, ok := numberParam(params, "charging_amps")
+		if !ok || amps < 0 || amps > 48 {
+			return "invalid charging amps"
+		}
+		v.ChargeAmps = int(amps)
+		return ""
+	},
+	"charge_start": func(v *Vehicle, _ map[string]any) string {
+		switch {
+		case v.ChargingState == "Disconnected":
+			return "disconnected"
+		case v.ChargingState == "Charging":
+			return "is_charging"
+		case v.BatteryLevel >= v.ChargeLimitSOC:
+			return "complete"
+		}
+		v.ChargingState = "Charging"
+		return ""
+	},
+	"charge_stop": func(v *Vehicle, _ map[string]any) string {
+		if v.ChargingState != "Charging" {
+			return "not_charging"
+		}
+		v.ChargingState = "Stopped"
+		return ""
+	},
+	"charge_port_door_open":  func(v *Vehicle, _ map[string]any) string { v.ChargePortDoorOpen = true; return "" },
+	"charge_port_door_close": func(v *Vehicle, _ map[string]any) string { v.ChargePortDoorOpen = false; return "" },
+	"set_sentry_mode": func(v *Vehicle, params map[string]any) string {
+		on, ok := params["on"].(bool)
+		if !ok {
+			return "missing on"
+		}
+		v.SentryMode = on
+		return ""
+	},
+	"flash_lights":  func(*Vehicle, map[string]any) string { return "" },
+	"honk_horn":     func(*Vehicle, map[string]any) string { return "" },
+	"actuate_trunk": func(*Vehicle, map[string]any) string { return "" },
+	"remote_start_drive": func(*Vehicle, map[string]any) string {
+		return ""
+	},
+}
+
+func (s *Server) handleCommand(w http.ResponseWriter, r *http.Request, _ issuedToken) {
+	name := r.PathValue("command")
+	apply, known := restCommands[name]
+	if !known {
+		writeTeslaError(w, http.StatusNotFound, fmt.Sprintf("unknown command %s", name), "")
+		return
+	}
+
+	params := map[string]any{}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			writeTeslaError(w, http.StatusBadRequest, "invalid JSON body", err.Error())
+			return
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v := s.lookupLocked(w, r)
+	if v == nil || !requireOnline(w, v) {
+		return
+	}
+
+	reason := s.applyCommandLocked(v, apply, name, params, false)
+	writeJSON(w, http.StatusOK, map[string]any{"response": map[string]any{"result": reason == "", "reason": reason}})
+}
+
+// applyCommandLocked mutates the vehicle and records the command. A nil apply accepts the command
+// without changing state. Both the REST and the signed command paths end up here.
+func (s *Server) applyCommandLocked(v *Vehicle, apply commandFunc, name string, params map[string]any, signed bool) string {
+	reason := ""
+	if apply != nil {
+		reason = apply(v, params)
+	}
+	s.commands = append(s.commands, CommandRecord{
+		VIN:     v.VIN,
+		Command: name,
+		Params:  params,
+		Signed:  signed,
+		Result:  reason == "",
+		Reason:  reason,
+		At:      s.now(),
+	})
+	return reason
+}
+
+func numberParam(params map[string]any, key string) (float64, bool) {
+	switch value := params[key].(type) {
+	case float64:
+		return value, true
+	case json.Number:
+		f, err := value.Float64()
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
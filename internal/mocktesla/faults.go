@@ -0,0 +1,86 @@
+package mocktesla
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Fault makes matching requests fail with a fixed status, e.g. 408 for an unreachable vehicle or 429
+// for rate limiting. Fault 用于让匹配的请求返回指定错误（如 408、429）。
+type Fault struct {
+	// Method restricts the fault to one HTTP method; empty matches any.
+	Method string `json:"method,omitempty"`
+	// PathPrefix restricts the fault to paths starting with it; empty matches every Fleet API path.
+	PathPrefix string `json:"path_prefix,omitempty"`
+	// Status is the HTTP status to return.
+	Status int `json:"status"`
+	// Error and ErrorDescription override Tesla's error body fields.
+	Error            string `json:"error,omitempty"`
+	ErrorDescription string `json:"error_description,omitempty"`
+	// RetryAfter sets the Retry-After header in seconds, mainly for 429.
+	RetryAfter int `json:"retry_after,omitempty"`
+	// Times limits how many requests fail; 0 keeps the fault until cleared.
+	Times int `json:"times,omitempty"`
+
+	hits int
+}
+
+// InjectFault adds a fault. Faults are evaluated in insertion order and the first match wins.
+func (s *Server) InjectFault(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copied := f
+	s.faults = append(s.faults, &copied)
+}
+
+// ClearFaults removes every injected fault.
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = nil
+}
+
+func (s *Server) matchFault(r *http.Request) *Fault {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, f := range s.faults {
+		if f.Method != "" && !strings.EqualFold(f.Method, r.Method) {
+			continue
+		}
+		prefix := f.PathPrefix
+		if prefix == "" {
+			prefix = "/api/"
+		}
+		if !strings.HasPrefix(r.URL.Path, prefix) {
+			continue
+		}
+		f.hits++
+		matched := *f
+		if f.Times > 0 && f.hits >= f.Times {
+			s.faults = append(s.faults[:i], s.faults[i+1:]...)
+		}
+		return &matched
+	}
+	return nil
+}
+
+func (f *Fault) write(w http.ResponseWriter) {
+	message := f.Error
+	if message == "" {
+		switch f.Status {
+		case http.StatusRequestTimeout:
+			message = "vehicle unavailable: vehicle is offline or asleep"
+		case http.StatusTooManyRequests:
+			message = "Rate limit exceeded"
+		default:
+			message = strings.ToLower(http.StatusText(f.Status))
+		}
+	}
+	if f.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(f.RetryAfter))
+	} else if f.Status == http.StatusTooManyRequests {
+		w.Header().Set("Retry-After", "1")
+	}
+	writeTeslaError(w, f.Status, message, f.ErrorDescription)
+}
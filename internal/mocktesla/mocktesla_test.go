@@ -0,0 +1,181 @@
+package mocktesla_test
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"tds_server/internal/config"
+	"tds_server/internal/mocktesla"
+	"tds_server/internal/service"
+
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+)
+
+func mockConfig(baseURL string) *config.Config {
+	return &config.Config{
+		TeslaClientID:        "client",
+		TeslaClientSecret:    "secret",
+		TeslaAuthURL:         baseURL + "/oauth2/v3/authorize",
+		TeslaTokenURL:        baseURL + "/oauth2/v3/token",
+		TeslaPartnerTokenURL: baseURL + "/oauth2/v3/token",
+		TeslaAPIURL:          baseURL,
+		TeslaPartnerDomain:   "example.com",
+	}
+}
+
+func TestServicesRunAgainstMock(t *testing.T) {
+	mock, ts := mocktesla.Start(mocktesla.WithStrictAuth())
+	defer ts.Close()
+	cfg := mockConfig(ts.URL)
+
+	if _, err := service.NewPartnerTokenService(cfg); err != nil {
+		t.Fatalf("partner token service: %v", err)
+	}
+	if domains := mock.PartnerDomains(); len(domains) != 1 || domains[0] != "example.com" {
+		t.Fatalf("partner domains = %v", domains)
+	}
+
+	if _, err := service.RefreshToken(context.Background(), cfg, "unknown"); err == nil {
+		t.Fatal("strict mock must reject unknown refresh tokens")
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(service.BuildAuthURL(&config.Config{
+		TeslaAuthURL:     cfg.TeslaAuthURL,
+		TeslaClientID:    "client",
+		TeslaRedirectURI: "http://localhost/callback",
+	}, "state-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	location, _ := resp.Location()
+	code := location.Query().Get("code")
+	if code == "" || location.Query().Get("state") != "state-1" {
+		t.Fatalf("unexpected redirect %s", location)
+	}
+
+	tokens, err := service.ExchangeCode(context.Background(), cfg, code)
+	if err != nil {
+		t.Fatalf("exchange code: %v", err)
+	}
+	if _, err := service.RefreshToken(context.Background(), cfg, tokens.RefreshToken); err != nil {
+		t.Fatalf("refresh token: %v", err)
+	}
+}
+
+func TestVehicleStateFaultsAndCommands(t *testing.T) {
+	now := time.Now()
+	mock, ts := mocktesla.Start(mocktesla.WithWakeDelay(time.Minute), mocktesla.WithClock(func() time.Time { return now }))
+	defer ts.Close()
+	vehicle := mock.AddVehicle(mocktesla.Vehicle{State: mocktesla.StateAsleep})
+
+	call := func(method, path, body string) (int, map[string]any) {
+		req, _ := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer anything")
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var payload map[string]any
+		_ = json.NewDecoder(resp.Body).Decode(&payload)
+		return resp.StatusCode, payload
+	}
+
+	dataPath := "/api/1/vehicles/" + vehicle.VIN + "/vehicle_data"
+	if status, _ := call(http.MethodGet, dataPath, ""); status != http.StatusRequestTimeout {
+		t.Fatalf("asleep vehicle_data status = %d, want 408", status)
+	}
+	call(http.MethodPost, "/api/1/vehicles/"+vehicle.VIN+"/wake_up", "")
+	now = now.Add(2 * time.Minute)
+	if status, _ := call(http.MethodGet, dataPath, ""); status != http.StatusOK {
+		t.Fatalf("vehicle_data after wake status = %d", status)
+	}
+
+	mock.InjectFault(mocktesla.Fault{Status: http.StatusTooManyRequests, Times: 1})
+	if status, _ := call(http.MethodGet, dataPath, ""); status != http.StatusTooManyRequests {
+		t.Fatalf("fault status = %d, want 429", status)
+	}
+
+	status, payload := call(http.MethodPost, "/api/1/vehicles/"+vehicle.VIN+"/command/set_charge_limit", `{"percent": 90}`)
+	if status != http.StatusOK || payload["response"].(map[string]any)["result"] != true {
+		t.Fatalf("command response %d %v", status, payload)
+	}
+	if updated, _ := mock.Vehicle(vehicle.VIN); updated.ChargeLimitSOC != 90 {
+		t.Fatalf("charge limit = %d", updated.ChargeLimitSOC)
+	}
+}
+
+func TestSignedCommandsMutateVehicle(t *testing.T) {
+	generated, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commandKey := protocol.UnmarshalECDHPrivateKey(generated.Bytes())
+	keyPath := filepath.Join(t.TempDir(), "private-key.pem")
+	if err := protocol.SavePrivateKey(commandKey, keyPath); err != nil {
+		t.Fatal(err)
+	}
+
+	mock, ts := mocktesla.Start(mocktesla.WithPairedKey(commandKey.PublicBytes()))
+	defer ts.Close()
+	vehicle := mock.AddVehicle(mocktesla.Vehicle{})
+
+	cfg := mockConfig(ts.URL)
+	cfg.TeslaCommandKeyPath = keyPath
+	cfg.TeslaCommandURL = ts.URL
+	commands, err := service.NewVehicleCommandService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	for _, step := range []struct {
+		command string
+		payload string
+	}{
+		{"door_lock", ""},
+		{"auto_conditioning_start", ""},
+		{"set_charge_limit", `{"percent": 65}`},
+	} {
+		result, err := commands.Execute(ctx, vehicle.VIN, step.command, []byte(step.payload), "mock-token")
+		if err != nil {
+			t.Fatalf("%s: %v", step.command, err)
+		}
+		if !strings.Contains(string(result.Body), `"result":true`) {
+			t.Fatalf("%s: unexpected result %s", step.command, result.Body)
+		}
+	}
+
+	updated, _ := mock.Vehicle(vehicle.VIN)
+	if !updated.Locked || !updated.IsClimateOn || updated.ChargeLimitSOC != 65 {
+		t.Fatalf("vehicle state not updated: %+v", updated)
+	}
+	for _, record := range mock.Commands() {
+		if !record.Signed {
+			t.Fatalf("command %s did not use the signed path", record.Command)
+		}
+	}
+
+	// A key the vehicle does not know is rejected.
+	other, _ := ecdh.P256().GenerateKey(rand.Reader)
+	otherPath := filepath.Join(t.TempDir(), "other.pem")
+	_ = protocol.SavePrivateKey(protocol.UnmarshalECDHPrivateKey(other.Bytes()), otherPath)
+	cfg.TeslaCommandKeyPath = otherPath
+	unpaired, err := service.NewVehicleCommandService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := unpaired.Execute(ctx, vehicle.VIN, "door_unlock", nil, "mock-token"); err == nil {
+		t.Fatal("unpaired key must be rejected")
+	}
+}
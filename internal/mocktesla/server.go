@@ -0,0 +1,358 @@
+// Package mocktesla implements an in-memory stand-in for the Tesla auth server and Fleet API so the
+// server can run and be tested without Tesla credentials. It is usable as a library (wrap Handler in
+// httptest.NewServer) and through cmd/mocktesla.
+// mocktesla 提供内存版的特斯拉鉴权与 Fleet API 模拟服务，可作为测试库使用，也可通过 cmd/mocktesla 独立运行。
+package mocktesla
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+)
+
+const (
+	defaultTokenTTL = 8 * time.Hour
+	defaultSubject  = "mock-user"
+)
+
+// Option customises a Server.
+type Option func(*Server)
+
+// WithBaseURL sets the public URL of the server, used as the audience of issued tokens.
+func WithBaseURL(baseURL string) Option {
+	return func(s *Server) { s.baseURL = strings.TrimRight(baseURL, "/") }
+}
+
+// WithTokenTTL sets the lifetime of issued access tokens, e.g. to exercise refresh paths.
+func WithTokenTTL(ttl time.Duration) Option {
+	return func(s *Server) { s.tokenTTL = ttl }
+}
+
+// WithWakeDelay sets how long an asleep vehicle takes to come online after wake_up.
+func WithWakeDelay(delay time.Duration) Option {
+	return func(s *Server) { s.wakeDelay = delay }
+}
+
+// WithStrictAuth rejects bearer tokens the server did not issue. By default any bearer token is
+// accepted so a restarted mock keeps working with tokens stored by the server.
+func WithStrictAuth() Option {
+	return func(s *Server) { s.strictAuth = true }
+}
+
+// WithClock overrides the time source, mainly for tests.
+func WithClock(now func() time.Time) Option {
+	return func(s *Server) { s.now = now }
+}
+
+// Server is a scriptable mock of the Tesla auth server and Fleet API. Server 是可编排的特斯拉模拟服务。
+type Server struct {
+	mu         sync.Mutex
+	baseURL    string
+	tokenTTL   time.Duration
+	wakeDelay  time.Duration
+	strictAuth bool
+	now        func() time.Time
+
+	vehicles       []*Vehicle
+	nextVehicleID  int64
+	tokens         map[string]issuedToken
+	refreshTokens  map[string]string
+	codes          map[string]string
+	partnerDomains []string
+	faults         []*Fault
+	commands       []CommandRecord
+	vehicleKeys    map[string]protocol.ECDHPrivateKey
+	sessions       map[sessionKey]*vehicleSession
+	pairedKeys     map[string]bool
+
+	mux *http.ServeMux
+}
+
+type issuedToken struct {
+	subject   string
+	partner   bool
+	expiresAt time.Time
+}
+
+// New creates a Server with no vehicles; add them with AddVehicle.
+func New(opts ...Option) *Server {
+	s := &Server{
+		baseURL:       "http://127.0.0.1:4443",
+		tokenTTL:      defaultTokenTTL,
+		wakeDelay:     0,
+		now:           time.Now,
+		nextVehicleID: 1492931520123456,
+		tokens:        map[string]issuedToken{},
+		refreshTokens: map[string]string{},
+		codes:         map[string]string{},
+		vehicleKeys:   map[string]protocol.ECDHPrivateKey{},
+		sessions:      map[sessionKey]*vehicleSession{},
+		pairedKeys:    map[string]bool{},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.mux = http.NewServeMux()
+	s.routes()
+	return s
+}
+
+// Start runs a Server on a local httptest listener, with the base URL already set. Callers must
+// Close the returned httptest.Server.
+func Start(opts ...Option) (*Server, *httptest.Server) {
+	s := New(opts...)
+	ts := httptest.NewServer(s)
+	s.SetBaseURL(ts.URL)
+	return s, ts
+}
+
+// SetBaseURL updates the public URL once it is known, e.g. after httptest.NewServer started.
+func (s *Server) SetBaseURL(baseURL string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.baseURL = strings.TrimRight(baseURL, "/")
+}
+
+// Handler returns the HTTP handler serving every mock endpoint.
+func (s *Server) Handler() http.Handler {
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, adminPrefix) {
+		if fault := s.matchFault(r); fault != nil {
+			fault.write(w)
+			return
+		}
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) routes() {
+	s.mux.HandleFunc("GET /oauth2/v3/authorize", s.handleAuthorize)
+	s.mux.HandleFunc("POST /oauth2/v3/token", s.handleToken)
+
+	s.mux.HandleFunc("POST /api/1/partner_accounts", s.requireToken(true, s.handlePartnerAccounts))
+	s.mux.HandleFunc("GET /api/1/vehicles", s.requireToken(false, s.handleListVehicles))
+	s.mux.HandleFunc("GET /api/1/vehicles/{tag}", s.requireToken(false, s.handleGetVehicle))
+	s.mux.HandleFunc("GET /api/1/vehicles/{tag}/vehicle_data", s.requireToken(false, s.handleVehicleData))
+	s.mux.HandleFunc("POST /api/1/vehicles/{tag}/wake_up", s.requireToken(false, s.handleWakeUp))
+	s.mux.HandleFunc("GET /api/1/vehicles/{tag}/drivers", s.requireToken(false, s.handleDrivers))
+	s.mux.HandleFunc("POST /api/1/vehicles/{tag}/command/{command}", s.requireToken(false, s.handleCommand))
+	s.mux.HandleFunc("POST /api/1/vehicles/{tag}/signed_command", s.requireToken(false, s.handleSignedCommand))
+
+	s.adminRoutes()
+}
+
+// handleAuthorize immediately redirects back with an authorization code, as if the user logged in.
+func (s *Server) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	redirectURI := r.URL.Query().Get("redirect_uri")
+	if redirectURI == "" {
+		writeTeslaError(w, http.StatusBadRequest, "invalid_request", "redirect_uri is required")
+		return
+	}
+	target, err := url.Parse(redirectURI)
+	if err != nil {
+		writeTeslaError(w, http.StatusBadRequest, "invalid_request", "redirect_uri is invalid")
+		return
+	}
+
+	subject := r.URL.Query().Get("login_hint")
+	if subject == "" {
+		subject = defaultSubject
+	}
+	code := randomToken(16)
+	s.mu.Lock()
+	s.codes[code] = subject
+	s.mu.Unlock()
+
+	query := target.Query()
+	query.Set("code", code)
+	if state := r.URL.Query().Get("state"); state != "" {
+		query.Set("state", state)
+	}
+	target.RawQuery = query.Encode()
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+// handleToken implements the authorization_code, refresh_token and client_credentials grants. Both
+// form and JSON bodies are accepted, like Tesla's token endpoint.
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	params, err := tokenParams(r)
+	if err != nil {
+		writeTeslaError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if params["client_id"] == "" {
+		writeTeslaError(w, http.StatusUnauthorized, "invalid_client", "client_id is required")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var (
+		subject string
+		partner bool
+	)
+	switch params["grant_type"] {
+	case "authorization_code":
+		var ok bool
+		if subject, ok = s.codes[params["code"]]; !ok {
+			writeTeslaError(w, http.StatusBadRequest, "invalid_grant", "authorization code is invalid or expired")
+			return
+		}
+		delete(s.codes, params["code"])
+	case "refresh_token":
+		var ok bool
+		subject, ok = s.refreshTokens[params["refresh_token"]]
+		if !ok && s.strictAuth {
+			writeTeslaError(w, http.StatusBadRequest, "invalid_grant", "refresh_token is invalid")
+			return
+		}
+		if !ok {
+			subject = defaultSubject
+		}
+		delete(s.refreshTokens, params["refresh_token"])
+	case "client_credentials":
+		subject, partner = params["client_id"], true
+	default:
+		writeTeslaError(w, http.StatusBadRequest, "unsupported_grant_type", fmt.Sprintf("grant_type %q is not supported", params["grant_type"]))
+		return
+	}
+
+	accessToken := s.issueAccessTokenLocked(subject, partner)
+	response := map[string]any{
+		"access_token": accessToken,
+		"expires_in":   int(s.tokenTTL.Seconds()),
+		"token_type":   "Bearer",
+		"scope":        params["scope"],
+	}
+	if !partner {
+		refreshToken := "mock-refresh-" + randomToken(16)
+		s.refreshTokens[refreshToken] = subject
+		response["refresh_token"] = refreshToken
+		response["id_token"] = accessToken
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) handlePartnerAccounts(w http.ResponseWriter, r *http.Request, _ issuedToken) {
+	var body struct {
+		Domain string `json:"domain"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Domain == "" {
+		writeTeslaError(w, http.StatusBadRequest, "invalid_request", "domain is required")
+		return
+	}
+	s.mu.Lock()
+	s.partnerDomains = append(s.partnerDomains, body.Domain)
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]any{"response": map[string]any{"domain": body.Domain, "client_id": "mock"}})
+}
+
+// requireToken validates the bearer token. Partner endpoints require a client_credentials token.
+func (s *Server) requireToken(partner bool, next func(http.ResponseWriter, *http.Request, issuedToken)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if !strings.HasPrefix(strings.ToLower(header), "bearer ") {
+			writeTeslaError(w, http.StatusUnauthorized, "unauthorized", "missing bearer token")
+			return
+		}
+		token := strings.TrimSpace(header[len("bearer "):])
+
+		s.mu.Lock()
+		issued, ok := s.tokens[token]
+		now := s.now()
+		strict := s.strictAuth
+		s.mu.Unlock()
+
+		switch {
+		case ok && now.After(issued.expiresAt):
+			writeTeslaError(w, http.StatusUnauthorized, "token expired (401)", "")
+			return
+		case !ok && strict:
+			writeTeslaError(w, http.StatusUnauthorized, "invalid bearer token", "")
+			return
+		case !ok:
+			issued = issuedToken{subject: defaultSubject, partner: partner, expiresAt: now.Add(s.tokenTTL)}
+		}
+		if strict && partner != issued.partner {
+			writeTeslaError(w, http.StatusForbidden, "token type is not allowed for this endpoint", "")
+			return
+		}
+		next(w, r, issued)
+	}
+}
+
+// issueAccessTokenLocked returns a JWT-shaped token whose aud claim points at the mock, which is the
+// format the vehicle-command SDK expects.
+func (s *Server) issueAccessTokenLocked(subject string, partner bool) string {
+	expiresAt := s.now().Add(s.tokenTTL)
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+	claims, _ := json.Marshal(map[string]any{
+		"iss": s.baseURL + "/oauth2/v3",
+		"aud": []string{s.baseURL + "/", s.baseURL + "/oauth2/v3/userinfo"},
+		"sub": subject,
+		"exp": expiresAt.Unix(),
+		"iat": s.now().Unix(),
+	})
+	token := header + "." + base64.RawURLEncoding.EncodeToString(claims) + "." + randomToken(16)
+	s.tokens[token] = issuedToken{subject: subject, partner: partner, expiresAt: expiresAt}
+	return token
+}
+
+// PartnerDomains returns the domains registered through POST /api/1/partner_accounts.
+func (s *Server) PartnerDomains() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.partnerDomains...)
+}
+
+func tokenParams(r *http.Request) (map[string]string, error) {
+	params := map[string]string{}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			return nil, fmt.Errorf("invalid JSON body: %w", err)
+		}
+		return params, nil
+	}
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+	for key := range r.PostForm {
+		params[key] = r.PostForm.Get(key)
+	}
+	return params, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// writeTeslaError writes Tesla's error body shape: {"response":null,"error":"...","error_description":"..."}.
+func writeTeslaError(w http.ResponseWriter, status int, message, description string) {
+	writeJSON(w, status, map[string]any{
+		"response":          nil,
+		"error":             message,
+		"error_description": description,
+	})
+}
+
+func randomToken(n int) string {
+	buf := make([]byte, n)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
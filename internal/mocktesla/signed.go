@@ -0,0 +1,284 @@
+package mocktesla
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/carserver"
+	universal "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/universalmessage"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/vcsec"
+	"google.golang.org/protobuf/proto"
+)
+
+// sessionKey identifies a command session: one client key talking to one domain of one vehicle.
+type sessionKey struct {
+	vin       string
+	domain    universal.Domain
+	clientKey string
+}
+
+// WithPairedKey pairs a client public key (uncompressed P-256 bytes) with every vehicle. Until a key
+// is paired, vehicles accept commands signed by any key, as if the virtual key were already added.
+func WithPairedKey(publicKey []byte) Option {
+	return func(s *Server) { s.pairedKeys[hex.EncodeToString(publicKey)] = true }
+}
+
+// PairKey pairs a client public key with every vehicle, see WithPairedKey.
+func (s *Server) PairKey(publicKey []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pairedKeys[hex.EncodeToString(publicKey)] = true
+}
+
+// handleSignedCommand implements POST /api/1/vehicles/{tag}/signed_command, the transport used by the
+// vehicle-command SDK. The body carries a protobuf RoutableMessage that is either a session info
+// request or a signed command; the answer is the vehicle's RoutableMessage.
+func (s *Server) handleSignedCommand(w http.ResponseWriter, r *http.Request, _ issuedToken) {
+	var body struct {
+		RoutableMessage []byte `json:"routable_message"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeTeslaError(w, http.StatusBadRequest, "invalid JSON body", err.Error())
+		return
+	}
+	var request universal.RoutableMessage
+	if err := proto.Unmarshal(body.RoutableMessage, &request); err != nil {
+		writeTeslaError(w, http.StatusBadRequest, "invalid routable_message", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v := s.lookupLocked(w, r)
+	if v == nil || !requireOnline(w, v) {
+		return
+	}
+
+	response, err := s.handleRoutableMessageLocked(v, &request)
+	if err != nil {
+		writeTeslaError(w, http.StatusInternalServerError, "internal error", err.Error())
+		return
+	}
+	encoded, err := proto.Marshal(response)
+	if err != nil {
+		writeTeslaError(w, http.StatusInternalServerError, "internal error", err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"response": encoded})
+}
+
+func (s *Server) handleRoutableMessageLocked(v *Vehicle, request *universal.RoutableMessage) (*universal.RoutableMessage, error) {
+	domain := request.GetToDestination().GetDomain()
+	response := &universal.RoutableMessage{
+		ToDestination: request.GetFromDestination(),
+		FromDestination: &universal.Destination{
+			SubDestination: &universal.Destination_Domain{Domain: domain},
+		},
+		RequestUuid: request.GetUuid(),
+		Uuid:        []byte(randomToken(8)),
+	}
+	if domain != universal.Domain_DOMAIN_VEHICLE_SECURITY && domain != universal.Domain_DOMAIN_INFOTAINMENT {
+		return withFault(response, universal.MessageFault_E_MESSAGEFAULT_ERROR_INVALID_DOMAINS), nil
+	}
+
+	if hello, ok := request.GetPayload().(*universal.RoutableMessage_SessionInfoRequest); ok {
+		session, fault := s.sessionLocked(v, domain, hello.SessionInfoRequest.GetPublicKey())
+		if session == nil {
+			return withFault(response, fault), nil
+		}
+		return response, session.attachSessionInfo(response, request.GetUuid())
+	}
+
+	signer := request.GetSignatureData().GetSignerIdentity().GetPublicKey()
+	session, fault := s.sessionLocked(v, domain, signer)
+	if session == nil {
+		return withFault(response, fault), nil
+	}
+	plaintext, fault := session.verify(request)
+	if fault != universal.MessageFault_E_MESSAGEFAULT_ERROR_NONE {
+		// Include fresh session info so the client can resynchronise and retry.
+		withFault(response, fault)
+		return response, session.attachSessionInfo(response, request.GetUuid())
+	}
+
+	var reply []byte
+	var err error
+	if domain == universal.Domain_DOMAIN_VEHICLE_SECURITY {
+		reply, err = s.applyVCSECLocked(v, plaintext)
+	} else {
+		reply, err = s.applyCarServerLocked(v, plaintext)
+	}
+	if err != nil {
+		return nil, err
+	}
+	response.Payload = &universal.RoutableMessage_ProtobufMessageAsBytes{ProtobufMessageAsBytes: reply}
+	if request.GetFlags()&(1<<uint32(universal.Flags_FLAG_ENCRYPT_RESPONSE)) != 0 {
+		if err := session.encryptResponse(response, requestID(request)); err != nil {
+			return nil, err
+		}
+	}
+	return response, nil
+}
+
+// sessionLocked returns the session for a client key, creating it on first contact. Unpaired keys are
+// rejected with the fault a vehicle reports for an unknown key.
+func (s *Server) sessionLocked(v *Vehicle, domain universal.Domain, clientKey []byte) (*vehicleSession, universal.MessageFault_E) {
+	if len(clientKey) == 0 {
+		return nil, universal.MessageFault_E_MESSAGEFAULT_ERROR_BAD_PARAMETER
+	}
+	keyHex := hex.EncodeToString(clientKey)
+	if len(s.pairedKeys) > 0 && !s.pairedKeys[keyHex] {
+		return nil, universal.MessageFault_E_MESSAGEFAULT_ERROR_UNKNOWN_KEY_ID
+	}
+	id := sessionKey{vin: v.VIN, domain: domain, clientKey: keyHex}
+	if session, ok := s.sessions[id]; ok {
+		return session, universal.MessageFault_E_MESSAGEFAULT_ERROR_NONE
+	}
+
+	vehicleKey, err := s.vehicleKeyLocked(v.VIN)
+	if err != nil {
+		return nil, universal.MessageFault_E_MESSAGEFAULT_ERROR_INTERNAL
+	}
+	crypto, err := vehicleKey.Exchange(clientKey)
+	if err != nil {
+		return nil, universal.MessageFault_E_MESSAGEFAULT_ERROR_BAD_PARAMETER
+	}
+	session, err := newVehicleSession(crypto, v.VIN)
+	if err != nil {
+		return nil, universal.MessageFault_E_MESSAGEFAULT_ERROR_INTERNAL
+	}
+	s.sessions[id] = session
+	return session, universal.MessageFault_E_MESSAGEFAULT_ERROR_NONE
+}
+
+// vehicleKeyLocked returns the vehicle's own ECDH key, generated on first use.
+func (s *Server) vehicleKeyLocked(vin string) (protocol.ECDHPrivateKey, error) {
+	if key, ok := s.vehicleKeys[vin]; ok {
+		return key, nil
+	}
+	generated, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	key := protocol.UnmarshalECDHPrivateKey(generated.Bytes())
+	if key == nil {
+		return nil, fmt.Errorf("generate vehicle key for %s", vin)
+	}
+	s.vehicleKeys[vin] = key
+	return key, nil
+}
+
+func withFault(response *universal.RoutableMessage, fault universal.MessageFault_E) *universal.RoutableMessage {
+	response.SignedMessageStatus = &universal.MessageStatus{
+		OperationStatus:    universal.OperationStatus_E_OPERATIONSTATUS_ERROR,
+		SignedMessageFault: fault,
+	}
+	return response
+}
+
+// applyVCSECLocked executes a vehicle security command (locks, closures, remote start).
+func (s *Server) applyVCSECLocked(v *Vehicle, plaintext []byte) ([]byte, error) {
+	var message vcsec.UnsignedMessage
+	if err := proto.Unmarshal(plaintext, &message); err != nil {
+		return nil, fmt.Errorf("decode vcsec message: %w", err)
+	}
+
+	switch sub := message.GetSubMessage().(type) {
+	case *vcsec.UnsignedMessage_RKEAction:
+		switch sub.RKEAction {
+		case vcsec.RKEAction_E_RKE_ACTION_LOCK, vcsec.RKEAction_E_RKE_ACTION_AUTO_SECURE_VEHICLE:
+			s.applyCommandLocked(v, restCommands["door_lock"], "door_lock", nil, true)
+		case vcsec.RKEAction_E_RKE_ACTION_UNLOCK:
+			s.applyCommandLocked(v, restCommands["door_unlock"], "door_unlock", nil, true)
+		case vcsec.RKEAction_E_RKE_ACTION_REMOTE_DRIVE:
+			s.applyCommandLocked(v, restCommands["remote_start_drive"], "remote_start_drive", nil, true)
+		default:
+			s.applyCommandLocked(v, nil, sub.RKEAction.String(), nil, true)
+		}
+	case *vcsec.UnsignedMessage_ClosureMoveRequest:
+		which := "rear"
+		if sub.ClosureMoveRequest.GetFrontTrunk() != vcsec.ClosureMoveType_E_CLOSURE_MOVE_TYPE_NONE {
+			which = "front"
+		}
+		s.applyCommandLocked(v, restCommands["actuate_trunk"], "actuate_trunk", map[string]any{"which_trunk": which}, true)
+	default:
+		s.applyCommandLocked(v, nil, fmt.Sprintf("%T", sub), nil, true)
+	}
+	return proto.Marshal(&vcsec.FromVCSECMessage{})
+}
+
+// applyCarServerLocked executes an infotainment command. Actions with a REST equivalent reuse the REST
+// command logic so both paths change vehicle state identically; other actions are accepted and
+// recorded without changing state.
+func (s *Server) applyCarServerLocked(v *Vehicle, plaintext []byte) ([]byte, error) {
+	var action carserver.Action
+	if err := proto.Unmarshal(plaintext, &action); err != nil {
+		return nil, fmt.Errorf("decode car server action: %w", err)
+	}
+
+	name, params := carServerCommand(action.GetVehicleAction())
+	reason := s.applyCommandLocked(v, restCommands[name], name, params, true)
+
+	status := &carserver.ActionStatus{Result: carserver.OperationStatus_E_OPERATIONSTATUS_OK}
+	if reason != "" {
+		status.Result = carserver.OperationStatus_E_OPERATIONSTATUS_ERROR
+		status.ResultReason = &carserver.ResultReason{Reason: &carserver.ResultReason_PlainText{PlainText: reason}}
+	}
+	return proto.Marshal(&carserver.Response{ActionStatus: status})
+}
+
+// carServerCommand maps a vehicle action to the equivalent REST command name and parameters.
+func carServerCommand(action *carserver.VehicleAction) (string, map[string]any) {
+	switch msg := action.GetVehicleActionMsg().(type) {
+	case *carserver.VehicleAction_HvacAutoAction:
+		if msg.HvacAutoAction.GetPowerOn() {
+			return "auto_conditioning_start", nil
+		}
+		return "auto_conditioning_stop", nil
+	case *carserver.VehicleAction_HvacTemperatureAdjustmentAction:
+		return "set_temps", map[string]any{
+			"driver_temp":    float64(msg.HvacTemperatureAdjustmentAction.GetDriverTempCelsius()),
+			"passenger_temp": float64(msg.HvacTemperatureAdjustmentAction.GetPassengerTempCelsius()),
+		}
+	case *carserver.VehicleAction_ChargingSetLimitAction:
+		return "set_charge_limit", map[string]any{"percent": float64(msg.ChargingSetLimitAction.GetPercent())}
+	case *carserver.VehicleAction_ChargingStartStopAction:
+		switch msg.ChargingStartStopAction.GetChargingAction().(type) {
+		case *carserver.ChargingStartStopAction_Stop:
+			return "charge_stop", nil
+		case *carserver.ChargingStartStopAction_StartMaxRange:
+			return "set_charge_limit", map[string]any{"percent": float64(100)}
+		case *carserver.ChargingStartStopAction_StartStandard:
+			return "set_charge_limit", map[string]any{"percent": float64(90)}
+		default:
+			return "charge_start", nil
+		}
+	case *carserver.VehicleAction_SetChargingAmpsAction:
+		return "set_charging_amps", map[string]any{"charging_amps": float64(msg.SetChargingAmpsAction.GetChargingAmps())}
+	case *carserver.VehicleAction_ChargePortDoorOpen:
+		return "charge_port_door_open", nil
+	case *carserver.VehicleAction_ChargePortDoorClose:
+		return "charge_port_door_close", nil
+	case *carserver.VehicleAction_VehicleControlSetSentryModeAction:
+		return "set_sentry_mode", map[string]any{"on": msg.VehicleControlSetSentryModeAction.GetOn()}
+	case *carserver.VehicleAction_VehicleControlFlashLightsAction:
+		return "flash_lights", nil
+	case *carserver.VehicleAction_VehicleControlHonkHornAction:
+		return "honk_horn", nil
+	}
+
+	// Fall back to the protobuf field name, e.g. "mediaNextTrack".
+	reflected := action.ProtoReflect()
+	oneof := reflected.Descriptor().Oneofs().ByName("vehicle_action_msg")
+	if oneof != nil {
+		if field := reflected.WhichOneof(oneof); field != nil {
+			return string(field.Name()), nil
+		}
+	}
+	return "unknown", nil
+}
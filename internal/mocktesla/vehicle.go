@@ -0,0 +1,452 @@
+package mocktesla
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Vehicle states reported by the Fleet API.
+const (
+	StateOnline  = "online"
+	StateAsleep  = "asleep"
+	StateOffline = "offline"
+)
+
+// Vehicle is the scriptable state of a mock vehicle. Every field can be patched through the admin API
+// (PATCH /_mock/vehicles/{vin}) or UpdateVehicle. Distances are in miles and temperatures in Celsius,
+// matching Tesla. Vehicle 为模拟车辆的可编排状态。
+type Vehicle struct {
+	ID          int64  `json:"id"`
+	VehicleID   int64  `json:"vehicle_id"`
+	VIN         string `json:"vin"`
+	DisplayName string `json:"display_name"`
+	AccessType  string `json:"access_type"`
+	State       string `json:"state"`
+	HidePrivate bool   `json:"hide_private"`
+	CarType     string `json:"car_type"`
+	CarVersion  string `json:"car_version"`
+
+	Locked     bool    `json:"locked"`
+	SentryMode bool    `json:"sentry_mode"`
+	Odometer   float64 `json:"odometer"`
+
+	BatteryLevel       int     `json:"battery_level"`
+	BatteryRange       float64 `json:"battery_range"`
+	ChargeLimitSOC     int     `json:"charge_limit_soc"`
+	ChargingState      string  `json:"charging_state"`
+	ChargePortDoorOpen bool    `json:"charge_port_door_open"`
+	ChargeAmps         int     `json:"charge_amps"`
+
+	IsClimateOn          bool    `json:"is_climate_on"`
+	InsideTemp           float64 `json:"inside_temp"`
+	OutsideTemp          float64 `json:"outside_temp"`
+	DriverTempSetting    float64 `json:"driver_temp_setting"`
+	PassengerTempSetting float64 `json:"passenger_temp_setting"`
+
+	Latitude   float64  `json:"latitude"`
+	Longitude  float64  `json:"longitude"`
+	Heading    int      `json:"heading"`
+	Speed      *float64 `json:"speed"`
+	ShiftState *string  `json:"shift_state"`
+
+	// wakeAt is when an asleep vehicle that received wake_up comes online.
+	wakeAt time.Time
+}
+
+// CommandRecord is a command received by the mock, in arrival order. Signed is set for commands
+// that arrived through the vehicle-command protocol rather than the REST endpoints.
+type CommandRecord struct {
+	VIN     string         `json:"vin"`
+	Command string         `json:"command"`
+	Params  map[string]any `json:"params,omitempty"`
+	Signed  bool           `json:"signed"`
+	Result  bool           `json:"result"`
+	Reason  string         `json:"reason,omitempty"`
+	At      time.Time      `json:"at"`
+}
+
+// AddVehicle registers a vehicle. Zero fields get realistic defaults and the stored copy is returned.
+func (s *Server) AddVehicle(v Vehicle) Vehicle {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return *s.addVehicleLocked(v)
+}
+
+func (s *Server) addVehicleLocked(v Vehicle) *Vehicle {
+	index := len(s.vehicles) + 1
+	if v.ID == 0 {
+		v.ID = s.nextVehicleID
+		s.nextVehicleID++
+	}
+	if v.VehicleID == 0 {
+		v.VehicleID = 1000000000 + int64(index)
+	}
+	if v.VIN == "" {
+		v.VIN = fmt.Sprintf("5YJ3E1EA0PF%06d", index)
+	}
+	if v.DisplayName == "" {
+		v.DisplayName = fmt.Sprintf("Mock Car %d", index)
+	}
+	if v.AccessType == "" {
+		v.AccessType = "OWNER"
+	}
+	if v.State == "" {
+		v.State = StateOnline
+	}
+	if v.CarType == "" {
+		v.CarType = "model3"
+	}
+	if v.CarVersion == "" {
+		v.CarVersion = "2024.44.25 mock"
+	}
+	if v.BatteryLevel == 0 {
+		v.BatteryLevel = 72
+		v.BatteryRange = 231.5
+	}
+	if v.ChargeLimitSOC == 0 {
+		v.ChargeLimitSOC = 80
+	}
+	if v.ChargingState == "" {
+		v.ChargingState = "Disconnected"
+	}
+	if v.Odometer == 0 {
+		v.Odometer = 12345.6
+	}
+	if v.DriverTempSetting == 0 {
+		v.DriverTempSetting, v.PassengerTempSetting = 21, 21
+	}
+	if v.InsideTemp == 0 {
+		v.InsideTemp, v.OutsideTemp = 18.5, 12
+	}
+	if v.Latitude == 0 && v.Longitude == 0 {
+		v.Latitude, v.Longitude = 31.2304, 121.4737
+	}
+	stored := v
+	s.vehicles = append(s.vehicles, &stored)
+	return &stored
+}
+
+// Vehicle returns a copy of the vehicle with the given VIN.
+func (s *Server) Vehicle(vin string) (Vehicle, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v := s.findLocked(vin)
+	if v == nil {
+		return Vehicle{}, false
+	}
+	s.settleLocked(v)
+	return *v, true
+}
+
+// Vehicles returns copies of all vehicles in list order.
+func (s *Server) Vehicles() []Vehicle {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	vehicles := make([]Vehicle, 0, len(s.vehicles))
+	for _, v := range s.vehicles {
+		s.settleLocked(v)
+		vehicles = append(vehicles, *v)
+	}
+	return vehicles
+}
+
+// UpdateVehicle mutates the vehicle with the given VIN under the server lock.
+func (s *Server) UpdateVehicle(vin string, update func(*Vehicle)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v := s.findLocked(vin)
+	if v == nil {
+		return fmt.Errorf("vehicle %s not found", vin)
+	}
+	update(v)
+	return nil
+}
+
+// SetState moves a vehicle to online, asleep or offline.
+func (s *Server) SetState(vin, state string) error {
+	return s.UpdateVehicle(vin, func(v *Vehicle) {
+		v.State = state
+		v.wakeAt = time.Time{}
+	})
+}
+
+// Commands returns every command received so far.
+func (s *Server) Commands() []CommandRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]CommandRecord(nil), s.commands...)
+}
+
+// findLocked matches a VIN, numeric id or id_s, like the Fleet API's vehicle_tag.
+func (s *Server) findLocked(tag string) *Vehicle {
+	for _, v := range s.vehicles {
+		if strings.EqualFold(v.VIN, tag) || strconv.FormatInt(v.ID, 10) == tag {
+			return v
+		}
+	}
+	return nil
+}
+
+// settleLocked completes a pending wake-up whose delay has elapsed.
+func (s *Server) settleLocked(v *Vehicle) {
+	if !v.wakeAt.IsZero() && !s.now().Before(v.wakeAt) {
+		v.State = StateOnline
+		v.wakeAt = time.Time{}
+	}
+}
+
+func (s *Server) handleListVehicles(w http.ResponseWriter, r *http.Request, _ issuedToken) {
+	page := max(queryInt(r, "page", 1), 1)
+	perPage := queryInt(r, "per_page", 100)
+	if perPage <= 0 || perPage > 100 {
+		perPage = 100
+	}
+
+	s.mu.Lock()
+	all := make([]map[string]any, 0, len(s.vehicles))
+	for _, v := range s.vehicles {
+		s.settleLocked(v)
+		all = append(all, summaryJSON(v))
+	}
+	s.mu.Unlock()
+
+	pages := max((len(all)+perPage-1)/perPage, 1)
+	start := min((page-1)*perPage, len(all))
+	end := min(start+perPage, len(all))
+	items := all[start:end]
+
+	var previous, next any
+	if page > 1 {
+		previous = strconv.Itoa(page - 1)
+	}
+	if page < pages {
+		next = strconv.Itoa(page + 1)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"response": items,
+		"pagination": map[string]any{
+			"previous": previous,
+			"next":     next,
+			"current":  page,
+			"per_page": perPage,
+			"count":    len(items),
+			"pages":    pages,
+		},
+		"count": len(items),
+	})
+}
+
+func (s *Server) handleGetVehicle(w http.ResponseWriter, r *http.Request, _ issuedToken) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v := s.lookupLocked(w, r)
+	if v == nil {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"response": summaryJSON(v)})
+}
+
+func (s *Server) handleVehicleData(w http.ResponseWriter, r *http.Request, _ issuedToken) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v := s.lookupLocked(w, r)
+	if v == nil || !requireOnline(w, v) {
+		return
+	}
+
+	endpoints := map[string]bool{}
+	for _, endpoint := range strings.Split(r.URL.Query().Get("endpoints"), ";") {
+		if endpoint = strings.TrimSpace(endpoint); endpoint != "" {
+			endpoints[endpoint] = true
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"response": vehicleDataJSON(v, endpoints, s.now())})
+}
+
+func (s *Server) handleWakeUp(w http.ResponseWriter, r *http.Request, _ issuedToken) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v := s.lookupLocked(w, r)
+	if v == nil {
+		return
+	}
+	if v.State == StateAsleep && v.wakeAt.IsZero() {
+		v.wakeAt = s.now().Add(s.wakeDelay)
+		s.settleLocked(v)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"response": summaryJSON(v)})
+}
+
+func (s *Server) handleDrivers(w http.ResponseWriter, r *http.Request, issued issuedToken) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v := s.lookupLocked(w, r)
+	if v == nil {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"response": []map[string]any{{
+			"my_tesla_unique_id": 8888888,
+			"user_id":            800001,
+			"user_id_s":          "800001",
+			"vault_uuid":         "b5c443af-a286-49eb-a4ad-35a97963155d",
+			"driver_first_name":  issued.subject,
+			"driver_last_name":   "",
+			"granular_access":    map[string]any{"hide_private": v.HidePrivate},
+			"active_pubkeys":     []string{},
+			"public_key":         "",
+		}},
+		"count": 1,
+	})
+}
+
+// lookupLocked resolves the {tag} path value and writes 404 when the vehicle is unknown.
+func (s *Server) lookupLocked(w http.ResponseWriter, r *http.Request) *Vehicle {
+	v := s.findLocked(r.PathValue("tag"))
+	if v == nil {
+		writeTeslaError(w, http.StatusNotFound, "not_found", "")
+		return nil
+	}
+	s.settleLocked(v)
+	return v
+}
+
+// requireOnline writes Tesla's 408 when the vehicle is asleep or offline.
+func requireOnline(w http.ResponseWriter, v *Vehicle) bool {
+	if v.State == StateOnline {
+		return true
+	}
+	writeTeslaError(w, http.StatusRequestTimeout, "vehicle unavailable: vehicle is offline or asleep", "")
+	return false
+}
+
+func summaryJSON(v *Vehicle) map[string]any {
+	return map[string]any{
+		"id":                        v.ID,
+		"vehicle_id":                v.VehicleID,
+		"vin":                       v.VIN,
+		"color":                     nil,
+		"access_type":               v.AccessType,
+		"display_name":              v.DisplayName,
+		"option_codes":              "",
+		"granular_access":           map[string]any{"hide_private": v.HidePrivate},
+		"tokens":                    []string{},
+		"state":                     v.State,
+		"in_service":                false,
+		"id_s":                      strconv.FormatInt(v.ID, 10),
+		"calendar_enabled":          true,
+		"api_version":               79,
+		"backseat_token":            nil,
+		"backseat_token_updated_at": nil,
+	}
+}
+
+// vehicleDataJSON renders vehicle_data. location_data is only included when requested, as on Tesla.
+func vehicleDataJSON(v *Vehicle, endpoints map[string]bool, now time.Time) map[string]any {
+	ts := now.UnixMilli()
+	include := func(name string) bool {
+		if len(endpoints) == 0 {
+			return name != "location_data"
+		}
+		return endpoints[name]
+	}
+
+	data := summaryJSON(v)
+	data["user_id"] = 800001
+	if include("charge_state") {
+		data["charge_state"] = map[string]any{
+			"battery_level":          v.BatteryLevel,
+			"usable_battery_level":   v.BatteryLevel,
+			"battery_range":          v.BatteryRange,
+			"est_battery_range":      v.BatteryRange * 0.9,
+			"ideal_battery_range":    v.BatteryRange,
+			"charge_limit_soc":       v.ChargeLimitSOC,
+			"charge_limit_soc_min":   50,
+			"charge_limit_soc_max":   100,
+			"charging_state":         v.ChargingState,
+			"charge_port_door_open":  v.ChargePortDoorOpen,
+			"charge_amps":            v.ChargeAmps,
+			"charge_current_request": v.ChargeAmps,
+			"timestamp":              ts,
+		}
+	}
+	if include("climate_state") {
+		data["climate_state"] = map[string]any{
+			"inside_temp":             v.InsideTemp,
+			"outside_temp":            v.OutsideTemp,
+			"driver_temp_setting":     v.DriverTempSetting,
+			"passenger_temp_setting":  v.PassengerTempSetting,
+			"is_climate_on":           v.IsClimateOn,
+			"is_auto_conditioning_on": v.IsClimateOn,
+			"min_avail_temp":          15,
+			"max_avail_temp":          28,
+			"timestamp":               ts,
+		}
+	}
+	if include("drive_state") {
+		data["drive_state"] = map[string]any{
+			"latitude":    v.Latitude,
+			"longitude":   v.Longitude,
+			"heading":     v.Heading,
+			"gps_as_of":   now.Unix(),
+			"speed":       v.Speed,
+			"shift_state": v.ShiftState,
+			"power":       0,
+			"timestamp":   ts,
+		}
+	}
+	if include("location_data") {
+		data["location_data"] = map[string]any{
+			"latitude":  v.Latitude,
+			"longitude": v.Longitude,
+			"heading":   v.Heading,
+			"gps_as_of": now.Unix(),
+			"timestamp": ts,
+		}
+	}
+	if include("gui_settings") {
+		data["gui_settings"] = map[string]any{
+			"gui_24_hour_time":       true,
+			"gui_charge_rate_units":  "kW",
+			"gui_distance_units":     "km/hr",
+			"gui_range_display":      "Rated",
+			"gui_temperature_units":  "C",
+			"gui_tirepressure_units": "Bar",
+			"show_range_units":       false,
+			"timestamp":              ts,
+		}
+	}
+	if include("vehicle_config") {
+		data["vehicle_config"] = map[string]any{
+			"car_type":           v.CarType,
+			"can_actuate_trunks": true,
+			"charge_port_type":   "GB",
+			"exterior_color":     "PearlWhite",
+			"plg":                true,
+			"timestamp":          ts,
+		}
+	}
+	if include("vehicle_state") {
+		data["vehicle_state"] = map[string]any{
+			"car_version":  v.CarVersion,
+			"locked":       v.Locked,
+			"sentry_mode":  v.SentryMode,
+			"odometer":     v.Odometer,
+			"vehicle_name": v.DisplayName,
+			"api_version":  79,
+			"timestamp":    ts,
+		}
+	}
+	return data
+}
+
+func queryInt(r *http.Request, key string, fallback int) int {
+	value, err := strconv.Atoi(r.URL.Query().Get(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,84 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Outcomes of an audited vehicle command. 审计记录中的指令结果。
+const (
+	CommandAuditSucceeded = "succeeded"
+	// CommandAuditDeclined means the vehicle received the command but refused it (result false).
+	CommandAuditDeclined = "declined"
+	CommandAuditFailed   = "failed"
+	// CommandAuditRejected means the request failed validation and nothing was sent.
+	CommandAuditRejected = "rejected"
+)
+
+// CommandAudit records one attempt to send a command to a vehicle or energy site. Entries form a hash chain: Hash
+// covers the entry's fields and PrevHash, the Hash of the entry before it, so editing or deleting a
+// row breaks every later hash. CommandAudit 记录一次车辆指令调用，记录之间以哈希链防篡改。
+type CommandAudit struct {
+	ID     uint      `gorm:"primaryKey:autoIncrement"`
+	UserID uuid.UUID `gorm:"type:uuid;not null;index"`
+	// Actor is who sent the command: the user itself, or the delegated party named in the JWT act claim.
+	Actor     string `gorm:"type:varchar(255);not null"`
+	RequestID string `gorm:"type:varchar(64);not null;default:''"`
+	// VIN is the resolved VIN, or the vehicle tag from the request when it could not be resolved or
+	// the request was rejected. Energy site commands store energy_site:<energy_site_id>.
+	VIN     string `gorm:"type:varchar(64);not null;index"`
+	Command string `gorm:"type:varchar(255);not null"`
+	// Params is the request body with secrets and coordinates redacted.
+	Params string `gorm:"type:text;not null;default:''"`
+	// Path is sdk or rest, the way the command was sent; empty when it failed before that.
+	Path       string `gorm:"type:varchar(16);not null;default:''"`
+	Outcome    string `gorm:"type:varchar(16);not null"`
+	HTTPStatus int    `gorm:"not null;default:0"`
+	ErrorCode  string `gorm:"type:varchar(64);not null;default:''"`
+	// Reason is the vehicle's reason for declining, or the error message of a failure.
+	Reason    string    `gorm:"type:text;not null;default:''"`
+	LatencyMS int64     `gorm:"not null;default:0"`
+	CreatedAt time.Time `gorm:"not null;index"`
+	PrevHash  string    `gorm:"type:char(64);not null"`
+	Hash      string    `gorm:"type:char(64);not null;uniqueIndex"`
+}
+
+// ComputeHash returns the chain hash of the entry given the hash of the entry before it. The ID is not
+// covered since it is assigned by the database after hashing; the chain order is.
+func (a *CommandAudit) ComputeHash(prevHash string) string {
+	// A struct keeps the field order, and thus the hash, stable.
+	content, _ := json.Marshal(struct {
+		PrevHash   string    `json:"prev_hash"`
+		UserID     uuid.UUID `json:"user_id"`
+		Actor      string    `json:"actor"`
+		RequestID  string    `json:"request_id"`
+		VIN        string    `json:"vin"`
+		Command    string    `json:"command"`
+		Params     string    `json:"params"`
+		Path       string    `json:"path"`
+		Outcome    string    `json:"outcome"`
+		HTTPStatus int       `json:"http_status"`
+		ErrorCode  string    `json:"error_code"`
+		Reason     string    `json:"reason"`
+		LatencyMS  int64     `json:"latency_ms"`
+		CreatedAt  string    `json:"created_at"`
+	}{prevHash, a.UserID, a.Actor, a.RequestID, a.VIN, a.Command, a.Params, a.Path, a.Outcome, a.HTTPStatus,
+		a.ErrorCode, a.Reason, a.LatencyMS, a.CreatedAt.UTC().Format(time.RFC3339Nano)})
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// CommandAuditFilter narrows an audit query; zero values do not filter. Results are ordered newest
+// first and BeforeID pages through them.
+type CommandAuditFilter struct {
+	UserID   uuid.UUID
+	VIN      string
+	From     time.Time
+	To       time.Time
+	BeforeID uint
+	Limit    int
+}
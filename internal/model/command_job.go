@@ -0,0 +1,64 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Statuses of an asynchronous vehicle command, in the order they normally occur.
+// 异步车辆指令的状态，按通常的先后顺序排列。
+const (
+	CommandJobQueued     = "queued"
+	CommandJobWaking     = "waking"
+	CommandJobConnecting = "connecting"
+	CommandJobSent       = "sent"
+	CommandJobSucceeded  = "succeeded"
+	CommandJobFailed     = "failed"
+)
+
+// CommandJob is a vehicle command executed in the background. Reason holds the failure reason or the
+// vehicle's reason for declining; Response is the final response body returned by the command.
+// CommandJob 记录一次后台执行的车辆指令及其最终结果。
+type CommandJob struct {
+	ID      uuid.UUID `gorm:"type:uuid;primaryKey"`
+	UserID  uuid.UUID `gorm:"type:uuid;not null;index"`
+	VIN     string    `gorm:"type:varchar(17);not null;index"`
+	Command string    `gorm:"type:varchar(255);not null"`
+	// BatchID links the jobs queued by one fleet batch request.
+	BatchID *uuid.UUID `gorm:"type:uuid;index"`
+	// Instance is the server instance whose worker pool runs the job.
+	Instance       string    `gorm:"type:varchar(255);not null;default:'';index"`
+	Status         string    `gorm:"type:varchar(16);not null;index"`
+	Reason         string    `gorm:"type:text;not null;default:''"`
+	ErrorCode      string    `gorm:"type:varchar(64);not null;default:''"`
+	ResponseStatus int       `gorm:"not null;default:0"`
+	Response       string    `gorm:"type:text;not null;default:''"`
+	CreatedAt      time.Time `gorm:"autoCreateTime"`
+	UpdatedAt      time.Time `gorm:"autoUpdateTime"`
+	FinishedAt     *time.Time
+	Events         []CommandJobEvent `gorm:"foreignKey:JobID;constraint:OnDelete:CASCADE"`
+}
+
+// Finished reports whether the job reached a terminal status.
+func (j *CommandJob) Finished() bool {
+	return j.Status == CommandJobSucceeded || j.Status == CommandJobFailed
+}
+
+// CommandJobEvent records one status transition of a CommandJob.
+type CommandJobEvent struct {
+	ID        uint      `gorm:"primaryKey:autoIncrement"`
+	JobID     uuid.UUID `gorm:"type:uuid;not null;index"`
+	Status    string    `gorm:"type:varchar(16);not null"`
+	Reason    string    `gorm:"type:text;not null;default:''"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+// CommandJobUpdate describes a status transition; the response fields are only set on completion.
+type CommandJobUpdate struct {
+	Status         string
+	Reason         string
+	ErrorCode      string
+	ResponseStatus int
+	Response       []byte
+}
@@ -0,0 +1,44 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CommandScene is a named sequence of vehicle commands defined by a user, such as "leave for work".
+// By default the scene stops at the first step that fails or is declined.
+// CommandScene 为用户定义的指令场景，按顺序执行多条车辆指令。
+type CommandScene struct {
+	ID     uuid.UUID   `gorm:"type:uuid;primaryKey"`
+	UserID uuid.UUID   `gorm:"type:uuid;not null;uniqueIndex:idx_command_scene_user_name"`
+	Name   string      `gorm:"type:varchar(100);not null;uniqueIndex:idx_command_scene_user_name"`
+	Steps  []SceneStep `gorm:"type:jsonb;serializer:json;not null"`
+	// ContinueOnFailure runs the remaining steps after a failed or declined one.
+	ContinueOnFailure bool      `gorm:"not null;default:false"`
+	CreatedAt         time.Time `gorm:"autoCreateTime"`
+	UpdatedAt         time.Time `gorm:"autoUpdateTime"`
+}
+
+// SceneStep is one command of a scene.
+type SceneStep struct {
+	Command string `json:"command"`
+	// Params is the command body, as for the v1 command route.
+	Params json.RawMessage `json:"params,omitempty"`
+	// DelaySeconds is waited before the step runs.
+	DelaySeconds int `json:"delay_seconds,omitempty"`
+	// Condition skips the step unless the vehicle state matches it.
+	Condition *SceneCondition `json:"condition,omitempty"`
+	// ContinueOnFailure lets the scene go on when this step fails or is declined.
+	ContinueOnFailure bool `json:"continue_on_failure,omitempty"`
+}
+
+// SceneCondition compares a vehicle_data field with a value, e.g. climate_state.outside_temp lt 5.
+type SceneCondition struct {
+	// Field is the path of the field in vehicle_data.
+	Field string `json:"field"`
+	// Op is eq, ne, lt, lte, gt or gte; the ordering operators need numbers.
+	Op    string `json:"op"`
+	Value any    `json:"value"`
+}
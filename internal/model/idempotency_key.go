@@ -0,0 +1,32 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// States of an idempotency key. 幂等键的状态。
+const (
+	IdempotencyProcessing = "processing"
+	IdempotencyCompleted  = "completed"
+)
+
+// IdempotencyKey remembers the first response to a request carrying an Idempotency-Key header so that
+// repeats within the window get the same response instead of executing again. Fingerprint identifies
+// the request the key was first used with. IdempotencyKey 保存幂等键首次请求的响应，供重复请求直接返回。
+type IdempotencyKey struct {
+	ID          uint      `gorm:"primaryKey:autoIncrement"`
+	UserID      uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_idempotency_user_key"`
+	Key         string    `gorm:"type:varchar(255);not null;uniqueIndex:idx_idempotency_user_key"`
+	Fingerprint string    `gorm:"type:char(64);not null"`
+	Status      string    `gorm:"type:varchar(16);not null"`
+	// The stored response; only set once Status is completed.
+	ResponseStatus int    `gorm:"not null;default:0"`
+	ContentType    string `gorm:"type:varchar(255);not null;default:''"`
+	Location       string `gorm:"type:varchar(255);not null;default:''"`
+	Response       []byte `gorm:"type:bytea"`
+	CreatedAt      time.Time
+	// ExpiresAt ends the processing lock while processing and the replay window once completed.
+	ExpiresAt time.Time `gorm:"not null;index"`
+}
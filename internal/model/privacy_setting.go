@@ -0,0 +1,38 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Location modes applied to coordinates returned to clients. 返回给客户端的坐标处理模式。
+const (
+	// LocationModeExact returns coordinates unchanged.
+	LocationModeExact = "exact"
+	// LocationModeCoarse snaps coordinates to the centre of a geohash cell.
+	LocationModeCoarse = "coarse"
+	// LocationModeHidden strips coordinates entirely.
+	LocationModeHidden = "hidden"
+)
+
+// PrivacySetting stores a user's location privacy preferences. An empty VIN holds the user's default;
+// a non-empty VIN overrides it for that vehicle grant.
+// PrivacySetting 保存用户的位置隐私设置，VIN 为空表示默认设置，非空表示针对该车辆授权的覆盖设置。
+type PrivacySetting struct {
+	ID               uint      `gorm:"primaryKey:autoIncrement"`
+	UserID           uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_privacy_user_vin"`
+	VIN              string    `gorm:"type:varchar(17);not null;default:'';uniqueIndex:idx_privacy_user_vin"`
+	LocationMode     string    `gorm:"type:varchar(16);not null;default:'exact'"`
+	GeohashPrecision int       `gorm:"not null;default:5"`
+	HomeLatitude     *float64
+	HomeLongitude    *float64
+	HomeRadiusMeters int       `gorm:"not null;default:0"`
+	CreatedAt        time.Time `gorm:"autoCreateTime"`
+	UpdatedAt        time.Time `gorm:"autoUpdateTime"`
+}
+
+// HasHomeZone reports whether a home zone is configured.
+func (s *PrivacySetting) HasHomeZone() bool {
+	return s != nil && s.HomeLatitude != nil && s.HomeLongitude != nil && s.HomeRadiusMeters > 0
+}
@@ -0,0 +1,19 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// VehicleGroup is a named set of a user's vehicles, such as "delivery vans", that batch commands can
+// target. VehicleGroup 为用户定义的车辆分组，可作为批量指令的目标。
+type VehicleGroup struct {
+	ID     uuid.UUID `gorm:"type:uuid;primaryKey"`
+	UserID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_vehicle_group_user_name"`
+	Name   string    `gorm:"type:varchar(100);not null;uniqueIndex:idx_vehicle_group_user_name"`
+	// VINs lists the members; the tags given by the client are resolved to VINs when the group is saved.
+	VINs      []string  `gorm:"column:vins;type:jsonb;serializer:json;not null"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`
+}
@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"time"
+
+	"tds_server/internal/data"
+	"tds_server/internal/model"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// commandAuditLockKey is the Postgres advisory lock serializing appends to the audit hash chain.
+const commandAuditLockKey = 0x7464735f61756469 // "tds_audi"
+
+type CommandAuditRepo struct {
+	db *gorm.DB
+}
+
+func NewCommandAuditRepo() *CommandAuditRepo {
+	return &CommandAuditRepo{db: data.DB}
+}
+
+// Append links entry to the end of the hash chain and stores it. Appends are serialized across
+// processes by an advisory lock so two entries never share a predecessor.
+// Append 将记录接到哈希链末尾并保存，通过 advisory lock 保证多实例下链不分叉。
+func (repo *CommandAuditRepo) Append(entry *model.CommandAudit) error {
+	return repo.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", commandAuditLockKey).Error; err != nil {
+			return err
+		}
+		var prevHash string
+		err := tx.Model(&model.CommandAudit{}).Order("id DESC").Limit(1).Pluck("hash", &prevHash).Error
+		if err != nil {
+			return err
+		}
+		if entry.CreatedAt.IsZero() {
+			entry.CreatedAt = time.Now()
+		}
+		// Postgres keeps microseconds; hash the value that will be read back.
+		entry.CreatedAt = entry.CreatedAt.UTC().Truncate(time.Microsecond)
+		entry.PrevHash = prevHash
+		entry.Hash = entry.ComputeHash(prevHash)
+		return tx.Create(entry).Error
+	})
+}
+
+// List returns the entries matching filter, newest first. List 按条件查询审计记录，按时间倒序。
+func (repo *CommandAuditRepo) List(filter model.CommandAuditFilter) ([]model.CommandAudit, error) {
+	query := repo.db.Model(&model.CommandAudit{})
+	if filter.UserID != uuid.Nil {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if filter.VIN != "" {
+		query = query.Where("vin = ?", filter.VIN)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("created_at < ?", filter.To)
+	}
+	if filter.BeforeID > 0 {
+		query = query.Where("id < ?", filter.BeforeID)
+	}
+	var entries []model.CommandAudit
+	if err := query.Order("id DESC").Limit(filter.Limit).Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Chain returns up to limit entries after afterID in chain order. Chain 按链顺序分页读取记录。
+func (repo *CommandAuditRepo) Chain(afterID uint, limit int) ([]model.CommandAudit, error) {
+	var entries []model.CommandAudit
+	if err := repo.db.Where("id > ?", afterID).Order("id").Limit(limit).Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"time"
+
+	"tds_server/internal/data"
+	"tds_server/internal/model"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type CommandJobRepo struct {
+	db *gorm.DB
+}
+
+func NewCommandJobRepo() *CommandJobRepo {
+	return &CommandJobRepo{db: data.DB}
+}
+
+// Create stores a new job together with its initial status event. Create 保存新任务及其初始状态记录。
+func (repo *CommandJobRepo) Create(job *model.CommandJob) error {
+	return repo.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Events").Create(job).Error; err != nil {
+			return err
+		}
+		return tx.Create(&model.CommandJobEvent{JobID: job.ID, Status: job.Status, Reason: job.Reason}).Error
+	})
+}
+
+// Transition moves an unfinished job to a new status and records the event; terminal statuses also
+// store the response and the finish time. A job that already finished is left unchanged, so a late
+// update never overwrites its outcome. Transition 更新未结束任务的状态并追加状态变更记录。
+func (repo *CommandJobRepo) Transition(id uuid.UUID, update model.CommandJobUpdate) error {
+	return repo.db.Transaction(func(tx *gorm.DB) error {
+		_, err := transitionJob(tx, id, update)
+		return err
+	})
+}
+
+// transitionJob applies update within tx and reports whether the job was still unfinished.
+func transitionJob(tx *gorm.DB, id uuid.UUID, update model.CommandJobUpdate) (bool, error) {
+	columns := map[string]any{"status": update.Status, "reason": update.Reason, "error_code": update.ErrorCode}
+	if update.Status == model.CommandJobSucceeded || update.Status == model.CommandJobFailed {
+		columns["response_status"] = update.ResponseStatus
+		columns["response"] = string(update.Response)
+		columns["finished_at"] = time.Now()
+	}
+	result := tx.Model(&model.CommandJob{}).
+		Where("id = ? AND status NOT IN ?", id, finishedJobStatuses).
+		Updates(columns)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+	return true, tx.Create(&model.CommandJobEvent{JobID: id, Status: update.Status, Reason: update.Reason}).Error
+}
+
+// finishedJobStatuses are the terminal job statuses.
+var finishedJobStatuses = []string{model.CommandJobSucceeded, model.CommandJobFailed}
+
+// Get returns the user's job with its status history, or gorm.ErrRecordNotFound. Get 返回用户的任务及状态历史。
+func (repo *CommandJobRepo) Get(userID, id uuid.UUID) (*model.CommandJob, error) {
+	var job model.CommandJob
+	err := repo.db.Preload("Events", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Where("id = ? AND user_id = ?", id, userID).First(&job).Error
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// ListBatch returns the user's jobs queued by one batch request, in creation order, without their
+// status history. ListBatch 返回同一批量请求创建的任务。
+func (repo *CommandJobRepo) ListBatch(userID, batchID uuid.UUID) ([]model.CommandJob, error) {
+	var jobs []model.CommandJob
+	err := repo.db.Where("batch_id = ? AND user_id = ?", batchID, userID).Order("created_at, id").Find(&jobs).Error
+	return jobs, err
+}
+
+// FailUnfinished marks jobs left unfinished by a previous process of this instance as failed, since
+// their workers are gone. Jobs of other instances are still running there and are left alone; jobs
+// stored without an instance predate its recording and are failed by the first instance to start.
+// FailUnfinished 将本实例上次进程遗留的未完成任务标记为失败。
+func (repo *CommandJobRepo) FailUnfinished(instance, reason string) (int64, error) {
+	var failed int64
+	err := repo.db.Transaction(func(tx *gorm.DB) error {
+		var ids []uuid.UUID
+		err := tx.Model(&model.CommandJob{}).
+			Where("status NOT IN ? AND instance IN ?", finishedJobStatuses, []string{instance, ""}).
+			Pluck("id", &ids).Error
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			applied, err := transitionJob(tx, id, model.CommandJobUpdate{Status: model.CommandJobFailed, Reason: reason})
+			if err != nil {
+				return err
+			}
+			if applied {
+				failed++
+			}
+		}
+		return nil
+	})
+	return failed, err
+}
@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"tds_server/internal/data"
+	"tds_server/internal/model"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type CommandSceneRepo struct {
+	db *gorm.DB
+}
+
+func NewCommandSceneRepo() *CommandSceneRepo {
+	return &CommandSceneRepo{db: data.DB}
+}
+
+// List returns the user's scenes ordered by name. List 返回用户的全部指令场景。
+func (repo *CommandSceneRepo) List(userID uuid.UUID) ([]model.CommandScene, error) {
+	var scenes []model.CommandScene
+	if err := repo.db.Where("user_id = ?", userID).Order("name").Find(&scenes).Error; err != nil {
+		return nil, err
+	}
+	return scenes, nil
+}
+
+// Get returns the user's scene, or gorm.ErrRecordNotFound. Get 返回用户的指定场景。
+func (repo *CommandSceneRepo) Get(userID, id uuid.UUID) (*model.CommandScene, error) {
+	var scene model.CommandScene
+	if err := repo.db.Where("id = ? AND user_id = ?", id, userID).First(&scene).Error; err != nil {
+		return nil, err
+	}
+	return &scene, nil
+}
+
+// Save creates the scene, or replaces its name, steps and options when it already exists.
+// Save 创建或更新指令场景。
+func (repo *CommandSceneRepo) Save(scene *model.CommandScene) error {
+	return repo.db.Save(scene).Error
+}
+
+// Delete removes the user's scene, or returns gorm.ErrRecordNotFound. Delete 删除指定场景。
+func (repo *CommandSceneRepo) Delete(userID, id uuid.UUID) error {
+	result := repo.db.Where("id = ? AND user_id = ?", id, userID).Delete(&model.CommandScene{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
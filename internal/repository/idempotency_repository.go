@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"time"
+
+	"tds_server/internal/data"
+	"tds_server/internal/model"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type IdempotencyRepo struct {
+	db *gorm.DB
+}
+
+func NewIdempotencyRepo() *IdempotencyRepo {
+	return &IdempotencyRepo{db: data.DB}
+}
+
+// Acquire stores record as processing unless an unexpired record with the same (user_id, key)
+// exists, in which case that record is returned and nothing is written. Expired records are
+// replaced. Acquire 占用幂等键；已存在且未过期时返回已有记录。
+func (repo *IdempotencyRepo) Acquire(record *model.IdempotencyKey) (*model.IdempotencyKey, error) {
+	var existing *model.IdempotencyKey
+	err := repo.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+		if result.Error != nil || result.RowsAffected == 1 {
+			return result.Error
+		}
+
+		var current model.IdempotencyKey
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ? AND key = ?", record.UserID, record.Key).First(&current).Error
+		if err != nil {
+			return err
+		}
+		if current.ExpiresAt.After(time.Now()) {
+			existing = &current
+			return nil
+		}
+		record.ID = current.ID
+		return tx.Select("*").Omit("created_at").Save(record).Error
+	})
+	return existing, err
+}
+
+// Complete stores the response of a processing key and keeps it until expiresAt.
+func (repo *IdempotencyRepo) Complete(userID uuid.UUID, key string, response model.IdempotencyKey, expiresAt time.Time) error {
+	return repo.db.Model(&model.IdempotencyKey{}).
+		Where("user_id = ? AND key = ? AND status = ?", userID, key, model.IdempotencyProcessing).
+		Updates(map[string]any{
+			"status":          model.IdempotencyCompleted,
+			"response_status": response.ResponseStatus,
+			"content_type":    response.ContentType,
+			"location":        response.Location,
+			"response":        response.Response,
+			"expires_at":      expiresAt,
+		}).Error
+}
+
+// Release forgets a processing key so the request can be retried with it.
+func (repo *IdempotencyRepo) Release(userID uuid.UUID, key string) error {
+	return repo.db.Where("user_id = ? AND key = ? AND status = ?", userID, key, model.IdempotencyProcessing).
+		Delete(&model.IdempotencyKey{}).Error
+}
+
+// DeleteExpired removes keys whose window has passed. DeleteExpired 清理已过期的幂等键。
+func (repo *IdempotencyRepo) DeleteExpired() (int64, error) {
+	result := repo.db.Where("expires_at < ?", time.Now()).Delete(&model.IdempotencyKey{})
+	return result.RowsAffected, result.Error
+}
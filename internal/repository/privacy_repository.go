@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"errors"
+	"tds_server/internal/data"
+	"tds_server/internal/model"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type PrivacyRepo struct {
+	db *gorm.DB
+}
+
+func NewPrivacyRepo() *PrivacyRepo {
+	return &PrivacyRepo{db: data.DB}
+}
+
+// Save creates or updates the setting identified by (user_id, vin). Save 会按 (user_id, vin) 创建或更新隐私设置。
+func (repo *PrivacyRepo) Save(setting *model.PrivacySetting) error {
+	return repo.db.Clauses(
+		clause.OnConflict{
+			Columns: []clause.Column{{Name: "user_id"}, {Name: "vin"}},
+			DoUpdates: clause.AssignmentColumns([]string{
+				"location_mode", "geohash_precision", "home_latitude", "home_longitude", "home_radius_meters", "updated_at",
+			}),
+		},
+	).Create(setting).Error
+}
+
+// ListByUserID returns the default and per-vehicle settings of a user. ListByUserID 返回用户的默认与按车辆设置。
+func (repo *PrivacyRepo) ListByUserID(userID uuid.UUID) ([]model.PrivacySetting, error) {
+	var settings []model.PrivacySetting
+	if err := repo.db.Where("user_id = ?", userID).Order("vin").Find(&settings).Error; err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// GetEffective returns the vehicle override when present, otherwise the user default, or nil when the
+// user has not configured privacy. GetEffective 优先返回车辆覆盖设置，其次为默认设置，均无时返回 nil。
+func (repo *PrivacyRepo) GetEffective(userID uuid.UUID, vin string) (*model.PrivacySetting, error) {
+	var settings []model.PrivacySetting
+	err := repo.db.Where("user_id = ? AND vin IN ?", userID, []string{"", vin}).Find(&settings).Error
+	if err != nil {
+		return nil, err
+	}
+	var effective *model.PrivacySetting
+	for i := range settings {
+		if settings[i].VIN == vin && vin != "" {
+			return &settings[i], nil
+		}
+		effective = &settings[i]
+	}
+	return effective, nil
+}
+
+// Delete removes the setting identified by (user_id, vin). Delete 删除指定的隐私设置。
+func (repo *PrivacyRepo) Delete(userID uuid.UUID, vin string) error {
+	result := repo.db.Where("user_id = ? AND vin = ?", userID, vin).Delete(&model.PrivacySetting{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// IsNotFound reports whether err means the record does not exist.
+func IsNotFound(err error) bool {
+	return errors.Is(err, gorm.ErrRecordNotFound)
+}
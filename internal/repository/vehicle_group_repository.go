@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"tds_server/internal/data"
+	"tds_server/internal/model"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type VehicleGroupRepo struct {
+	db *gorm.DB
+}
+
+func NewVehicleGroupRepo() *VehicleGroupRepo {
+	return &VehicleGroupRepo{db: data.DB}
+}
+
+// List returns the user's vehicle groups ordered by name. List 返回用户的全部车辆分组。
+func (repo *VehicleGroupRepo) List(userID uuid.UUID) ([]model.VehicleGroup, error) {
+	var groups []model.VehicleGroup
+	if err := repo.db.Where("user_id = ?", userID).Order("name").Find(&groups).Error; err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// Get returns the user's vehicle group, or gorm.ErrRecordNotFound. Get 返回用户的指定车辆分组。
+func (repo *VehicleGroupRepo) Get(userID, id uuid.UUID) (*model.VehicleGroup, error) {
+	var group model.VehicleGroup
+	if err := repo.db.Where("id = ? AND user_id = ?", id, userID).First(&group).Error; err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// Save creates the group, or replaces its name and members when it already exists.
+// Save 创建或更新车辆分组。
+func (repo *VehicleGroupRepo) Save(group *model.VehicleGroup) error {
+	return repo.db.Save(group).Error
+}
+
+// Delete removes the user's vehicle group, or returns gorm.ErrRecordNotFound. Delete 删除指定车辆分组。
+func (repo *VehicleGroupRepo) Delete(userID, id uuid.UUID) error {
+	result := repo.db.Where("id = ? AND user_id = ?", id, userID).Delete(&model.VehicleGroup{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
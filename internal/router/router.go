@@ -4,17 +4,28 @@ import (
 	"net/http"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"tds_server/internal/apierror"
 	"tds_server/internal/config"
 	"tds_server/internal/handler"
 	"tds_server/internal/middleware"
 	"tds_server/internal/repository"
 	"tds_server/internal/service"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-func NewRouter(cfg *config.Config, tokenRepo *repository.TokenRepo, partnerSvc *service.PartnerTokenService, commandSvc *service.VehicleCommandService) *gin.Engine {
+func NewRouter(cfg *config.Config, tokenRepo *repository.TokenRepo, partnerSvc *service.PartnerTokenService, commandSvc *service.VehicleCommandService, vehicleDirectory *service.VehicleDirectory, privacyRepo *repository.PrivacyRepo, commandJobs *service.CommandJobService, commandAudit *service.CommandAuditService, idempotency *service.IdempotencyService, commandScenes *service.CommandSceneService, vehicleGroups *service.VehicleGroupService, energySites *service.EnergySiteDirectory) *gin.Engine {
 	r := gin.New()
+	r.Use(middleware.RequestID(), middleware.AccessLog(), middleware.Recovery())
+	r.HandleMethodNotAllowed = true
+	r.NoRoute(func(c *gin.Context) {
+		apierror.Write(c, apierror.New(http.StatusNotFound, apierror.CodeNotFound, "route not found"))
+	})
+	r.NoMethod(func(c *gin.Context) {
+		apierror.Write(c, apierror.New(http.StatusMethodNotAllowed, apierror.CodeMethodNotAllowed, "method not allowed"))
+	})
 	r.GET("/", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"message": "ping"})
 	})
@@ -36,16 +47,138 @@ func NewRouter(cfg *config.Config, tokenRepo *repository.TokenRepo, partnerSvc *
 
 		protected := api.Group("/")
 		protected.Use(middleware.JWTAuth(cfg))
-		protected.GET("/1/vehicles", handler.ListVehicles(cfg, tokenRepo))
-		protected.GET("/1/vehicles/:vehicle_tag", handler.GetVehicle(cfg, tokenRepo))
-		protected.GET("/1/vehicles/:vehicle_tag/vehicle_data", handler.GetVehicleData(cfg, tokenRepo))
-		protected.POST("/1/vehicles/:vehicle_tag/wake_up", handler.WakeVehicle(cfg, tokenRepo))
-		protected.GET("/1/vehicles/:vehicle_tag/drivers", handler.GetVehicleDrivers(cfg, tokenRepo))
-		protected.POST("/vehicles/:vehicle_tag/command/*command_path", handler.VehicleCommand(cfg, tokenRepo, commandSvc))
+		protected.GET("/1/vehicles", handler.ListVehicles(cfg, tokenRepo, vehicleDirectory))
+		protected.GET("/1/vehicles/:vehicle_tag", handler.GetVehicle(cfg, tokenRepo, vehicleDirectory))
+		protected.GET("/1/vehicles/:vehicle_tag/vehicle_data", handler.GetVehicleData(cfg, tokenRepo, vehicleDirectory, privacyRepo))
+		protected.POST("/1/vehicles/:vehicle_tag/wake_up", handler.WakeVehicle(cfg, tokenRepo, vehicleDirectory))
+		protected.GET("/1/vehicles/:vehicle_tag/drivers", handler.GetVehicleDrivers(cfg, tokenRepo, vehicleDirectory))
+		protected.GET("/1/vehicles/:vehicle_tag/nearby_charging_sites", handler.GetNearbyChargingSites(cfg, tokenRepo, vehicleDirectory, privacyRepo))
+		protected.GET("/1/vehicles/:vehicle_tag/service_data", handler.GetServiceData(cfg, tokenRepo, vehicleDirectory))
+		protected.GET("/1/vehicles/:vehicle_tag/recent_alerts", handler.GetRecentAlerts(cfg, tokenRepo, vehicleDirectory))
+		protected.GET("/1/vehicles/:vehicle_tag/release_notes", handler.GetReleaseNotes(cfg, tokenRepo, vehicleDirectory))
+		protected.GET("/1/vehicles/:vehicle_tag/mobile_enabled", handler.GetMobileEnabled(cfg, tokenRepo, vehicleDirectory))
+		protected.GET("/1/vehicles/:vehicle_tag/specs", handler.GetVehicleSpecs(cfg, tokenRepo, vehicleDirectory))
+		protected.GET("/1/vehicles/:vehicle_tag/options", handler.GetVehicleOptions(cfg, tokenRepo, vehicleDirectory))
+		protected.GET("/1/vehicles/:vehicle_tag/warranty_details", handler.GetWarrantyDetails(cfg, tokenRepo, vehicleDirectory))
+		protected.POST("/1/vehicles/fleet_status", handler.GetFleetStatus(cfg, tokenRepo, vehicleDirectory))
+		protected.GET("/1/products", handler.ListProducts(cfg, tokenRepo, vehicleDirectory, energySites))
+		protected.GET("/1/dx/charging/history", handler.GetChargingHistory(cfg, tokenRepo, vehicleDirectory, privacyRepo))
+		protected.GET("/1/dx/charging/sessions", handler.GetChargingSessions(cfg, tokenRepo, vehicleDirectory, privacyRepo))
+		protected.GET("/1/dx/charging/invoice/:invoice_id", handler.GetChargingInvoice(cfg, tokenRepo, vehicleDirectory))
+		protected.GET("/1/energy_sites/:energy_site_id/site_info", handler.GetEnergySiteInfo(cfg, tokenRepo, vehicleDirectory, energySites))
+		protected.GET("/1/energy_sites/:energy_site_id/live_status", handler.GetEnergyLiveStatus(cfg, tokenRepo, vehicleDirectory, energySites))
+		protected.GET("/1/energy_sites/:energy_site_id/calendar_history", handler.GetEnergyCalendarHistory(cfg, tokenRepo, vehicleDirectory, energySites))
+		protected.GET("/1/energy_sites/:energy_site_id/telemetry_history", handler.GetEnergyTelemetryHistory(cfg, tokenRepo, vehicleDirectory, energySites))
+		protected.GET("/privacy", handler.GetPrivacySettings(privacyRepo))
+		protected.PUT("/privacy", handler.PutPrivacySettings(privacyRepo))
+		protected.PUT("/vehicles/:vehicle_tag/privacy", handler.PutVehiclePrivacySettings(cfg, tokenRepo, vehicleDirectory, privacyRepo))
+		protected.DELETE("/vehicles/:vehicle_tag/privacy", handler.DeleteVehiclePrivacySettings(cfg, tokenRepo, vehicleDirectory, privacyRepo))
+		protected.GET("/vehicles/commands", handler.ListVehicleCommands())
+		protected.POST("/vehicles/:vehicle_tag/command/*command_path",
+			middleware.Deprecated(v1CommandDeprecatedAt, cfg.V1CommandSunset, v1CommandSuccessor),
+			middleware.Idempotency(idempotency),
+			handler.VehicleCommand(cfg, tokenRepo, commandSvc, vehicleDirectory, commandJobs, commandAudit))
+		protected.GET("/commands/:command_id", handler.GetCommandJob(commandJobs))
+		protected.GET("/commands/:command_id/events", handler.StreamCommandJob(commandJobs))
+		protected.GET("/audit/commands", handler.ListCommandAudits(cfg, commandAudit))
+		protected.GET("/audit/commands/verify", handler.VerifyCommandAudit(cfg, commandAudit))
+		protected.POST("/energy_sites/:energy_site_id/command/:command",
+			middleware.Idempotency(idempotency),
+			handler.EnergyCommand(cfg, tokenRepo, vehicleDirectory, energySites, commandAudit))
+	}
+
+	// v2 exposes typed, resource-oriented command endpoints on top of the same command pipeline.
+	// v2 以资源风格的强类型接口封装车辆指令。
+	v2 := r.Group("/api/v2")
+	v2.Use(middleware.JWTAuth(cfg))
+	{
+		vehicle := v2.Group("/vehicles/:vehicle_tag")
+		vehicle.Use(middleware.Idempotency(idempotency))
+		action := func(command string, params map[string]any) gin.HandlerFunc {
+			return handler.V2Action(cfg, tokenRepo, commandSvc, vehicleDirectory, commandJobs, commandAudit, command, params)
+		}
+		vehicle.POST("/wake", action("wake_up", nil))
+		vehicle.PUT("/charge/limit", handler.SetChargeLimitV2(cfg, tokenRepo, commandSvc, vehicleDirectory, commandJobs, commandAudit))
+		vehicle.PUT("/charge/amps", handler.SetChargingAmpsV2(cfg, tokenRepo, commandSvc, vehicleDirectory, commandJobs, commandAudit))
+		vehicle.POST("/charge/start", action("charge_start", nil))
+		vehicle.POST("/charge/stop", action("charge_stop", nil))
+		vehicle.POST("/charge_port/open", action("charge_port_door_open", nil))
+		vehicle.POST("/charge_port/close", action("charge_port_door_close", nil))
+		vehicle.PUT("/climate", handler.UpdateClimateV2(cfg, tokenRepo, commandSvc, vehicleDirectory, commandJobs, commandAudit))
+		vehicle.PUT("/climate/seats/:seat/heater", handler.SetSeatHeaterV2(cfg, tokenRepo, commandSvc, vehicleDirectory, commandJobs, commandAudit))
+		vehicle.PUT("/climate/steering_wheel_heater", handler.SetSteeringWheelHeaterV2(cfg, tokenRepo, commandSvc, vehicleDirectory, commandJobs, commandAudit))
+		vehicle.POST("/doors/lock", action("door_lock", nil))
+		vehicle.POST("/doors/unlock", action("door_unlock", nil))
+		vehicle.POST("/trunks/:which/actuate", handler.ActuateTrunkV2(cfg, tokenRepo, commandSvc, vehicleDirectory, commandJobs, commandAudit))
+		vehicle.POST("/windows/vent", action("window_control", map[string]any{"command": "vent"}))
+		vehicle.POST("/windows/close", action("window_control", map[string]any{"command": "close"}))
+		vehicle.POST("/lights/flash", action("flash_lights", nil))
+		vehicle.POST("/horn/honk", action("honk_horn", nil))
+		vehicle.PUT("/sentry_mode", handler.SetSentryModeV2(cfg, tokenRepo, commandSvc, vehicleDirectory, commandJobs, commandAudit))
+		vehicle.PUT("/valet_mode", handler.SetValetModeV2(cfg, tokenRepo, commandSvc, vehicleDirectory, commandJobs, commandAudit))
+		vehicle.PUT("/media/volume", handler.SetVolumeV2(cfg, tokenRepo, commandSvc, vehicleDirectory, commandJobs, commandAudit))
+		vehicle.POST("/media/toggle_playback", action("media_toggle_playback", nil))
+		vehicle.PUT("/name", handler.RenameVehicleV2(cfg, tokenRepo, commandSvc, vehicleDirectory, commandJobs, commandAudit))
+
+		vehicle.POST("/scenes/:scene_id/run", handler.RunCommandScene(cfg, tokenRepo, commandSvc, vehicleDirectory, commandJobs, commandAudit, commandScenes, privacyRepo))
+
+		v2.POST("/command_batches", middleware.Idempotency(idempotency), handler.RunCommandBatch(cfg, tokenRepo, commandSvc, vehicleDirectory, commandJobs, commandAudit, vehicleGroups))
+		v2.GET("/command_batches/:batch_id", handler.GetCommandBatch(commandJobs))
+
+		v2.GET("/scenes", handler.ListCommandScenes(commandScenes))
+		v2.POST("/scenes", handler.CreateCommandScene(commandScenes))
+		v2.GET("/scenes/:scene_id", handler.GetCommandScene(commandScenes))
+		v2.PUT("/scenes/:scene_id", handler.UpdateCommandScene(commandScenes))
+		v2.DELETE("/scenes/:scene_id", handler.DeleteCommandScene(commandScenes))
+
+		v2.GET("/vehicle_groups", handler.ListVehicleGroups(vehicleGroups))
+		v2.POST("/vehicle_groups", handler.CreateVehicleGroup(cfg, tokenRepo, vehicleDirectory, vehicleGroups))
+		v2.GET("/vehicle_groups/:group_id", handler.GetVehicleGroup(vehicleGroups))
+		v2.PUT("/vehicle_groups/:group_id", handler.UpdateVehicleGroup(cfg, tokenRepo, vehicleDirectory, vehicleGroups))
+		v2.DELETE("/vehicle_groups/:group_id", handler.DeleteVehicleGroup(vehicleGroups))
 	}
 	return r
 }
 
+// v1CommandDeprecatedAt is announced in the Deprecation header of the generic v1 command route.
+var v1CommandDeprecatedAt = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+
+// v1CommandSuccessors maps v1 commands to the v2 route, below /api/v2/vehicles/:vehicle_tag, that
+// replaces them. Commands whose v2 route depends on their parameters (seat heaters, trunks, windows)
+// or that have none are left out.
+var v1CommandSuccessors = map[string]string{
+	"wake_up":                              "wake",
+	"set_charge_limit":                     "charge/limit",
+	"set_charging_amps":                    "charge/amps",
+	"charge_start":                         "charge/start",
+	"charge_stop":                          "charge/stop",
+	"charge_port_door_open":                "charge_port/open",
+	"charge_port_door_close":               "charge_port/close",
+	"set_temps":                            "climate",
+	"auto_conditioning_start":              "climate",
+	"auto_conditioning_stop":               "climate",
+	"remote_steering_wheel_heater_request": "climate/steering_wheel_heater",
+	"door_lock":                            "doors/lock",
+	"door_unlock":                          "doors/unlock",
+	"flash_lights":                         "lights/flash",
+	"honk_horn":                            "horn/honk",
+	"set_sentry_mode":                      "sentry_mode",
+	"set_valet_mode":                       "valet_mode",
+	"adjust_volume":                        "media/volume",
+	"media_toggle_playback":                "media/toggle_playback",
+	"set_vehicle_name":                     "name",
+}
+
+// v1CommandSuccessor returns the v2 route replacing the command of a v1 command request, or "" when
+// there is none.
+func v1CommandSuccessor(c *gin.Context) string {
+	command, _, _ := strings.Cut(strings.Trim(c.Param("command_path"), "/"), "/")
+	if route, ok := v1CommandSuccessors[command]; ok {
+		return "/api/v2/vehicles/:vehicle_tag/" + route
+	}
+	return ""
+}
+
 func publicKeyFilePath() string {
 	_, filename, _, ok := runtime.Caller(0)
 	if !ok {
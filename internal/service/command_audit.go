@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"tds_server/internal/logging"
+	"tds_server/internal/model"
+)
+
+const (
+	// DefaultCommandAuditLimit and MaxCommandAuditLimit bound one page of audit entries.
+	DefaultCommandAuditLimit = 50
+	MaxCommandAuditLimit     = 500
+	// commandAuditVerifyBatch is the number of entries read at a time while verifying the chain.
+	commandAuditVerifyBatch = 1000
+)
+
+var auditLog = logging.Logger(logging.SubsystemCommand)
+
+// CommandAuditStore persists the audit chain; repository.CommandAuditRepo implements it.
+type CommandAuditStore interface {
+	// Append sets PrevHash and Hash on entry and stores it at the end of the chain.
+	Append(entry *model.CommandAudit) error
+	List(filter model.CommandAuditFilter) ([]model.CommandAudit, error)
+	// Chain returns up to limit entries after afterID, in chain order.
+	Chain(afterID uint, limit int) ([]model.CommandAudit, error)
+}
+
+// CommandAuditVerification is the result of walking the audit chain.
+type CommandAuditVerification struct {
+	Valid bool `json:"valid"`
+	// Checked is the number of entries verified, up to and including the broken one.
+	Checked int `json:"checked"`
+	// BrokenID is the first entry whose hash or link does not match; zero when the chain is valid.
+	BrokenID uint `json:"broken_id,omitempty"`
+	// LastHash is the hash of the last entry checked; an external copy of it pins the chain so far.
+	LastHash string `json:"last_hash,omitempty"`
+}
+
+// CommandAuditService records every vehicle command attempt in a tamper-evident log.
+// CommandAuditService 记录每一次车辆指令调用，并支持校验哈希链完整性。
+type CommandAuditService struct {
+	store CommandAuditStore
+}
+
+func NewCommandAuditService(store CommandAuditStore) *CommandAuditService {
+	return &CommandAuditService{store: store}
+}
+
+// Record appends entry to the audit log. The command has already been attempted, so a failure to
+// record is logged rather than returned to the caller.
+func (s *CommandAuditService) Record(ctx context.Context, entry *model.CommandAudit) {
+	if s == nil {
+		return
+	}
+	entry.Params = string(logging.RedactJSON([]byte(entry.Params)))
+	if err := s.store.Append(entry); err != nil {
+		auditLog.ErrorContext(ctx, "record command audit failed", "command", entry.Command, "vin", entry.VIN, "error", err)
+	}
+}
+
+// List returns the entries matching filter, newest first, applying the default and maximum page size.
+func (s *CommandAuditService) List(filter model.CommandAuditFilter) ([]model.CommandAudit, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultCommandAuditLimit
+	}
+	filter.Limit = min(filter.Limit, MaxCommandAuditLimit)
+	return s.store.List(filter)
+}
+
+// Verify recomputes every hash of the chain and stops at the first entry that does not match.
+// Verify 重新计算整条哈希链，返回第一条不一致的记录。
+func (s *CommandAuditService) Verify(ctx context.Context) (CommandAuditVerification, error) {
+	var result CommandAuditVerification
+	var afterID uint
+	for {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		entries, err := s.store.Chain(afterID, commandAuditVerifyBatch)
+		if err != nil {
+			return result, fmt.Errorf("read audit chain: %w", err)
+		}
+		for _, entry := range entries {
+			result.Checked++
+			if entry.PrevHash != result.LastHash || entry.ComputeHash(entry.PrevHash) != entry.Hash {
+				result.BrokenID = entry.ID
+				return result, nil
+			}
+			result.LastHash = entry.Hash
+			afterID = entry.ID
+		}
+		if len(entries) < commandAuditVerifyBatch {
+			result.Valid = true
+			return result, nil
+		}
+	}
+}
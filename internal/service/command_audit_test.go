@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"tds_server/internal/model"
+
+	"github.com/google/uuid"
+)
+
+// memoryAuditStore keeps the audit chain in memory.
+type memoryAuditStore struct {
+	entries []model.CommandAudit
+}
+
+func (s *memoryAuditStore) Append(entry *model.CommandAudit) error {
+	if n := len(s.entries); n > 0 {
+		entry.PrevHash = s.entries[n-1].Hash
+	}
+	entry.ID = uint(len(s.entries) + 1)
+	entry.Hash = entry.ComputeHash(entry.PrevHash)
+	s.entries = append(s.entries, *entry)
+	return nil
+}
+
+func (s *memoryAuditStore) List(filter model.CommandAuditFilter) ([]model.CommandAudit, error) {
+	var entries []model.CommandAudit
+	for i := len(s.entries) - 1; i >= 0 && len(entries) < filter.Limit; i-- {
+		if filter.VIN == "" || s.entries[i].VIN == filter.VIN {
+			entries = append(entries, s.entries[i])
+		}
+	}
+	return entries, nil
+}
+
+func (s *memoryAuditStore) Chain(afterID uint, limit int) ([]model.CommandAudit, error) {
+	start := min(int(afterID), len(s.entries))
+	return s.entries[start:min(start+limit, len(s.entries))], nil
+}
+
+func TestCommandAuditChain(t *testing.T) {
+	store := &memoryAuditStore{}
+	audit := NewCommandAuditService(store)
+	user := uuid.New()
+	for _, command := range []string{"door_unlock", "speed_limit_activate", "door_lock"} {
+		audit.Record(context.Background(), &model.CommandAudit{
+			UserID: user, Actor: user.String(), VIN: "5YJ3E1EA7KF123456", Command: command,
+			Params: `{"pin":"1234"}`, Path: CommandPathSDK, Outcome: model.CommandAuditSucceeded,
+		})
+	}
+	if strings.Contains(store.entries[1].Params, "1234") {
+		t.Fatalf("params must be redacted: %s", store.entries[1].Params)
+	}
+	if entries, _ := audit.List(model.CommandAuditFilter{}); len(entries) != 3 || entries[0].Command != "door_lock" {
+		t.Fatalf("List = %+v", entries)
+	}
+
+	result, err := audit.Verify(context.Background())
+	if err != nil || !result.Valid || result.Checked != 3 || result.LastHash != store.entries[2].Hash {
+		t.Fatalf("Verify = %+v, %v", result, err)
+	}
+
+	store.entries[1].Outcome = model.CommandAuditDeclined
+	result, err = audit.Verify(context.Background())
+	if err != nil || result.Valid || result.BrokenID != 2 {
+		t.Fatalf("tampered entry: Verify = %+v, %v", result, err)
+	}
+
+	// Rehashing the edited entry still breaks the link to its successor.
+	store.entries[1].Hash = store.entries[1].ComputeHash(store.entries[1].PrevHash)
+	if result, _ = audit.Verify(context.Background()); result.Valid || result.BrokenID != 3 {
+		t.Fatalf("rehashed entry: Verify = %+v", result)
+	}
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"tds_server/internal/model"
+)
+
+const (
+	// DefaultCommandBatchConcurrency is the number of vehicles a synchronous batch commands at once.
+	DefaultCommandBatchConcurrency = 4
+	// MaxCommandBatchSize bounds the vehicles of one batch.
+	MaxCommandBatchSize = 100
+)
+
+// Outcomes of one vehicle in a command batch. 批量指令中单辆车的执行结果。
+const (
+	CommandBatchSucceeded = "succeeded"
+	// CommandBatchDeclined means the vehicle received the command but refused it (result false).
+	CommandBatchDeclined = "declined"
+	CommandBatchFailed   = "failed"
+	// CommandBatchPending is an asynchronous job that has not finished yet.
+	CommandBatchPending = "pending"
+)
+
+// CommandBatchItem is the outcome of a batch command for one vehicle.
+type CommandBatchItem struct {
+	// Vehicle is the tag as requested; VIN is set once it was resolved.
+	Vehicle string `json:"vehicle"`
+	VIN     string `json:"vin,omitempty"`
+	Status  string `json:"status"`
+	// Reason explains a failure, including the vehicle's reason when it declined the command.
+	Reason    string `json:"reason,omitempty"`
+	ErrorCode string `json:"error_code,omitempty"`
+	// Response is the body the command returned for this vehicle.
+	Response     json.RawMessage      `json:"response,omitempty"`
+	Verification *CommandVerification `json:"verification,omitempty"`
+	// JobID and StatusURL identify the asynchronous job of the vehicle.
+	JobID     string `json:"job_id,omitempty"`
+	StatusURL string `json:"status_url,omitempty"`
+}
+
+// CommandBatchSummary counts the vehicles of a batch by outcome.
+type CommandBatchSummary struct {
+	Total     int `json:"total"`
+	Succeeded int `json:"succeeded"`
+	Declined  int `json:"declined"`
+	Failed    int `json:"failed"`
+	Pending   int `json:"pending"`
+}
+
+// SummarizeCommandBatch counts items by status.
+func SummarizeCommandBatch(items []CommandBatchItem) CommandBatchSummary {
+	summary := CommandBatchSummary{Total: len(items)}
+	for _, item := range items {
+		switch item.Status {
+		case CommandBatchSucceeded:
+			summary.Succeeded++
+		case CommandBatchDeclined:
+			summary.Declined++
+		case CommandBatchPending:
+			summary.Pending++
+		default:
+			summary.Failed++
+		}
+	}
+	return summary
+}
+
+// RunCommandBatch calls run for every vehicle with at most concurrency calls in flight and returns
+// the items in the order of vehicles. Vehicles not started before ctx ends are reported as failed.
+// Commands to the same VIN are still serialized by VehicleCommandService.
+// RunCommandBatch 以有限并发对多辆车执行同一指令，结果顺序与请求一致。
+func RunCommandBatch(ctx context.Context, vehicles []string, concurrency int, run func(vehicle string) CommandBatchItem) []CommandBatchItem {
+	if concurrency <= 0 {
+		concurrency = DefaultCommandBatchConcurrency
+	}
+	items := make([]CommandBatchItem, len(vehicles))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for i, vehicle := range vehicles {
+		// select picks at random when both cases are ready, so check for the end of the request first.
+		if err := ctx.Err(); err != nil {
+			items[i] = CommandBatchItem{Vehicle: vehicle, Status: CommandBatchFailed, Reason: err.Error()}
+			continue
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			items[i] = CommandBatchItem{Vehicle: vehicle, Status: CommandBatchFailed, Reason: ctx.Err().Error()}
+			continue
+		}
+		wg.Add(1)
+		go func(i int, vehicle string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			items[i] = run(vehicle)
+		}(i, vehicle)
+	}
+	wg.Wait()
+	return items
+}
+
+// CommandBatchJobItem reports an asynchronous job of a batch as a batch item.
+func CommandBatchJobItem(job *model.CommandJob) CommandBatchItem {
+	item := CommandBatchItem{VIN: job.VIN, Vehicle: job.VIN, Status: CommandBatchPending, Reason: job.Reason,
+		ErrorCode: job.ErrorCode, JobID: job.ID.String()}
+	switch job.Status {
+	case model.CommandJobSucceeded:
+		item.Status = CommandBatchSucceeded
+	case model.CommandJobFailed:
+		item.Status = CommandBatchFailed
+		// Declined jobs keep the vehicle's response but carry no error code.
+		if job.ErrorCode == "" && job.ResponseStatus != 0 {
+			item.Status = CommandBatchDeclined
+		}
+	}
+	if job.Response != "" && json.Valid([]byte(job.Response)) {
+		item.Response = json.RawMessage(job.Response)
+	}
+	return item
+}
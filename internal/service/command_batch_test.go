@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tds_server/internal/model"
+)
+
+func TestRunCommandBatch(t *testing.T) {
+	var running, peak atomic.Int32
+	vehicles := []string{"A", "B", "C", "D", "E"}
+	items := RunCommandBatch(context.Background(), vehicles, 2, func(vehicle string) CommandBatchItem {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			current := peak.Load()
+			if n <= current || peak.CompareAndSwap(current, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		status := CommandBatchSucceeded
+		if vehicle == "C" {
+			status = CommandBatchDeclined
+		}
+		return CommandBatchItem{Vehicle: vehicle, Status: status}
+	})
+	if peak.Load() > 2 {
+		t.Fatalf("%d vehicles commanded at once, want at most 2", peak.Load())
+	}
+	for i, item := range items {
+		if item.Vehicle != vehicles[i] {
+			t.Fatalf("items out of order: %+v", items)
+		}
+	}
+	want := CommandBatchSummary{Total: 5, Succeeded: 4, Declined: 1}
+	if got := SummarizeCommandBatch(items); got != want {
+		t.Fatalf("summary = %+v, want %+v", got, want)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	items = RunCommandBatch(ctx, []string{"A"}, 1, func(string) CommandBatchItem {
+		t.Fatal("no vehicle may start after the request ended")
+		return CommandBatchItem{}
+	})
+	if items[0].Status != CommandBatchFailed {
+		t.Fatalf("cancelled batch: %+v", items[0])
+	}
+}
+
+func TestCommandBatchJobItem(t *testing.T) {
+	cases := map[string]model.CommandJob{
+		CommandBatchPending:   {Status: model.CommandJobWaking},
+		CommandBatchSucceeded: {Status: model.CommandJobSucceeded, ResponseStatus: 200},
+		CommandBatchDeclined:  {Status: model.CommandJobFailed, Reason: "already_set", ResponseStatus: 200},
+		CommandBatchFailed:    {Status: model.CommandJobFailed, ErrorCode: "vehicle_unavailable"},
+	}
+	for want, job := range cases {
+		if got := CommandBatchJobItem(&job).Status; got != want {
+			t.Fatalf("job %+v: status %s, want %s", job, got, want)
+		}
+	}
+}
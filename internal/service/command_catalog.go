@@ -0,0 +1,467 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// ErrUnknownCommand is returned for vehicle commands outside the command catalog.
+var ErrUnknownCommand = errors.New("unknown vehicle command")
+
+// Parameter types used in the command catalog.
+const (
+	ParamBool    = "bool"
+	ParamInteger = "integer"
+	ParamNumber  = "number"
+	ParamString  = "string"
+	ParamEnum    = "enum"
+	// ParamDays is a comma separated list of day names (SUN/SUNDAY … SAT/SATURDAY, ALL, WEEKDAYS).
+	ParamDays = "days"
+	// ParamMinutes is an integer number of minutes after midnight (0-1439).
+	ParamMinutes = "minutes"
+)
+
+// Execution paths of a command.
+const (
+	// CommandPathSDK commands are signed through the vehicle-command SDK, with REST fallback for
+	// vehicles that do not support the signed protocol.
+	CommandPathSDK = "sdk"
+	// CommandPathREST commands are always sent to the Fleet API REST endpoint.
+	CommandPathREST = "rest"
+	// CommandPathUnsupported commands are listed for completeness but rejected.
+	CommandPathUnsupported = "unsupported"
+)
+
+// Danger levels, so clients can ask for confirmation before risky commands.
+const (
+	DangerLow    = "low"
+	DangerMedium = "medium"
+	DangerHigh   = "high"
+)
+
+// Command categories, matching docs/vehicle_command_reference.md.
+const (
+	CategoryMedia    = "media"
+	CategoryClimate  = "climate"
+	CategoryBody     = "body"
+	CategoryCharging = "charging"
+	CategorySchedule = "schedule"
+	CategorySecurity = "security"
+	CategorySoftware = "software"
+	CategoryLocation = "navigation"
+)
+
+// CommandParam describes one body parameter of a vehicle command.
+type CommandParam struct {
+	Name        string   `json:"name"`
+	Type        string   `json:"type"`
+	Required    bool     `json:"required"`
+	Min         *float64 `json:"min,omitempty"`
+	Max         *float64 `json:"max,omitempty"`
+	Enum        []string `json:"enum,omitempty"`
+	Description string   `json:"description,omitempty"`
+}
+
+// CommandSpec describes a vehicle command: where it runs, how risky it is and what it accepts.
+// CommandSpec 描述一个车辆指令的分类、执行路径、危险等级与参数。
+type CommandSpec struct {
+	Name        string         `json:"name"`
+	Category    string         `json:"category"`
+	Description string         `json:"description"`
+	Path        string         `json:"path"`
+	Danger      string         `json:"danger"`
+	Params      []CommandParam `json:"params"`
+	// AdditionalParams marks REST commands whose body is passed through without a closed schema.
+	AdditionalParams bool `json:"additional_params,omitempty"`
+}
+
+// FieldError reports a problem with a single command parameter.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+func rangeOf(min, max float64) (*float64, *float64) {
+	return &min, &max
+}
+
+func boolParam(name string, required bool, description string) CommandParam {
+	return CommandParam{Name: name, Type: ParamBool, Required: required, Description: description}
+}
+
+func stringParam(name string, required bool, description string) CommandParam {
+	return CommandParam{Name: name, Type: ParamString, Required: required, Description: description}
+}
+
+func numberParam(name string, required bool, min, max float64, description string) CommandParam {
+	lo, hi := rangeOf(min, max)
+	return CommandParam{Name: name, Type: ParamNumber, Required: required, Min: lo, Max: hi, Description: description}
+}
+
+func integerParam(name string, required bool, min, max float64, description string) CommandParam {
+	lo, hi := rangeOf(min, max)
+	return CommandParam{Name: name, Type: ParamInteger, Required: required, Min: lo, Max: hi, Description: description}
+}
+
+func enumParam(name string, required bool, values []string, description string) CommandParam {
+	return CommandParam{Name: name, Type: ParamEnum, Required: required, Enum: values, Description: description}
+}
+
+func minutesParam(name string, required bool, description string) CommandParam {
+	lo, hi := rangeOf(0, 24*60-1)
+	return CommandParam{Name: name, Type: ParamMinutes, Required: required, Min: lo, Max: hi, Description: description}
+}
+
+func daysParam(name string, description string) CommandParam {
+	return CommandParam{Name: name, Type: ParamDays, Required: true, Description: description}
+}
+
+func latParam(required bool) CommandParam {
+	return numberParam("lat", required, -90, 90, "latitude")
+}
+
+func lonParam(required bool) CommandParam {
+	return numberParam("lon", required, -180, 180, "longitude")
+}
+
+// maxScheduleID bounds schedule ids, which the SDK stores as uint64 but JSON numbers carry as float64.
+const maxScheduleID = 1 << 53
+
+// commandCatalog lists every command the service knows about. Keep it in sync with the
+// ExtractCommandAction switch in github.com/teslamotors/vehicle-command/pkg/proxy/command.go.
+// commandCatalog 是所有已支持指令的注册表，新增指令时需同步 SDK 与文档。
+var commandCatalog = []CommandSpec{
+	// Media.
+	{Name: "adjust_volume", Category: CategoryMedia, Description: "Set the media volume", Danger: DangerLow,
+		Params: []CommandParam{numberParam("volume", true, 0, 11, "volume level")}},
+	{Name: "media_next_fav", Category: CategoryMedia, Description: "Next favorite station", Danger: DangerLow},
+	{Name: "media_prev_fav", Category: CategoryMedia, Description: "Previous favorite station", Danger: DangerLow},
+	{Name: "media_next_track", Category: CategoryMedia, Description: "Next track", Danger: DangerLow},
+	{Name: "media_prev_track", Category: CategoryMedia, Description: "Previous track", Danger: DangerLow},
+	{Name: "media_volume_up", Category: CategoryMedia, Description: "Volume up one step", Danger: DangerLow},
+	{Name: "media_volume_down", Category: CategoryMedia, Description: "Volume down one step", Danger: DangerLow},
+	{Name: "media_toggle_playback", Category: CategoryMedia, Description: "Toggle play / pause", Danger: DangerLow},
+	{Name: "remote_boombox", Category: CategoryMedia, Description: "Play a boombox sound", Danger: DangerLow, Path: CommandPathUnsupported},
+
+	// Climate and comfort.
+	{Name: "auto_conditioning_start", Category: CategoryClimate, Description: "Start climate control", Danger: DangerLow},
+	{Name: "auto_conditioning_stop", Category: CategoryClimate, Description: "Stop climate control", Danger: DangerLow},
+	{Name: "remote_seat_heater_request", Category: CategoryClimate, Description: "Set a seat heater level", Danger: DangerLow,
+		Params: []CommandParam{
+			integerParam("seat_position", true, 0, 8, "0=front left, 1=front right, 2=rear left, 3=rear left back, 4=rear center, 5=rear right, 6=rear right back, 7=third row left, 8=third row right"),
+			integerParam("level", true, 0, 3, "0=off, 3=high"),
+		}},
+	{Name: "remote_seat_cooler_request", Category: CategoryClimate, Description: "Set a seat cooler level", Danger: DangerLow,
+		Params: []CommandParam{
+			integerParam("seat_position", true, 1, 2, "1=front left, 2=front right"),
+			integerParam("seat_cooler_level", true, 1, 3, "1=off, 3=high"),
+		}},
+	{Name: "remote_auto_seat_climate_request", Category: CategoryClimate, Description: "Toggle automatic seat climate", Danger: DangerLow,
+		Params: []CommandParam{
+			integerParam("auto_seat_position", true, 1, 2, "1=front left, 2=front right"),
+			boolParam("auto_climate_on", true, ""),
+		}},
+	{Name: "remote_steering_wheel_heater_request", Category: CategoryClimate, Description: "Toggle the steering wheel heater", Danger: DangerLow,
+		Params: []CommandParam{boolParam("on", true, "")}},
+	{Name: "set_bioweapon_mode", Category: CategoryClimate, Description: "Toggle bioweapon defense mode", Danger: DangerLow,
+		Params: []CommandParam{boolParam("on", true, ""), boolParam("manual_override", true, "")}},
+	{Name: "set_cabin_overheat_protection", Category: CategoryClimate, Description: "Configure cabin overheat protection", Danger: DangerLow,
+		Params: []CommandParam{boolParam("on", true, ""), boolParam("fan_only", false, "")}},
+	{Name: "set_climate_keeper_mode", Category: CategoryClimate, Description: "Set climate keeper mode", Danger: DangerMedium,
+		Params: []CommandParam{
+			integerParam("climate_keeper_mode", true, 0, 3, "0=off, 1=on, 2=dog, 3=camp"),
+			boolParam("manual_override", false, ""),
+		}},
+	{Name: "set_cop_temp", Category: CategoryClimate, Description: "Set the cabin overheat protection temperature level", Danger: DangerLow,
+		Params: []CommandParam{integerParam("cop_temp", true, 0, 3, "0=unspecified, 1=low, 2=medium, 3=high")}},
+	{Name: "set_preconditioning_max", Category: CategoryClimate, Description: "Toggle max preconditioning", Danger: DangerLow,
+		Params: []CommandParam{boolParam("on", true, ""), boolParam("manual_override", false, "")}},
+	{Name: "set_temps", Category: CategoryClimate, Description: "Set cabin temperatures in Celsius", Danger: DangerLow,
+		Params: []CommandParam{
+			numberParam("driver_temp", false, 15, 28, "°C"),
+			numberParam("passenger_temp", false, 15, 28, "°C"),
+		}},
+
+	// Body.
+	{Name: "actuate_trunk", Category: CategoryBody, Description: "Open or close a trunk", Danger: DangerHigh,
+		Params: []CommandParam{enumParam("which_trunk", false, []string{"front", "rear"}, "defaults to rear")}},
+	{Name: "charge_port_door_open", Category: CategoryBody, Description: "Open the charge port door", Danger: DangerMedium},
+	{Name: "charge_port_door_close", Category: CategoryBody, Description: "Close the charge port door", Danger: DangerLow},
+	{Name: "flash_lights", Category: CategoryBody, Description: "Flash the headlights", Danger: DangerLow},
+	{Name: "honk_horn", Category: CategoryBody, Description: "Honk the horn", Danger: DangerLow},
+	{Name: "remote_start_drive", Category: CategoryBody, Description: "Enable keyless driving", Danger: DangerHigh},
+	{Name: "open_tonneau", Category: CategoryBody, Description: "Open the tonneau cover", Danger: DangerMedium},
+	{Name: "close_tonneau", Category: CategoryBody, Description: "Close the tonneau cover", Danger: DangerLow},
+	{Name: "stop_tonneau", Category: CategoryBody, Description: "Stop the tonneau cover", Danger: DangerLow},
+	{Name: "wake_up", Category: CategoryBody, Description: "Wake the vehicle", Danger: DangerLow},
+	{Name: "window_control", Category: CategoryBody, Description: "Vent or close all windows", Danger: DangerHigh,
+		Params: []CommandParam{
+			enumParam("command", true, []string{"vent", "close"}, ""),
+			latParam(false),
+			lonParam(false),
+		}},
+
+	// Charging.
+	{Name: "charge_max_range", Category: CategoryCharging, Description: "Set the charge limit to max range", Danger: DangerLow},
+	{Name: "charge_standard", Category: CategoryCharging, Description: "Set the charge limit to standard", Danger: DangerLow},
+	{Name: "charge_start", Category: CategoryCharging, Description: "Start charging", Danger: DangerLow},
+	{Name: "charge_stop", Category: CategoryCharging, Description: "Stop charging", Danger: DangerLow},
+	{Name: "set_charging_amps", Category: CategoryCharging, Description: "Set the charging current", Danger: DangerLow,
+		Params: []CommandParam{integerParam("charging_amps", true, 0, 80, "amps")}},
+	{Name: "set_charge_limit", Category: CategoryCharging, Description: "Set the charge limit", Danger: DangerLow,
+		Params: []CommandParam{integerParam("percent", true, 50, 100, "percent")}},
+	{Name: "set_scheduled_charging", Category: CategoryCharging, Description: "Configure scheduled charging", Danger: DangerLow,
+		Params: []CommandParam{boolParam("enable", true, ""), minutesParam("time", false, "start time, minutes after midnight")}},
+	{Name: "set_scheduled_departure", Category: CategoryCharging, Description: "Configure scheduled departure", Danger: DangerLow,
+		Params: []CommandParam{
+			boolParam("enable", true, ""),
+			boolParam("off_peak_charging_enabled", false, ""),
+			boolParam("off_peak_charging_weekdays_only", false, ""),
+			boolParam("preconditioning_enabled", false, ""),
+			boolParam("preconditioning_weekdays_only", false, ""),
+			minutesParam("departure_time", false, "minutes after midnight"),
+			minutesParam("end_off_peak_time", false, "minutes after midnight"),
+		}},
+	{Name: "set_managed_charge_current_request", Category: CategoryCharging, Description: "Set the managed charging current", Danger: DangerLow,
+		Path: CommandPathREST, AdditionalParams: true},
+	{Name: "set_managed_charger_location", Category: CategoryCharging, Description: "Set the managed charger location", Danger: DangerLow,
+		Path: CommandPathREST, AdditionalParams: true},
+	{Name: "set_managed_scheduled_charging_time", Category: CategoryCharging, Description: "Set the managed scheduled charging time", Danger: DangerLow,
+		Path: CommandPathREST, AdditionalParams: true},
+
+	// Charge and precondition schedules.
+	{Name: "add_charge_schedule", Category: CategorySchedule, Description: "Add or update a charge schedule", Danger: DangerLow,
+		Params: []CommandParam{
+			latParam(true),
+			lonParam(true),
+			boolParam("start_enabled", true, ""),
+			boolParam("end_enabled", true, ""),
+			daysParam("days_of_week", ""),
+			boolParam("enabled", true, ""),
+			minutesParam("start_time", false, "minutes after midnight"),
+			minutesParam("end_time", false, "minutes after midnight"),
+			integerParam("id", false, 0, maxScheduleID, "defaults to the current timestamp"),
+			boolParam("one_time", false, ""),
+		}},
+	{Name: "add_precondition_schedule", Category: CategorySchedule, Description: "Add or update a precondition schedule", Danger: DangerLow,
+		Params: []CommandParam{
+			latParam(true),
+			lonParam(true),
+			minutesParam("precondition_time", true, "minutes after midnight"),
+			daysParam("days_of_week", ""),
+			boolParam("enabled", true, ""),
+			integerParam("id", false, 0, maxScheduleID, "defaults to the current timestamp"),
+			boolParam("one_time", false, ""),
+		}},
+	{Name: "remove_charge_schedule", Category: CategorySchedule, Description: "Remove a charge schedule", Danger: DangerLow,
+		Params: []CommandParam{integerParam("id", true, 0, maxScheduleID, "")}},
+	{Name: "remove_precondition_schedule", Category: CategorySchedule, Description: "Remove a precondition schedule", Danger: DangerLow,
+		Params: []CommandParam{integerParam("id", true, 0, maxScheduleID, "")}},
+
+	// Security.
+	{Name: "door_lock", Category: CategorySecurity, Description: "Lock the doors", Danger: DangerLow},
+	{Name: "door_unlock", Category: CategorySecurity, Description: "Unlock the doors", Danger: DangerHigh},
+	{Name: "set_pin_to_drive", Category: CategorySecurity, Description: "Toggle PIN to drive", Danger: DangerHigh,
+		Params: []CommandParam{boolParam("on", true, ""), stringParam("password", false, "4 digit PIN")}},
+	{Name: "clear_pin_to_drive_admin", Category: CategorySecurity, Description: "Clear the PIN to drive (fleet manager)", Danger: DangerHigh},
+	{Name: "reset_pin_to_drive_pin", Category: CategorySecurity, Description: "Reset the PIN to drive", Danger: DangerHigh},
+	{Name: "set_valet_mode", Category: CategorySecurity, Description: "Toggle valet mode", Danger: DangerMedium,
+		Params: []CommandParam{boolParam("on", true, ""), stringParam("password", false, "4 digit PIN")}},
+	{Name: "reset_valet_pin", Category: CategorySecurity, Description: "Reset the valet PIN", Danger: DangerMedium},
+	{Name: "guest_mode", Category: CategorySecurity, Description: "Toggle guest mode", Danger: DangerMedium,
+		Params: []CommandParam{boolParam("enable", true, "")}},
+	{Name: "set_sentry_mode", Category: CategorySecurity, Description: "Toggle sentry mode", Danger: DangerMedium,
+		Params: []CommandParam{boolParam("on", true, "")}},
+	{Name: "set_vehicle_name", Category: CategorySecurity, Description: "Rename the vehicle", Danger: DangerLow,
+		Params: []CommandParam{stringParam("vehicle_name", true, "")}},
+	{Name: "speed_limit_activate", Category: CategorySecurity, Description: "Activate speed limit mode", Danger: DangerMedium,
+		Params: []CommandParam{stringParam("pin", true, "4 digit PIN")}},
+	{Name: "speed_limit_deactivate", Category: CategorySecurity, Description: "Deactivate speed limit mode", Danger: DangerMedium,
+		Params: []CommandParam{stringParam("pin", true, "4 digit PIN")}},
+	{Name: "speed_limit_clear_pin", Category: CategorySecurity, Description: "Clear the speed limit PIN", Danger: DangerMedium,
+		Params: []CommandParam{stringParam("pin", true, "4 digit PIN")}},
+	{Name: "speed_limit_clear_pin_admin", Category: CategorySecurity, Description: "Clear the speed limit PIN (fleet manager)", Danger: DangerMedium},
+	{Name: "speed_limit_set_limit", Category: CategorySecurity, Description: "Set the speed limit in mph", Danger: DangerMedium,
+		Params: []CommandParam{numberParam("limit_mph", true, 50, 120, "mph")}},
+	{Name: "trigger_homelink", Category: CategorySecurity, Description: "Trigger HomeLink near the given location", Danger: DangerHigh,
+		Params: []CommandParam{latParam(true), lonParam(true)}},
+	{Name: "erase_user_data", Category: CategorySecurity, Description: "Erase guest user data", Danger: DangerHigh},
+
+	// Software.
+	{Name: "schedule_software_update", Category: CategorySoftware, Description: "Schedule a software update", Danger: DangerMedium,
+		Params: []CommandParam{integerParam("offset_sec", true, 0, 7*24*3600, "delay in seconds")}},
+	{Name: "cancel_software_update", Category: CategorySoftware, Description: "Cancel a scheduled software update", Danger: DangerLow},
+
+	// Navigation, handled by Tesla's servers.
+	{Name: "navigation_request", Category: CategoryLocation, Description: "Share a destination with the vehicle", Danger: DangerLow,
+		Path: CommandPathREST, AdditionalParams: true},
+	{Name: "navigation_gps_request", Category: CategoryLocation, Description: "Navigate to coordinates", Danger: DangerLow,
+		Path: CommandPathREST, AdditionalParams: true},
+	{Name: "navigation_sc_request", Category: CategoryLocation, Description: "Navigate to a Supercharger", Danger: DangerLow,
+		Path: CommandPathREST, AdditionalParams: true},
+}
+
+// commandIndex maps command names to their catalog entries.
+var commandIndex = func() map[string]*CommandSpec {
+	index := make(map[string]*CommandSpec, len(commandCatalog))
+	for i := range commandCatalog {
+		spec := &commandCatalog[i]
+		if spec.Path == "" {
+			spec.Path = CommandPathSDK
+		}
+		if spec.Params == nil {
+			spec.Params = []CommandParam{}
+		}
+		index[spec.Name] = spec
+	}
+	return index
+}()
+
+// CommandCatalog returns every known vehicle command sorted by category and name.
+// CommandCatalog 返回按分类与名称排序的指令目录，供客户端生成表单。
+func CommandCatalog() []CommandSpec {
+	specs := make([]CommandSpec, len(commandCatalog))
+	copy(specs, commandCatalog)
+	sort.SliceStable(specs, func(i, j int) bool {
+		if specs[i].Category != specs[j].Category {
+			return specs[i].Category < specs[j].Category
+		}
+		return specs[i].Name < specs[j].Name
+	})
+	return specs
+}
+
+// LookupCommand returns the catalog entry for name.
+func LookupCommand(name string) (CommandSpec, bool) {
+	spec, ok := commandIndex[name]
+	if !ok {
+		return CommandSpec{}, false
+	}
+	return *spec, true
+}
+
+// ValidateCommandParams checks a command body against its catalog schema before anything is sent
+// to the vehicle. Unknown commands yield ErrUnknownCommand; a body that is not a JSON object yields
+// a plain error; otherwise every offending field is reported. ValidateCommandParams 按目录校验指令参数，
+// 返回逐字段的错误信息。
+func ValidateCommandParams(name string, body []byte) ([]FieldError, error) {
+	spec, ok := commandIndex[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCommand, name)
+	}
+
+	params := map[string]any{}
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err := json.Unmarshal(body, &params); err != nil || params == nil {
+			return nil, errors.New("request body must be a JSON object")
+		}
+	}
+
+	var fieldErrors []FieldError
+	known := make(map[string]bool, len(spec.Params))
+	for _, param := range spec.Params {
+		known[param.Name] = true
+		value, present := params[param.Name]
+		if !present || value == nil {
+			if param.Required {
+				fieldErrors = append(fieldErrors, FieldError{Field: param.Name, Message: "is required"})
+			}
+			continue
+		}
+		if msg := checkParam(param, value); msg != "" {
+			fieldErrors = append(fieldErrors, FieldError{Field: param.Name, Message: msg})
+		}
+	}
+
+	if !spec.AdditionalParams {
+		var unknown []string
+		for key := range params {
+			if !known[key] {
+				unknown = append(unknown, key)
+			}
+		}
+		sort.Strings(unknown)
+		for _, key := range unknown {
+			fieldErrors = append(fieldErrors, FieldError{Field: key, Message: "is not a parameter of " + name})
+		}
+	}
+	return fieldErrors, nil
+}
+
+// checkParam returns a description of what is wrong with value, or "" when it is valid. The JSON
+// types match what proxy.RequestParameters accepts: numbers must be JSON numbers, not strings.
+func checkParam(param CommandParam, value any) string {
+	switch param.Type {
+	case ParamBool:
+		if _, ok := value.(bool); !ok {
+			return "must be a boolean"
+		}
+	case ParamString:
+		s, ok := value.(string)
+		if !ok {
+			return "must be a string"
+		}
+		if strings.TrimSpace(s) == "" {
+			return "must not be empty"
+		}
+	case ParamEnum:
+		s, ok := value.(string)
+		if !ok {
+			return "must be a string"
+		}
+		for _, allowed := range param.Enum {
+			if s == allowed {
+				return ""
+			}
+		}
+		return "must be one of " + strings.Join(param.Enum, ", ")
+	case ParamDays:
+		s, ok := value.(string)
+		if !ok {
+			return "must be a string"
+		}
+		if err := checkDays(s); err != "" {
+			return err
+		}
+	case ParamNumber, ParamInteger, ParamMinutes:
+		n, ok := value.(float64)
+		if !ok {
+			return "must be a number"
+		}
+		if param.Type != ParamNumber && n != math.Trunc(n) {
+			return "must be an integer"
+		}
+		if (param.Min != nil && n < *param.Min) || (param.Max != nil && n > *param.Max) {
+			return fmt.Sprintf("must be between %g and %g", *param.Min, *param.Max)
+		}
+	}
+	return ""
+}
+
+// dayNames are the day tokens accepted by the SDK's days_of_week parser.
+var dayNames = map[string]bool{
+	"SUN": true, "SUNDAY": true, "MON": true, "MONDAY": true, "TUES": true, "TUESDAY": true,
+	"WED": true, "WEDNESDAY": true, "THURS": true, "THURSDAY": true, "FRI": true, "FRIDAY": true,
+	"SAT": true, "SATURDAY": true, "ALL": true, "WEEKDAYS": true,
+}
+
+func checkDays(value string) string {
+	if strings.TrimSpace(value) == "" {
+		return "must list at least one day"
+	}
+	for _, day := range strings.Split(value, ",") {
+		if !dayNames[strings.ToUpper(strings.TrimSpace(day))] {
+			return fmt.Sprintf("contains unknown day %q", strings.TrimSpace(day))
+		}
+	}
+	return ""
+}
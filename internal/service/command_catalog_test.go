@@ -0,0 +1,76 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestValidateCommandParams(t *testing.T) {
+	valid := map[string]string{
+		"honk_horn":                  ``,
+		"set_charge_limit":           `{"percent": 80}`,
+		"remote_seat_heater_request": `{"seat_position": 8, "level": 3}`,
+		"set_temps":                  `{"driver_temp": 21.5}`,
+		"add_charge_schedule":        `{"lat": 31.2, "lon": 121.5, "start_enabled": true, "end_enabled": false, "days_of_week": "Weekdays, sat", "enabled": true, "start_time": 120}`,
+		"navigation_request":         `{"type": "share_ext_content_raw", "value": {}}`,
+	}
+	for name, body := range valid {
+		fieldErrors, err := ValidateCommandParams(name, []byte(body))
+		if err != nil || len(fieldErrors) > 0 {
+			t.Fatalf("%s %s: field errors %v, err %v", name, body, fieldErrors, err)
+		}
+	}
+
+	invalid := map[string]struct {
+		body   string
+		fields []string
+	}{
+		"set_charge_limit":           {`{"percent": "80"}`, []string{"percent"}},
+		"remote_seat_heater_request": {`{"seat_position": 1.5, "level": 4}`, []string{"seat_position", "level"}},
+		"set_sentry_mode":            {`{"enabled": true}`, []string{"on", "enabled"}},
+		"window_control":             {`{"command": "open"}`, []string{"command"}},
+		"add_precondition_schedule":  {`{"lat": 95, "lon": 0, "precondition_time": 1440, "days_of_week": "Funday", "enabled": true}`, []string{"lat", "precondition_time", "days_of_week"}},
+	}
+	for name, tc := range invalid {
+		fieldErrors, err := ValidateCommandParams(name, []byte(tc.body))
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", name, err)
+		}
+		fields := make([]string, 0, len(fieldErrors))
+		for _, fieldErr := range fieldErrors {
+			fields = append(fields, fieldErr.Field)
+		}
+		if !reflect.DeepEqual(fields, tc.fields) {
+			t.Fatalf("%s %s: fields %v, want %v", name, tc.body, fields, tc.fields)
+		}
+	}
+
+	if _, err := ValidateCommandParams("set_charge_limit", []byte(`[80]`)); err == nil {
+		t.Fatal("expected an error for a non-object body")
+	}
+	if _, err := ValidateCommandParams("self_destruct", nil); !errors.Is(err, ErrUnknownCommand) {
+		t.Fatalf("unknown command error = %v", err)
+	}
+}
+
+func TestCommandCatalog(t *testing.T) {
+	seen := map[string]bool{}
+	for _, spec := range CommandCatalog() {
+		if seen[spec.Name] {
+			t.Fatalf("duplicate command %s", spec.Name)
+		}
+		seen[spec.Name] = true
+		if spec.Category == "" || spec.Danger == "" || spec.Params == nil {
+			t.Fatalf("incomplete catalog entry %+v", spec)
+		}
+		switch spec.Path {
+		case CommandPathSDK, CommandPathREST, CommandPathUnsupported:
+		default:
+			t.Fatalf("%s: unexpected path %q", spec.Name, spec.Path)
+		}
+	}
+	if spec, ok := LookupCommand("set_managed_charger_location"); !ok || spec.Path != CommandPathREST {
+		t.Fatalf("set_managed_charger_location = %+v", spec)
+	}
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"tds_server/internal/upstream"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/teslamotors/vehicle-command/pkg/connector"
+	"github.com/teslamotors/vehicle-command/pkg/connector/inet"
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+)
+
+const (
+	commandRetryInterval = time.Second
+	wakePollInterval     = 2 * time.Second
+)
+
+// fleetConnector carries signed commands to a configurable Fleet API base URL. The SDK's own
+// connector always dials https://<token audience>, so this one is used when TESLA_COMMAND_URL points
+// somewhere else, such as the local mock. fleetConnector 将签名指令发送到可配置的 Fleet API 地址。
+type fleetConnector struct {
+	baseURL    string
+	vin        string
+	authHeader string
+	client     *resty.Client
+
+	lock  sync.Mutex
+	inbox chan []byte
+}
+
+var _ connector.FleetAPIConnector = (*fleetConnector)(nil)
+
+func newFleetConnector(baseURL, vin, oauthToken string) *fleetConnector {
+	client := upstream.NewClient()
+	client.SetHeader("User-Agent", commandUserAgent)
+	return &fleetConnector{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		vin:        vin,
+		authHeader: "Bearer " + oauthToken,
+		client:     client,
+		inbox:      make(chan []byte, connector.BufferSize),
+	}
+}
+
+func (c *fleetConnector) Receive() <-chan []byte {
+	return c.inbox
+}
+
+func (c *fleetConnector) Send(ctx context.Context, buffer []byte) error {
+	body, err := c.SendFleetAPICommand(ctx, fmt.Sprintf("api/1/vehicles/%s/signed_command", c.vin), map[string][]byte{"routable_message": buffer})
+	if err != nil {
+		return err
+	}
+	var payload struct {
+		Response []byte `json:"response"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return &protocol.CommandError{Err: fmt.Errorf("unable to parse server response: %w", err), PossibleSuccess: true}
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.inbox == nil {
+		return protocol.ErrNotConnected
+	}
+	select {
+	case c.inbox <- payload.Response:
+		return nil
+	default:
+		return protocol.NewError("dropped response because inbox is full", true, false)
+	}
+}
+
+// SendFleetAPICommand POSTs command to endpoint, mapping statuses to the same errors as the SDK's
+// connector so retries and REST fallback behave identically.
+func (c *fleetConnector) SendFleetAPICommand(ctx context.Context, endpoint string, command interface{}) ([]byte, error) {
+	req := newTeslaRequest(ctx, c.client).
+		SetHeader("Authorization", c.authHeader).
+		SetHeader("Content-Type", "application/json")
+	if command != nil {
+		req.SetBody(command)
+	}
+	resp, err := req.Post(c.baseURL + "/" + strings.TrimLeft(endpoint, "/"))
+	if err != nil {
+		return nil, &protocol.CommandError{Err: err, PossibleTemporary: true}
+	}
+
+	body := resp.Body()
+	switch resp.StatusCode() {
+	case http.StatusOK:
+		return body, nil
+	case http.StatusUnprocessableEntity:
+		return nil, protocol.ErrProtocolNotSupported
+	case http.StatusServiceUnavailable:
+		return nil, inet.ErrVehicleNotAwake
+	case http.StatusRequestTimeout:
+		if bytes.Contains(body, []byte("vehicle is offline")) {
+			return nil, inet.ErrVehicleNotAwake
+		}
+	}
+	return nil, &inet.HTTPError{Code: resp.StatusCode(), Message: string(body)}
+}
+
+// Wakeup sends wake_up and polls until the vehicle reports online or ctx ends.
+func (c *fleetConnector) Wakeup(ctx context.Context) error {
+	endpoint := fmt.Sprintf("api/1/vehicles/%s/wake_up", c.vin)
+	for {
+		body, err := c.SendFleetAPICommand(ctx, endpoint, nil)
+		if err == nil {
+			var payload struct {
+				Response struct {
+					State string `json:"state"`
+				} `json:"response"`
+			}
+			if json.Unmarshal(body, &payload) == nil && payload.Response.State == "online" {
+				return nil
+			}
+		} else if !protocol.Temporary(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wakePollInterval):
+		}
+	}
+}
+
+func (c *fleetConnector) VIN() string {
+	return c.vin
+}
+
+func (c *fleetConnector) Close() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.inbox != nil {
+		close(c.inbox)
+		c.inbox = nil
+	}
+}
+
+func (c *fleetConnector) PreferredAuthMethod() connector.AuthMethod {
+	return connector.AuthMethodHMAC
+}
+
+func (c *fleetConnector) RetryInterval() time.Duration {
+	return commandRetryInterval
+}
+
+func (c *fleetConnector) AllowedLatency() time.Duration {
+	return inet.MaxLatency
+}
@@ -0,0 +1,291 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"tds_server/internal/apierror"
+	"tds_server/internal/logging"
+	"tds_server/internal/model"
+
+	"github.com/google/uuid"
+)
+
+// ErrCommandQueueFull is returned when no worker can accept another asynchronous command.
+var ErrCommandQueueFull = errors.New("command queue is full")
+
+const (
+	// DefaultCommandWorkers is the number of asynchronous commands executed concurrently.
+	DefaultCommandWorkers = 4
+	// DefaultCommandQueueSize bounds the commands waiting for a worker.
+	DefaultCommandQueueSize = 100
+	// DefaultCommandJobTimeout bounds a whole job, including waking the vehicle.
+	DefaultCommandJobTimeout = 2 * time.Minute
+	// progressBufferSize is the number of progress events buffered per subscriber.
+	progressBufferSize = 32
+)
+
+var jobLog = logging.Logger(logging.SubsystemCommand)
+
+// CommandJobStore persists asynchronous commands; repository.CommandJobRepo implements it.
+type CommandJobStore interface {
+	Create(job *model.CommandJob) error
+	Transition(id uuid.UUID, update model.CommandJobUpdate) error
+	Get(userID, id uuid.UUID) (*model.CommandJob, error)
+	ListBatch(userID, batchID uuid.UUID) ([]model.CommandJob, error)
+}
+
+// CommandTask executes a command. It reports intermediate stages through ReportCommandProgress on ctx.
+type CommandTask func(ctx context.Context) (*CommandResult, error)
+
+// CommandDeclinedError is returned by a CommandTask when the vehicle received the command but
+// refused it (result false); Result is the response the vehicle sent.
+type CommandDeclinedError struct {
+	Reason string
+	Result *CommandResult
+}
+
+func (e *CommandDeclinedError) Error() string {
+	return "command declined: " + e.Reason
+}
+
+// CommandJobService runs vehicle commands on a worker pool and persists every status transition so
+// clients can poll for the outcome instead of holding the HTTP request open.
+// CommandJobService 通过工作池异步执行车辆指令，并持久化每次状态变化供客户端轮询。
+type CommandJobService struct {
+	store CommandJobStore
+	// instance names this server in the jobs it stores; see config Commands.Instance.
+	instance string
+	queue    chan commandJobItem
+	timeout  time.Duration
+
+	mu sync.Mutex
+	// watchers holds the live subscribers of jobs queued or running in this process.
+	watchers map[uuid.UUID]map[chan CommandProgress]struct{}
+}
+
+type commandJobItem struct {
+	ctx  context.Context
+	id   uuid.UUID
+	task CommandTask
+}
+
+// NewCommandJobService starts workers goroutines consuming a queue of queueSize jobs; non-positive
+// values fall back to the defaults. Jobs are stored as run by instance.
+func NewCommandJobService(store CommandJobStore, instance string, workers, queueSize int, timeout time.Duration) *CommandJobService {
+	if workers <= 0 {
+		workers = DefaultCommandWorkers
+	}
+	if queueSize <= 0 {
+		queueSize = DefaultCommandQueueSize
+	}
+	if timeout <= 0 {
+		timeout = DefaultCommandJobTimeout
+	}
+	s := &CommandJobService{
+		store:    store,
+		instance: instance,
+		queue:    make(chan commandJobItem, queueSize),
+		timeout:  timeout,
+		watchers: map[uuid.UUID]map[chan CommandProgress]struct{}{},
+	}
+	for i := 0; i < workers; i++ {
+		go s.work()
+	}
+	return s
+}
+
+// Submit stores job as queued and hands task to the worker pool. ctx should outlive the HTTP request
+// (see context.WithoutCancel); it carries request-scoped values such as the request ID.
+func (s *CommandJobService) Submit(ctx context.Context, job *model.CommandJob, task CommandTask) error {
+	if job.ID == uuid.Nil {
+		job.ID = uuid.New()
+	}
+	job.Status, job.Instance = model.CommandJobQueued, s.instance
+	if err := s.store.Create(job); err != nil {
+		return fmt.Errorf("create command job: %w", err)
+	}
+
+	s.mu.Lock()
+	s.watchers[job.ID] = map[chan CommandProgress]struct{}{}
+	s.mu.Unlock()
+
+	select {
+	case s.queue <- commandJobItem{ctx: ctx, id: job.ID, task: task}:
+		return nil
+	default:
+		job.Status, job.Reason = model.CommandJobFailed, ErrCommandQueueFull.Error()
+		s.finish(ctx, job.ID, model.CommandJobUpdate{Status: job.Status, Reason: job.Reason, ErrorCode: apierror.CodeServiceOverloaded})
+		return ErrCommandQueueFull
+	}
+}
+
+// Subscribe streams the progress of a job queued or running in this process. The channel is closed
+// once the job finishes; live is false when the job is unknown here (finished, or handled by another
+// instance) and the caller should read the store instead. cancel must always be called.
+// Subscribe 订阅本进程中任务的实时进度，任务结束后通道关闭。
+func (s *CommandJobService) Subscribe(id uuid.UUID) (events <-chan CommandProgress, cancel func(), live bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	subscribers, ok := s.watchers[id]
+	if !ok {
+		return nil, func() {}, false
+	}
+	ch := make(chan CommandProgress, progressBufferSize)
+	subscribers[ch] = struct{}{}
+	return ch, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, ok := s.watchers[id][ch]; ok {
+			delete(s.watchers[id], ch)
+			close(ch)
+		}
+	}, true
+}
+
+// Get returns the user's job, or an error satisfying repository.IsNotFound.
+func (s *CommandJobService) Get(userID, id uuid.UUID) (*model.CommandJob, error) {
+	return s.store.Get(userID, id)
+}
+
+// ListBatch returns the user's jobs queued by one batch request; none means the batch is unknown.
+func (s *CommandJobService) ListBatch(userID, batchID uuid.UUID) ([]model.CommandJob, error) {
+	return s.store.ListBatch(userID, batchID)
+}
+
+func (s *CommandJobService) work() {
+	for item := range s.queue {
+		s.run(item)
+	}
+}
+
+func (s *CommandJobService) run(item commandJobItem) {
+	timeout := s.timeout
+	if extended, ok := item.ctx.Value(commandJobTimeoutKey{}).(time.Duration); ok && extended > timeout {
+		timeout = extended
+	}
+	ctx, cancel := context.WithTimeout(item.ctx, timeout)
+	defer cancel()
+	ctx = WithCommandProgress(ctx, func(progress CommandProgress) {
+		if persistedStage(progress.Stage) {
+			s.transition(ctx, item.id, model.CommandJobUpdate{Status: progress.Stage, Reason: progress.Detail})
+		}
+		s.publish(item.id, progress)
+	})
+
+	result, err := item.task(ctx)
+	update := model.CommandJobUpdate{Status: model.CommandJobSucceeded}
+	var declined *CommandDeclinedError
+	switch {
+	case errors.As(err, &declined):
+		update.Status, update.Reason, result = model.CommandJobFailed, declined.Reason, declined.Result
+	case err != nil:
+		update.Status, update.Reason = model.CommandJobFailed, err.Error()
+		update.ErrorCode = apierror.From(http.StatusInternalServerError, err).Code
+		if ctx.Err() != nil {
+			update.Reason = "command timed out: " + err.Error()
+		}
+	}
+	if result != nil {
+		update.ResponseStatus, update.Response = result.Status, result.Body
+	}
+	s.finish(ctx, item.id, update)
+}
+
+// finish stores the terminal status, publishes it and closes the job's subscriptions.
+func (s *CommandJobService) finish(ctx context.Context, id uuid.UUID, update model.CommandJobUpdate) {
+	s.transition(ctx, id, update)
+	s.publish(id, CommandProgress{Stage: update.Status, Detail: update.Reason, At: time.Now()})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch := range s.watchers[id] {
+		close(ch)
+	}
+	delete(s.watchers, id)
+}
+
+// publish delivers progress to the job's subscribers, dropping it for subscribers that are too slow.
+func (s *CommandJobService) publish(id uuid.UUID, progress CommandProgress) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch := range s.watchers[id] {
+		select {
+		case ch <- progress:
+		default:
+		}
+	}
+}
+
+func (s *CommandJobService) transition(ctx context.Context, id uuid.UUID, update model.CommandJobUpdate) {
+	if err := s.store.Transition(id, update); err != nil {
+		jobLog.ErrorContext(ctx, "command job transition failed", "job_id", id, "status", update.Status, "error", err)
+		return
+	}
+	jobLog.InfoContext(ctx, "command job transition", "job_id", id, "status", update.Status, "reason", update.Reason)
+}
+
+// Command progress stages streamed to clients. Queued, waking, connecting and sent are also persisted
+// as job statuses; the others only appear in the live stream. 指令执行阶段，部分阶段同时作为任务状态持久化。
+const (
+	CommandStageQueued     = model.CommandJobQueued
+	CommandStageWaking     = model.CommandJobWaking
+	CommandStageConnecting = model.CommandJobConnecting
+	// CommandStageSession is the signed session handshake (StartSession).
+	CommandStageSession = "session"
+	CommandStageSent    = model.CommandJobSent
+	// CommandStageRESTFallback means the vehicle does not support signed commands and REST is used.
+	CommandStageRESTFallback = "rest_fallback"
+	// CommandStageRetrying is reported before a request is repeated, e.g. after a token refresh.
+	CommandStageRetrying = "retrying"
+	// CommandStageVerifying is reported while vehicle_data is polled to confirm the command's effect.
+	CommandStageVerifying = "verifying"
+	// CommandStageStep starts the next step of a scene; the detail names it, e.g. "2/4 set_temps".
+	CommandStageStep      = "step"
+	CommandStageSucceeded = model.CommandJobSucceeded
+	CommandStageFailed    = model.CommandJobFailed
+)
+
+// CommandProgress is one stage of a command as it happens.
+type CommandProgress struct {
+	Stage  string    `json:"stage"`
+	Detail string    `json:"detail,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+type commandProgressKey struct{}
+
+type commandJobTimeoutKey struct{}
+
+// WithCommandJobTimeout returns a context for Submit whose job may run for timeout instead of the
+// service's timeout, when that is longer; scenes use it to cover their delays.
+func WithCommandJobTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, commandJobTimeoutKey{}, timeout)
+}
+
+// WithCommandProgress returns a context whose command stages are reported to fn.
+func WithCommandProgress(ctx context.Context, fn func(CommandProgress)) context.Context {
+	return context.WithValue(ctx, commandProgressKey{}, fn)
+}
+
+// ReportCommandProgress reports a command stage to the callback installed by WithCommandProgress;
+// it does nothing for synchronous requests.
+func ReportCommandProgress(ctx context.Context, stage, detail string) {
+	if fn, ok := ctx.Value(commandProgressKey{}).(func(CommandProgress)); ok {
+		fn(CommandProgress{Stage: stage, Detail: detail, At: time.Now()})
+	}
+}
+
+// persistedStage reports whether stage is an intermediate job status stored in the database; terminal
+// statuses are only stored when the task returns.
+func persistedStage(stage string) bool {
+	switch stage {
+	case model.CommandJobQueued, model.CommandJobWaking, model.CommandJobConnecting, model.CommandJobSent:
+		return true
+	}
+	return false
+}
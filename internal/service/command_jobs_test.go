@@ -0,0 +1,179 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"tds_server/internal/apierror"
+	"tds_server/internal/model"
+
+	"github.com/google/uuid"
+)
+
+// memoryJobStore keeps jobs and their status history in memory.
+type memoryJobStore struct {
+	mu      sync.Mutex
+	jobs    map[uuid.UUID]*model.CommandJob
+	history map[uuid.UUID][]string
+}
+
+func newMemoryJobStore() *memoryJobStore {
+	return &memoryJobStore{jobs: map[uuid.UUID]*model.CommandJob{}, history: map[uuid.UUID][]string{}}
+}
+
+func (s *memoryJobStore) Create(job *model.CommandJob) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := *job
+	s.jobs[job.ID] = &stored
+	s.history[job.ID] = []string{job.Status}
+	return nil
+}
+
+func (s *memoryJobStore) Transition(id uuid.UUID, update model.CommandJobUpdate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job := s.jobs[id]
+	job.Status, job.Reason, job.ErrorCode, job.Response = update.Status, update.Reason, update.ErrorCode, string(update.Response)
+	s.history[id] = append(s.history[id], update.Status)
+	return nil
+}
+
+func (s *memoryJobStore) Get(_, id uuid.UUID) (*model.CommandJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job := *s.jobs[id]
+	return &job, nil
+}
+
+func (s *memoryJobStore) ListBatch(_, batchID uuid.UUID) ([]model.CommandJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var jobs []model.CommandJob
+	for _, job := range s.jobs {
+		if job.BatchID != nil && *job.BatchID == batchID {
+			jobs = append(jobs, *job)
+		}
+	}
+	return jobs, nil
+}
+
+func (s *memoryJobStore) waitFinished(t *testing.T, id uuid.UUID) (*model.CommandJob, []string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		job, _ := s.Get(uuid.Nil, id)
+		if job.Finished() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			return job, append([]string(nil), s.history[id]...)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish", id)
+	return nil, nil
+}
+
+func TestCommandJobServiceRecordsTransitions(t *testing.T) {
+	store := newMemoryJobStore()
+	jobs := NewCommandJobService(store, "test", 2, 4, time.Second)
+
+	succeeded := &model.CommandJob{Command: "door_lock"}
+	err := jobs.Submit(context.Background(), succeeded, func(ctx context.Context) (*CommandResult, error) {
+		ReportCommandProgress(ctx, CommandStageConnecting, "")
+		ReportCommandProgress(ctx, CommandStageSession, "")
+		ReportCommandProgress(ctx, CommandStageSent, "")
+		return successResult(), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, history := store.waitFinished(t, succeeded.ID)
+	want := []string{model.CommandJobQueued, model.CommandJobConnecting, model.CommandJobSent, model.CommandJobSucceeded}
+	if !reflect.DeepEqual(history, want) || job.Response == "" {
+		t.Fatalf("history %v, response %q", history, job.Response)
+	}
+
+	declined := &model.CommandJob{Command: "charge_start"}
+	_ = jobs.Submit(context.Background(), declined, func(ctx context.Context) (*CommandResult, error) {
+		return nil, &CommandDeclinedError{Reason: "is_charging", Result: nominalResult("is_charging")}
+	})
+	if job, _ := store.waitFinished(t, declined.ID); job.Status != model.CommandJobFailed || job.Reason != "is_charging" || job.Response == "" {
+		t.Fatalf("declined job = %+v", job)
+	}
+
+	failed := &model.CommandJob{Command: "honk_horn"}
+	_ = jobs.Submit(context.Background(), failed, func(ctx context.Context) (*CommandResult, error) {
+		return nil, errors.New("vehicle offline")
+	})
+	if job, _ := store.waitFinished(t, failed.ID); job.Status != model.CommandJobFailed || job.Reason != "vehicle offline" {
+		t.Fatalf("failed job = %+v", job)
+	}
+}
+
+func TestCommandJobServiceQueueFull(t *testing.T) {
+	store := newMemoryJobStore()
+	jobs := NewCommandJobService(store, "test", 1, 1, time.Second)
+	release := make(chan struct{})
+	defer close(release)
+	block := func(ctx context.Context) (*CommandResult, error) {
+		<-release
+		return successResult(), nil
+	}
+
+	var err error
+	var job *model.CommandJob
+	for i := 0; i < 3 && err == nil; i++ {
+		job = &model.CommandJob{Command: "flash_lights"}
+		err = jobs.Submit(context.Background(), job, block)
+		time.Sleep(10 * time.Millisecond) // let the worker pick up the first job
+	}
+	if !errors.Is(err, ErrCommandQueueFull) {
+		t.Fatalf("expected ErrCommandQueueFull, got %v", err)
+	}
+	// A full queue is server overload, not a quota the caller hit.
+	if rejected, _ := store.waitFinished(t, job.ID); rejected.ErrorCode != apierror.CodeServiceOverloaded {
+		t.Fatalf("rejected job = %+v", rejected)
+	}
+}
+
+func TestCommandJobServiceStreamsProgress(t *testing.T) {
+	jobs := NewCommandJobService(newMemoryJobStore(), "test", 1, 1, time.Second)
+	start := make(chan struct{})
+	job := &model.CommandJob{Command: "door_unlock"}
+	err := jobs.Submit(context.Background(), job, func(ctx context.Context) (*CommandResult, error) {
+		<-start
+		ReportCommandProgress(ctx, CommandStageConnecting, "")
+		ReportCommandProgress(ctx, CommandStageRESTFallback, "vehicle does not accept signed commands")
+		ReportCommandProgress(ctx, CommandStageSent, "")
+		return successResult(), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events, cancel, live := jobs.Subscribe(job.ID)
+	defer cancel()
+	if !live {
+		t.Fatal("expected a live subscription for a queued job")
+	}
+	close(start)
+
+	var stages []string
+	for progress := range events {
+		stages = append(stages, progress.Stage)
+	}
+	want := []string{CommandStageConnecting, CommandStageRESTFallback, CommandStageSent, CommandStageSucceeded}
+	if !reflect.DeepEqual(stages, want) {
+		t.Fatalf("stages = %v, want %v", stages, want)
+	}
+
+	if _, cancel, live := jobs.Subscribe(job.ID); live {
+		cancel()
+		t.Fatal("finished job should not be live")
+	}
+}
@@ -0,0 +1,329 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"tds_server/internal/apierror"
+	"tds_server/internal/model"
+
+	"github.com/google/uuid"
+)
+
+// ErrSceneNameTaken is returned when the user already has another scene with the same name.
+var ErrSceneNameTaken = errors.New("a scene with this name already exists")
+
+const (
+	// MaxSceneSteps bounds the steps of one scene.
+	MaxSceneSteps = 20
+	// MaxSceneDelay bounds the total delay of a scene, and so the delay of each step.
+	MaxSceneDelay = 15 * time.Minute
+	// SceneStepBudget is the time allowed per step when sizing the job of an asynchronous scene.
+	SceneStepBudget = 30 * time.Second
+	// MaxSyncSceneDuration bounds SceneDuration for a scene run synchronously. It stays below
+	// DefaultIdempotencyLockTimeout, so a retry with the same Idempotency-Key cannot start a second run
+	// while the first is still executing, and below usual proxy timeouts; longer scenes run as jobs.
+	MaxSyncSceneDuration = 2 * time.Minute
+	maxSceneNameLength   = 100
+)
+
+// Outcomes of a scene step. 场景中单个步骤的执行结果。
+const (
+	SceneStepSucceeded = "succeeded"
+	// SceneStepDeclined means the vehicle received the command but refused it (result false).
+	SceneStepDeclined = "declined"
+	SceneStepFailed   = "failed"
+	// SceneStepSkipped means the step's condition did not hold.
+	SceneStepSkipped = "skipped"
+	// SceneStepNotRun follows a failed step that stopped the scene.
+	SceneStepNotRun = "not_run"
+)
+
+// Operators of a scene condition.
+const (
+	SceneConditionEq  = "eq"
+	SceneConditionNe  = "ne"
+	SceneConditionLt  = "lt"
+	SceneConditionLte = "lte"
+	SceneConditionGt  = "gt"
+	SceneConditionGte = "gte"
+)
+
+// sceneStateSections are the vehicle_data sections a condition may read.
+var sceneStateSections = map[string]bool{
+	"charge_state": true, "climate_state": true, "drive_state": true, "gui_settings": true,
+	"location_data": true, "vehicle_config": true, "vehicle_state": true,
+}
+
+// CommandSceneStore persists scenes; repository.CommandSceneRepo implements it.
+type CommandSceneStore interface {
+	List(userID uuid.UUID) ([]model.CommandScene, error)
+	Get(userID, id uuid.UUID) (*model.CommandScene, error)
+	Save(scene *model.CommandScene) error
+	Delete(userID, id uuid.UUID) error
+}
+
+// CommandSceneService stores the users' command scenes. CommandSceneService 管理用户的指令场景。
+type CommandSceneService struct {
+	store CommandSceneStore
+}
+
+func NewCommandSceneService(store CommandSceneStore) *CommandSceneService {
+	return &CommandSceneService{store: store}
+}
+
+// List returns the user's scenes ordered by name.
+func (s *CommandSceneService) List(userID uuid.UUID) ([]model.CommandScene, error) {
+	return s.store.List(userID)
+}
+
+// Get returns the user's scene, or an error satisfying repository.IsNotFound.
+func (s *CommandSceneService) Get(userID, id uuid.UUID) (*model.CommandScene, error) {
+	return s.store.Get(userID, id)
+}
+
+// Delete removes the user's scene, or returns an error satisfying repository.IsNotFound.
+func (s *CommandSceneService) Delete(userID, id uuid.UUID) error {
+	return s.store.Delete(userID, id)
+}
+
+// Save validates and stores scene, assigning an id to new scenes. Invalid scenes are reported as
+// field errors; a name used by another of the user's scenes yields ErrSceneNameTaken.
+func (s *CommandSceneService) Save(scene *model.CommandScene) ([]FieldError, error) {
+	scene.Name = strings.TrimSpace(scene.Name)
+	if fieldErrors := ValidateScene(scene.Name, scene.Steps); len(fieldErrors) > 0 {
+		return fieldErrors, nil
+	}
+	scenes, err := s.store.List(scene.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("list scenes: %w", err)
+	}
+	for _, existing := range scenes {
+		if existing.ID != scene.ID && strings.EqualFold(existing.Name, scene.Name) {
+			return nil, ErrSceneNameTaken
+		}
+	}
+	if scene.ID == uuid.Nil {
+		scene.ID = uuid.New()
+	}
+	if err := s.store.Save(scene); err != nil {
+		return nil, fmt.Errorf("save scene: %w", err)
+	}
+	return nil, nil
+}
+
+// ValidateScene checks a scene's name and steps, including every step's command parameters against
+// the command catalog. ValidateScene 校验场景名称与各步骤的指令、参数、延时和条件。
+func ValidateScene(name string, steps []model.SceneStep) []FieldError {
+	var fieldErrors []FieldError
+	if name == "" || utf8.RuneCountInString(name) > maxSceneNameLength {
+		fieldErrors = append(fieldErrors, FieldError{Field: "name", Message: fmt.Sprintf("must be 1 to %d characters", maxSceneNameLength)})
+	}
+	if len(steps) == 0 || len(steps) > MaxSceneSteps {
+		return append(fieldErrors, FieldError{Field: "steps", Message: fmt.Sprintf("must contain 1 to %d steps", MaxSceneSteps)})
+	}
+
+	var delay time.Duration
+	for i, step := range steps {
+		prefix := fmt.Sprintf("steps[%d].", i)
+		spec, ok := LookupCommand(step.Command)
+		switch {
+		case !ok:
+			fieldErrors = append(fieldErrors, FieldError{Field: prefix + "command", Message: fmt.Sprintf("unknown command %q", step.Command)})
+		case spec.Path == CommandPathUnsupported:
+			fieldErrors = append(fieldErrors, FieldError{Field: prefix + "command", Message: fmt.Sprintf("command %q is not supported", step.Command)})
+		default:
+			paramErrors, err := ValidateCommandParams(step.Command, SceneStepParams(step))
+			if err != nil {
+				fieldErrors = append(fieldErrors, FieldError{Field: prefix + "params", Message: err.Error()})
+			}
+			for _, paramErr := range paramErrors {
+				fieldErrors = append(fieldErrors, FieldError{Field: prefix + "params." + paramErr.Field, Message: paramErr.Message})
+			}
+		}
+		if step.DelaySeconds < 0 || step.DelaySeconds > int(MaxSceneDelay.Seconds()) {
+			fieldErrors = append(fieldErrors, FieldError{Field: prefix + "delay_seconds", Message: fmt.Sprintf("must be 0 to %d", int(MaxSceneDelay.Seconds()))})
+			continue
+		}
+		delay += time.Duration(step.DelaySeconds) * time.Second
+		if step.Condition != nil {
+			if message := validateSceneCondition(step.Condition); message != "" {
+				fieldErrors = append(fieldErrors, FieldError{Field: prefix + "condition", Message: message})
+			}
+		}
+	}
+	if delay > MaxSceneDelay {
+		fieldErrors = append(fieldErrors, FieldError{Field: "steps", Message: fmt.Sprintf("delays must add up to at most %d seconds", int(MaxSceneDelay.Seconds()))})
+	}
+	return fieldErrors
+}
+
+func validateSceneCondition(condition *model.SceneCondition) string {
+	section, field, _ := strings.Cut(condition.Field, ".")
+	if !sceneStateSections[section] || field == "" {
+		return "field must be a vehicle_data path such as climate_state.outside_temp"
+	}
+	switch condition.Op {
+	case SceneConditionEq, SceneConditionNe:
+		if condition.Value == nil {
+			return "value is required"
+		}
+	case SceneConditionLt, SceneConditionLte, SceneConditionGt, SceneConditionGte:
+		if _, ok := toFloat(condition.Value); !ok {
+			return "value must be a number for " + condition.Op
+		}
+	default:
+		return "op must be one of eq, ne, lt, lte, gt, gte"
+	}
+	return ""
+}
+
+// SceneStepParams returns the command body of step, or nil when it has none.
+func SceneStepParams(step model.SceneStep) []byte {
+	params := strings.TrimSpace(string(step.Params))
+	if params == "" || params == "null" {
+		return nil
+	}
+	return []byte(params)
+}
+
+// SceneTimeout is the time an asynchronous run of steps may take: jobTimeout for waking the vehicle
+// plus SceneDuration.
+func SceneTimeout(steps []model.SceneStep, jobTimeout time.Duration) time.Duration {
+	return jobTimeout + SceneDuration(steps)
+}
+
+// SceneDuration is the time the steps may take once the vehicle is awake: their delays plus
+// SceneStepBudget per step.
+func SceneDuration(steps []model.SceneStep) time.Duration {
+	duration := time.Duration(len(steps)) * SceneStepBudget
+	for _, step := range steps {
+		duration += time.Duration(step.DelaySeconds) * time.Second
+	}
+	return duration
+}
+
+// SceneStepResult is the outcome of one step of a scene run.
+type SceneStepResult struct {
+	Index   int    `json:"index"`
+	Command string `json:"command"`
+	Status  string `json:"status"`
+	// Reason explains a failure, a declined command or a skipped step.
+	Reason    string `json:"reason,omitempty"`
+	ErrorCode string `json:"error_code,omitempty"`
+	// Observed is the value the step's condition was evaluated on.
+	Observed     any                  `json:"observed,omitempty"`
+	Response     json.RawMessage      `json:"response,omitempty"`
+	Verification *CommandVerification `json:"verification,omitempty"`
+}
+
+// SceneRunResult reports a scene run step by step. Result is false when a step failed or was
+// declined; Stopped is true when that ended the scene early.
+type SceneRunResult struct {
+	SceneID string            `json:"scene_id"`
+	Name    string            `json:"name"`
+	VIN     string            `json:"vin,omitempty"`
+	Result  bool              `json:"result"`
+	Stopped bool              `json:"stopped,omitempty"`
+	Steps   []SceneStepResult `json:"steps"`
+}
+
+// FailedStep returns the first failed or declined step, or nil.
+func (r *SceneRunResult) FailedStep() *SceneStepResult {
+	for i := range r.Steps {
+		if r.Steps[i].Status == SceneStepFailed || r.Steps[i].Status == SceneStepDeclined {
+			return &r.Steps[i]
+		}
+	}
+	return nil
+}
+
+// RunScene executes the steps of scene in order through exec, waiting for each step's delay and
+// checking its condition against vehicle_data read through fetch. exec returns the status, reason and
+// response of one command. RunScene 按顺序执行场景步骤，处理延时、条件与失败停止。
+func RunScene(ctx context.Context, scene *model.CommandScene, fetch VehicleStateFetcher, exec func(step model.SceneStep) SceneStepResult) SceneRunResult {
+	result := SceneRunResult{SceneID: scene.ID.String(), Name: scene.Name, Result: true, Steps: make([]SceneStepResult, 0, len(scene.Steps))}
+	for i, step := range scene.Steps {
+		if result.Stopped {
+			result.Steps = append(result.Steps, SceneStepResult{Index: i, Command: step.Command, Status: SceneStepNotRun})
+			continue
+		}
+		ReportCommandProgress(ctx, CommandStageStep, fmt.Sprintf("%d/%d %s", i+1, len(scene.Steps), step.Command))
+		outcome := runSceneStep(ctx, step, fetch, exec)
+		outcome.Index, outcome.Command = i, step.Command
+		if outcome.Status == SceneStepFailed || outcome.Status == SceneStepDeclined {
+			result.Result = false
+			result.Stopped = !scene.ContinueOnFailure && !step.ContinueOnFailure && i < len(scene.Steps)-1
+		}
+		result.Steps = append(result.Steps, outcome)
+	}
+	return result
+}
+
+func runSceneStep(ctx context.Context, step model.SceneStep, fetch VehicleStateFetcher, exec func(step model.SceneStep) SceneStepResult) SceneStepResult {
+	if step.DelaySeconds > 0 && !sleepContext(ctx, time.Duration(step.DelaySeconds)*time.Second) {
+		return SceneStepResult{Status: SceneStepFailed, Reason: "scene cancelled during delay: " + ctx.Err().Error()}
+	}
+	if ctx.Err() != nil {
+		return SceneStepResult{Status: SceneStepFailed, Reason: "scene cancelled: " + ctx.Err().Error()}
+	}
+
+	var observed any
+	if condition := step.Condition; condition != nil {
+		data, err := fetch(ctx, stateSections([]StateCheck{{Field: condition.Field}}))
+		if err != nil {
+			outcome := SceneStepResult{Status: SceneStepFailed, Reason: "read vehicle state: " + err.Error()}
+			var apiErr *apierror.Error
+			if errors.As(err, &apiErr) {
+				outcome.ErrorCode = apiErr.Code
+			}
+			return outcome
+		}
+		observed = lookupField(data, condition.Field)
+		if !sceneConditionHolds(condition, observed) {
+			return SceneStepResult{Status: SceneStepSkipped, Observed: observed,
+				Reason: fmt.Sprintf("condition %s %s %v not met", condition.Field, condition.Op, condition.Value)}
+		}
+	}
+
+	outcome := exec(step)
+	outcome.Observed = observed
+	return outcome
+}
+
+// sceneConditionHolds evaluates condition on the observed value; a missing field never matches.
+func sceneConditionHolds(condition *model.SceneCondition, observed any) bool {
+	if observed == nil {
+		return false
+	}
+	switch condition.Op {
+	case SceneConditionEq:
+		return stateValueMatches(observed, condition.Value, 0)
+	case SceneConditionNe:
+		return !stateValueMatches(observed, condition.Value, 0)
+	}
+	a, ok := toFloat(observed)
+	if !ok {
+		return false
+	}
+	b, ok := toFloat(condition.Value)
+	if !ok {
+		return false
+	}
+	switch condition.Op {
+	case SceneConditionLt:
+		return a < b
+	case SceneConditionLte:
+		return a <= b
+	case SceneConditionGt:
+		return a > b
+	case SceneConditionGte:
+		return a >= b
+	}
+	return false
+}
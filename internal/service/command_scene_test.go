@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"tds_server/internal/model"
+)
+
+func TestValidateScene(t *testing.T) {
+	steps := []model.SceneStep{
+		{Command: "auto_conditioning_start"},
+		{Command: "set_temps", Params: json.RawMessage(`{"driver_temp": 21, "passenger_temp": 21}`)},
+		{Command: "remote_seat_heater_request", Params: json.RawMessage(`{"seat_position": 0, "level": 3}`),
+			Condition: &model.SceneCondition{Field: "climate_state.outside_temp", Op: SceneConditionLt, Value: 5.0}},
+		{Command: "door_unlock", DelaySeconds: 60},
+	}
+	if fieldErrors := ValidateScene("leave for work", steps); len(fieldErrors) != 0 {
+		t.Fatalf("valid scene rejected: %+v", fieldErrors)
+	}
+
+	invalid := []model.SceneStep{
+		{Command: "no_such_command"},
+		{Command: "set_charge_limit", Params: json.RawMessage(`{"percent": 200}`)},
+		{Command: "door_lock", DelaySeconds: -1},
+		{Command: "door_lock", Condition: &model.SceneCondition{Field: "outside_temp", Op: SceneConditionLt, Value: 5.0}},
+		{Command: "door_lock", Condition: &model.SceneCondition{Field: "climate_state.outside_temp", Op: SceneConditionLt, Value: "cold"}},
+	}
+	want := []string{"name", "steps[0].command", "steps[1].params.percent", "steps[2].delay_seconds", "steps[3].condition", "steps[4].condition"}
+	fieldErrors := ValidateScene("", invalid)
+	if len(fieldErrors) != len(want) {
+		t.Fatalf("field errors = %+v, want fields %v", fieldErrors, want)
+	}
+	for i, field := range want {
+		if fieldErrors[i].Field != field {
+			t.Fatalf("field error %d = %+v, want %s", i, fieldErrors[i], field)
+		}
+	}
+}
+
+func TestRunScene(t *testing.T) {
+	outsideTemp := 10.0
+	fetch := func(_ context.Context, sections []string) (map[string]any, error) {
+		if len(sections) != 1 || sections[0] != "climate_state" {
+			t.Fatalf("sections = %v", sections)
+		}
+		return map[string]any{"climate_state": map[string]any{"outside_temp": outsideTemp}}, nil
+	}
+	var executed []string
+	exec := func(step model.SceneStep) SceneStepResult {
+		executed = append(executed, step.Command)
+		if step.Command == "door_unlock" {
+			return SceneStepResult{Status: SceneStepDeclined, Reason: "already_set"}
+		}
+		return SceneStepResult{Status: SceneStepSucceeded}
+	}
+	scene := &model.CommandScene{Name: "leave for work", Steps: []model.SceneStep{
+		{Command: "auto_conditioning_start"},
+		{Command: "remote_seat_heater_request", Condition: &model.SceneCondition{Field: "climate_state.outside_temp", Op: SceneConditionLt, Value: 5.0}},
+		{Command: "door_unlock"},
+		{Command: "flash_lights"},
+	}}
+
+	result := RunScene(context.Background(), scene, fetch, exec)
+	statuses := []string{SceneStepSucceeded, SceneStepSkipped, SceneStepDeclined, SceneStepNotRun}
+	for i, status := range statuses {
+		if result.Steps[i].Status != status {
+			t.Fatalf("step %d: %+v, want %s", i, result.Steps[i], status)
+		}
+	}
+	if result.Result || !result.Stopped || result.Steps[1].Observed != 10.0 || len(executed) != 2 {
+		t.Fatalf("stop on failure: %+v, executed %v", result, executed)
+	}
+	if failed := result.FailedStep(); failed == nil || failed.Index != 2 {
+		t.Fatalf("failed step = %+v", failed)
+	}
+
+	outsideTemp, executed = 2, nil
+	scene.Steps[2].ContinueOnFailure = true
+	result = RunScene(context.Background(), scene, fetch, exec)
+	if result.Result || result.Stopped || len(executed) != 4 || result.Steps[3].Status != SceneStepSucceeded {
+		t.Fatalf("continue on failure: %+v, executed %v", result, executed)
+	}
+}
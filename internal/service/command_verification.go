@@ -0,0 +1,250 @@
+package service
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Outcomes of post-command state verification. 指令执行后的状态校验结果。
+const (
+	// VerificationConfirmed means vehicle_data shows the state the command should have produced.
+	VerificationConfirmed = "confirmed"
+	// VerificationMismatched means vehicle_data was read but still differed when time ran out.
+	VerificationMismatched = "mismatched"
+	// VerificationTimedOut means vehicle_data could not be read before time ran out.
+	VerificationTimedOut = "timed_out"
+	// VerificationUnverified means vehicle_data was read earlier but the final read failed, so the
+	// outcome is unknown.
+	VerificationUnverified = "unverified"
+	// VerificationUnsupported means the command has no observable effect to check.
+	VerificationUnsupported = "unsupported"
+)
+
+const (
+	// DefaultCommandVerifyTimeout bounds the polling of vehicle_data after a command.
+	DefaultCommandVerifyTimeout = 30 * time.Second
+	// DefaultCommandVerifyInterval is the delay between two vehicle_data reads.
+	DefaultCommandVerifyInterval = 2 * time.Second
+)
+
+// StateCheck is one expected field of vehicle_data after a command.
+type StateCheck struct {
+	// Field is the path of the field in vehicle_data, e.g. vehicle_state.locked.
+	Field    string `json:"field"`
+	Expected any    `json:"expected"`
+	// Not requires the field to differ from Expected, e.g. charging_state after charge_stop.
+	Not bool `json:"not,omitempty"`
+	// Tolerance is the allowed difference for numbers, since the vehicle rounds some settings.
+	Tolerance float64 `json:"-"`
+}
+
+// CommandVerification reports whether a command's effect became visible in vehicle_data.
+type CommandVerification struct {
+	Status string       `json:"status"`
+	Checks []StateCheck `json:"checks,omitempty"`
+	// Observed holds the last value read for each checked field.
+	Observed map[string]any `json:"observed,omitempty"`
+	// Reason is the last read error of a timed-out or unverified verification.
+	Reason    string `json:"reason,omitempty"`
+	Attempts  int    `json:"attempts"`
+	ElapsedMS int64  `json:"elapsed_ms"`
+}
+
+// VehicleStateFetcher reads the given vehicle_data sections, e.g. vehicle_state and charge_state.
+type VehicleStateFetcher func(ctx context.Context, sections []string) (map[string]any, error)
+
+// commandExpectations derives the expected vehicle_data fields from the command parameters. A nil
+// result means the parameters have no observable effect. 各指令执行后预期的车辆状态。
+var commandExpectations = map[string]func(params map[string]any) []StateCheck{
+	"door_lock":                            expect("vehicle_state.locked", true),
+	"door_unlock":                          expect("vehicle_state.locked", false),
+	"set_sentry_mode":                      expectParam("vehicle_state.sentry_mode", "on", 0),
+	"set_valet_mode":                       expectParam("vehicle_state.valet_mode", "on", 0),
+	"set_vehicle_name":                     expectParam("vehicle_state.vehicle_name", "vehicle_name", 0),
+	"speed_limit_activate":                 expect("vehicle_state.speed_limit_mode.active", true),
+	"speed_limit_deactivate":               expect("vehicle_state.speed_limit_mode.active", false),
+	"adjust_volume":                        expectParam("vehicle_state.media_info.audio_volume", "volume", 0.5),
+	"set_charge_limit":                     expectParam("charge_state.charge_limit_soc", "percent", 0),
+	"set_charging_amps":                    expectParam("charge_state.charge_current_request", "charging_amps", 0),
+	"charge_start":                         expect("charge_state.charging_state", "Charging"),
+	"charge_stop":                          expectNot("charge_state.charging_state", "Charging"),
+	"charge_port_door_open":                expect("charge_state.charge_port_door_open", true),
+	"charge_port_door_close":               expect("charge_state.charge_port_door_open", false),
+	"auto_conditioning_start":              expect("climate_state.is_climate_on", true),
+	"auto_conditioning_stop":               expect("climate_state.is_climate_on", false),
+	"remote_steering_wheel_heater_request": expectParam("climate_state.steering_wheel_heater", "on", 0),
+	"set_temps": func(params map[string]any) []StateCheck {
+		var checks []StateCheck
+		for _, param := range []string{"driver_temp", "passenger_temp"} {
+			if value, ok := params[param]; ok {
+				checks = append(checks, StateCheck{Field: "climate_state." + param + "_setting", Expected: value, Tolerance: 0.5})
+			}
+		}
+		return checks
+	},
+	"remote_seat_heater_request": func(params map[string]any) []StateCheck {
+		position, _ := params["seat_position"].(float64)
+		// Only the seats vehicle_data reports a heater level for.
+		field, ok := map[float64]string{0: "seat_heater_left", 1: "seat_heater_right", 2: "seat_heater_rear_left",
+			4: "seat_heater_rear_center", 5: "seat_heater_rear_right"}[position]
+		if !ok {
+			return nil
+		}
+		return []StateCheck{{Field: "climate_state." + field, Expected: params["level"]}}
+	},
+	"window_control": func(params map[string]any) []StateCheck {
+		var checks []StateCheck
+		for _, window := range []string{"fd_window", "fp_window", "rd_window", "rp_window"} {
+			// 0 is closed; vented windows report a non-zero position.
+			checks = append(checks, StateCheck{Field: "vehicle_state." + window, Expected: 0, Not: params["command"] == "vent"})
+		}
+		return checks
+	},
+}
+
+func expect(field string, value any) func(map[string]any) []StateCheck {
+	return func(map[string]any) []StateCheck { return []StateCheck{{Field: field, Expected: value}} }
+}
+
+func expectNot(field string, value any) func(map[string]any) []StateCheck {
+	return func(map[string]any) []StateCheck { return []StateCheck{{Field: field, Expected: value, Not: true}} }
+}
+
+func expectParam(field, param string, tolerance float64) func(map[string]any) []StateCheck {
+	return func(params map[string]any) []StateCheck {
+		value, ok := params[param]
+		if !ok {
+			return nil
+		}
+		return []StateCheck{{Field: field, Expected: value, Tolerance: tolerance}}
+	}
+}
+
+// CommandStateChecks returns the vehicle_data fields a command with params should change; nil when
+// the command has no observable effect.
+func CommandStateChecks(command string, params map[string]any) []StateCheck {
+	if expectation, ok := commandExpectations[command]; ok {
+		return expectation(params)
+	}
+	return nil
+}
+
+// VerifyCommandState polls vehicle_data through fetch until every check holds or timeout passes.
+// VerifyCommandState 轮询 vehicle_data，直到状态符合预期或超时。
+func VerifyCommandState(ctx context.Context, checks []StateCheck, fetch VehicleStateFetcher, timeout, interval time.Duration) CommandVerification {
+	result := CommandVerification{Status: VerificationUnsupported, Checks: checks}
+	if len(checks) == 0 {
+		return result
+	}
+	ReportCommandProgress(ctx, CommandStageVerifying, "")
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	sections := stateSections(checks)
+	for {
+		result.Attempts++
+		data, err := fetch(ctx, sections)
+		if err != nil {
+			result.Reason = err.Error()
+		} else {
+			result.Reason = ""
+			observed, ok := evaluateStateChecks(checks, data)
+			result.Observed = observed
+			if ok {
+				result.Status = VerificationConfirmed
+				break
+			}
+		}
+		if !sleepContext(ctx, interval) {
+			switch {
+			case result.Observed == nil:
+				result.Status = VerificationTimedOut
+			case result.Reason != "":
+				// A mismatch seen before the failed read may already be outdated.
+				result.Status = VerificationUnverified
+				result.Observed = nil
+			default:
+				result.Status = VerificationMismatched
+			}
+			break
+		}
+	}
+	result.ElapsedMS = time.Since(start).Milliseconds()
+	return result
+}
+
+// sleepContext waits for d and reports false when ctx ends first.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// stateSections lists the vehicle_data sections the checks read, in order of first use.
+func stateSections(checks []StateCheck) []string {
+	var sections []string
+	for _, check := range checks {
+		section, _, _ := strings.Cut(check.Field, ".")
+		if !slices.Contains(sections, section) {
+			sections = append(sections, section)
+		}
+	}
+	return sections
+}
+
+// evaluateStateChecks returns the observed value of every checked field and whether all checks hold.
+func evaluateStateChecks(checks []StateCheck, data map[string]any) (map[string]any, bool) {
+	observed := make(map[string]any, len(checks))
+	ok := true
+	for _, check := range checks {
+		value := lookupField(data, check.Field)
+		observed[check.Field] = value
+		if value == nil || stateValueMatches(value, check.Expected, check.Tolerance) == check.Not {
+			ok = false
+		}
+	}
+	return observed, ok
+}
+
+func lookupField(data map[string]any, path string) any {
+	var value any = data
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		value = object[key]
+	}
+	return value
+}
+
+// stateValueMatches compares numbers numerically within tolerance and other values exactly.
+func stateValueMatches(observed, expected any, tolerance float64) bool {
+	if a, ok := toFloat(observed); ok {
+		if b, ok := toFloat(expected); ok {
+			return math.Abs(a-b) <= tolerance
+		}
+	}
+	return reflect.DeepEqual(observed, expected)
+}
+
+func toFloat(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCommandStateChecks(t *testing.T) {
+	checks := CommandStateChecks("set_temps", map[string]any{"driver_temp": 21.5, "passenger_temp": 22.0})
+	if len(checks) != 2 || checks[0].Field != "climate_state.driver_temp_setting" || checks[1].Field != "climate_state.passenger_temp_setting" {
+		t.Fatalf("set_temps checks: %+v", checks)
+	}
+	if checks := CommandStateChecks("set_charge_limit", map[string]any{}); checks != nil {
+		t.Fatalf("missing parameter must not produce checks: %+v", checks)
+	}
+	if checks := CommandStateChecks("honk_horn", nil); checks != nil {
+		t.Fatalf("honk_horn has no observable effect: %+v", checks)
+	}
+}
+
+func TestVerifyCommandState(t *testing.T) {
+	ctx := context.Background()
+	locked := func(values ...bool) VehicleStateFetcher {
+		calls := 0
+		return func(_ context.Context, sections []string) (map[string]any, error) {
+			if len(sections) != 1 || sections[0] != "vehicle_state" {
+				t.Fatalf("sections = %v", sections)
+			}
+			value := values[min(calls, len(values)-1)]
+			calls++
+			return map[string]any{"vehicle_state": map[string]any{"locked": value}}, nil
+		}
+	}
+	checks := CommandStateChecks("door_lock", nil)
+
+	result := VerifyCommandState(ctx, checks, locked(false, true), time.Second, time.Millisecond)
+	if result.Status != VerificationConfirmed || result.Attempts != 2 || result.Observed["vehicle_state.locked"] != true {
+		t.Fatalf("confirmed: %+v", result)
+	}
+	result = VerifyCommandState(ctx, checks, locked(false), 20*time.Millisecond, time.Millisecond)
+	if result.Status != VerificationMismatched || result.Observed["vehicle_state.locked"] != false {
+		t.Fatalf("mismatched: %+v", result)
+	}
+	offline := func(context.Context, []string) (map[string]any, error) { return nil, errors.New("vehicle is offline") }
+	result = VerifyCommandState(ctx, checks, offline, 20*time.Millisecond, time.Millisecond)
+	if result.Status != VerificationTimedOut || result.Reason != "vehicle is offline" {
+		t.Fatalf("timed out: %+v", result)
+	}
+	// The vehicle went offline after an early mismatch: the stale mismatch must not be reported.
+	calls := 0
+	wentOffline := func(context.Context, []string) (map[string]any, error) {
+		calls++
+		if calls == 1 {
+			return map[string]any{"vehicle_state": map[string]any{"locked": false}}, nil
+		}
+		return nil, errors.New("vehicle is offline")
+	}
+	result = VerifyCommandState(ctx, checks, wentOffline, 20*time.Millisecond, time.Millisecond)
+	if result.Status != VerificationUnverified || result.Reason != "vehicle is offline" || result.Observed != nil {
+		t.Fatalf("unverified: %+v", result)
+	}
+	if result := VerifyCommandState(ctx, nil, offline, time.Second, time.Millisecond); result.Status != VerificationUnsupported || result.Attempts != 0 {
+		t.Fatalf("unsupported: %+v", result)
+	}
+
+	// Numbers are compared within the command's tolerance.
+	temps := CommandStateChecks("set_temps", map[string]any{"driver_temp": 21.5})
+	fetch := func(context.Context, []string) (map[string]any, error) {
+		return map[string]any{"climate_state": map[string]any{"driver_temp_setting": 21.0}}, nil
+	}
+	if result := VerifyCommandState(ctx, temps, fetch, time.Second, time.Millisecond); result.Status != VerificationConfirmed {
+		t.Fatalf("tolerance: %+v", result)
+	}
+}
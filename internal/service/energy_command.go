@@ -0,0 +1,147 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ErrUnknownEnergyCommand is returned for commands outside the energy command catalog.
+var ErrUnknownEnergyCommand = errors.New("unknown energy command")
+
+// Operation modes accepted by the operation command.
+const (
+	EnergyModeSelfConsumption = "self_consumption"
+	EnergyModeAutonomous      = "autonomous"
+)
+
+// Export rules accepted by grid_import_export.
+const (
+	ExportRuleBatteryOK = "battery_ok"
+	ExportRulePVOnly    = "pv_only"
+	ExportRuleNever     = "never"
+)
+
+// energyCommand validates one command's body and returns the payload sent to Tesla.
+type energyCommand func(body []byte) (any, error)
+
+// energyCommands maps the command names, which are also Tesla's endpoint names, to their validators.
+// energyCommands 以特斯拉接口名为键，定义每个能源指令的参数校验。
+var energyCommands = map[string]energyCommand{
+	"backup": func(body []byte) (any, error) {
+		var params struct {
+			BackupReservePercent *int `json:"backup_reserve_percent"`
+		}
+		if err := decodeEnergyParams(body, &params); err != nil {
+			return nil, err
+		}
+		if err := requirePercent("backup_reserve_percent", params.BackupReservePercent); err != nil {
+			return nil, err
+		}
+		return params, nil
+	},
+	"operation": func(body []byte) (any, error) {
+		var params struct {
+			DefaultRealMode string `json:"default_real_mode"`
+		}
+		if err := decodeEnergyParams(body, &params); err != nil {
+			return nil, err
+		}
+		if params.DefaultRealMode != EnergyModeSelfConsumption && params.DefaultRealMode != EnergyModeAutonomous {
+			return nil, fmt.Errorf("default_real_mode must be %s or %s", EnergyModeSelfConsumption, EnergyModeAutonomous)
+		}
+		return params, nil
+	},
+	"storm_mode": func(body []byte) (any, error) {
+		var params struct {
+			Enabled *bool `json:"enabled"`
+		}
+		if err := decodeEnergyParams(body, &params); err != nil {
+			return nil, err
+		}
+		if params.Enabled == nil {
+			return nil, errors.New("enabled is required")
+		}
+		return params, nil
+	},
+	"grid_import_export": func(body []byte) (any, error) {
+		var params struct {
+			DisallowChargeFromGridWithSolarInstalled *bool  `json:"disallow_charge_from_grid_with_solar_installed,omitempty"`
+			CustomerPreferredExportRule              string `json:"customer_preferred_export_rule,omitempty"`
+		}
+		if err := decodeEnergyParams(body, &params); err != nil {
+			return nil, err
+		}
+		if params.DisallowChargeFromGridWithSolarInstalled == nil && params.CustomerPreferredExportRule == "" {
+			return nil, errors.New("disallow_charge_from_grid_with_solar_installed or customer_preferred_export_rule is required")
+		}
+		switch params.CustomerPreferredExportRule {
+		case "", ExportRuleBatteryOK, ExportRulePVOnly, ExportRuleNever:
+		default:
+			return nil, fmt.Errorf("customer_preferred_export_rule must be %s, %s or %s", ExportRuleBatteryOK, ExportRulePVOnly, ExportRuleNever)
+		}
+		return params, nil
+	},
+	"off_grid_vehicle_charging_reserve": func(body []byte) (any, error) {
+		var params struct {
+			OffGridVehicleChargingReservePercent *int `json:"off_grid_vehicle_charging_reserve_percent"`
+		}
+		if err := decodeEnergyParams(body, &params); err != nil {
+			return nil, err
+		}
+		if err := requirePercent("off_grid_vehicle_charging_reserve_percent", params.OffGridVehicleChargingReservePercent); err != nil {
+			return nil, err
+		}
+		return params, nil
+	},
+}
+
+// EnergyCommandNames lists the supported energy commands in alphabetical order.
+func EnergyCommandNames() []string {
+	names := make([]string, 0, len(energyCommands))
+	for name := range energyCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ValidateEnergyCommand checks the parameters of an energy site command and returns the normalized
+// JSON body to send to Tesla. Unknown commands yield ErrUnknownEnergyCommand; any other error
+// describes invalid parameters. ValidateEnergyCommand 校验能源指令参数并返回规范化后的请求体。
+func ValidateEnergyCommand(name string, body []byte) ([]byte, error) {
+	validate, ok := energyCommands[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownEnergyCommand, name)
+	}
+	params, err := validate(body)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(params)
+}
+
+// decodeEnergyParams decodes body strictly so misspelled parameters are reported instead of ignored.
+func decodeEnergyParams(body []byte, dest any) error {
+	if len(bytes.TrimSpace(body)) == 0 {
+		body = []byte("{}")
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(dest); err != nil {
+		return fmt.Errorf("invalid parameters: %w", err)
+	}
+	return nil
+}
+
+func requirePercent(field string, value *int) error {
+	if value == nil {
+		return fmt.Errorf("%s is required", field)
+	}
+	if *value < 0 || *value > 100 {
+		return fmt.Errorf("%s must be between 0 and 100", field)
+	}
+	return nil
+}
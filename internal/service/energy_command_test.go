@@ -0,0 +1,39 @@
+package service
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateEnergyCommand(t *testing.T) {
+	valid := map[string]struct{ body, want string }{
+		"backup":                            {`{"backup_reserve_percent": 20}`, `{"backup_reserve_percent":20}`},
+		"operation":                         {`{"default_real_mode": "autonomous"}`, `{"default_real_mode":"autonomous"}`},
+		"storm_mode":                        {`{"enabled": false}`, `{"enabled":false}`},
+		"grid_import_export":                {`{"customer_preferred_export_rule": "pv_only"}`, `{"customer_preferred_export_rule":"pv_only"}`},
+		"off_grid_vehicle_charging_reserve": {`{"off_grid_vehicle_charging_reserve_percent": 0}`, `{"off_grid_vehicle_charging_reserve_percent":0}`},
+	}
+	for name, tc := range valid {
+		payload, err := ValidateEnergyCommand(name, []byte(tc.body))
+		if err != nil || string(payload) != tc.want {
+			t.Fatalf("%s: payload %s, err %v", name, payload, err)
+		}
+	}
+
+	invalid := map[string]string{
+		"backup":                            `{"backup_reserve_percent": 101}`,
+		"operation":                         `{"default_real_mode": "backup"}`,
+		"storm_mode":                        ``,
+		"grid_import_export":                `{"customer_preferred_export_rule": "always"}`,
+		"off_grid_vehicle_charging_reserve": `{"percent": 20}`,
+	}
+	for name, body := range invalid {
+		if _, err := ValidateEnergyCommand(name, []byte(body)); err == nil || errors.Is(err, ErrUnknownEnergyCommand) {
+			t.Fatalf("%s %s: expected a parameter error, got %v", name, body, err)
+		}
+	}
+
+	if _, err := ValidateEnergyCommand("time_of_use_settings", nil); !errors.Is(err, ErrUnknownEnergyCommand) {
+		t.Fatalf("unknown command error = %v", err)
+	}
+}
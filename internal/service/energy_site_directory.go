@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrEnergySiteNotFound indicates the energy site is not among the user's products. ErrEnergySiteNotFound 表示能源站点不属于该用户。
+var ErrEnergySiteNotFound = errors.New("energy site not found")
+
+// EnergySiteLister fetches the ids of the current user's energy sites from Tesla's product list.
+type EnergySiteLister func(ctx context.Context) ([]int64, error)
+
+// EnergySiteDirectory caches the energy sites of each user's product list, the set of sites the user
+// may access, the same way VehicleDirectory caches vehicles. EnergySiteDirectory 按用户缓存有权访问的能源站点。
+type EnergySiteDirectory struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[uuid.UUID]*energySiteDirectoryEntry
+}
+
+type energySiteDirectoryEntry struct {
+	refreshMu sync.Mutex
+	sites     map[int64]struct{}
+	fetchedAt time.Time
+}
+
+// NewEnergySiteDirectory creates an EnergySiteDirectory whose cached lists expire after ttl.
+func NewEnergySiteDirectory(ttl time.Duration) *EnergySiteDirectory {
+	if ttl <= 0 {
+		ttl = defaultVehicleDirectoryTTL
+	}
+	return &EnergySiteDirectory{ttl: ttl, entries: map[uuid.UUID]*energySiteDirectoryEntry{}}
+}
+
+// Store replaces the cached energy sites of a user, typically after a ListProducts call.
+func (d *EnergySiteDirectory) Store(userID uuid.UUID, siteIDs []int64) {
+	sites := make(map[int64]struct{}, len(siteIDs))
+	for _, id := range siteIDs {
+		sites[id] = struct{}{}
+	}
+	entry := d.entry(userID)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	entry.sites, entry.fetchedAt = sites, time.Now()
+}
+
+// Check returns nil when siteID is one of the user's energy sites and ErrEnergySiteNotFound when it is
+// not. Like VehicleDirectory.Resolve, the cached list is refreshed through list when it is stale or,
+// at most every minVehicleRefreshInterval, when the site is unknown.
+// Check 校验能源站点是否属于用户，缓存过期或未命中时通过 list 刷新。
+func (d *EnergySiteDirectory) Check(ctx context.Context, userID uuid.UUID, siteID int64, list EnergySiteLister) error {
+	entry := d.entry(userID)
+	owned, fetchedAt := d.lookup(entry, siteID)
+	if age := time.Since(fetchedAt); !fetchedAt.IsZero() && age < d.ttl && (owned || age < minVehicleRefreshInterval) {
+		return siteResult(owned)
+	}
+
+	entry.refreshMu.Lock()
+	defer entry.refreshMu.Unlock()
+
+	// Another request may have refreshed the list while we waited for the lock.
+	if refreshedOwned, refreshedAt := d.lookup(entry, siteID); refreshedAt.After(fetchedAt) {
+		return siteResult(refreshedOwned)
+	}
+	if list == nil {
+		return ErrEnergySiteNotFound
+	}
+	siteIDs, err := list(ctx)
+	if err != nil {
+		return err
+	}
+	d.Store(userID, siteIDs)
+	owned, _ = d.lookup(entry, siteID)
+	return siteResult(owned)
+}
+
+func siteResult(owned bool) error {
+	if !owned {
+		return ErrEnergySiteNotFound
+	}
+	return nil
+}
+
+func (d *EnergySiteDirectory) entry(userID uuid.UUID) *energySiteDirectoryEntry {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	entry, ok := d.entries[userID]
+	if !ok {
+		entry = &energySiteDirectoryEntry{}
+		d.entries[userID] = entry
+	}
+	return entry
+}
+
+func (d *EnergySiteDirectory) lookup(entry *energySiteDirectoryEntry, siteID int64) (bool, time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, owned := entry.sites[siteID]
+	return owned, entry.fetchedAt
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"tds_server/internal/logging"
+	"tds_server/internal/model"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrIdempotencyInProgress is returned while the first request with a key is still executing.
+	ErrIdempotencyInProgress = errors.New("a request with this idempotency key is still being processed")
+	// ErrIdempotencyKeyReused is returned when a key is repeated with a different request.
+	ErrIdempotencyKeyReused = errors.New("idempotency key was already used for a different request")
+)
+
+const (
+	// DefaultIdempotencyWindow is how long the first response is replayed for repeats of a key.
+	DefaultIdempotencyWindow = 24 * time.Hour
+	// DefaultIdempotencyLockTimeout frees a key whose request never completed, e.g. after a crash.
+	DefaultIdempotencyLockTimeout = 5 * time.Minute
+)
+
+var idempotencyLog = logging.Logger(logging.SubsystemCommand)
+
+// IdempotencyStore persists idempotency keys; repository.IdempotencyRepo implements it.
+type IdempotencyStore interface {
+	// Acquire stores record as processing, or returns the unexpired record already holding the key.
+	Acquire(record *model.IdempotencyKey) (*model.IdempotencyKey, error)
+	Complete(userID uuid.UUID, key string, response model.IdempotencyKey, expiresAt time.Time) error
+	Release(userID uuid.UUID, key string) error
+	DeleteExpired() (int64, error)
+}
+
+// IdempotencyService makes command requests carrying an Idempotency-Key safe to retry: the first
+// request executes and its response is stored, repeats get the stored response, and duplicates
+// arriving while the first is still executing are refused.
+// IdempotencyService 保证携带相同幂等键的指令请求只执行一次。
+type IdempotencyService struct {
+	store       IdempotencyStore
+	window      time.Duration
+	lockTimeout time.Duration
+}
+
+// NewIdempotencyService replays responses for window; non-positive values use the defaults.
+func NewIdempotencyService(store IdempotencyStore, window, lockTimeout time.Duration) *IdempotencyService {
+	if window <= 0 {
+		window = DefaultIdempotencyWindow
+	}
+	if lockTimeout <= 0 {
+		lockTimeout = DefaultIdempotencyLockTimeout
+	}
+	return &IdempotencyService{store: store, window: window, lockTimeout: lockTimeout}
+}
+
+// Begin claims key for the request identified by fingerprint. It returns nil when the caller should
+// execute the request and then call Complete or Release, the stored record when the request already
+// completed, ErrIdempotencyInProgress while it is executing and ErrIdempotencyKeyReused when the key
+// belongs to another request.
+func (s *IdempotencyService) Begin(userID uuid.UUID, key, fingerprint string) (*model.IdempotencyKey, error) {
+	existing, err := s.store.Acquire(&model.IdempotencyKey{
+		UserID:      userID,
+		Key:         key,
+		Fingerprint: fingerprint,
+		Status:      model.IdempotencyProcessing,
+		ExpiresAt:   time.Now().Add(s.lockTimeout),
+	})
+	switch {
+	case err != nil:
+		return nil, fmt.Errorf("acquire idempotency key: %w", err)
+	case existing == nil:
+		return nil, nil
+	case existing.Fingerprint != fingerprint:
+		return nil, ErrIdempotencyKeyReused
+	case existing.Status != model.IdempotencyCompleted:
+		return nil, ErrIdempotencyInProgress
+	default:
+		return existing, nil
+	}
+}
+
+// Complete stores the response to replay for the rest of the window.
+func (s *IdempotencyService) Complete(userID uuid.UUID, key string, response model.IdempotencyKey) error {
+	return s.store.Complete(userID, key, response, time.Now().Add(s.window))
+}
+
+// Release frees key without storing a response, so the request may be retried with it.
+func (s *IdempotencyService) Release(userID uuid.UUID, key string) error {
+	return s.store.Release(userID, key)
+}
+
+// PurgeExpired deletes expired keys every interval; it never returns.
+func (s *IdempotencyService) PurgeExpired(interval time.Duration) {
+	for range time.Tick(interval) {
+		if deleted, err := s.store.DeleteExpired(); err != nil {
+			idempotencyLog.Error("purge idempotency keys failed", "error", err)
+		} else if deleted > 0 {
+			idempotencyLog.Debug("purged idempotency keys", "count", deleted)
+		}
+	}
+}
+
+// RequestFingerprint identifies a request by method, target and body so a key cannot be reused for
+// a different request.
+func RequestFingerprint(method, target string, body []byte) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s %s\n", method, target)
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"tds_server/internal/config"
+	"tds_server/internal/upstream"
 
 	"github.com/go-resty/resty/v2"
 )
@@ -52,7 +53,7 @@ func NewPartnerTokenService(cfg *config.Config) (*PartnerTokenService, error) {
 
 	svc := &PartnerTokenService{
 		cfg:    cfg,
-		client: resty.New(),
+		client: upstream.NewClient(),
 	}
 
 	if err := svc.refresh(context.Background()); err != nil {
@@ -111,8 +112,7 @@ func (s *PartnerTokenService) refreshLocked(ctx context.Context) error {
 	}
 	var tokenResp partnerTokenResponse
 
-	resp, err := s.client.R().
-		SetContext(ctx).
+	resp, err := newTeslaRequest(ctx, s.client).
 		SetHeader("Content-Type", "application/json").
 		SetHeader("User-Agent", defaultUserAgent).
 		SetBody(payload).
@@ -159,8 +159,7 @@ func (s *PartnerTokenService) registerPartnerAccount(ctx context.Context, token
 		"domain": s.cfg.TeslaPartnerDomain,
 	}
 
-	resp, err := s.client.R().
-		SetContext(ctx).
+	resp, err := newTeslaRequest(ctx, s.client).
 		SetHeader("Content-Type", "application/json").
 		SetHeader("Authorization", "Bearer "+token).
 		SetHeader("User-Agent", defaultUserAgent).
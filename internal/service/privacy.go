@@ -0,0 +1,195 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"tds_server/internal/model"
+)
+
+const (
+	// DefaultGeohashPrecision gives cells of roughly 4.9km x 4.9km.
+	DefaultGeohashPrecision = 5
+	minGeohashPrecision     = 1
+	maxGeohashPrecision     = 9
+	maxHomeRadiusMeters     = 50_000
+	earthRadiusMeters       = 6_371_000
+	geohashAlphabet         = "0123456789bcdefghjkmnpqrstuvwxyz"
+)
+
+// HomeZone is a circle in which coordinates are always masked. HomeZone 表示需要始终屏蔽坐标的“家”区域。
+type HomeZone struct {
+	Latitude     float64
+	Longitude    float64
+	RadiusMeters int
+}
+
+// LocationPolicy decides how coordinates are exposed to a client. The zero value returns coordinates
+// unchanged. LocationPolicy 决定坐标如何返回给客户端，零值表示原样返回。
+type LocationPolicy struct {
+	Mode             string
+	GeohashPrecision int
+	Home             *HomeZone
+}
+
+// NewLocationPolicy builds the policy for a vehicle grant from the stored setting (which may be nil)
+// and Tesla's granular_access.hide_private flag, which always forces coordinates to be hidden.
+// NewLocationPolicy 根据隐私设置与特斯拉 hide_private 标记生成策略，hide_private 为 true 时强制隐藏坐标。
+func NewLocationPolicy(setting *model.PrivacySetting, hidePrivate bool) LocationPolicy {
+	policy := LocationPolicy{Mode: model.LocationModeExact, GeohashPrecision: DefaultGeohashPrecision}
+	if setting != nil {
+		if setting.LocationMode != "" {
+			policy.Mode = setting.LocationMode
+		}
+		if setting.GeohashPrecision > 0 {
+			policy.GeohashPrecision = setting.GeohashPrecision
+		}
+		if setting.HasHomeZone() {
+			policy.Home = &HomeZone{
+				Latitude:     *setting.HomeLatitude,
+				Longitude:    *setting.HomeLongitude,
+				RadiusMeters: setting.HomeRadiusMeters,
+			}
+		}
+	}
+	if hidePrivate {
+		policy.Mode = model.LocationModeHidden
+	}
+	return policy
+}
+
+// IsExact reports whether the policy leaves every coordinate untouched.
+func (p LocationPolicy) IsExact() bool {
+	return (p.Mode == "" || p.Mode == model.LocationModeExact) && p.Home == nil
+}
+
+// HidesLocation reports whether coordinates and headings are stripped entirely.
+func (p LocationPolicy) HidesLocation() bool {
+	return p.Mode == model.LocationModeHidden
+}
+
+// InHomeZone reports whether the coordinate lies inside the configured home zone.
+func (p LocationPolicy) InHomeZone(lat, lon float64) bool {
+	if p.Home == nil {
+		return false
+	}
+	return haversineMeters(lat, lon, p.Home.Latitude, p.Home.Longitude) <= float64(p.Home.RadiusMeters)
+}
+
+// Apply returns the coordinate to expose, or ok=false when it must be stripped.
+// Apply 返回处理后的坐标，ok 为 false 时表示应移除该坐标。
+func (p LocationPolicy) Apply(lat, lon float64) (float64, float64, bool) {
+	if p.HidesLocation() || p.InHomeZone(lat, lon) {
+		return 0, 0, false
+	}
+	if p.Mode == model.LocationModeCoarse {
+		cellLat, cellLon := DecodeGeohash(EncodeGeohash(lat, lon, p.GeohashPrecision))
+		return cellLat, cellLon, true
+	}
+	return lat, lon, true
+}
+
+// ValidatePrivacySetting checks a setting before it is stored. ValidatePrivacySetting 在保存前校验隐私设置。
+func ValidatePrivacySetting(setting *model.PrivacySetting) error {
+	switch setting.LocationMode {
+	case model.LocationModeExact, model.LocationModeCoarse, model.LocationModeHidden:
+	default:
+		return fmt.Errorf("location_mode must be one of %s, %s, %s", model.LocationModeExact, model.LocationModeCoarse, model.LocationModeHidden)
+	}
+	if setting.GeohashPrecision < minGeohashPrecision || setting.GeohashPrecision > maxGeohashPrecision {
+		return fmt.Errorf("geohash_precision must be between %d and %d", minGeohashPrecision, maxGeohashPrecision)
+	}
+	if (setting.HomeLatitude == nil) != (setting.HomeLongitude == nil) {
+		return fmt.Errorf("home zone requires both latitude and longitude")
+	}
+	if setting.HomeLatitude != nil {
+		if math.Abs(*setting.HomeLatitude) > 90 || math.Abs(*setting.HomeLongitude) > 180 {
+			return fmt.Errorf("home zone coordinates are out of range")
+		}
+		if setting.HomeRadiusMeters <= 0 || setting.HomeRadiusMeters > maxHomeRadiusMeters {
+			return fmt.Errorf("home zone radius_meters must be between 1 and %d", maxHomeRadiusMeters)
+		}
+	}
+	return nil
+}
+
+// EncodeGeohash encodes a coordinate as a geohash of the given precision.
+func EncodeGeohash(lat, lon float64, precision int) string {
+	precision = min(max(precision, minGeohashPrecision), maxGeohashPrecision)
+	latRange := [2]float64{-90, 90}
+	lonRange := [2]float64{-180, 180}
+
+	var hash strings.Builder
+	even := true
+	bit, ch := 0, 0
+	for hash.Len() < precision {
+		if even {
+			mid := (lonRange[0] + lonRange[1]) / 2
+			if lon >= mid {
+				ch |= 1 << (4 - bit)
+				lonRange[0] = mid
+			} else {
+				lonRange[1] = mid
+			}
+		} else {
+			mid := (latRange[0] + latRange[1]) / 2
+			if lat >= mid {
+				ch |= 1 << (4 - bit)
+				latRange[0] = mid
+			} else {
+				latRange[1] = mid
+			}
+		}
+		even = !even
+		if bit < 4 {
+			bit++
+			continue
+		}
+		hash.WriteByte(geohashAlphabet[ch])
+		bit, ch = 0, 0
+	}
+	return hash.String()
+}
+
+// DecodeGeohash returns the centre of the geohash cell.
+func DecodeGeohash(hash string) (float64, float64) {
+	latRange := [2]float64{-90, 90}
+	lonRange := [2]float64{-180, 180}
+	even := true
+	for _, r := range hash {
+		idx := strings.IndexRune(geohashAlphabet, r)
+		if idx < 0 {
+			break
+		}
+		for bit := 4; bit >= 0; bit-- {
+			set := idx&(1<<bit) != 0
+			if even {
+				mid := (lonRange[0] + lonRange[1]) / 2
+				if set {
+					lonRange[0] = mid
+				} else {
+					lonRange[1] = mid
+				}
+			} else {
+				mid := (latRange[0] + latRange[1]) / 2
+				if set {
+					latRange[0] = mid
+				} else {
+					latRange[1] = mid
+				}
+			}
+			even = !even
+		}
+	}
+	return (latRange[0] + latRange[1]) / 2, (lonRange[0] + lonRange[1]) / 2
+}
+
+func haversineMeters(lat1, lon1, lat2, lon2 float64) float64 {
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat := toRad(lat2 - lat1)
+	dLon := toRad(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusMeters * math.Asin(math.Sqrt(a))
+}
@@ -0,0 +1,45 @@
+package service
+
+import (
+	"math"
+	"testing"
+
+	"tds_server/internal/model"
+)
+
+func TestGeohashRoundTrip(t *testing.T) {
+	if hash := EncodeGeohash(42.6, -5.6, 5); hash != "ezs42" {
+		t.Fatalf("EncodeGeohash = %q, want ezs42", hash)
+	}
+	lat, lon := DecodeGeohash("ezs42")
+	if math.Abs(lat-42.605) > 0.03 || math.Abs(lon+5.603) > 0.03 {
+		t.Fatalf("DecodeGeohash = %f,%f", lat, lon)
+	}
+}
+
+func TestLocationPolicy(t *testing.T) {
+	homeLat, homeLon := 31.2304, 121.4737
+	setting := &model.PrivacySetting{
+		LocationMode:     model.LocationModeCoarse,
+		GeohashPrecision: 5,
+		HomeLatitude:     &homeLat,
+		HomeLongitude:    &homeLon,
+		HomeRadiusMeters: 500,
+	}
+	policy := NewLocationPolicy(setting, false)
+
+	if _, _, ok := policy.Apply(31.2310, 121.4740); ok {
+		t.Fatal("coordinate inside the home zone must be stripped")
+	}
+	lat, lon, ok := policy.Apply(31.3000, 121.5000)
+	if !ok || (lat == 31.3 && lon == 121.5) {
+		t.Fatalf("coarse mode must snap to the cell centre, got %f,%f ok=%v", lat, lon, ok)
+	}
+
+	if _, _, ok := NewLocationPolicy(nil, true).Apply(31.3, 121.5); ok {
+		t.Fatal("hide_private must hide coordinates")
+	}
+	if !NewLocationPolicy(nil, false).IsExact() {
+		t.Fatal("missing setting must keep coordinates exact")
+	}
+}
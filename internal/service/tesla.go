@@ -1,12 +1,16 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/url"
 
+	"tds_server/internal/apierror"
 	"tds_server/internal/config"
+	"tds_server/internal/logging"
+	"tds_server/internal/upstream"
 
 	"github.com/go-resty/resty/v2"
 )
@@ -14,6 +18,8 @@ import (
 const defaultUserAgent = "Mozilla/5.0 (iPhone; CPU iPhone OS 15_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148"
 const teslaMobileUA = "TeslaApp/4.24.0-1505/ios/15.4"
 
+var authLog = logging.Logger(logging.SubsystemAuth)
+
 type TeslaTokenResponse struct {
 	AccessToken  string `json:"access_token"`
 	RefreshToken string `json:"refresh_token"`
@@ -37,14 +43,14 @@ func BuildAuthURL(cfg *config.Config, state string) string {
 	return fmt.Sprintf("%s?%s", cfg.TeslaAuthURL, values.Encode())
 }
 
-func ExchangeCode(cfg *config.Config, code string) (*TeslaTokenResponse, error) {
-	client := resty.New()
+func ExchangeCode(ctx context.Context, cfg *config.Config, code string) (*TeslaTokenResponse, error) {
+	client := upstream.NewClient()
 
 	client.SetContentLength(true)
 	client.SetHeader("User-Agent", defaultUserAgent)
 	client.SetHeader("x-tesla-user-agent", teslaMobileUA)
 	client.SetHeader("Referer", cfg.TeslaAuthURL)
-	resp, err := client.R().
+	resp, err := newTeslaRequest(ctx, client).
 		SetHeader("Content-Type", "application/x-www-form-urlencoded").
 		SetFormData(map[string]string{
 			"grant_type":    "authorization_code",
@@ -61,25 +67,25 @@ func ExchangeCode(cfg *config.Config, code string) (*TeslaTokenResponse, error)
 		return nil, err
 	}
 	if resp.StatusCode() != http.StatusOK {
-		return nil, fmt.Errorf("failed to exchange code: %d body: %s", resp.StatusCode(), string(resp.Body()))
+		return nil, fmt.Errorf("failed to exchange code: %w", apierror.FromUpstream(resp.StatusCode(), resp.Body()))
 	}
 
 	var tr TeslaTokenResponse
 	if err := json.Unmarshal(resp.Body(), &tr); err != nil {
 		return nil, err
 	}
-	fmt.Printf("Response: %+s\n", resp.Body())
+	authLog.DebugContext(ctx, "authorization code exchanged", "scope", tr.Scope, "expires_in", tr.ExpiresIn)
 	return &tr, nil
 }
 
-func RefreshToken(cfg *config.Config, refreshToken string) (*TeslaTokenResponse, error) {
-	client := resty.New()
+func RefreshToken(ctx context.Context, cfg *config.Config, refreshToken string) (*TeslaTokenResponse, error) {
+	client := upstream.NewClient()
 
 	client.SetContentLength(true)
 	client.SetHeader("User-Agent", defaultUserAgent)
 	client.SetHeader("x-tesla-user-agent", teslaMobileUA)
 	client.SetHeader("Referer", cfg.TeslaAuthURL)
-	resp, err := client.R().
+	resp, err := newTeslaRequest(ctx, client).
 		SetHeader("Content-Type", "application/x-www-form-urlencoded").
 		SetFormData(map[string]string{
 			"grant_type":    "refresh_token",
@@ -93,12 +99,27 @@ func RefreshToken(cfg *config.Config, refreshToken string) (*TeslaTokenResponse,
 		return nil, err
 	}
 	if resp.StatusCode() != http.StatusOK {
-		return nil, fmt.Errorf("failed to refresh token: %d body: %s", resp.StatusCode(), string(resp.Body()))
+		return nil, fmt.Errorf("failed to refresh token: %w", apierror.FromUpstream(resp.StatusCode(), resp.Body()))
 	}
 
 	var tr TeslaTokenResponse
 	if err := json.Unmarshal(resp.Body(), &tr); err != nil {
 		return nil, err
 	}
+	authLog.DebugContext(ctx, "access token refreshed", "expires_in", tr.ExpiresIn)
 	return &tr, nil
 }
+
+// newTeslaRequest binds the request to ctx and forwards the request ID so Tesla-side traces can be
+// correlated with ours. newTeslaRequest 会绑定上下文并透传请求 ID。
+func newTeslaRequest(ctx context.Context, client *resty.Client) *resty.Request {
+	req := client.R()
+	if ctx == nil {
+		return req
+	}
+	req.SetContext(ctx)
+	if id := logging.RequestIDFromContext(ctx); id != "" {
+		req.SetHeader(logging.RequestIDHeader, id)
+	}
+	return req
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/teslamotors/vehicle-command/pkg/connector/inet"
 	"github.com/teslamotors/vehicle-command/pkg/protocol"
 	"github.com/teslamotors/vehicle-command/pkg/proxy"
+	"github.com/teslamotors/vehicle-command/pkg/vehicle"
 )
 
 var (
@@ -45,6 +46,8 @@ type CommandResult struct {
 	Status      int
 	Body        []byte
 	ContentType string
+	// Verification is set when the caller asked to confirm the command's effect in vehicle_data.
+	Verification *CommandVerification
 }
 
 // CommandError wraps failures with HTTP semantics. CommandError 使用 HTTP 语义封装失败信息。
@@ -61,6 +64,26 @@ func (e *CommandError) Error() string {
 	return http.StatusText(e.Status)
 }
 
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+// Temporary reports whether the failure is transient, e.g. the vehicle is asleep or the session
+// timed out. Temporary 表示该失败是否为暂时性错误（如车辆休眠、会话超时）。
+func (e *CommandError) Temporary() bool {
+	switch e.Status {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return e.Err != nil && protocol.Temporary(e.Err)
+}
+
+// Unauthorized reports whether Tesla rejected the OAuth token, so a refreshed token may succeed.
+func (e *CommandError) Unauthorized() bool {
+	var httpErr *inet.HTTPError
+	return e.Status == http.StatusUnauthorized || (errors.As(e.Err, &httpErr) && httpErr.Code == http.StatusUnauthorized)
+}
+
 // NewVehicleCommandService constructs a VehicleCommandService. NewVehicleCommandService 构建一个新的 VehicleCommandService 实例。
 func NewVehicleCommandService(cfg *config.Config) (*VehicleCommandService, error) {
 	if cfg == nil {
@@ -98,9 +121,13 @@ func (s *VehicleCommandService) Execute(ctx context.Context, vin, command string
 		ctx = context.Background()
 	}
 
-	acct, err := account.New(oauthToken, commandUserAgent)
-	if err != nil {
-		return nil, &CommandError{Status: http.StatusForbidden, Err: err}
+	// The account is only needed to locate the Fleet API host from the token audience.
+	var acct *account.Account
+	if s.cfg.TeslaCommandURL == "" {
+		var err error
+		if acct, err = account.New(oauthToken, commandUserAgent); err != nil {
+			return nil, &CommandError{Status: http.StatusForbidden, Err: err}
+		}
 	}
 
 	params := proxy.RequestParameters{}
@@ -135,7 +162,8 @@ func (s *VehicleCommandService) Execute(ctx context.Context, vin, command string
 	unlock := s.lockVIN(vin)
 	defer unlock()
 
-	car, err := acct.GetVehicle(execCtx, vin, s.commandKey, s.sessions)
+	ReportCommandProgress(ctx, CommandStageConnecting, "")
+	car, err := s.vehicle(execCtx, acct, vin, oauthToken)
 	if err != nil {
 		return nil, &CommandError{Status: http.StatusInternalServerError, Err: err}
 	}
@@ -145,6 +173,7 @@ func (s *VehicleCommandService) Execute(ctx context.Context, vin, command string
 	}
 	defer car.Disconnect()
 
+	ReportCommandProgress(ctx, CommandStageSession, "")
 	if err := car.StartSession(execCtx, nil); err != nil {
 		if errors.Is(err, protocol.ErrProtocolNotSupported) {
 			return nil, ErrVehicleCommandUseREST
@@ -155,6 +184,7 @@ func (s *VehicleCommandService) Execute(ctx context.Context, vin, command string
 		_ = car.UpdateCachedSessions(s.sessions)
 	}()
 
+	ReportCommandProgress(ctx, CommandStageSent, "")
 	if err := action(car); err != nil {
 		if protocol.IsNominalError(err) {
 			return nominalResult(err.Error()), nil
@@ -168,6 +198,19 @@ func (s *VehicleCommandService) Execute(ctx context.Context, vin, command string
 	return successResult(), nil
 }
 
+// vehicle returns the SDK handle for vin, honouring the TESLA_COMMAND_URL override.
+func (s *VehicleCommandService) vehicle(ctx context.Context, acct *account.Account, vin, oauthToken string) (*vehicle.Vehicle, error) {
+	if s.cfg.TeslaCommandURL == "" {
+		return acct.GetVehicle(ctx, vin, s.commandKey, s.sessions)
+	}
+	conn := newFleetConnector(s.cfg.TeslaCommandURL, vin, oauthToken)
+	car, err := vehicle.NewVehicle(conn, s.commandKey, s.sessions)
+	if err != nil {
+		conn.Close()
+	}
+	return car, err
+}
+
 func (s *VehicleCommandService) lockVIN(vin string) func() {
 	mutexAny, _ := s.vinLocks.LoadOrStore(vin, &sync.Mutex{})
 	mutex := mutexAny.(*sync.Mutex)
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrVehicleNotFound indicates the vehicle tag does not match any vehicle of the user. ErrVehicleNotFound 表示车辆标识无法匹配到用户名下的车辆。
+	ErrVehicleNotFound = errors.New("vehicle not found")
+	// ErrVehicleAmbiguous indicates a display name matches more than one vehicle. ErrVehicleAmbiguous 表示展示名称匹配到多辆车。
+	ErrVehicleAmbiguous = errors.New("vehicle display name is ambiguous")
+	// ErrVehicleListIncomplete indicates the tag matched none of the vehicles fetched before the list was
+	// cut off, so the account may still own it. ErrVehicleListIncomplete 表示车辆列表被截断，无法判断该车辆是否属于用户。
+	ErrVehicleListIncomplete = errors.New("vehicle is not in the part of the vehicle list that could be fetched")
+)
+
+const (
+	defaultVehicleDirectoryTTL = 10 * time.Minute
+	// minVehicleRefreshInterval throttles refetches triggered by unknown tags.
+	minVehicleRefreshInterval = 30 * time.Second
+)
+
+// VehicleIdentity holds the identifiers Tesla uses for a single vehicle. VehicleIdentity 保存特斯拉用于标识车辆的各类 ID。
+type VehicleIdentity struct {
+	ID          int64
+	IDS         string
+	VIN         string
+	DisplayName string
+	// HidePrivate mirrors granular_access.hide_private of the grant.
+	HidePrivate bool
+}
+
+// VehicleLister fetches the complete vehicle list of the current user from Tesla. When the list had to
+// be cut off it returns the vehicles it got together with ErrVehicleListIncomplete.
+type VehicleLister func(ctx context.Context) ([]VehicleIdentity, error)
+
+// VehicleDirectory caches each user's vehicle list and resolves vehicle tags against it. The list doubles as
+// the set of vehicles the user is authorized to access. VehicleDirectory 按用户缓存车辆列表并据此解析 vehicle_tag，该列表同时作为用户有权访问的车辆集合。
+type VehicleDirectory struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[uuid.UUID]*vehicleDirectoryEntry
+}
+
+type vehicleDirectoryEntry struct {
+	refreshMu sync.Mutex
+	vehicles  []VehicleIdentity
+	fetchedAt time.Time
+	// incomplete marks a list cut off by the lister, which cannot prove a vehicle is not the user's.
+	incomplete bool
+}
+
+// NewVehicleDirectory creates a VehicleDirectory whose cached lists expire after ttl. NewVehicleDirectory 创建一个按 ttl 过期的车辆目录。
+func NewVehicleDirectory(ttl time.Duration) *VehicleDirectory {
+	if ttl <= 0 {
+		ttl = defaultVehicleDirectoryTTL
+	}
+	return &VehicleDirectory{
+		ttl:     ttl,
+		entries: map[uuid.UUID]*vehicleDirectoryEntry{},
+	}
+}
+
+// Store replaces the cached vehicle list of a user, typically after a complete ListVehicles call. Store 会替换用户的车辆缓存，通常在完整拉取车辆列表后调用。
+func (d *VehicleDirectory) Store(userID uuid.UUID, vehicles []VehicleIdentity) {
+	d.store(userID, vehicles, false)
+}
+
+func (d *VehicleDirectory) store(userID uuid.UUID, vehicles []VehicleIdentity, incomplete bool) {
+	entry := d.entry(userID)
+	copied := append([]VehicleIdentity(nil), vehicles...)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	entry.vehicles = copied
+	entry.fetchedAt = time.Now()
+	entry.incomplete = incomplete
+}
+
+// Invalidate drops the cached vehicle list of a user. Invalidate 会清除用户的车辆缓存。
+func (d *VehicleDirectory) Invalidate(userID uuid.UUID) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.entries, userID)
+}
+
+// Resolve maps a VIN, numeric id, id_s or unique display name to the vehicle identity. The cached
+// list is refreshed through list when it is stale or, at most every minVehicleRefreshInterval, when
+// the tag is unknown so newly added vehicles are picked up. A tag missing from a list the lister cut
+// off yields ErrVehicleListIncomplete rather than ErrVehicleNotFound.
+// Resolve 会把 VIN、数字 id、id_s 或唯一展示名称解析为车辆标识，缓存过期或未命中时通过 list 刷新。
+func (d *VehicleDirectory) Resolve(ctx context.Context, userID uuid.UUID, tag string, list VehicleLister) (*VehicleIdentity, error) {
+	tag = strings.TrimSpace(tag)
+	if tag == "" {
+		return nil, fmt.Errorf("vehicle tag is required")
+	}
+
+	entry := d.entry(userID)
+	vehicles, fetchedAt, incomplete := d.snapshot(entry)
+	age := time.Since(fetchedAt)
+	if !fetchedAt.IsZero() && age < d.ttl {
+		identity, err := matchVehicle(vehicles, tag, incomplete)
+		if err == nil || !isUnknownVehicle(err) || age < minVehicleRefreshInterval {
+			return identity, err
+		}
+	}
+
+	entry.refreshMu.Lock()
+	defer entry.refreshMu.Unlock()
+
+	// Another request may have refreshed the list while we waited for the lock.
+	if refreshedVehicles, refreshedAt, refreshedIncomplete := d.snapshot(entry); refreshedAt.After(fetchedAt) {
+		return matchVehicle(refreshedVehicles, tag, refreshedIncomplete)
+	}
+
+	if list == nil {
+		return nil, ErrVehicleNotFound
+	}
+	fetched, err := list(ctx)
+	incomplete = errors.Is(err, ErrVehicleListIncomplete)
+	if err != nil && !incomplete {
+		return nil, err
+	}
+	d.store(userID, fetched, incomplete)
+	return matchVehicle(fetched, tag, incomplete)
+}
+
+// Cached returns the identity matching tag from the cached list without calling Tesla, even when the
+// list is stale. Cached 仅从缓存中查找车辆，不会请求特斯拉。
+func (d *VehicleDirectory) Cached(userID uuid.UUID, tag string) (*VehicleIdentity, bool) {
+	vehicles, _, _ := d.snapshot(d.entry(userID))
+	identity, err := matchVehicle(vehicles, strings.TrimSpace(tag), false)
+	if err != nil {
+		return nil, false
+	}
+	return identity, true
+}
+
+func isUnknownVehicle(err error) bool {
+	return errors.Is(err, ErrVehicleNotFound) || errors.Is(err, ErrVehicleListIncomplete)
+}
+
+func (d *VehicleDirectory) entry(userID uuid.UUID) *vehicleDirectoryEntry {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	entry, ok := d.entries[userID]
+	if !ok {
+		entry = &vehicleDirectoryEntry{}
+		d.entries[userID] = entry
+	}
+	return entry
+}
+
+func (d *VehicleDirectory) snapshot(entry *vehicleDirectoryEntry) ([]VehicleIdentity, time.Time, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return entry.vehicles, entry.fetchedAt, entry.incomplete
+}
+
+// matchVehicle checks VIN first, then the numeric id, then the display name. A miss in an incomplete
+// list is reported as ErrVehicleListIncomplete.
+func matchVehicle(vehicles []VehicleIdentity, tag string, incomplete bool) (*VehicleIdentity, error) {
+	for _, vehicle := range vehicles {
+		if vehicle.VIN != "" && strings.EqualFold(vehicle.VIN, tag) {
+			return &vehicle, nil
+		}
+	}
+
+	if id, err := strconv.ParseInt(tag, 10, 64); err == nil {
+		for _, vehicle := range vehicles {
+			if vehicle.ID == id || vehicle.IDS == tag {
+				return &vehicle, nil
+			}
+		}
+	}
+
+	var match *VehicleIdentity
+	for _, vehicle := range vehicles {
+		if vehicle.DisplayName == "" || !strings.EqualFold(strings.TrimSpace(vehicle.DisplayName), tag) {
+			continue
+		}
+		if match != nil {
+			return nil, ErrVehicleAmbiguous
+		}
+		match = &vehicle
+	}
+	if match != nil {
+		return match, nil
+	}
+	if incomplete {
+		return nil, ErrVehicleListIncomplete
+	}
+	return nil, ErrVehicleNotFound
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestVehicleDirectoryResolve(t *testing.T) {
+	userID := uuid.New()
+	fleet := []VehicleIdentity{
+		{ID: 100021, IDS: "100021", VIN: "5YJ3E1EA7KF000001", DisplayName: "Daily"},
+		{ID: 100022, IDS: "100022", VIN: "5YJ3E1EA7KF000002", DisplayName: "Twin"},
+		{ID: 100023, IDS: "100023", VIN: "5YJ3E1EA7KF000003", DisplayName: "twin"},
+	}
+	calls := 0
+	lister := func(ctx context.Context) ([]VehicleIdentity, error) {
+		calls++
+		return fleet, nil
+	}
+
+	dir := NewVehicleDirectory(time.Minute)
+
+	cases := []struct {
+		tag     string
+		wantVIN string
+		wantErr error
+	}{
+		{"5yj3e1ea7kf000001", "5YJ3E1EA7KF000001", nil},
+		{"100022", "5YJ3E1EA7KF000002", nil},
+		{" daily ", "5YJ3E1EA7KF000001", nil},
+		{"TWIN", "", ErrVehicleAmbiguous},
+		{"unknown", "", ErrVehicleNotFound},
+	}
+	for _, tc := range cases {
+		identity, err := dir.Resolve(context.Background(), userID, tc.tag, lister)
+		if tc.wantErr != nil {
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("%q: expected %v, got %v", tc.tag, tc.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", tc.tag, err)
+		}
+		if identity.VIN != tc.wantVIN {
+			t.Fatalf("%q: unexpected vin %s", tc.tag, identity.VIN)
+		}
+	}
+
+	if calls != 1 {
+		t.Fatalf("expected a single upstream list call within the refresh interval, got %d", calls)
+	}
+}
+
+func TestVehicleDirectoryRefreshesStaleEntries(t *testing.T) {
+	userID := uuid.New()
+	dir := NewVehicleDirectory(time.Minute)
+	dir.Store(userID, []VehicleIdentity{{ID: 1, IDS: "1", VIN: "5YJ3E1EA7KF000001"}})
+
+	dir.mu.Lock()
+	dir.entries[userID].fetchedAt = time.Now().Add(-2 * time.Minute)
+	dir.mu.Unlock()
+
+	identity, err := dir.Resolve(context.Background(), userID, "2", func(ctx context.Context) ([]VehicleIdentity, error) {
+		return []VehicleIdentity{{ID: 2, IDS: "2", VIN: "5YJ3E1EA7KF000002"}}, nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if identity.VIN != "5YJ3E1EA7KF000002" {
+		t.Fatalf("unexpected vin %s", identity.VIN)
+	}
+}
+
+func TestVehicleDirectoryIncompleteList(t *testing.T) {
+	userID := uuid.New()
+	lister := func(ctx context.Context) ([]VehicleIdentity, error) {
+		return []VehicleIdentity{{ID: 1, IDS: "1", VIN: "5YJ3E1EA7KF000001"}}, ErrVehicleListIncomplete
+	}
+	dir := NewVehicleDirectory(time.Minute)
+
+	if identity, err := dir.Resolve(context.Background(), userID, "1", lister); err != nil || identity.VIN != "5YJ3E1EA7KF000001" {
+		t.Fatalf("fetched vehicle: %v, %v", identity, err)
+	}
+	if _, err := dir.Resolve(context.Background(), userID, "5YJ3E1EA7KF000999", lister); !errors.Is(err, ErrVehicleListIncomplete) {
+		t.Fatalf("expected ErrVehicleListIncomplete, got %v", err)
+	}
+
+	dir.Store(userID, []VehicleIdentity{{ID: 1, IDS: "1", VIN: "5YJ3E1EA7KF000001"}})
+	if _, err := dir.Resolve(context.Background(), userID, "5YJ3E1EA7KF000999", lister); !errors.Is(err, ErrVehicleNotFound) {
+		t.Fatalf("expected ErrVehicleNotFound after a complete list, got %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"tds_server/internal/model"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrVehicleGroupNameTaken is returned when the user already has another group with the same name.
+	ErrVehicleGroupNameTaken = errors.New("a vehicle group with this name already exists")
+	// ErrVehicleGroupNotFound is returned by Find when no group of the user matches.
+	ErrVehicleGroupNotFound = errors.New("vehicle group not found")
+)
+
+const maxVehicleGroupNameLength = 100
+
+// VehicleGroupStore persists vehicle groups; repository.VehicleGroupRepo implements it.
+type VehicleGroupStore interface {
+	List(userID uuid.UUID) ([]model.VehicleGroup, error)
+	Get(userID, id uuid.UUID) (*model.VehicleGroup, error)
+	Save(group *model.VehicleGroup) error
+	Delete(userID, id uuid.UUID) error
+}
+
+// VehicleGroupService stores the users' named vehicle groups. VehicleGroupService 管理用户的车辆分组。
+type VehicleGroupService struct {
+	store VehicleGroupStore
+}
+
+func NewVehicleGroupService(store VehicleGroupStore) *VehicleGroupService {
+	return &VehicleGroupService{store: store}
+}
+
+// List returns the user's groups ordered by name.
+func (s *VehicleGroupService) List(userID uuid.UUID) ([]model.VehicleGroup, error) {
+	return s.store.List(userID)
+}
+
+// Get returns the user's group, or an error satisfying repository.IsNotFound.
+func (s *VehicleGroupService) Get(userID, id uuid.UUID) (*model.VehicleGroup, error) {
+	return s.store.Get(userID, id)
+}
+
+// Delete removes the user's group, or returns an error satisfying repository.IsNotFound.
+func (s *VehicleGroupService) Delete(userID, id uuid.UUID) error {
+	return s.store.Delete(userID, id)
+}
+
+// Find returns the user's group whose id or name (case-insensitive) is ref, or ErrVehicleGroupNotFound.
+func (s *VehicleGroupService) Find(userID uuid.UUID, ref string) (*model.VehicleGroup, error) {
+	ref = strings.TrimSpace(ref)
+	groups, err := s.store.List(userID)
+	if err != nil {
+		return nil, fmt.Errorf("list vehicle groups: %w", err)
+	}
+	for i := range groups {
+		if groups[i].ID.String() == ref || strings.EqualFold(groups[i].Name, ref) {
+			return &groups[i], nil
+		}
+	}
+	return nil, ErrVehicleGroupNotFound
+}
+
+// Save validates and stores group, assigning an id to new groups. Members must already be resolved
+// to VINs. Invalid groups are reported as field errors; a name used by another of the user's groups
+// yields ErrVehicleGroupNameTaken.
+func (s *VehicleGroupService) Save(group *model.VehicleGroup) ([]FieldError, error) {
+	group.Name = strings.TrimSpace(group.Name)
+	if fieldErrors := ValidateVehicleGroup(group.Name, group.VINs); len(fieldErrors) > 0 {
+		return fieldErrors, nil
+	}
+	groups, err := s.store.List(group.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("list vehicle groups: %w", err)
+	}
+	for _, existing := range groups {
+		if existing.ID != group.ID && strings.EqualFold(existing.Name, group.Name) {
+			return nil, ErrVehicleGroupNameTaken
+		}
+	}
+	if group.ID == uuid.Nil {
+		group.ID = uuid.New()
+	}
+	if err := s.store.Save(group); err != nil {
+		return nil, fmt.Errorf("save vehicle group: %w", err)
+	}
+	return nil, nil
+}
+
+// ValidateVehicleGroup checks a group's name and members; a group may hold as many vehicles as one
+// batch may command. ValidateVehicleGroup 校验分组名称与车辆数量。
+func ValidateVehicleGroup(name string, vins []string) []FieldError {
+	var fieldErrors []FieldError
+	if name == "" || utf8.RuneCountInString(name) > maxVehicleGroupNameLength {
+		fieldErrors = append(fieldErrors, FieldError{Field: "name", Message: fmt.Sprintf("must be 1 to %d characters", maxVehicleGroupNameLength)})
+	}
+	if _, err := uuid.Parse(name); err == nil {
+		fieldErrors = append(fieldErrors, FieldError{Field: "name", Message: "must not be a UUID, which would be mistaken for a group id"})
+	}
+	if len(vins) == 0 || len(vins) > MaxCommandBatchSize {
+		fieldErrors = append(fieldErrors, FieldError{Field: "vehicles", Message: fmt.Sprintf("must contain 1 to %d vehicles", MaxCommandBatchSize)})
+	}
+	return fieldErrors
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"tds_server/internal/model"
+
+	"github.com/google/uuid"
+)
+
+// memoryVehicleGroupStore keeps groups in memory in place of repository.VehicleGroupRepo.
+type memoryVehicleGroupStore struct {
+	groups []model.VehicleGroup
+}
+
+func (s *memoryVehicleGroupStore) List(userID uuid.UUID) ([]model.VehicleGroup, error) {
+	var groups []model.VehicleGroup
+	for _, group := range s.groups {
+		if group.UserID == userID {
+			groups = append(groups, group)
+		}
+	}
+	return groups, nil
+}
+
+func (s *memoryVehicleGroupStore) Get(userID, id uuid.UUID) (*model.VehicleGroup, error) {
+	for i := range s.groups {
+		if s.groups[i].UserID == userID && s.groups[i].ID == id {
+			return &s.groups[i], nil
+		}
+	}
+	return nil, errors.New("record not found")
+}
+
+func (s *memoryVehicleGroupStore) Save(group *model.VehicleGroup) error {
+	for i := range s.groups {
+		if s.groups[i].ID == group.ID {
+			s.groups[i] = *group
+			return nil
+		}
+	}
+	s.groups = append(s.groups, *group)
+	return nil
+}
+
+func (s *memoryVehicleGroupStore) Delete(uuid.UUID, uuid.UUID) error {
+	return nil
+}
+
+func TestVehicleGroupService(t *testing.T) {
+	groups := NewVehicleGroupService(&memoryVehicleGroupStore{})
+	userID := uuid.New()
+
+	vans := &model.VehicleGroup{UserID: userID, Name: " Delivery vans ", VINs: []string{"5YJ3E1EA7KF000001", "5YJ3E1EA7KF000002"}}
+	if fieldErrors, err := groups.Save(vans); err != nil || len(fieldErrors) != 0 {
+		t.Fatalf("save: %v %v", fieldErrors, err)
+	}
+	if vans.ID == uuid.Nil || vans.Name != "Delivery vans" {
+		t.Fatalf("saved group: %+v", vans)
+	}
+	if _, err := groups.Save(&model.VehicleGroup{UserID: userID, Name: "delivery VANS", VINs: []string{"5YJ3E1EA7KF000003"}}); !errors.Is(err, ErrVehicleGroupNameTaken) {
+		t.Fatalf("duplicate name: %v", err)
+	}
+	if fieldErrors, _ := groups.Save(&model.VehicleGroup{UserID: userID, Name: uuid.NewString()}); len(fieldErrors) != 2 {
+		t.Fatalf("invalid group: %+v", fieldErrors)
+	}
+
+	for _, ref := range []string{"delivery vans", vans.ID.String()} {
+		if group, err := groups.Find(userID, ref); err != nil || group.ID != vans.ID {
+			t.Fatalf("find %q: %v %v", ref, group, err)
+		}
+	}
+	if _, err := groups.Find(uuid.New(), "delivery vans"); !errors.Is(err, ErrVehicleGroupNotFound) {
+		t.Fatalf("other users' groups must not match: %v", err)
+	}
+}
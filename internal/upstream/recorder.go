@@ -0,0 +1,265 @@
+package upstream
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"tds_server/internal/logging"
+)
+
+const serverRecording = "server"
+
+// recordedHeaders are the headers kept in recordings; everything else is noise for a fixture.
+var recordedHeaders = []string{"Authorization", "Content-Type", "Retry-After", "Location"}
+
+// recorder passes requests through to base and appends each redacted exchange to a JSON Lines file.
+type recorder struct {
+	base     http.RoundTripper
+	dir      string
+	secret   []byte
+	users    map[string]struct{}
+	vehicles []string
+
+	mu sync.Mutex
+}
+
+func newRecorder(base http.RoundTripper, opts Options) *recorder {
+	users := make(map[string]struct{}, len(opts.Users))
+	for _, user := range opts.Users {
+		users[user] = struct{}{}
+	}
+	return &recorder{base: base, dir: opts.Dir, secret: []byte(opts.Secret), users: users, vehicles: opts.Vehicles}
+}
+
+func (r *recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	userID := UserIDFromContext(req.Context())
+	if !r.shouldRecord(userID, req.URL.Path) {
+		return r.base.RoundTrip(req)
+	}
+
+	var requestBody []byte
+	if req.Body != nil {
+		var err error
+		if requestBody, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(requestBody))
+	}
+
+	started := time.Now()
+	resp, err := r.base.RoundTrip(req)
+	interaction := Interaction{
+		RecordedAt: started.UTC(),
+		RequestID:  logging.RequestIDFromContext(req.Context()),
+		UserID:     userID,
+		Request: RecordedRequest{
+			Method:  req.Method,
+			URL:     logging.RedactString(req.URL.String()),
+			Key:     requestKey(r.secret, req.Method, req.URL.String()),
+			Headers: recordHeaders(req.Header),
+		},
+	}
+	interaction.Request.Body, interaction.Request.Size = captureBody(req.Header.Get("Content-Type"), requestBody)
+	if err != nil {
+		interaction.DurationMS = time.Since(started).Milliseconds()
+		interaction.Error = logging.RedactString(err.Error())
+		r.write(interaction)
+		return nil, err
+	}
+
+	interaction.DurationMS = time.Since(started).Milliseconds()
+	interaction.Response = &RecordedResponse{
+		Status:  resp.StatusCode,
+		Headers: recordHeaders(resp.Header),
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if !capturable(contentType) {
+		// Binary bodies such as invoice PDFs are streamed through; only their size is recorded,
+		// once the caller has read them.
+		resp.Body = &sizedBody{ReadCloser: resp.Body, done: func(size int64, readErr error) {
+			interaction.Response.Size = size
+			if readErr != nil {
+				interaction.Error = logging.RedactString(readErr.Error())
+			}
+			r.write(interaction)
+		}}
+		return resp, nil
+	}
+
+	responseBody, readErr := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(responseBody))
+	interaction.Response.Body, interaction.Response.Size = captureBody(contentType, responseBody)
+	if readErr != nil {
+		interaction.Error = logging.RedactString(readErr.Error())
+	}
+	r.write(interaction)
+	return resp, readErr
+}
+
+// sizedBody passes a body through unbuffered and reports how many bytes were read when it is closed.
+type sizedBody struct {
+	io.ReadCloser
+	size int64
+	err  error
+	once sync.Once
+	done func(size int64, err error)
+}
+
+func (b *sizedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.size += int64(n)
+	if err != nil && err != io.EOF {
+		b.err = err
+	}
+	return n, err
+}
+
+func (b *sizedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() { b.done(b.size, b.err) })
+	return err
+}
+
+// shouldRecord applies the user and vehicle filters; with neither configured everything is recorded.
+func (r *recorder) shouldRecord(userID, path string) bool {
+	if len(r.users) == 0 && len(r.vehicles) == 0 {
+		return true
+	}
+	if _, ok := r.users[userID]; ok && userID != "" {
+		return true
+	}
+	for _, segment := range strings.Split(path, "/") {
+		for _, vehicle := range r.vehicles {
+			if segment == vehicle {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r *recorder) write(interaction Interaction) {
+	line, err := json.Marshal(interaction)
+	if err != nil {
+		log.Error("encode recording failed", "error", err)
+		return
+	}
+	name := serverRecording
+	if interaction.UserID != "" {
+		name = "user-" + sanitizeName(interaction.UserID)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := os.MkdirAll(r.dir, 0o700); err != nil {
+		log.Error("create recording directory failed", "dir", r.dir, "error", err)
+		return
+	}
+	file, err := os.OpenFile(filepath.Join(r.dir, name+".jsonl"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		log.Error("open recording failed", "error", err)
+		return
+	}
+	defer file.Close()
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		log.Error("write recording failed", "error", err)
+	}
+}
+
+func recordHeaders(header http.Header) map[string]string {
+	out := make(map[string]string)
+	for _, name := range recordedHeaders {
+		if value := header.Get(name); value != "" {
+			out[name] = logging.RedactString(value)
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// captureBody returns the redacted body when its content type is JSON, text or a form, and only its
+// size otherwise, so binary payloads never reach the recording.
+func captureBody(contentType string, body []byte) (string, int64) {
+	if len(body) == 0 {
+		return "", 0
+	}
+	if !capturable(contentType) {
+		return "", int64(len(body))
+	}
+	if mediaType(contentType) == "application/x-www-form-urlencoded" {
+		return logging.RedactString(string(body)), 0
+	}
+	return string(logging.RedactJSON(body)), 0
+}
+
+// capturable reports whether a body of this content type is recorded: JSON, text or form data.
+func capturable(contentType string) bool {
+	media := mediaType(contentType)
+	return media == "application/json" || strings.HasSuffix(media, "+json") ||
+		strings.HasPrefix(media, "text/") || media == "application/x-www-form-urlencoded"
+}
+
+func mediaType(contentType string) string {
+	media, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		media, _, _ = strings.Cut(contentType, ";")
+	}
+	return strings.ToLower(strings.TrimSpace(media))
+}
+
+func sanitizeName(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' {
+			return r
+		}
+		return '_'
+	}, value)
+}
+
+// requestKey identifies a request by an HMAC-SHA256 of its method and unredacted canonical URL under
+// the local recording secret, so replay tells apart requests whose redacted URLs are equal (e.g. two
+// VINs sharing prefix and suffix). A plain hash would let the masked middle of a VIN be brute-forced;
+// without the secret, which is never written to a recording, the key reveals nothing. Without a
+// secret no key is produced.
+func requestKey(secret []byte, method, rawURL string) string {
+	if len(secret) == 0 {
+		return ""
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(replayKey(method, rawURL)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// canonicalURL is the path plus sorted query of a URL, without scheme and host.
+func canonicalURL(rawURL string) string {
+	path, query, _ := strings.Cut(rawURL, "?")
+	if i := strings.Index(path, "://"); i >= 0 {
+		if slash := strings.Index(path[i+3:], "/"); slash >= 0 {
+			path = path[i+3+slash:]
+		} else {
+			path = "/"
+		}
+	}
+	if query == "" {
+		return path
+	}
+	params := strings.Split(query, "&")
+	sort.Strings(params)
+	return path + "?" + strings.Join(params, "&")
+}
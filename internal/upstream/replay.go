@@ -0,0 +1,136 @@
+package upstream
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+
+	"tds_server/internal/logging"
+)
+
+// Replayer serves recorded responses instead of calling Tesla. With the recording secret, requests are
+// matched on the keyed hash of their method and unredacted URL; otherwise, and for recordings without
+// a key, on the redacted URL. Repeated requests get the recorded responses in order and then the last
+// one again. Bodies that were not captured are replayed empty.
+// Replayer 按录制顺序回放响应，用于把问题现场变成可重复的测试数据。
+type Replayer struct {
+	secret  []byte
+	mu      sync.Mutex
+	entries map[string][]Interaction
+	served  map[string]int
+	total   int
+}
+
+// LoadReplay reads every *.jsonl file in dir. secret must be the one used while recording, or empty.
+func LoadReplay(dir, secret string) (*Replayer, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no recordings found in %s", dir)
+	}
+	sort.Strings(files)
+
+	replayer := &Replayer{secret: []byte(secret), entries: make(map[string][]Interaction), served: make(map[string]int)}
+	for _, name := range files {
+		if err := replayer.load(name); err != nil {
+			return nil, err
+		}
+	}
+	return replayer, nil
+}
+
+func (r *Replayer) load(name string) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var interaction Interaction
+		if err := json.Unmarshal(scanner.Bytes(), &interaction); err != nil {
+			return fmt.Errorf("%s:%d: %w", name, line, err)
+		}
+		key := replayKey(interaction.Request.Method, interaction.Request.URL)
+		if interaction.Request.Key != "" && len(r.secret) > 0 {
+			key = interaction.Request.Key
+		}
+		r.entries[key] = append(r.entries[key], interaction)
+		r.total++
+	}
+	return scanner.Err()
+}
+
+// Len is the number of loaded interactions.
+func (r *Replayer) Len() int {
+	return r.total
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	redactedKey := replayKey(req.Method, logging.RedactString(req.URL.String()))
+
+	r.mu.Lock()
+	key := requestKey(r.secret, req.Method, req.URL.String())
+	if _, ok := r.entries[key]; !ok || key == "" {
+		key = redactedKey
+	}
+	entries := r.entries[key]
+	index := r.served[key]
+	if index < len(entries) {
+		r.served[key] = index + 1
+	} else {
+		index = len(entries) - 1
+	}
+	r.mu.Unlock()
+
+	if index < 0 {
+		return nil, fmt.Errorf("replay: no recording for %s", redactedKey)
+	}
+	interaction := entries[index]
+	if interaction.Response == nil {
+		return nil, fmt.Errorf("replay: %s", interaction.Error)
+	}
+
+	recorded := interaction.Response
+	header := make(http.Header)
+	for name, value := range recorded.Headers {
+		header.Set(name, value)
+	}
+	if header.Get("Content-Type") == "" {
+		header.Set("Content-Type", "application/json")
+	}
+	return &http.Response{
+		Status:        strconv.Itoa(recorded.Status) + " " + http.StatusText(recorded.Status),
+		StatusCode:    recorded.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader([]byte(recorded.Body))),
+		ContentLength: int64(len(recorded.Body)),
+		Request:       req,
+	}, nil
+}
+
+func replayKey(method, rawURL string) string {
+	return method + " " + canonicalURL(rawURL)
+}
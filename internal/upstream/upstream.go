@@ -0,0 +1,148 @@
+// Package upstream builds the HTTP clients used to call Tesla and can record their traffic to files or
+// replay earlier recordings, so a customer issue can be reproduced and turned into a test fixture.
+// upstream 负责构建访问特斯拉的 HTTP 客户端，并支持录制与回放上游流量，便于复现问题。
+package upstream
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"tds_server/internal/logging"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// Modes accepted by Setup.
+const (
+	ModeOff    = "off"
+	ModeRecord = "record"
+	ModeReplay = "replay"
+)
+
+var log = logging.Logger(logging.SubsystemTesla)
+
+// Options controls Setup.
+type Options struct {
+	// Mode is off (default), record or replay.
+	Mode string
+	// Dir holds the recordings: one JSON Lines file per user plus server.jsonl for calls made
+	// outside a user request, such as partner tokens.
+	Dir string
+	// Users limits recording to these user IDs. Together with Vehicles empty, everything is recorded.
+	Users []string
+	// Vehicles limits recording to requests whose path names one of these VINs or vehicle ids.
+	Vehicles []string
+	// Secret keys the request hashes replay matches on and must be the same when recording and
+	// replaying. It is never written to recordings. Without it, replay matches on the redacted URL.
+	Secret string
+	// Base is the transport used for real requests; defaults to http.DefaultTransport.
+	Base http.RoundTripper
+}
+
+var current atomic.Pointer[http.RoundTripper]
+
+// Setup installs the transport used by every client from NewClient, including clients created
+// before Setup. Setup 会切换所有上游客户端的传输层（直连、录制或回放）。
+func Setup(opts Options) error {
+	base := opts.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	var transport http.RoundTripper
+	switch strings.ToLower(strings.TrimSpace(opts.Mode)) {
+	case "", ModeOff:
+		transport = base
+	case ModeRecord:
+		if opts.Dir == "" {
+			return fmt.Errorf("recording requires a directory")
+		}
+		transport = newRecorder(base, opts)
+		log.Warn("recording tesla traffic", "dir", opts.Dir, "users", len(opts.Users), "vehicles", len(opts.Vehicles))
+	case ModeReplay:
+		replayer, err := LoadReplay(opts.Dir, opts.Secret)
+		if err != nil {
+			return err
+		}
+		transport = replayer
+		log.Warn("replaying recorded tesla traffic", "dir", opts.Dir, "interactions", replayer.Len())
+	default:
+		return fmt.Errorf("unknown upstream mode %q", opts.Mode)
+	}
+	current.Store(&transport)
+	return nil
+}
+
+// Transport returns a RoundTripper that delegates to whatever Setup installed last.
+func Transport() http.RoundTripper {
+	return dynamicTransport{}
+}
+
+// NewClient returns a resty client wired to Transport. All Tesla calls should use it instead of
+// resty.New so recording and replay cover them.
+func NewClient() *resty.Client {
+	return resty.New().SetTransport(Transport())
+}
+
+type dynamicTransport struct{}
+
+func (dynamicTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if transport := current.Load(); transport != nil {
+		return (*transport).RoundTrip(req)
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+type userIDKey struct{}
+
+// WithUserID tags ctx with the user an upstream call is made for, used to scope recordings.
+func WithUserID(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, userIDKey{}, userID)
+}
+
+// UserIDFromContext returns the user set by WithUserID.
+func UserIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(userIDKey{}).(string)
+	return id
+}
+
+// Interaction is one recorded request/response pair. Tokens, VINs and coordinates are redacted
+// before it is written.
+type Interaction struct {
+	RecordedAt time.Time         `json:"recorded_at"`
+	RequestID  string            `json:"request_id,omitempty"`
+	UserID     string            `json:"user_id,omitempty"`
+	DurationMS int64             `json:"duration_ms"`
+	Request    RecordedRequest   `json:"request"`
+	Response   *RecordedResponse `json:"response,omitempty"`
+	// Error is set instead of Response when the request failed at the transport level.
+	Error string `json:"error,omitempty"`
+}
+
+// RecordedRequest is the redacted upstream request.
+type RecordedRequest struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	// Key is the keyed hash replay matches on; see requestKey.
+	Key     string            `json:"key,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+	// Size is the length of a body that was not captured because it is neither JSON, text nor a form.
+	Size int64 `json:"size,omitempty"`
+}
+
+// RecordedResponse is the redacted upstream response.
+type RecordedResponse struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+	// Size is the length of a body that was streamed through without being captured, e.g. a PDF.
+	Size int64 `json:"size,omitempty"`
+}
@@ -0,0 +1,174 @@
+package upstream
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecordThenReplay(t *testing.T) {
+	// The two VINs redact to the same 5YJ**********3456.
+	const vin, otherVIN = "5YJ3E1EA7KF123456", "5YJ3E1EB0LF993456"
+	upstreamCalls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamCalls++
+		id := "1492931365271386"
+		if strings.Contains(r.URL.Path, otherVIN) {
+			id = "1492931365271387"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"response":{"id":` + id + `,"vin":"` + vin + `","access_token":"secret-token","drive_state":{"latitude":31.2,"speed":null}}}`))
+	}))
+	defer Setup(Options{})
+
+	dir := t.TempDir()
+	const secret = "local-recording-secret"
+	if err := Setup(Options{Mode: ModeRecord, Dir: dir, Users: []string{"user-1"}, Secret: secret}); err != nil {
+		t.Fatal(err)
+	}
+	get := func(userID, vin string) (int, string, error) {
+		resp, err := NewClient().R().
+			SetContext(WithUserID(context.Background(), userID)).
+			SetHeader("Authorization", "Bearer secret-token").
+			SetQueryParam("endpoints", "drive_state").
+			Get(ts.URL + "/api/1/vehicles/" + vin + "/vehicle_data")
+		if err != nil {
+			return 0, "", err
+		}
+		return resp.StatusCode(), string(resp.Body()), nil
+	}
+
+	_, original, err := get("user-1", vin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := get("user-1", otherVIN); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := get("user-2", vin); err != nil {
+		t.Fatal(err)
+	}
+	ts.Close()
+
+	recording, err := os.ReadFile(filepath.Join(dir, "user-user-1.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, leak := range []string{"secret-token", vin, otherVIN, secret} {
+		if strings.Contains(string(recording), leak) {
+			t.Fatalf("recording leaks %q: %s", leak, recording)
+		}
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(recording)), "\n") {
+		var interaction Interaction
+		var body struct {
+			Response struct {
+				DriveState map[string]any `json:"drive_state"`
+			} `json:"response"`
+		}
+		if err := json.Unmarshal([]byte(line), &interaction); err != nil || interaction.Response == nil {
+			t.Fatalf("decode recording: %v: %s", err, line)
+		}
+		// An unkeyed hash of the URL would let the masked VIN digits be brute-forced.
+		if sum := sha256.Sum256([]byte(replayKey(interaction.Request.Method, ts.URL+"/api/1/vehicles/"+vin+"/vehicle_data?endpoints=drive_state"))); interaction.Request.Key == hex.EncodeToString(sum[:]) {
+			t.Fatalf("request key is a plain hash of the URL")
+		}
+		if err := json.Unmarshal([]byte(interaction.Response.Body), &body); err != nil {
+			t.Fatalf("decode recorded body: %v", err)
+		}
+		if latitude := body.Response.DriveState["latitude"]; latitude != nil {
+			t.Fatalf("recording leaks latitude %v", latitude)
+		}
+	}
+	if !strings.Contains(string(recording), "1492931365271386") {
+		t.Fatalf("vehicle id lost: %s", recording)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.jsonl")); len(files) != 1 {
+		t.Fatalf("unfiltered user was recorded: %v", files)
+	}
+
+	if err := Setup(Options{Mode: ModeReplay, Dir: dir, Secret: secret}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		status, body, err := get("anyone", vin)
+		if err != nil || status != http.StatusOK {
+			t.Fatalf("replay %d: status %d err %v", i, status, err)
+		}
+		if !strings.Contains(body, `"id":1492931365271386`) || strings.Contains(original, "[REDACTED]") {
+			t.Fatalf("unexpected replay body %s", body)
+		}
+	}
+	if _, body, err := get("anyone", otherVIN); err != nil || !strings.Contains(body, `"id":1492931365271387`) {
+		t.Fatalf("replay of the other vehicle: %s, %v", body, err)
+	}
+	if upstreamCalls != 3 {
+		t.Fatalf("replay reached the upstream server: %d calls", upstreamCalls)
+	}
+
+	if _, err := NewClient().R().Get(ts.URL + "/api/1/products"); err == nil || !strings.Contains(err.Error(), "no recording") {
+		t.Fatalf("unmatched request error = %v", err)
+	}
+}
+
+func TestRecorderStreamsBinaryBodies(t *testing.T) {
+	const invoice = "%PDF-1.7 Jane Doe, 1 Example Road, 5YJ3E1EA7KF123456"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Write([]byte(invoice))
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	client := &http.Client{Transport: newRecorder(http.DefaultTransport, Options{Dir: dir})}
+	resp, err := client.Get(ts.URL + "/api/1/dx/charging/invoice/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := resp.Body.(*sizedBody); !ok {
+		t.Fatalf("binary body was buffered: %T", resp.Body)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != invoice {
+		t.Fatalf("streamed body = %q", body)
+	}
+
+	recording, err := os.ReadFile(filepath.Join(dir, serverRecording+".jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var interaction Interaction
+	if err := json.Unmarshal(recording, &interaction); err != nil {
+		t.Fatal(err)
+	}
+	if interaction.Response.Body != "" || interaction.Response.Size != int64(len(invoice)) || strings.Contains(string(recording), "Jane Doe") {
+		t.Fatalf("binary body must be recorded by size only: %s", recording)
+	}
+	if interaction.Request.Key != "" {
+		t.Fatalf("key written without a secret: %s", recording)
+	}
+}
+
+func TestRecorderMatchesWholeVehicleSegments(t *testing.T) {
+	r := newRecorder(nil, Options{Vehicles: []string{"1492931365271386", "5YJ3E1EA7KF123456"}})
+	for path, want := range map[string]bool{
+		"/api/1/vehicles/1492931365271386/vehicle_data":  true,
+		"/api/1/vehicles/5YJ3E1EA7KF123456/command/honk": true,
+		"/api/1/vehicles/14929313652713861/vehicle_data": false,
+		"/api/1/vehicles/5YJ3E1EA7KF1234567":             false,
+		"/api/1/products":                                false,
+	} {
+		if got := r.shouldRecord("", path); got != want {
+			t.Errorf("shouldRecord(%q) = %v, want %v", path, got, want)
+		}
+	}
+}